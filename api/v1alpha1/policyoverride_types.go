@@ -0,0 +1,63 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package v1alpha1
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+)
+
+// PolicyOverrideSpec is the local change to a policy replicated from the hub.
+type PolicyOverrideSpec struct {
+	// RemediationAction overrides the remediation action of the policy, which also overrides the remediation action
+	// of its templates.
+	// +kubebuilder:validation:Enum=Inform;inform;Enforce;enforce
+	// +optional
+	RemediationAction policiesv1.RemediationAction `json:"remediationAction,omitempty"`
+
+	// DisabledTemplates are the names of the policy templates that aren't synced to the cluster while the override is
+	// active. Their objects are removed from the cluster and their compliance is ignored.
+	// +optional
+	DisabledTemplates []string `json:"disabledTemplates,omitempty"`
+
+	// ExpiresAt is when the override stops being applied and the policy from the hub is restored. The override is
+	// applied until it's deleted when this isn't set.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=policyoverrides,scope=Namespaced
+// +kubebuilder:printcolumn:name="Remediation action",type="string",JSONPath=".spec.remediationAction"
+// +kubebuilder:printcolumn:name="Expires at",type="string",JSONPath=".spec.expiresAt"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// PolicyOverride is a local change on the managed cluster to the replicated policy with the same name and namespace,
+// such as to temporarily inform on a policy during an incident. The change is applied on top of the policy from the
+// hub, and the hub is told about it in the policy status.
+type PolicyOverride struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec PolicyOverrideSpec `json:"spec,omitempty"`
+}
+
+// Expired returns whether the override expired by the given time.
+func (o *PolicyOverride) Expired(now time.Time) bool {
+	return o.Spec.ExpiresAt != nil && !now.Before(o.Spec.ExpiresAt.Time)
+}
+
+// +kubebuilder:object:root=true
+
+// PolicyOverrideList contains a list of PolicyOverride.
+type PolicyOverrideList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PolicyOverride `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PolicyOverride{}, &PolicyOverrideList{})
+}
@@ -69,9 +69,10 @@ var _ reconcile.Reconciler = &GatekeeperConstraintReconciler{}
 
 // Used to track sent messages for a particular Gatekeeper constraint.
 type policyKindName struct {
-	Policy string
-	Kind   string
-	Name   string
+	Namespace string
+	Policy    string
+	Kind      string
+	Name      string
 }
 
 // GatekeeperConstraintReconciler is responsible for relaying Gatekeeper constraint audit results as policy status
@@ -125,7 +126,7 @@ func (r *GatekeeperConstraintReconciler) Reconcile(
 
 			r.lastSentMessages.Range(func(key, _ any) bool {
 				keyTyped := key.(policyKindName)
-				if keyTyped.Policy == request.Name {
+				if keyTyped.Namespace == request.Namespace && keyTyped.Policy == request.Name {
 					r.lastSentMessages.Delete(keyTyped)
 				}
 
@@ -187,7 +188,7 @@ func (r *GatekeeperConstraintReconciler) Reconcile(
 
 		constraintName := templateUnstructured.GetName()
 
-		pkn := policyKindName{Policy: policy.Name, Kind: templateGVK.Kind, Name: constraintName}
+		pkn := policyKindName{Namespace: policy.Namespace, Policy: policy.Name, Kind: templateGVK.Kind, Name: constraintName}
 		constraintsSet[pkn] = true
 
 		// https://github.com/open-policy-agent/frameworks/blob/v0.9.0/constraint/pkg/client/crds/crds.go#L34
@@ -312,7 +313,7 @@ func (r *GatekeeperConstraintReconciler) Reconcile(
 	// Clear the status message cache for any removed constraints in the policy since the last reconcile
 	r.lastSentMessages.Range(func(key, _ any) bool {
 		keyTyped := key.(policyKindName)
-		if keyTyped.Policy == policy.Name && !constraintsSet[keyTyped] {
+		if keyTyped.Namespace == policy.Namespace && keyTyped.Policy == policy.Name && !constraintsSet[keyTyped] {
 			r.lastSentMessages.Delete(keyTyped)
 		}
 
@@ -373,7 +374,7 @@ func (r *GatekeeperConstraintReconciler) sendComplianceEvent(
 		Name:       refreshedPolicy.Name,
 		UID:        refreshedPolicy.UID,
 	}
-	kn := policyKindName{Policy: policy.Name, Kind: constraint.GetKind(), Name: constraint.GetName()}
+	kn := policyKindName{Namespace: policy.Namespace, Policy: policy.Name, Kind: constraint.GetKind(), Name: constraint.GetName()}
 
 	if len(refreshedPolicy.Status.Details) < templateIndex+1 ||
 		len(refreshedPolicy.Status.Details[templateIndex].History) == 0 ||
@@ -387,7 +388,11 @@ func (r *GatekeeperConstraintReconciler) sendComplianceEvent(
 
 		reason := utils.EventReason(constraint.GetNamespace(), constraint.GetName())
 
-		err := r.SendEvent(ctx, constraint, owner, reason, msg, compliance)
+		// The policies from each hub are replicated to their own namespace, so send the event to the policy namespace
+		sender := r.ComplianceEventSender
+		sender.ClusterNamespace = refreshedPolicy.Namespace
+
+		err := sender.SendEvent(ctx, constraint, owner, reason, msg, compliance)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,526 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package kyvernosync
+
+import (
+	"context"
+	// #nosec G505
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	depclient "github.com/stolostron/kubernetes-dependency-watches/client"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	policyv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"open-cluster-management.io/governance-policy-framework-addon/controllers/uninstall"
+	"open-cluster-management.io/governance-policy-framework-addon/controllers/utils"
+)
+
+const (
+	ControllerName = "kyverno-policy-status-sync"
+	// KyvernoGroup is the API group of the Kyverno ClusterPolicy and Policy kinds.
+	KyvernoGroup = "kyverno.io"
+	// ClusterPolicyCRDName is the name of the CRD whose presence indicates that Kyverno is installed.
+	ClusterPolicyCRDName = "clusterpolicies." + KyvernoGroup
+)
+
+var (
+	policyReportGVK = schema.GroupVersionKind{
+		Group:   "wgpolicyk8s.io",
+		Version: "v1alpha2",
+		Kind:    "PolicyReport",
+	}
+	clusterPolicyReportGVK = schema.GroupVersionKind{
+		Group:   "wgpolicyk8s.io",
+		Version: "v1alpha2",
+		Kind:    "ClusterPolicyReport",
+	}
+	// The label Kyverno sets on all the reports it generates
+	kyvernoReportSelector = labels.SelectorFromSet(labels.Set{"app.kubernetes.io/managed-by": "kyverno"})
+)
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *KyvernoPolicyReconciler) SetupWithManager(mgr ctrl.Manager, reportEvents source.Source) error {
+	skipNameValidation := true // we need to be able to stop and restart this controller
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&policyv1.Policy{}).
+		WithEventFilter(policyPredicates()).
+		WithOptions(controller.Options{
+			SkipNameValidation:      &skipNameValidation,
+			MaxConcurrentReconciles: r.ConcurrentReconciles,
+		}).
+		WatchesRawSource(reportEvents).
+		Named(ControllerName).
+		WithLogConstructor(func(req *reconcile.Request) logr.Logger {
+			return utils.LogConstructor(ControllerName, "Policy", req)
+		}).
+		Complete(r)
+}
+
+// blank assignment to verify that KyvernoPolicyReconciler implements reconcile.Reconciler
+var _ reconcile.Reconciler = &KyvernoPolicyReconciler{}
+
+// Used to track sent messages for a particular Kyverno policy.
+type policyKindName struct {
+	Namespace string
+	Policy    string
+	Kind      string
+	Name      string
+}
+
+// KyvernoPolicyReconciler is responsible for relaying the Kyverno policy report results as policy status events.
+type KyvernoPolicyReconciler struct {
+	client.Client
+	utils.ComplianceEventSender
+	Scheme         *runtime.Scheme
+	ReportsWatcher depclient.DynamicWatcher
+	// A cache of sent messages to avoid repeating status events due to race conditions. Each value is a SHA1
+	// digest.
+	lastSentMessages     sync.Map
+	ConcurrentReconciles int
+}
+
+//+kubebuilder:rbac:groups=policy.open-cluster-management.io,resources=policies,verbs=get;list;watch
+//+kubebuilder:rbac:groups=kyverno.io,resources=clusterpolicies;policies,verbs=get;list;watch
+//+kubebuilder:rbac:groups=wgpolicyk8s.io,resources=policyreports;clusterpolicyreports,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core;events.k8s.io,resources=events,verbs=create;delete;get;list;patch;update;watch
+
+// Reconcile handles Policy objects that contain a Kyverno ClusterPolicy or Policy and relays the results in the
+// policy reports generated by Kyverno. Every time a Kyverno policy in a Policy or one of its reports is updated, a
+// reconcile on the Policy is triggered.
+func (r *KyvernoPolicyReconciler) Reconcile(
+	ctx context.Context, request reconcile.Request,
+) (
+	reconcile.Result, error,
+) {
+	log := ctrl.LoggerFrom(ctx)
+
+	if uninstall.DeploymentIsUninstalling {
+		log.Info("Skipping reconcile because the deployment is in uninstallation mode")
+
+		return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+
+	log.V(1).Info("Reconciling a Policy with one or more Kyverno policies")
+
+	policyObjID := depclient.ObjectIdentifier{
+		Group:     policyv1.GroupVersion.Group,
+		Version:   policyv1.GroupVersion.Version,
+		Kind:      "Policy",
+		Namespace: request.Namespace,
+		Name:      request.Name,
+	}
+	policy := &policyv1.Policy{}
+
+	err := r.Get(ctx, request.NamespacedName, policy)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			log.Info("The Policy was deleted. Cleaning up watchers and status message cache.")
+
+			r.lastSentMessages.Range(func(key, _ any) bool {
+				keyTyped := key.(policyKindName)
+				if keyTyped.Namespace == request.Namespace && keyTyped.Policy == request.Name {
+					r.lastSentMessages.Delete(keyTyped)
+				}
+
+				return true
+			})
+
+			err := r.ReportsWatcher.RemoveWatcher(policyObjID)
+			if errors.Is(err, depclient.ErrInvalidInput) {
+				log.Error(err, "Could not construct a valid object identifier for the policy. Will not retry.")
+
+				return reconcile.Result{}, nil
+			}
+
+			return reconcile.Result{}, err
+		}
+
+		log.Error(err, "Failed to get the Policy from the cache. Will retry the reconcile request.")
+
+		return reconcile.Result{}, err
+	}
+
+	// Start query batch for caching and watching related objects
+	err = r.ReportsWatcher.StartQueryBatch(policyObjID)
+	if err != nil {
+		log.Error(err, "Could not start query batch for the watcher", "objectID", policyObjID)
+
+		return reconcile.Result{}, err
+	}
+
+	defer func() {
+		err := r.ReportsWatcher.EndQueryBatch(policyObjID)
+		if err != nil {
+			log.Error(err, "Could not end query batch for the watcher", "objectID", policyObjID)
+		}
+	}()
+
+	kyvernoPoliciesSet := map[policyKindName]bool{}
+
+	for templateIndex, template := range policy.Spec.PolicyTemplates {
+		templateMap := map[string]any{}
+
+		err := json.Unmarshal(template.ObjectDefinition.Raw, &templateMap)
+		if err != nil {
+			log.Error(
+				err,
+				"The policy template is invalid. Skipping this policy template.",
+				"policyTemplateIndex", strconv.Itoa(templateIndex),
+			)
+
+			continue
+		}
+
+		templateUnstructured := unstructured.Unstructured{Object: templateMap}
+		templateGVK := templateUnstructured.GroupVersionKind()
+
+		if !isKyvernoPolicy(templateGVK.GroupKind()) {
+			continue
+		}
+
+		kyvernoPolicyName := templateUnstructured.GetName()
+
+		// Namespaced policy templates are always created in the policy's namespace
+		kyvernoPolicyNs := ""
+		if templateGVK.Kind == "Policy" {
+			kyvernoPolicyNs = policy.Namespace
+		}
+
+		pkn := policyKindName{Namespace: policy.Namespace, Policy: policy.Name, Kind: templateGVK.Kind, Name: kyvernoPolicyName}
+		kyvernoPoliciesSet[pkn] = true
+
+		kyvernoPolicy, err := r.ReportsWatcher.Get(policyObjID, templateGVK, kyvernoPolicyNs, kyvernoPolicyName)
+		if err != nil {
+			log.Error(
+				err, "Failed to get the Kyverno policy. Will retry the reconcile request.", "name", kyvernoPolicyName,
+			)
+
+			return reconcile.Result{}, err
+		}
+
+		if kyvernoPolicy == nil {
+			log.Info(
+				"The Kyverno policy does not exist on the cluster yet. Will retry the reconcile request once it's "+
+					"created.",
+				"name", kyvernoPolicyName,
+			)
+
+			continue
+		}
+
+		if _, processed := kyvernoPolicy.Object["status"]; !processed {
+			log.V(1).Info("The Kyverno policy hasn't been processed by Kyverno yet. Skipping status update.")
+
+			continue
+		}
+
+		if ready, reason := policyReady(kyvernoPolicy); !ready {
+			err := r.sendComplianceEvent(
+				ctx, policy, kyvernoPolicy, templateIndex,
+				"The Kyverno policy is not ready: "+reason, policyv1.NonCompliant,
+			)
+			if err != nil {
+				log.Error(err, "Failed to send the compliance event")
+
+				return reconcile.Result{}, err
+			}
+
+			continue
+		}
+
+		reports, err := r.listReports(policyObjID, kyvernoPolicy)
+		if err != nil {
+			log.Error(err, "Failed to list the Kyverno policy reports. Will retry the reconcile request.")
+
+			return reconcile.Result{}, err
+		}
+
+		violations := reportViolations(kyvernoPolicy, reports)
+
+		if len(violations) == 0 {
+			err := r.sendComplianceEvent(
+				ctx, policy, kyvernoPolicy, templateIndex, "The Kyverno policy has no violations", policyv1.Compliant,
+			)
+			if err != nil {
+				log.Error(err, "Failed to send the compliance event")
+
+				return reconcile.Result{}, err
+			}
+
+			continue
+		}
+
+		err = r.sendComplianceEvent(
+			ctx, policy, kyvernoPolicy, templateIndex, strings.Join(violations, "; "), policyv1.NonCompliant,
+		)
+		if err != nil {
+			log.Error(err, "Failed to send the compliance event")
+
+			return reconcile.Result{}, err
+		}
+	}
+
+	// Clear the status message cache for any removed Kyverno policies in the policy since the last reconcile
+	r.lastSentMessages.Range(func(key, _ any) bool {
+		keyTyped := key.(policyKindName)
+		if keyTyped.Namespace == policy.Namespace && keyTyped.Policy == policy.Name && !kyvernoPoliciesSet[keyTyped] {
+			r.lastSentMessages.Delete(keyTyped)
+		}
+
+		return true
+	})
+
+	return reconcile.Result{}, nil
+}
+
+// listReports returns the policy reports that may contain results for the Kyverno policy. Kyverno labels each report
+// with the policies it has results for, so that label is used to narrow the watch when it's a valid label key.
+// Otherwise, all reports generated by Kyverno are returned and the results must be filtered by the caller.
+func (r *KyvernoPolicyReconciler) listReports(
+	policyObjID depclient.ObjectIdentifier, kyvernoPolicy *unstructured.Unstructured,
+) ([]unstructured.Unstructured, error) {
+	labelPrefix := "cpol.kyverno.io/"
+	if kyvernoPolicy.GetKind() == "Policy" {
+		labelPrefix = "pol.kyverno.io/"
+	}
+
+	selector := kyvernoReportSelector
+
+	requirement, err := labels.NewRequirement(labelPrefix+kyvernoPolicy.GetName(), selection.Exists, nil)
+	if err == nil {
+		selector = labels.NewSelector().Add(*requirement)
+	}
+
+	// A namespaced Kyverno policy only applies to objects in its namespace
+	reports, err := r.ReportsWatcher.List(policyObjID, policyReportGVK, kyvernoPolicy.GetNamespace(), selector)
+	if err != nil {
+		return nil, err
+	}
+
+	if kyvernoPolicy.GetKind() == "Policy" {
+		return reports, nil
+	}
+
+	clusterReports, err := r.ReportsWatcher.List(policyObjID, clusterPolicyReportGVK, "", selector)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(reports, clusterReports...), nil
+}
+
+// reportViolations returns a sorted list of messages for the failed and errored results for the Kyverno policy in the
+// input reports.
+func reportViolations(kyvernoPolicy *unstructured.Unstructured, reports []unstructured.Unstructured) []string {
+	// Kyverno refers to namespaced policies as namespace/name in the results
+	policyRef := kyvernoPolicy.GetName()
+	if kyvernoPolicy.GetNamespace() != "" {
+		policyRef = kyvernoPolicy.GetNamespace() + "/" + policyRef
+	}
+
+	violations := []string{}
+
+	for _, report := range reports {
+		results, _, _ := unstructured.NestedSlice(report.Object, "results")
+		// Kyverno v1.10+ generates a report per resource with the resource in the scope field
+		scope, _, _ := unstructured.NestedMap(report.Object, "scope")
+
+		for _, result := range results {
+			result, ok := result.(map[string]any)
+			if !ok {
+				continue
+			}
+
+			if ref, _ := result["policy"].(string); ref != policyRef && ref != kyvernoPolicy.GetName() {
+				continue
+			}
+
+			status, _ := result["result"].(string)
+			if status != "fail" && status != "error" {
+				continue
+			}
+
+			resources := []map[string]any{}
+
+			if resultResources, ok := result["resources"].([]any); ok {
+				for _, resource := range resultResources {
+					if resource, ok := resource.(map[string]any); ok {
+						resources = append(resources, resource)
+					}
+				}
+			}
+
+			if len(resources) == 0 && scope != nil {
+				resources = append(resources, scope)
+			}
+
+			for _, resource := range resources {
+				violations = append(violations, fmt.Sprintf(
+					"%s - %s: %s (on %s %s)", status, result["rule"], result["message"], resource["kind"],
+					resourceName(resource),
+				))
+			}
+
+			if len(resources) == 0 {
+				violations = append(violations, fmt.Sprintf("%s - %s: %s", status, result["rule"], result["message"]))
+			}
+		}
+	}
+
+	slices.Sort(violations)
+
+	return slices.Compact(violations)
+}
+
+func resourceName(resource map[string]any) string {
+	name, _ := resource["name"].(string)
+
+	if ns, _ := resource["namespace"].(string); ns != "" {
+		return ns + "/" + name
+	}
+
+	return name
+}
+
+// policyReady returns whether Kyverno has loaded the policy and if not, the reason why not.
+func policyReady(kyvernoPolicy *unstructured.Unstructured) (bool, string) {
+	conditions, found, _ := unstructured.NestedSlice(kyvernoPolicy.Object, "status", "conditions")
+	if !found {
+		// Older versions of Kyverno only set status.ready
+		ready, _, _ := unstructured.NestedBool(kyvernoPolicy.Object, "status", "ready")
+
+		return ready, "the policy status is not ready"
+	}
+
+	for _, condition := range conditions {
+		condition, ok := condition.(map[string]any)
+		if !ok || condition["type"] != "Ready" {
+			continue
+		}
+
+		if condition["status"] == string(metav1.ConditionTrue) {
+			return true, ""
+		}
+
+		message, _ := condition["message"].(string)
+
+		return false, message
+	}
+
+	return true, ""
+}
+
+// sendComplianceEvent wraps SendComplianceEvent and only sends an event if it isn't already set in the policy.
+func (r *KyvernoPolicyReconciler) sendComplianceEvent(
+	ctx context.Context,
+	policy *policyv1.Policy,
+	kyvernoPolicy *unstructured.Unstructured,
+	templateIndex int,
+	msg string,
+	compliance policyv1.ComplianceState,
+) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	refreshedPolicy := &policyv1.Policy{}
+
+	err := r.Get(ctx, types.NamespacedName{Namespace: policy.Namespace, Name: policy.Name}, refreshedPolicy)
+	if err != nil {
+		log.Error(err, "Failed to refresh the cached policy. Will use potentially stale policy for history comparison.")
+
+		refreshedPolicy = policy
+	}
+
+	owner := metav1.OwnerReference{
+		APIVersion: refreshedPolicy.APIVersion,
+		Kind:       refreshedPolicy.Kind,
+		Name:       refreshedPolicy.Name,
+		UID:        refreshedPolicy.UID,
+	}
+	kn := policyKindName{Namespace: policy.Namespace, Policy: policy.Name, Kind: kyvernoPolicy.GetKind(), Name: kyvernoPolicy.GetName()}
+
+	if len(refreshedPolicy.Status.Details) < templateIndex+1 ||
+		len(refreshedPolicy.Status.Details[templateIndex].History) == 0 ||
+		refreshedPolicy.Status.Details[templateIndex].History[0].Message != fmt.Sprintf("%s; %s", compliance, msg) {
+		//#nosec G401
+		msgSHA1 := sha1.Sum([]byte(msg))
+		if existingMsgSHA1, ok := r.lastSentMessages.Load(kn); ok && existingMsgSHA1.([20]byte) == msgSHA1 {
+			// The message was already sent.
+			return nil
+		}
+
+		reason := utils.EventReason(kyvernoPolicy.GetNamespace(), kyvernoPolicy.GetName())
+
+		// The policies from each hub are replicated to their own namespace, so send the event to the policy namespace
+		sender := r.ComplianceEventSender
+		sender.ClusterNamespace = refreshedPolicy.Namespace
+
+		err := sender.SendEvent(ctx, kyvernoPolicy, owner, reason, msg, compliance)
+		if err != nil {
+			return err
+		}
+
+		log.Info(
+			"Sent a compliance message for the Kyverno policy",
+			"policy", refreshedPolicy.Name,
+			"kyvernoPolicyKind", kyvernoPolicy.GetKind(),
+			"kyvernoPolicyName", kyvernoPolicy.GetName(),
+			"msg", msg,
+		)
+
+		r.lastSentMessages.Store(kn, msgSHA1)
+	} else {
+		// The message is already recorded in the Policy status so the sent message in the cache can be removed. This
+		// way if the status message on the Policy is overwritten/deleted, a new status event is sent.
+		r.lastSentMessages.Delete(kn)
+	}
+
+	return nil
+}
+
+// isKyvernoPolicy returns whether the GroupKind is a Kyverno ClusterPolicy or Policy.
+func isKyvernoPolicy(gk schema.GroupKind) bool {
+	return gk.Group == KyvernoGroup && (gk.Kind == "ClusterPolicy" || gk.Kind == "Policy")
+}
+
+// hasKyvernoPolicies checks a policy's policy-templates array to determine if it contains a Kyverno ClusterPolicy or
+// Policy.
+func hasKyvernoPolicies(policy *policyv1.Policy) bool {
+	for _, template := range policy.Spec.PolicyTemplates {
+		templateMap := map[string]any{}
+
+		err := json.Unmarshal(template.ObjectDefinition.Raw, &templateMap)
+		if err != nil {
+			continue
+		}
+
+		templateUnstructured := unstructured.Unstructured{Object: templateMap}
+
+		if isKyvernoPolicy(templateUnstructured.GroupVersionKind().GroupKind()) {
+			return true
+		}
+	}
+
+	return false
+}
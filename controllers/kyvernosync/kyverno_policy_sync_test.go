@@ -0,0 +1,318 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package kyvernosync
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	depclient "github.com/stolostron/kubernetes-dependency-watches/client"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// fakeReportsWatcher lists the reports that match the kind, namespace, and selector of the query.
+type fakeReportsWatcher struct {
+	depclient.DynamicWatcher
+	reports   []unstructured.Unstructured
+	selectors []string
+}
+
+func (w *fakeReportsWatcher) List(
+	_ depclient.ObjectIdentifier, gvk schema.GroupVersionKind, namespace string, selector labels.Selector,
+) ([]unstructured.Unstructured, error) {
+	w.selectors = append(w.selectors, selector.String())
+
+	listed := []unstructured.Unstructured{}
+
+	for _, report := range w.reports {
+		if report.GroupVersionKind() != gvk || (namespace != "" && report.GetNamespace() != namespace) {
+			continue
+		}
+
+		if selector.Matches(labels.Set(report.GetLabels())) {
+			listed = append(listed, report)
+		}
+	}
+
+	return listed, nil
+}
+
+func kyvernoPolicy(kind string, namespace string, name string, status map[string]any) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "kyverno.io/v1",
+		"kind":       kind,
+		"metadata":   map[string]any{"name": name, "namespace": namespace},
+	}}
+
+	if status != nil {
+		obj.Object["status"] = status
+	}
+
+	return obj
+}
+
+func report(
+	gvk schema.GroupVersionKind, namespace string, name string, reportLabels map[string]string, fields map[string]any,
+) unstructured.Unstructured {
+	obj := unstructured.Unstructured{Object: fields}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetLabels(reportLabels)
+
+	return obj
+}
+
+func TestReportViolations(t *testing.T) {
+	t.Parallel()
+
+	deployment := map[string]any{"kind": "Deployment", "namespace": "app", "name": "web"}
+
+	tests := map[string]struct {
+		kyvernoPolicy *unstructured.Unstructured
+		results       []any
+		scope         map[string]any
+		expected      []string
+	}{
+		"failed result with resources": {
+			kyvernoPolicy: kyvernoPolicy("ClusterPolicy", "", "require-labels", nil),
+			results: []any{map[string]any{
+				"policy": "require-labels", "rule": "check-team", "result": "fail", "message": "missing team",
+				"resources": []any{deployment},
+			}},
+			expected: []string{"fail - check-team: missing team (on Deployment app/web)"},
+		},
+		"errored result with the resource in the scope": {
+			kyvernoPolicy: kyvernoPolicy("ClusterPolicy", "", "require-labels", nil),
+			results: []any{map[string]any{
+				"policy": "require-labels", "rule": "check-team", "result": "error", "message": "bad variable",
+			}},
+			scope:    map[string]any{"kind": "Namespace", "name": "app"},
+			expected: []string{"error - check-team: bad variable (on Namespace app)"},
+		},
+		"failed result without a resource": {
+			kyvernoPolicy: kyvernoPolicy("ClusterPolicy", "", "require-labels", nil),
+			results: []any{map[string]any{
+				"policy": "require-labels", "rule": "check-team", "result": "fail", "message": "missing team",
+			}},
+			expected: []string{"fail - check-team: missing team"},
+		},
+		"namespaced policy referred to by namespace and name": {
+			kyvernoPolicy: kyvernoPolicy("Policy", "app", "require-labels", nil),
+			results: []any{
+				map[string]any{
+					"policy": "app/require-labels", "rule": "check-team", "result": "fail", "message": "missing team",
+					"resources": []any{deployment},
+				},
+				map[string]any{
+					"policy": "other/require-labels", "rule": "check-team", "result": "fail", "message": "other",
+					"resources": []any{deployment},
+				},
+			},
+			expected: []string{"fail - check-team: missing team (on Deployment app/web)"},
+		},
+		"passing and skipped results and other policies": {
+			kyvernoPolicy: kyvernoPolicy("ClusterPolicy", "", "require-labels", nil),
+			results: []any{
+				map[string]any{"policy": "require-labels", "rule": "check-team", "result": "pass"},
+				map[string]any{"policy": "require-labels", "rule": "check-owner", "result": "skip"},
+				map[string]any{"policy": "disallow-latest", "rule": "check-tag", "result": "fail"},
+				"not-a-result",
+			},
+			expected: []string{},
+		},
+		"sorted without duplicates": {
+			kyvernoPolicy: kyvernoPolicy("ClusterPolicy", "", "require-labels", nil),
+			results: []any{
+				map[string]any{
+					"policy": "require-labels", "rule": "check-team", "result": "fail", "message": "missing team",
+					"resources": []any{deployment},
+				},
+				map[string]any{
+					"policy": "require-labels", "rule": "check-owner", "result": "fail", "message": "missing owner",
+					"resources": []any{deployment},
+				},
+				map[string]any{
+					"policy": "require-labels", "rule": "check-team", "result": "fail", "message": "missing team",
+					"resources": []any{deployment},
+				},
+			},
+			expected: []string{
+				"fail - check-owner: missing owner (on Deployment app/web)",
+				"fail - check-team: missing team (on Deployment app/web)",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			fields := map[string]any{"results": test.results}
+			if test.scope != nil {
+				fields["scope"] = test.scope
+			}
+
+			reports := []unstructured.Unstructured{report(policyReportGVK, "app", "report", nil, fields)}
+
+			violations := reportViolations(test.kyvernoPolicy, reports)
+			if !slices.Equal(violations, test.expected) {
+				t.Fatalf("Expected the violations %v, got %v", test.expected, violations)
+			}
+		})
+	}
+}
+
+func TestPolicyReady(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		status         map[string]any
+		expectedReady  bool
+		expectedReason string
+	}{
+		"ready condition is true": {
+			status: map[string]any{"conditions": []any{
+				map[string]any{"type": "Other", "status": "False"},
+				map[string]any{"type": "Ready", "status": "True"},
+			}},
+			expectedReady: true,
+		},
+		"ready condition is false": {
+			status: map[string]any{"conditions": []any{
+				map[string]any{"type": "Ready", "status": "False", "message": "invalid rule"},
+			}},
+			expectedReady:  false,
+			expectedReason: "invalid rule",
+		},
+		"no ready condition": {
+			status:        map[string]any{"conditions": []any{map[string]any{"type": "Other", "status": "False"}}},
+			expectedReady: true,
+		},
+		"older Kyverno that is ready": {
+			status:        map[string]any{"ready": true},
+			expectedReady: true,
+		},
+		"older Kyverno that isn't ready": {
+			status:         map[string]any{"ready": false},
+			expectedReady:  false,
+			expectedReason: "the policy status is not ready",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ready, reason := policyReady(kyvernoPolicy("ClusterPolicy", "", "require-labels", test.status))
+			if ready != test.expectedReady {
+				t.Fatalf("Expected ready to be %v, got %v", test.expectedReady, ready)
+			}
+
+			if !ready && reason != test.expectedReason {
+				t.Fatalf("Expected the reason %q, got %q", test.expectedReason, reason)
+			}
+		})
+	}
+}
+
+func TestResourceName(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		resource map[string]any
+		expected string
+	}{
+		"namespaced":      {map[string]any{"namespace": "app", "name": "web"}, "app/web"},
+		"cluster-scoped":  {map[string]any{"name": "app"}, "app"},
+		"empty namespace": {map[string]any{"namespace": "", "name": "app"}, "app"},
+		"no name":         {map[string]any{}, ""},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := resourceName(test.resource); actual != test.expected {
+				t.Fatalf("Expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestListReports(t *testing.T) {
+	t.Parallel()
+
+	kyvernoLabels := map[string]string{"app.kubernetes.io/managed-by": "kyverno"}
+	clusterPolicyLabels := map[string]string{"cpol.kyverno.io/require-labels": "1234"}
+	policyLabels := map[string]string{"pol.kyverno.io/require-labels": "1234"}
+
+	reports := []unstructured.Unstructured{
+		report(policyReportGVK, "app", "cpol-app", clusterPolicyLabels, map[string]any{}),
+		report(policyReportGVK, "other", "cpol-other", clusterPolicyLabels, map[string]any{}),
+		report(policyReportGVK, "app", "pol-app", policyLabels, map[string]any{}),
+		report(policyReportGVK, "other", "pol-other", policyLabels, map[string]any{}),
+		report(policyReportGVK, "app", "kyverno-app", kyvernoLabels, map[string]any{}),
+		report(clusterPolicyReportGVK, "", "cpol-cluster", clusterPolicyLabels, map[string]any{}),
+		report(clusterPolicyReportGVK, "", "kyverno-cluster", kyvernoLabels, map[string]any{}),
+	}
+
+	// A label name can't be longer than 63 characters
+	longName := strings.Repeat("a", 64)
+
+	tests := map[string]struct {
+		kyvernoPolicy     *unstructured.Unstructured
+		expectedReports   []string
+		expectedSelectors []string
+	}{
+		"cluster policy in namespaced and cluster reports": {
+			kyvernoPolicy:     kyvernoPolicy("ClusterPolicy", "", "require-labels", nil),
+			expectedReports:   []string{"cpol-app", "cpol-cluster", "cpol-other"},
+			expectedSelectors: []string{"cpol.kyverno.io/require-labels", "cpol.kyverno.io/require-labels"},
+		},
+		"namespaced policy only in its namespace": {
+			kyvernoPolicy:     kyvernoPolicy("Policy", "app", "require-labels", nil),
+			expectedReports:   []string{"pol-app"},
+			expectedSelectors: []string{"pol.kyverno.io/require-labels"},
+		},
+		"name that isn't a valid label key": {
+			kyvernoPolicy:   kyvernoPolicy("ClusterPolicy", "", longName, nil),
+			expectedReports: []string{"kyverno-app", "kyverno-cluster"},
+			expectedSelectors: []string{
+				"app.kubernetes.io/managed-by=kyverno", "app.kubernetes.io/managed-by=kyverno",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			watcher := &fakeReportsWatcher{reports: reports}
+			r := &KyvernoPolicyReconciler{ReportsWatcher: watcher}
+
+			listed, err := r.listReports(depclient.ObjectIdentifier{}, test.kyvernoPolicy)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			names := make([]string, 0, len(listed))
+			for _, listedReport := range listed {
+				names = append(names, listedReport.GetName())
+			}
+
+			slices.Sort(names)
+
+			if !slices.Equal(names, test.expectedReports) {
+				t.Fatalf("Expected the reports %v, got %v", test.expectedReports, names)
+			}
+
+			if !slices.Equal(watcher.selectors, test.expectedSelectors) {
+				t.Fatalf("Expected the selectors %v, got %v", test.expectedSelectors, watcher.selectors)
+			}
+		})
+	}
+}
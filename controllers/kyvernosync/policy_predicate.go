@@ -0,0 +1,34 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package kyvernosync
+
+import (
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// policyPredicates filters out policies without Kyverno policies and policy updates without the generation changing.
+func policyPredicates() predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			policy := e.Object.(*policiesv1.Policy)
+
+			return hasKyvernoPolicies(policy)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldPolicy := e.ObjectOld.(*policiesv1.Policy)
+			updatedPolicy := e.ObjectNew.(*policiesv1.Policy)
+
+			if oldPolicy.Generation == updatedPolicy.Generation {
+				return false
+			}
+
+			// oldPolicy is also checked in the event all the Kyverno policies were removed.
+			return hasKyvernoPolicies(oldPolicy) || hasKyvernoPolicies(updatedPolicy)
+		},
+		DeleteFunc: func(_ event.DeleteEvent) bool {
+			return true
+		},
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package policyprotection
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+	"open-cluster-management.io/governance-policy-propagator/controllers/common"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"open-cluster-management.io/governance-policy-framework-addon/controllers/utils"
+)
+
+const (
+	// WebhookName is the name of the validating webhook, which is used in log messages.
+	WebhookName = "policy-protection-webhook"
+	// WebhookPath is the path that the validating webhook is served on.
+	WebhookPath = "/validate-policy-protection"
+)
+
+// Validator is a validating admission webhook that rejects local changes to the policies replicated from the hub and
+// to the objects generated from their templates, which would otherwise only be reverted after the fact. Changes from
+// the addon itself and from the allowed groups are always allowed.
+type Validator struct {
+	// Username is the addon's username, such as its service account, which syncs the policies and templates.
+	Username string
+	// AllowedGroups are the groups whose members can change the replicated policies and templates, such as the service
+	// accounts of the policy controllers that add finalizers to the templates or of the garbage collector.
+	AllowedGroups []string
+}
+
+// blank assignment to verify that Validator implements admission.Handler
+var _ admission.Handler = &Validator{}
+
+// Handle rejects updates and deletions of the replicated policies and generated templates that aren't from the addon
+// or an allowed group. Updates that don't change the labels, annotations, or content, such as finalizer and status
+// changes, are always allowed.
+func (v *Validator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	log := ctrl.LoggerFrom(ctx).WithName(WebhookName).WithValues(
+		"kind", req.Kind.Kind, "namespace", req.Namespace, "name", req.Name, "operation", req.Operation,
+		"username", req.UserInfo.Username,
+	)
+
+	if req.Operation != admissionv1.Update && req.Operation != admissionv1.Delete {
+		return admission.Allowed("")
+	}
+
+	if req.UserInfo.Username == v.Username {
+		return admission.Allowed("the change is from the addon")
+	}
+
+	for _, group := range req.UserInfo.Groups {
+		if slices.Contains(v.AllowedGroups, group) {
+			return admission.Allowed("the change is from an allowed group")
+		}
+	}
+
+	existing := &unstructured.Unstructured{}
+
+	if err := existing.UnmarshalJSON(req.OldObject.Raw); err != nil {
+		log.Error(err, "Failed to decode the existing object")
+
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	var denied string
+
+	switch {
+	case isReplicatedPolicy(existing):
+		denied = fmt.Sprintf(
+			"the policy %s is replicated from the hub, so it must be changed on the hub instead", existing.GetName(),
+		)
+	case existing.GetLabels()[utils.ParentPolicyLabel] != "":
+		denied = fmt.Sprintf(
+			"the object is generated from the policy %s, so the policy must be changed on the hub instead",
+			existing.GetLabels()[utils.ParentPolicyLabel],
+		)
+	default:
+		return admission.Allowed("the object is not protected")
+	}
+
+	if req.Operation == admissionv1.Update {
+		updated := &unstructured.Unstructured{}
+
+		if err := updated.UnmarshalJSON(req.Object.Raw); err != nil {
+			log.Error(err, "Failed to decode the updated object")
+
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+
+		if equality.Semantic.DeepEqual(protectedContent(existing), protectedContent(updated)) {
+			return admission.Allowed("the protected content is unchanged")
+		}
+	}
+
+	log.Info("Rejecting a local change to a protected object")
+
+	return admission.Denied(denied)
+}
+
+// isReplicatedPolicy returns whether the object is a policy replicated from the hub, which has the root policy label.
+func isReplicatedPolicy(obj *unstructured.Unstructured) bool {
+	return obj.GroupVersionKind().Group == policiesv1.GroupVersion.Group &&
+		obj.GetKind() == policiesv1.Kind &&
+		obj.GetLabels()[common.RootPolicyLabel] != ""
+}
+
+// protectedContent returns the parts of the object that the addon syncs, which are the labels, the annotations, and
+// every top-level field other than the metadata and the status.
+func protectedContent(obj *unstructured.Unstructured) map[string]any {
+	content := map[string]any{
+		"labels":      obj.GetLabels(),
+		"annotations": obj.GetAnnotations(),
+	}
+
+	for field, value := range obj.Object {
+		if field != "metadata" && field != "status" {
+			content[field] = value
+		}
+	}
+
+	return content
+}
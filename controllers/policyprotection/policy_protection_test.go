@@ -0,0 +1,194 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package policyprotection
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func testObject(t *testing.T, obj map[string]any) runtime.RawExtension {
+	t.Helper()
+
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return runtime.RawExtension{Raw: raw}
+}
+
+func replicatedPolicy(remediation string, finalizers ...any) map[string]any {
+	return map[string]any{
+		"apiVersion": "policy.open-cluster-management.io/v1",
+		"kind":       "Policy",
+		"metadata": map[string]any{
+			"name":      "policies.case1",
+			"namespace": "managed",
+			"labels": map[string]any{
+				"policy.open-cluster-management.io/root-policy": "policies.case1",
+			},
+			"finalizers": finalizers,
+		},
+		"spec": map[string]any{"remediationAction": remediation},
+	}
+}
+
+func TestValidatorHandle(t *testing.T) {
+	t.Parallel()
+
+	validator := &Validator{
+		Username:      "system:serviceaccount:open-cluster-management-agent-addon:governance-policy-framework",
+		AllowedGroups: []string{"system:serviceaccounts:kube-system"},
+	}
+
+	template := map[string]any{
+		"apiVersion": "policy.open-cluster-management.io/v1",
+		"kind":       "ConfigurationPolicy",
+		"metadata": map[string]any{
+			"name":      "case1-config",
+			"namespace": "managed",
+			"labels":    map[string]any{"policy.open-cluster-management.io/policy": "policies.case1"},
+		},
+		"spec": map[string]any{"remediationAction": "inform"},
+	}
+	editedTemplate := map[string]any{
+		"apiVersion": "policy.open-cluster-management.io/v1",
+		"kind":       "ConfigurationPolicy",
+		"metadata": map[string]any{
+			"name":      "case1-config",
+			"namespace": "managed",
+			"labels":    map[string]any{"policy.open-cluster-management.io/policy": "policies.case1"},
+		},
+		"spec": map[string]any{"remediationAction": "enforce"},
+	}
+	unprotected := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]any{"name": "settings", "namespace": "managed"},
+	}
+
+	tests := map[string]struct {
+		operation admissionv1.Operation
+		username  string
+		groups    []string
+		oldObject map[string]any
+		object    map[string]any
+		expected  bool
+	}{
+		"an edit of a replicated policy": {
+			operation: admissionv1.Update,
+			oldObject: replicatedPolicy("inform"),
+			object:    replicatedPolicy("enforce"),
+			expected:  false,
+		},
+		"a deletion of a replicated policy": {
+			operation: admissionv1.Delete,
+			oldObject: replicatedPolicy("inform"),
+			expected:  false,
+		},
+		"a finalizer added to a replicated policy": {
+			operation: admissionv1.Update,
+			oldObject: replicatedPolicy("inform"),
+			object:    replicatedPolicy("inform", "example.com/cleanup"),
+			expected:  true,
+		},
+		"an edit of a replicated policy by the addon": {
+			operation: admissionv1.Update,
+			username:  validator.Username,
+			oldObject: replicatedPolicy("inform"),
+			object:    replicatedPolicy("enforce"),
+			expected:  true,
+		},
+		"a deletion of a replicated policy by an allowed group": {
+			operation: admissionv1.Delete,
+			groups:    []string{"system:authenticated", "system:serviceaccounts:kube-system"},
+			oldObject: replicatedPolicy("inform"),
+			expected:  true,
+		},
+		"an edit of a generated template": {
+			operation: admissionv1.Update,
+			oldObject: template,
+			object:    editedTemplate,
+			expected:  false,
+		},
+		"a deletion of a generated template": {
+			operation: admissionv1.Delete,
+			oldObject: template,
+			expected:  false,
+		},
+		"an edit of an unprotected object": {
+			operation: admissionv1.Update,
+			oldObject: unprotected,
+			object:    unprotected,
+			expected:  true,
+		},
+		"a creation": {
+			operation: admissionv1.Create,
+			object:    replicatedPolicy("enforce"),
+			expected:  true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			req := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Operation: test.operation,
+					UserInfo: authenticationv1.UserInfo{
+						Username: test.username,
+						Groups:   test.groups,
+					},
+				},
+			}
+
+			if test.username == "" {
+				req.UserInfo.Username = "kube:admin"
+			}
+
+			if test.oldObject != nil {
+				req.OldObject = testObject(t, test.oldObject)
+			}
+
+			if test.object != nil {
+				req.Object = testObject(t, test.object)
+			}
+
+			resp := validator.Handle(context.TODO(), req)
+			if resp.Allowed != test.expected {
+				t.Fatalf("Expected allowed to be %v, got %v: %v", test.expected, resp.Allowed, resp.Result)
+			}
+		})
+	}
+}
+
+func TestProtectedContent(t *testing.T) {
+	t.Parallel()
+
+	policy := &unstructured.Unstructured{Object: replicatedPolicy("inform")}
+	policy.Object["status"] = map[string]any{"compliant": "Compliant"}
+	policy.SetResourceVersion("2")
+
+	content := protectedContent(policy)
+
+	for _, field := range []string{"apiVersion", "kind", "spec", "labels", "annotations"} {
+		if _, ok := content[field]; !ok {
+			t.Fatalf("Expected the protected content to have %s", field)
+		}
+	}
+
+	for _, field := range []string{"metadata", "status"} {
+		if _, ok := content[field]; ok {
+			t.Fatalf("Expected the protected content to not have %s", field)
+		}
+	}
+}
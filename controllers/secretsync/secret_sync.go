@@ -30,12 +30,14 @@ const (
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *SecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	controllerName := utils.HubScopedName(ControllerName, r.HubName)
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.Secret{}).
-		Named(ControllerName).
+		Named(controllerName).
 		WithOptions(controller.Options{MaxConcurrentReconciles: r.ConcurrentReconciles}).
 		WithLogConstructor(func(req *reconcile.Request) logr.Logger {
-			return utils.LogConstructor(ControllerName, "Secret", req)
+			return utils.LogConstructor(controllerName, "Secret", req)
 		}).
 		Complete(r)
 }
@@ -50,6 +52,8 @@ type SecretReconciler struct {
 	// The namespace that the secret should be synced to.
 	TargetNamespace      string
 	ConcurrentReconciles int
+	// HubName is the name of the additional hub that the secret is synced from. It's empty for the primary hub.
+	HubName string
 }
 
 // WARNING: In production, this should be namespaced to the actual managed cluster namespace.
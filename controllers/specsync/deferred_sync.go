@@ -0,0 +1,78 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package specsync
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"open-cluster-management.io/governance-policy-framework-addon/controllers/utils"
+)
+
+// deferredSyncInterval is how often the deferred policies are checked for whether changes are allowed again.
+const deferredSyncInterval = 30 * time.Second
+
+// deferChange defers the creation or update of the replicated policy when changes are frozen by the maintenance
+// windows, and returns until when if it did. The deferred policies are reconciled again in the order they were deferred
+// once changes are allowed again.
+func (r *PolicyReconciler) deferChange(ctx context.Context, request reconcile.Request) (bool, time.Time, error) {
+	frozen, until := r.MaintenanceWindows.Frozen(time.Now())
+	if !frozen {
+		return false, time.Time{}, nil
+	}
+
+	if _, err := r.MaintenanceWindows.Defer(ctx, r.TargetNamespace, request.Name); err != nil {
+		return false, time.Time{}, err
+	}
+
+	return true, until, nil
+}
+
+// startDeferredSync reconciles the deferred policies once changes are allowed again until the context is canceled.
+func (r *PolicyReconciler) startDeferredSync(ctx context.Context) error {
+	ticker := time.NewTicker(deferredSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if frozen, _ := r.MaintenanceWindows.Frozen(time.Now()); !frozen {
+				r.flushDeferred(ctx)
+			}
+		}
+	}
+}
+
+// flushDeferred reconciles the deferred policies one at a time in the order they were deferred, so that the changes
+// from the hub land in the same order. The order is kept in the deferred ConfigMap, so it's the same after a restart.
+// When a reconcile fails, it and the rest of the policies stay deferred and are retried on the next flush.
+func (r *PolicyReconciler) flushDeferred(ctx context.Context) {
+	deferred := r.MaintenanceWindows.DeferredPolicies(r.TargetNamespace)
+	if len(deferred) == 0 {
+		return
+	}
+
+	controllerName := utils.HubScopedName(ControllerName, r.HubName)
+	log := ctrl.LoggerFrom(ctx).WithName(controllerName)
+
+	log.Info("Changes are allowed again, syncing the deferred policies", "policies", len(deferred))
+
+	for _, name := range deferred {
+		request := reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: r.ClusterNamespaceOnHub, Name: name},
+		}
+		reqCtx := ctrl.LoggerInto(ctx, utils.LogConstructor(controllerName, "Policy", &request))
+
+		if _, err := r.Reconcile(reqCtx, request); err != nil {
+			log.Error(err, "Failed to sync the deferred policy, will retry", "policy", name)
+
+			return
+		}
+	}
+}
@@ -6,9 +6,11 @@ package specsync
 import (
 	"context"
 	"fmt"
+	"maps"
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -19,12 +21,15 @@ import (
 	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
 	"open-cluster-management.io/governance-policy-propagator/controllers/common"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
+	"open-cluster-management.io/governance-policy-framework-addon/api/v1alpha1"
 	"open-cluster-management.io/governance-policy-framework-addon/controllers/uninstall"
 	"open-cluster-management.io/governance-policy-framework-addon/controllers/utils"
 )
@@ -33,19 +38,29 @@ const ControllerName string = "policy-spec-sync"
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *PolicyReconciler) SetupWithManager(mgr ctrl.Manager, additionalSource source.Source) error {
-	builder := ctrl.NewControllerManagedBy(mgr).
-		For(&policiesv1.Policy{}).
-		Named(ControllerName).
+	controllerName := utils.HubScopedName(ControllerName, r.HubName)
+
+	ctrlBuilder := ctrl.NewControllerManagedBy(mgr).
+		For(&policiesv1.Policy{}, builder.WithPredicates(r.Selector.Predicate())).
+		Named(controllerName).
 		WithOptions(controller.Options{MaxConcurrentReconciles: r.ConcurrentReconciles}).
 		WithLogConstructor(func(req *reconcile.Request) logr.Logger {
-			return utils.LogConstructor(ControllerName, "Policy", req)
+			return utils.LogConstructor(controllerName, "Policy", req)
 		})
 
 	if additionalSource != nil {
-		builder = builder.WatchesRawSource(additionalSource)
+		ctrlBuilder = ctrlBuilder.WatchesRawSource(additionalSource)
+	}
+
+	if r.MaintenanceWindows != nil {
+		if err := mgr.Add(manager.RunnableFunc(r.startDeferredSync)); err != nil {
+			return err
+		}
 	}
 
-	return builder.Complete(r)
+	return ctrlBuilder.Complete(utils.TraceReconciler(
+		controllerName, r.HubClient, func() client.Object { return &policiesv1.Policy{} }, r,
+	))
 }
 
 // blank assignment to verify that ReconcilePolicy implements reconcile.Reconciler
@@ -64,11 +79,28 @@ type PolicyReconciler struct {
 	ConcurrentReconciles int
 	// StatusSyncRequests triggers status-sync controller reconciles based on what is observed on the hub
 	StatusSyncRequests chan<- event.GenericEvent
+	// Selector selects the policies that this deployment syncs. Every policy is synced when it's nil.
+	Selector *utils.PolicySelector
+	// HubAPIReader reads from the hub without the cache. It's used to confirm that a policy that isn't in the
+	// filtered cache was deleted on the hub before removing it from the managed cluster.
+	HubAPIReader client.Reader
+	// HubName is the name of the additional hub that the policies are replicated from, which is added to the
+	// controller name and the spec-sync lag metric. It's empty for the primary hub.
+	HubName string
+	// PolicyOverrides enables the PolicyOverride resources on the managed cluster, which are applied on top of the
+	// policies from the hub when they're replicated.
+	PolicyOverrides bool
+	// MaintenanceWindows defers the creation and update of the replicated policies while changes are frozen. The
+	// changes are never deferred when it's nil.
+	MaintenanceWindows *utils.MaintenanceWindows
+	// ClusterNamespaceOnHub is the namespace of the policies on the hub, which the deferred policies are synced from.
+	ClusterNamespaceOnHub string
 }
 
 //+kubebuilder:rbac:groups=policy.open-cluster-management.io,resources=policies,verbs=create;delete;get;list;patch;update;watch
 //+kubebuilder:rbac:groups=policy.open-cluster-management.io,resources=policies/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=policy.open-cluster-management.io,resources=policies/finalizers,verbs=update
+//+kubebuilder:rbac:groups=policy.open-cluster-management.io,resources=policyoverrides,verbs=get;list;watch
 //+kubebuilder:rbac:groups=core;events.k8s.io,resources=events,verbs=create;delete;get;list;patch;update;watch
 // This is required for the status lease for the addon framework
 //+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list
@@ -97,9 +129,34 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 	err := r.HubClient.Get(ctx, request.NamespacedName, instance)
 	if err != nil {
 		if errors.IsNotFound(err) {
+			// When the cache only has the selected policies, the policy might not be deleted on the hub
+			if r.Selector != nil && r.HubAPIReader != nil {
+				err = r.HubAPIReader.Get(ctx, request.NamespacedName, instance)
+				if err == nil {
+					if !r.Selector.Matches(instance) {
+						reqLogger.V(1).Info("Policy is not selected by this deployment, skipping it")
+
+						return reconcile.Result{}, nil
+					}
+
+					// The policy was just selected and isn't in the cache yet
+					return reconcile.Result{}, fmt.Errorf("the selected policy %s isn't in the cache yet", request.Name)
+				}
+
+				if !errors.IsNotFound(err) {
+					reqLogger.Error(err, "Failed to get policy from hub...")
+
+					return reconcile.Result{}, err
+				}
+			}
+
 			// replicated policy on hub was deleted, remove policy on managed cluster
 			reqLogger.Info("Policy was deleted, removing on managed cluster...")
 
+			_ = specSyncLagHistogram.DeletePartialMatch(prometheus.Labels{
+				"controller": utils.HubScopedName(ControllerName, r.HubName), "policy": request.Name,
+			})
+
 			err = r.ManagedClient.Delete(ctx, &policiesv1.Policy{
 				TypeMeta: metav1.TypeMeta{
 					Kind:       policiesv1.Kind,
@@ -117,6 +174,13 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 				return reconcile.Result{}, err
 			}
 
+			// Deletions are never deferred
+			if _, err := r.MaintenanceWindows.Undefer(ctx, r.TargetNamespace, request.Name); err != nil {
+				reqLogger.Error(err, "Failed to remove the deleted policy from the deferred policies")
+
+				return reconcile.Result{}, err
+			}
+
 			reqLogger.Info("Policy has been removed from managed cluster...Reconciliation complete.")
 
 			return reconcile.Result{}, nil
@@ -127,15 +191,61 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 		return reconcile.Result{}, err
 	}
 
+	if !r.Selector.Matches(instance) {
+		reqLogger.V(1).Info("Policy is not selected by this deployment, skipping it")
+
+		// The policy isn't synced by this deployment, so its changes aren't deferred either
+		if _, err := r.MaintenanceWindows.Undefer(ctx, r.TargetNamespace, request.Name); err != nil {
+			reqLogger.Error(err, "Failed to remove the unselected policy from the deferred policies")
+
+			return reconcile.Result{}, err
+		}
+
+		return reconcile.Result{}, nil
+	}
+
+	// The replicated policy is the policy from the hub with the local PolicyOverride applied
+	var override *v1alpha1.PolicyOverride
+
+	if r.PolicyOverrides {
+		override, err = utils.GetPolicyOverride(ctx, r.ManagedClient, r.TargetNamespace, request.Name)
+		if err != nil {
+			reqLogger.Error(err, "Failed to get the policy override from managed...")
+
+			return reconcile.Result{}, err
+		}
+
+		if override != nil {
+			reqLogger.V(1).Info("Applying the policy override", "expiresAt", override.Spec.ExpiresAt)
+		}
+	}
+
+	desired := utils.ApplyPolicyOverride(instance, override)
+	// Reconcile again when the override expires to restore the policy from the hub
+	result := reconcile.Result{RequeueAfter: utils.PolicyOverrideRequeue(override)}
+
 	managedPlc := &policiesv1.Policy{}
 
 	err = r.ManagedClient.Get(ctx, types.NamespacedName{Namespace: r.TargetNamespace, Name: request.Name}, managedPlc)
 	if err != nil {
 		if errors.IsNotFound(err) {
+			deferred, until, err := r.deferChange(ctx, request)
+			if err != nil {
+				reqLogger.Error(err, "Failed to defer the policy creation")
+
+				return reconcile.Result{}, err
+			}
+
+			if deferred {
+				reqLogger.Info("Changes are frozen by a maintenance window, deferring the policy creation", "until", until)
+
+				return reconcile.Result{}, nil
+			}
+
 			// not found on managed cluster, create it
 			reqLogger.Info("Policy not found on managed cluster, creating it...")
 
-			managedPlc = instance.DeepCopy()
+			managedPlc = desired.DeepCopy()
 			managedPlc.Namespace = r.TargetNamespace
 
 			if managedPlc.Labels[common.ClusterNamespaceLabel] != "" {
@@ -144,6 +254,7 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 
 			managedPlc.SetOwnerReferences(nil)
 			managedPlc.SetResourceVersion("")
+			utils.InjectTraceContext(ctx, managedPlc)
 
 			err = r.ManagedClient.Create(ctx, managedPlc)
 			if err != nil {
@@ -152,6 +263,12 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 				return reconcile.Result{}, err
 			}
 
+			r.observeSpecSyncLag(instance)
+
+			if _, err := r.MaintenanceWindows.Undefer(ctx, r.TargetNamespace, request.Name); err != nil {
+				reqLogger.Error(err, "Failed to remove the created policy from the deferred policies")
+			}
+
 			r.ManagedRecorder.Eventf(managedPlc, nil, corev1.EventTypeNormal, "PolicySpecSync", "PolicySpecSync",
 				fmt.Sprintf("Policy %s was synchronized to cluster namespace %s", instance.GetName(),
 					r.TargetNamespace))
@@ -162,11 +279,28 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 		}
 	}
 	// found, then compare and update
-	if !utils.EquivalentReplicatedPolicies(instance, managedPlc) {
+	if !utils.EquivalentReplicatedPolicies(desired, managedPlc) {
+		deferred, until, err := r.deferChange(ctx, request)
+		if err != nil {
+			reqLogger.Error(err, "Failed to defer the policy update")
+
+			return reconcile.Result{}, err
+		}
+
+		if deferred {
+			reqLogger.Info("Changes are frozen by a maintenance window, deferring the policy update", "until", until)
+
+			// The status-sync reports the deferred changes to the hub
+			r.StatusSyncRequests <- event.GenericEvent{Object: managedPlc}
+
+			return result, nil
+		}
+
 		// update needed
 		reqLogger.Info("Policy mismatch between hub and managed, updating it...")
-		managedPlc.SetAnnotations(instance.GetAnnotations())
-		managedPlc.Spec = instance.Spec
+		managedPlc.SetAnnotations(maps.Clone(desired.GetAnnotations()))
+		managedPlc.Spec = desired.Spec
+		utils.InjectTraceContext(ctx, managedPlc)
 		err = r.ManagedClient.Update(ctx, managedPlc)
 
 		if err != nil && errors.IsNotFound(err) {
@@ -175,9 +309,25 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 			return reconcile.Result{}, err
 		}
 
+		if err == nil {
+			r.observeSpecSyncLag(instance)
+
+			if _, err := r.MaintenanceWindows.Undefer(ctx, r.TargetNamespace, request.Name); err != nil {
+				reqLogger.Error(err, "Failed to remove the updated policy from the deferred policies")
+			}
+		}
+
 		r.ManagedRecorder.Eventf(managedPlc, nil, corev1.EventTypeNormal, "PolicySpecSync", "PolicySpecSync",
 			fmt.Sprintf("Policy %s was updated in cluster namespace %s", instance.GetName(),
 				r.TargetNamespace))
+	} else if undeferred, err := r.MaintenanceWindows.Undefer(ctx, r.TargetNamespace, request.Name); err != nil {
+		reqLogger.Error(err, "Failed to remove the policy from the deferred policies")
+
+		return reconcile.Result{}, err
+	} else if undeferred {
+		reqLogger.Info("Policy is no longer deferred. Triggering the status-sync to update it.")
+
+		r.StatusSyncRequests <- event.GenericEvent{Object: managedPlc}
 	} else if !equality.Semantic.DeepEqual(instance.Status, managedPlc.Status) {
 		reqLogger.Info("Policy status does not match on the hub. Triggering the status-sync to update it.")
 
@@ -186,5 +336,16 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 
 	reqLogger.V(2).Info("Reconciliation complete.")
 
-	return reconcile.Result{}, nil
+	return result, nil
+}
+
+// observeSpecSyncLag records the time since the hub policy was last changed, which is when the change was synced.
+func (r *PolicyReconciler) observeSpecSyncLag(hubPolicy *policiesv1.Policy) {
+	lastChange := utils.LastSpecChange(hubPolicy)
+	if lastChange.IsZero() {
+		return
+	}
+
+	specSyncLagHistogram.WithLabelValues(utils.HubScopedName(ControllerName, r.HubName), hubPolicy.Name).
+		Observe(time.Since(lastChange).Seconds())
 }
@@ -0,0 +1,35 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package specsync
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"open-cluster-management.io/governance-policy-framework-addon/controllers/utils"
+)
+
+var specSyncLagHistogram = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name: "policy_spec_sync_lag_seconds",
+		Help: "The time from when a replicated policy changed on the hub to when the change was synced to the " +
+			"managed cluster",
+		Buckets: utils.LagBuckets,
+	},
+	[]string{
+		"controller",
+		"policy",
+	},
+)
+
+func init() {
+	// Register custom metrics with the global Prometheus registry
+	alreadyReg := &prometheus.AlreadyRegisteredError{}
+
+	regErr := metrics.Registry.Register(specSyncLagHistogram)
+	if regErr != nil && !errors.As(regErr, alreadyReg) {
+		panic(regErr)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package statussync
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+)
+
+const (
+	// aggregationAnnotation is the annotation on a policy that sets how the compliance of its templates is aggregated
+	// into the compliance of the policy. See the aggregationStrategy constants.
+	aggregationAnnotation = "policy.open-cluster-management.io/compliance-aggregation"
+	// thresholdAnnotation is the annotation on a policy with the Threshold aggregation strategy that sets how many
+	// templates must be compliant, as a number such as `2` or a percentage such as `50%`.
+	thresholdAnnotation = "policy.open-cluster-management.io/compliance-threshold"
+	// informationalAnnotation is the annotation on a policy template that, when `true`, excludes the template from the
+	// compliance of the policy. The template's own compliance is still reported.
+	informationalAnnotation = "policy.open-cluster-management.io/informational"
+)
+
+type aggregationStrategy string
+
+const (
+	// aggregateAllMustPass makes the policy compliant only when all of its templates are compliant. This is the
+	// default.
+	aggregateAllMustPass aggregationStrategy = "AllMustPass"
+	// aggregateAnyPass makes the policy compliant when any of its templates are compliant.
+	aggregateAnyPass aggregationStrategy = "AnyPass"
+	// aggregateThreshold makes the policy compliant when at least the number of templates in the thresholdAnnotation
+	// are compliant.
+	aggregateThreshold aggregationStrategy = "Threshold"
+)
+
+// complianceAggregation is the result of aggregating the compliance of a policy's templates.
+type complianceAggregation struct {
+	// compliance is the compliance of the policy. It's empty when it can't be determined yet since some templates have
+	// no compliance state, in which case the current compliance of the policy is kept.
+	compliance policiesv1.ComplianceState
+	// reason explains the compliance, such as which templates made the policy noncompliant.
+	reason string
+}
+
+// informationalTemplates returns the names of the policy's templates with the informational annotation.
+func informationalTemplates(pol *policiesv1.Policy) map[string]bool {
+	informational := map[string]bool{}
+
+	for _, policyT := range pol.Spec.PolicyTemplates {
+		if policyT == nil || policyT.ObjectDefinition.Raw == nil {
+			continue
+		}
+
+		template := struct {
+			Metadata metav1.ObjectMeta `json:"metadata"`
+		}{}
+
+		if err := json.Unmarshal(policyT.ObjectDefinition.Raw, &template); err != nil {
+			continue
+		}
+
+		if isInformational, _ := strconv.ParseBool(template.Metadata.Annotations[informationalAnnotation]); isInformational {
+			informational[template.Metadata.Name] = true
+		}
+	}
+
+	return informational
+}
+
+// aggregateCompliance aggregates the compliance of the policy's templates in its status with the policy's aggregation
+// strategy. An invalid strategy or threshold is logged and the AllMustPass strategy is used instead. The templates
+// disabled by a PolicyOverride are ignored.
+func aggregateCompliance(pol *policiesv1.Policy, log logr.Logger) complianceAggregation {
+	informational := informationalTemplates(pol)
+	byState := map[policiesv1.ComplianceState][]string{}
+	counted := 0
+
+	for _, dpt := range pol.Status.Details {
+		if dpt == nil || informational[dpt.TemplateMeta.Name] || overrideDisabled(dpt) {
+			continue
+		}
+
+		counted++
+
+		byState[dpt.ComplianceState] = append(byState[dpt.ComplianceState], dpt.TemplateMeta.Name)
+	}
+
+	strategy := aggregationStrategy(pol.GetAnnotations()[aggregationAnnotation])
+	required := 0
+
+	switch strategy {
+	case "":
+		strategy = aggregateAllMustPass
+	case aggregateAllMustPass, aggregateAnyPass:
+	case aggregateThreshold:
+		var err error
+
+		required, err = parseThreshold(pol.GetAnnotations()[thresholdAnnotation], counted)
+		if err != nil {
+			log.Info("Ignoring the invalid compliance threshold, using the AllMustPass aggregation strategy",
+				"error", err.Error())
+
+			strategy = aggregateAllMustPass
+		}
+	default:
+		log.Info("Ignoring the invalid compliance aggregation strategy, using AllMustPass instead",
+			"annotation", aggregationAnnotation, "value", strategy)
+
+		strategy = aggregateAllMustPass
+	}
+
+	if strategy == aggregateAllMustPass {
+		required = counted
+	} else if strategy == aggregateAnyPass {
+		required = min(1, counted)
+	}
+
+	aggregation := aggregateByThreshold(byState, required, counted)
+
+	aggregation.reason = fmt.Sprintf("%s: %s", strategy, aggregation.reason)
+
+	if len(informational) > 0 {
+		aggregation.reason += fmt.Sprintf(" (%d informational templates were ignored)", len(informational))
+	}
+
+	return aggregation
+}
+
+// aggregateByThreshold returns the compliance of a policy that requires the number of its counted templates to be
+// compliant. A policy that can't have enough compliant templates is noncompliant. Otherwise, it's pending while any of
+// the templates it's waiting on are pending.
+func aggregateByThreshold(
+	byState map[policiesv1.ComplianceState][]string, required int, counted int,
+) complianceAggregation {
+	compliant := len(byState[policiesv1.Compliant])
+
+	if compliant >= required {
+		return complianceAggregation{
+			compliance: policiesv1.Compliant,
+			reason:     fmt.Sprintf("%d of %d templates are compliant, %d required", compliant, counted, required),
+		}
+	}
+
+	nonCompliant := byState[policiesv1.NonCompliant]
+
+	if counted-len(nonCompliant) < required {
+		return complianceAggregation{
+			compliance: policiesv1.NonCompliant,
+			reason: fmt.Sprintf("%d of %d templates are compliant, %d required, noncompliant templates: %s",
+				compliant, counted, required, strings.Join(nonCompliant, ", ")),
+		}
+	}
+
+	if pending := byState[policiesv1.Pending]; len(pending) > 0 {
+		return complianceAggregation{
+			compliance: policiesv1.Pending,
+			reason: fmt.Sprintf("%d of %d templates are compliant, %d required, pending templates: %s",
+				compliant, counted, required, strings.Join(pending, ", ")),
+		}
+	}
+
+	return complianceAggregation{
+		reason: fmt.Sprintf("%d of %d templates are compliant, %d required, templates without a compliance state: %s",
+			compliant, counted, required, strings.Join(byState[""], ", ")),
+	}
+}
+
+// parseThreshold returns the number of templates required to be compliant from the threshold annotation, which is
+// either a number or a percentage of the counted templates, rounded up.
+func parseThreshold(rawThreshold string, counted int) (int, error) {
+	if rawPercent, isPercent := strings.CutSuffix(rawThreshold, "%"); isPercent {
+		percent, err := strconv.ParseFloat(rawPercent, 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return 0, fmt.Errorf("the %s annotation must be a percentage between 0%% and 100%%: %s",
+				thresholdAnnotation, rawThreshold)
+		}
+
+		return int(math.Ceil(percent * float64(counted) / 100)), nil
+	}
+
+	threshold, err := strconv.Atoi(rawThreshold)
+	if err != nil || threshold < 0 {
+		return 0, fmt.Errorf("the %s annotation must be a number or a percentage: %s", thresholdAnnotation, rawThreshold)
+	}
+
+	// A policy can't require more templates than it has
+	return min(threshold, counted), nil
+}
@@ -0,0 +1,444 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package statussync
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"open-cluster-management.io/governance-policy-framework-addon/controllers/utils"
+)
+
+const (
+	defaultArchiveFlushInterval = 10 * time.Second
+	defaultArchiveMaxQueue      = 10000
+	defaultArchiveRetention     = 24 * time.Hour
+	maxArchiveBackoff           = 5 * time.Minute
+	// archiveBatchSize is the most entries written to the sink at a time.
+	archiveBatchSize = 500
+)
+
+// ArchiveEntry is a compliance event in the compliance archive.
+type ArchiveEntry struct {
+	// EventName is the name of the compliance event, which is unique per event and so can be used to deduplicate
+	// entries that are delivered more than once.
+	EventName       string                     `json:"eventName"`
+	Timestamp       time.Time                  `json:"timestamp"`
+	Cluster         string                     `json:"cluster"`
+	PolicyNamespace string                     `json:"policyNamespace"`
+	Policy          string                     `json:"policy"`
+	Template        string                     `json:"template"`
+	Compliance      policiesv1.ComplianceState `json:"compliance"`
+	Category        utils.ComplianceCategory   `json:"category,omitempty"`
+	Message         string                     `json:"message"`
+}
+
+// ArchiveSink is a durable destination for compliance archive entries.
+type ArchiveSink interface {
+	// Write writes the entries to the sink. The entries are written again on an error, so the sink may receive
+	// entries more than once.
+	Write(ctx context.Context, entries []ArchiveEntry) error
+}
+
+// ComplianceArchive queues every compliance event processed by the status-sync to be written to a durable sink, so
+// that the compliance timeline is kept after the events expire and the entries drop out of the compliance history.
+// Events are deduplicated by name. The queue is only in memory, so entries can be written more than once after a
+// restart and, when the sink is unavailable long enough for the queue to fill, the oldest entries are dropped.
+type ComplianceArchive struct {
+	Sink ArchiveSink
+	// FlushInterval is how often the queued entries are written to the sink. This defaults to 10 seconds.
+	FlushInterval time.Duration
+	// MaxQueue is the most entries that are queued while the sink is unavailable. This defaults to 10000.
+	MaxQueue int
+	// Retention is how long event names are remembered to deduplicate them. Events older than this are assumed to
+	// already be archived. This defaults to 24 hours.
+	Retention time.Duration
+
+	// started is set once the archive is started, since it's shared by the status-sync of each hub.
+	started atomic.Bool
+	lock    sync.Mutex
+	queue   []ArchiveEntry
+	// seen maps the names of the queued or written events to their timestamps.
+	seen map[string]time.Time
+}
+
+// retention returns how long event names are remembered, with the default applied.
+func (a *ComplianceArchive) retention() time.Duration {
+	if a.Retention == 0 {
+		return defaultArchiveRetention
+	}
+
+	return a.Retention
+}
+
+// add queues the entries that weren't queued before. It's safe to call on a nil *ComplianceArchive.
+func (a *ComplianceArchive) add(entries ...ArchiveEntry) {
+	if a == nil || len(entries) == 0 {
+		return
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.seen == nil {
+		a.seen = map[string]time.Time{}
+	}
+
+	cutoff := time.Now().Add(-a.retention())
+
+	for _, entry := range entries {
+		if _, ok := a.seen[entry.EventName]; ok || entry.Timestamp.Before(cutoff) {
+			continue
+		}
+
+		a.seen[entry.EventName] = entry.Timestamp
+		a.queue = append(a.queue, entry)
+	}
+
+	maxQueue := a.MaxQueue
+	if maxQueue == 0 {
+		maxQueue = defaultArchiveMaxQueue
+	}
+
+	if dropped := len(a.queue) - maxQueue; dropped > 0 {
+		a.queue = a.queue[dropped:]
+		archiveDroppedCounter.Add(float64(dropped))
+	}
+
+	archiveQueueGauge.Set(float64(len(a.queue)))
+}
+
+// archiveLoader is implemented by sinks that can read back the entries they have, such as FileArchiveSink.
+type archiveLoader interface {
+	Load() ([]ArchiveEntry, error)
+}
+
+// seed marks the events as already archived, such as the events in an existing archive file.
+func (a *ComplianceArchive) seed(entries []ArchiveEntry) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.seen == nil {
+		a.seen = map[string]time.Time{}
+	}
+
+	for _, entry := range entries {
+		a.seen[entry.EventName] = entry.Timestamp
+	}
+}
+
+// flush writes the queued entries to the sink in batches and forgets the event names older than the retention. It
+// stops at the first batch that fails, which stays queued.
+func (a *ComplianceArchive) flush(ctx context.Context) error {
+	for {
+		a.lock.Lock()
+		batch := slices.Clone(a.queue[:min(len(a.queue), archiveBatchSize)])
+		a.lock.Unlock()
+
+		if len(batch) == 0 {
+			break
+		}
+
+		if err := a.Sink.Write(ctx, batch); err != nil {
+			return err
+		}
+
+		written := make(map[string]bool, len(batch))
+		for _, entry := range batch {
+			written[entry.EventName] = true
+		}
+
+		// Entries might have been dropped from the start of the queue while the batch was written, so the written
+		// entries are removed by name
+		a.lock.Lock()
+		a.queue = slices.DeleteFunc(a.queue, func(entry ArchiveEntry) bool { return written[entry.EventName] })
+		archiveQueueGauge.Set(float64(len(a.queue)))
+		a.lock.Unlock()
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	cutoff := time.Now().Add(-a.retention())
+
+	for eventName, timestamp := range a.seen {
+		if timestamp.Before(cutoff) {
+			delete(a.seen, eventName)
+		}
+	}
+
+	return nil
+}
+
+// Start writes the queued entries to the sink periodically until the context is canceled. When the sink fails, the
+// writes are retried with an exponential backoff. It returns right away if the archive was already started.
+func (a *ComplianceArchive) Start(ctx context.Context) error {
+	if !a.started.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	log := ctrl.LoggerFrom(ctx).WithName("compliance-archive")
+
+	interval := a.FlushInterval
+	if interval == 0 {
+		interval = defaultArchiveFlushInterval
+	}
+
+	// Avoid archiving the events in the sink again after a restart
+	if loader, ok := a.Sink.(archiveLoader); ok {
+		entries, err := loader.Load()
+		if err != nil {
+			log.Error(err, "Failed to read the existing compliance archive, events might be archived again")
+		}
+
+		a.seed(entries)
+	}
+
+	delay := interval
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Write what's queued before stopping, since the queue isn't persisted
+			flushCtx, cancel := context.WithTimeout(context.Background(), interval)
+			err := a.flush(flushCtx)
+
+			cancel()
+
+			if err != nil {
+				log.Error(err, "Failed to write the queued compliance events to the archive before stopping")
+			}
+
+			return nil
+		case <-time.After(delay):
+		}
+
+		if err := a.flush(ctx); err != nil {
+			delay = min(delay*2, maxArchiveBackoff)
+
+			log.Error(err, "Failed to write the compliance events to the archive, will retry", "retryAfter", delay)
+
+			continue
+		}
+
+		delay = interval
+	}
+}
+
+// archiveEntries returns the archive entries for the compliance events of a policy template. The compliance is
+// read from the event annotations when available.
+func (r *PolicyReconciler) archiveEntries(
+	instance *policiesv1.Policy, tName string, events []policiesv1.ComplianceHistory,
+	eventDetails map[string]utils.ComplianceDetails,
+) []ArchiveEntry {
+	entries := make([]ArchiveEntry, 0, len(events))
+
+	for _, event := range events {
+		details, ok := eventDetails[event.EventName]
+		if !ok {
+			details = utils.ComplianceDetailsFromMessage(event.Message)
+		}
+
+		timestamp := event.LastTimestamp.Time
+		if ts, err := parseTimestampFromEventName(event.EventName); err == nil {
+			timestamp = ts.Time
+		}
+
+		entries = append(entries, ArchiveEntry{
+			EventName:       event.EventName,
+			Timestamp:       timestamp.UTC(),
+			Cluster:         r.ClusterNamespaceOnHub,
+			PolicyNamespace: instance.Namespace,
+			Policy:          instance.Name,
+			Template:        tName,
+			Compliance:      details.Compliance,
+			Category:        details.Category,
+			Message:         event.Message,
+		})
+	}
+
+	return entries
+}
+
+// FileArchiveSink appends the entries as JSON lines to a file, such as on a persistent volume. The file is rotated
+// when it exceeds the max size, keeping the max number of rotated files with a numbered suffix, such as
+// `archive.jsonl.1` for the newest.
+type FileArchiveSink struct {
+	Path string
+	// MaxSize is the size in bytes at which the file is rotated. The file isn't rotated when this is 0.
+	MaxSize int64
+	// MaxBackups is the number of rotated files to keep.
+	MaxBackups int
+}
+
+// Load returns the entries in the current file, which are used to avoid archiving the same events again after a
+// restart. A file that doesn't exist yet has no entries.
+func (s *FileArchiveSink) Load() ([]ArchiveEntry, error) {
+	file, err := os.Open(s.Path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer file.Close()
+
+	entries := []ArchiveEntry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+
+	for scanner.Scan() {
+		entry := ArchiveEntry{}
+
+		// A partially written line from a crash is skipped
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil && entry.EventName != "" {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, scanner.Err()
+}
+
+func (s *FileArchiveSink) Write(_ context.Context, entries []ArchiveEntry) error {
+	if err := s.rotate(); err != nil {
+		return fmt.Errorf("failed to rotate the compliance archive file: %w", err)
+	}
+
+	body, err := jsonLines(entries)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(body); err != nil {
+		_ = file.Close()
+
+		return err
+	}
+
+	// The entries are removed from the queue once this returns, so make sure they're on disk
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+
+		return err
+	}
+
+	return file.Close()
+}
+
+// rotate renames the file to the first backup when it's over the max size, shifting the other backups and removing
+// the oldest.
+func (s *FileArchiveSink) rotate() error {
+	if s.MaxSize <= 0 {
+		return nil
+	}
+
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	if info.Size() < s.MaxSize {
+		return nil
+	}
+
+	backup := func(i int) string { return s.Path + "." + strconv.Itoa(i) }
+
+	if err := os.Remove(backup(s.MaxBackups)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	for i := s.MaxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(backup(i), backup(i+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	if s.MaxBackups == 0 {
+		return os.Remove(s.Path)
+	}
+
+	return os.Rename(s.Path, backup(1))
+}
+
+// HTTPArchiveSink sends the entries as JSON lines in the body of a POST request to a URL. Any response other than a
+// 2xx is an error, so that the entries are sent again.
+type HTTPArchiveSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s *HTTPArchiveSink) Write(ctx context.Context, entries []ArchiveEntry) error {
+	body, err := jsonLines(entries)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	httpClient := s.Client
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	// Read the body so that the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1024*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("the compliance archive endpoint responded with %s", resp.Status)
+	}
+
+	return nil
+}
+
+// jsonLines serializes the entries with one JSON object per line.
+func jsonLines(entries []ArchiveEntry) ([]byte, error) {
+	buf := bytes.Buffer{}
+	encoder := json.NewEncoder(&buf)
+
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
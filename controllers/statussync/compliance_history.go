@@ -0,0 +1,130 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package statussync
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+)
+
+const (
+	// historyLengthAnnotation is the annotation on a policy that overrides the number of entries kept in the
+	// compliance history of each of its templates.
+	historyLengthAnnotation = "policy.open-cluster-management.io/compliance-history-length"
+	// historyDedupeWindowAnnotation is the annotation on a policy that overrides how close in time, as a duration such
+	// as `1s`, two compliance events with the same message must be for the older one to be dropped as a duplicate.
+	historyDedupeWindowAnnotation = "policy.open-cluster-management.io/compliance-history-dedupe-window"
+	// historyCollapseRepeatsAnnotation is the annotation on a policy that overrides, with `true` or `false`, whether
+	// consecutive compliance events with the same message are collapsed into one history entry with a repeat count.
+	historyCollapseRepeatsAnnotation = "policy.open-cluster-management.io/compliance-history-collapse-repeats"
+
+	// MaxComplianceHistoryLength is the most entries that can be kept in a template's compliance history, which keeps
+	// the policy status well within the size limit of an object.
+	MaxComplianceHistoryLength = 100
+)
+
+// DefaultComplianceHistoryOptions are the compliance history options used when none are configured.
+var DefaultComplianceHistoryOptions = ComplianceHistoryOptions{Length: 10, DedupeWindow: 5 * time.Microsecond}
+
+// repeatedMsgRegex matches the repeat count that's added to the message of a collapsed history entry.
+var repeatedMsgRegex = regexp.MustCompile(`(?s)^(.*) \(repeated (\d+) times\)$`)
+
+// ComplianceHistoryOptions configures how the compliance history of each policy template is built from the
+// compliance events.
+type ComplianceHistoryOptions struct {
+	// Length is the number of entries kept in the history, from the newest.
+	Length int
+	// DedupeWindow is how close in time two events with the same message must be for the older one to be dropped as
+	// a duplicate. Events are not deduplicated when this is 0.
+	DedupeWindow time.Duration
+	// CollapseRepeats collapses consecutive events with the same message into the newest of them, with the number of
+	// events added to the message, so that a flapping or steady state doesn't push older changes out of the history.
+	CollapseRepeats bool
+}
+
+// Validate returns an error if the options are out of range.
+func (o ComplianceHistoryOptions) Validate() error {
+	if o.Length < 1 || o.Length > MaxComplianceHistoryLength {
+		return fmt.Errorf("the compliance history length must be between 1 and %d: %d", MaxComplianceHistoryLength,
+			o.Length)
+	}
+
+	if o.DedupeWindow < 0 {
+		return fmt.Errorf("the compliance history dedupe window must not be negative: %s", o.DedupeWindow)
+	}
+
+	return nil
+}
+
+// historyOptions returns the compliance history options for the policy, which are the reconciler's options with any
+// overrides from the policy's annotations. An invalid annotation is logged and ignored.
+func (r *PolicyReconciler) historyOptions(pol *policiesv1.Policy, log logr.Logger) ComplianceHistoryOptions {
+	opts := r.ComplianceHistory
+	if opts.Length == 0 {
+		opts = DefaultComplianceHistoryOptions
+	}
+
+	annotations := pol.GetAnnotations()
+
+	if rawLength, ok := annotations[historyLengthAnnotation]; ok {
+		length, err := strconv.Atoi(rawLength)
+		if err == nil && length >= 1 && length <= MaxComplianceHistoryLength {
+			opts.Length = length
+		} else {
+			log.Info("Ignoring an invalid annotation, it must be an integer between 1 and "+
+				strconv.Itoa(MaxComplianceHistoryLength), "annotation", historyLengthAnnotation, "value", rawLength)
+		}
+	}
+
+	if rawWindow, ok := annotations[historyDedupeWindowAnnotation]; ok {
+		window, err := time.ParseDuration(rawWindow)
+		if err == nil && window >= 0 {
+			opts.DedupeWindow = window
+		} else {
+			log.Info("Ignoring an invalid annotation, it must be a duration that isn't negative",
+				"annotation", historyDedupeWindowAnnotation, "value", rawWindow)
+		}
+	}
+
+	if rawCollapse, ok := annotations[historyCollapseRepeatsAnnotation]; ok {
+		collapse, err := strconv.ParseBool(rawCollapse)
+		if err == nil {
+			opts.CollapseRepeats = collapse
+		} else {
+			log.Info("Ignoring an invalid annotation, it must be true or false",
+				"annotation", historyCollapseRepeatsAnnotation, "value", rawCollapse)
+		}
+	}
+
+	return opts
+}
+
+// splitRepeats returns the message of a history entry without the repeat count and the number of events the entry
+// represents, which is 1 when the entry was not collapsed.
+func splitRepeats(message string) (string, int) {
+	match := repeatedMsgRegex.FindStringSubmatch(message)
+	if match == nil {
+		return message, 1
+	}
+
+	count, err := strconv.Atoi(match[2])
+	if err != nil || count < 1 {
+		return message, 1
+	}
+
+	return match[1], count
+}
+
+// withRepeats returns the message of a history entry that represents count events.
+func withRepeats(message string, count int) string {
+	if count <= 1 {
+		return message
+	}
+
+	return fmt.Sprintf("%s (repeated %d times)", message, count)
+}
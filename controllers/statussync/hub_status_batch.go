@@ -0,0 +1,228 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package statussync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// jsonPatchOp is an operation in a JSON patch (RFC 6902).
+type jsonPatchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value,omitempty"`
+}
+
+// hubStatusPatch returns a JSON patch that changes the policy status on the hub from the old status to the new status.
+// Rather than the whole status, only the compliance states and the changed history entries are included, such as the
+// new entries at the start of a template's history and the old entries dropped from the end. The operations use the
+// indexes of the old status, so the resource version of the hub policy that the old status is from is tested first,
+// and the patch fails rather than duplicating or dropping entries when the old status is stale, such as when the cache
+// doesn't have the previous batch yet. Each changed template is also tested to still be at the same index.
+func hubStatusPatch(resourceVersion string, oldStatus, newStatus policiesv1.PolicyStatus) ([]byte, error) {
+	ops := []jsonPatchOp{{Op: "test", Path: "/metadata/resourceVersion", Value: resourceVersion}}
+
+	// The status might not exist on the hub yet, so paths within it can't be used
+	if oldStatus.ComplianceState == "" && len(oldStatus.Details) == 0 {
+		return json.Marshal(append(ops, jsonPatchOp{Op: "add", Path: "/status", Value: newStatus}))
+	}
+
+	ops = appendFieldOps(ops, "/status/compliant", oldStatus.ComplianceState, newStatus.ComplianceState)
+
+	if !sameTemplates(oldStatus.Details, newStatus.Details) {
+		if len(newStatus.Details) == 0 {
+			ops = append(ops, jsonPatchOp{Op: "remove", Path: "/status/details"})
+		} else {
+			ops = append(ops, jsonPatchOp{Op: "add", Path: "/status/details", Value: newStatus.Details})
+		}
+
+		return json.Marshal(ops)
+	}
+
+	for i, newDetails := range newStatus.Details {
+		oldDetails := oldStatus.Details[i]
+		detailsPath := fmt.Sprintf("/status/details/%d", i)
+
+		detailsOps := appendFieldOps(nil, detailsPath+"/compliant", oldDetails.ComplianceState, newDetails.ComplianceState)
+
+		historyOps, err := historyPatchOps(detailsPath+"/history", oldDetails.History, newDetails.History)
+		if err != nil {
+			return nil, err
+		}
+
+		detailsOps = append(detailsOps, historyOps...)
+
+		if len(detailsOps) == 0 {
+			continue
+		}
+
+		ops = append(ops, jsonPatchOp{
+			Op: "test", Path: detailsPath + "/templateMeta/name", Value: newDetails.TemplateMeta.GetName(),
+		})
+		ops = append(ops, detailsOps...)
+	}
+
+	return json.Marshal(ops)
+}
+
+// appendFieldOps appends the operation to change a string field that is omitted when empty.
+func appendFieldOps[T ~string](ops []jsonPatchOp, path string, oldValue T, newValue T) []jsonPatchOp {
+	switch {
+	case oldValue == newValue:
+		return ops
+	case newValue == "":
+		return append(ops, jsonPatchOp{Op: "remove", Path: path})
+	default:
+		return append(ops, jsonPatchOp{Op: "add", Path: path, Value: newValue})
+	}
+}
+
+// sameTemplates returns whether both lists of details are for the same templates in the same order.
+func sameTemplates(oldDetails, newDetails []*policiesv1.DetailsPerTemplate) bool {
+	return slices.EqualFunc(oldDetails, newDetails, func(a, b *policiesv1.DetailsPerTemplate) bool {
+		return a != nil && b != nil &&
+			a.TemplateMeta.GetName() == b.TemplateMeta.GetName() &&
+			a.TemplateMeta.GetNamespace() == b.TemplateMeta.GetNamespace()
+	})
+}
+
+// historyPatchOps returns the operations to change a template's compliance history, which is ordered from newest to
+// oldest. When the new history is the old history with new entries at the start and the oldest entries dropped, only
+// those entries are added and removed. Otherwise, the whole history is replaced.
+func historyPatchOps(path string, oldHistory, newHistory []policiesv1.ComplianceHistory) ([]jsonPatchOp, error) {
+	// Compare the serialized entries since the timestamps only keep their precision to the second on the API server
+	serialize := func(history []policiesv1.ComplianceHistory) ([]string, error) {
+		serialized := make([]string, 0, len(history))
+
+		for _, entry := range history {
+			rawEntry, err := json.Marshal(entry)
+			if err != nil {
+				return nil, err
+			}
+
+			serialized = append(serialized, string(rawEntry))
+		}
+
+		return serialized, nil
+	}
+
+	oldEntries, err := serialize(oldHistory)
+	if err != nil {
+		return nil, err
+	}
+
+	newEntries, err := serialize(newHistory)
+	if err != nil {
+		return nil, err
+	}
+
+	if slices.Equal(oldEntries, newEntries) {
+		return nil, nil
+	}
+
+	if len(newEntries) == 0 {
+		return []jsonPatchOp{{Op: "remove", Path: path}}, nil
+	}
+
+	// Find the fewest new entries such that the rest of the new history is the start of the old history
+	for added := range len(newEntries) {
+		kept := len(newEntries) - added
+
+		if kept > len(oldEntries) || !slices.Equal(newEntries[added:], oldEntries[:kept]) {
+			continue
+		}
+
+		ops := make([]jsonPatchOp, 0, len(oldEntries)-kept+added)
+
+		// Remove from the end so that the indexes of the remaining entries don't change
+		for i := len(oldEntries) - 1; i >= kept; i-- {
+			ops = append(ops, jsonPatchOp{Op: "remove", Path: fmt.Sprintf("%s/%d", path, i)})
+		}
+
+		for i := range added {
+			ops = append(ops, jsonPatchOp{Op: "add", Path: fmt.Sprintf("%s/%d", path, i), Value: newHistory[i]})
+		}
+
+		return ops, nil
+	}
+
+	return []jsonPatchOp{{Op: "add", Path: path, Value: newHistory}}, nil
+}
+
+// queueHubStatus queues the policy to have its status sent to the hub at the end of the current batch window. A
+// policy queued several times within a window is only sent once, with its latest status.
+func (r *PolicyReconciler) queueHubStatus(namespace string, policyName string) {
+	r.batchLock.Lock()
+	defer r.batchLock.Unlock()
+
+	if r.batch == nil {
+		r.batch = map[string]string{}
+	}
+
+	r.batch[policyName] = namespace
+}
+
+// startHubStatusBatcher sends the status of the queued policies to the hub at the end of each batch window until the
+// context is canceled.
+func (r *PolicyReconciler) startHubStatusBatcher(ctx context.Context) error {
+	ticker := time.NewTicker(r.HubStatusBatchWindow)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			r.flushHubStatusBatch(ctx)
+		}
+	}
+}
+
+// flushHubStatusBatch sends the status of each queued policy to the hub. A policy that fails is queued again for the
+// next batch, or in the outbox if the hub is unreachable.
+func (r *PolicyReconciler) flushHubStatusBatch(ctx context.Context) {
+	log := ctrl.LoggerFrom(ctx).WithName("hub-status-batch")
+
+	r.batchLock.Lock()
+	batch := r.batch
+	r.batch = nil
+	r.batchLock.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	log.V(2).Info("Sending the batch of policy statuses to the hub", "policies", len(batch))
+
+	for policyName, namespace := range batch {
+		policyLog := log.WithValues("policy", policyName)
+
+		err := r.sendHubStatus(ctx, namespace, policyName)
+		if err == nil {
+			if err := r.Outbox.remove(ctx, policyName); err != nil {
+				policyLog.Error(err, "Failed to remove the policy from the hub status outbox")
+			}
+
+			continue
+		}
+
+		if r.Outbox != nil && hubUnreachable(err) {
+			if queueErr := r.Outbox.enqueue(ctx, namespace, policyName); queueErr == nil {
+				policyLog.Info("The hub is unreachable, queued the policy status to be sent when it's reachable")
+
+				continue
+			}
+		}
+
+		policyLog.Error(err, "Failed to send the policy status to the hub, will retry in the next batch")
+
+		r.queueHubStatus(namespace, policyName)
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package statussync
+
+import (
+	"time"
+
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+
+	"open-cluster-management.io/governance-policy-framework-addon/controllers/utils"
+)
+
+// deferredDetails reports in the template details, which are sent to the hub, that the spec-sync deferred the changes
+// from the hub to the policy since the time because of a maintenance window, so that the hub can see that they didn't
+// land yet. The until annotation is only set when it's known when changes are allowed again.
+func deferredDetails(details []*policiesv1.DetailsPerTemplate, since time.Time, until time.Time) {
+	for _, dpt := range details {
+		if dpt.TemplateMeta.Annotations == nil {
+			dpt.TemplateMeta.Annotations = map[string]string{}
+		}
+
+		dpt.TemplateMeta.Annotations[utils.SpecSyncDeferredSinceAnnotation] = since.UTC().Format(time.RFC3339)
+
+		if !until.IsZero() {
+			dpt.TemplateMeta.Annotations[utils.SpecSyncDeferredUntilAnnotation] = until.UTC().Format(time.RFC3339)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package statussync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// OutboxConfigMapName is the name of the ConfigMap in the addon's namespace that persists the policies whose status
+// could not be sent to the hub while it was unreachable.
+const OutboxConfigMapName = "governance-policy-status-outbox"
+
+// defaultOutboxFlushInterval is how often the outbox is flushed while it has entries.
+const defaultOutboxFlushInterval = 15 * time.Second
+
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=create,namespace=open-cluster-management-agent-addon
+//+kubebuilder:rbac:groups=core,resources=configmaps,resourceNames=governance-policy-status-outbox,verbs=get;update
+
+// outboxEntry is a policy in the outbox. Only the time the policy was first queued is stored, since the latest status
+// is read from the policy on the managed cluster when the outbox is flushed.
+type outboxEntry struct {
+	Namespace string           `json:"namespace"`
+	Queued    metav1.MicroTime `json:"queued"`
+	// Owner is the HubStatusOutbox Owner that queued the policy.
+	Owner string `json:"owner,omitempty"`
+}
+
+// HubStatusOutbox is a durable queue of the policies whose status needs to be sent to the hub. Updates are coalesced
+// per policy and flushed in the order the policies were first queued. It's persisted in the OutboxConfigMapName
+// ConfigMap on the managed cluster so that the queue survives restarts.
+type HubStatusOutbox struct {
+	// Client writes the ConfigMap on the managed cluster.
+	Client client.Client
+	// Reader reads the ConfigMap when the outbox is first used. This should not be a cached reader since the
+	// ConfigMap is not in the cache.
+	Reader client.Reader
+	// Namespace is the namespace of the ConfigMap. The outbox is only kept in memory when this is empty, such as when
+	// running locally.
+	Namespace string
+	// FlushInterval is how often the outbox is flushed while it has entries. This defaults to 15 seconds.
+	FlushInterval time.Duration
+	// Owner identifies the entries of this outbox when several deployments that sync different policies, or the
+	// status-sync of several hubs, share the ConfigMap. The entries of other owners are kept as is. Entries without an
+	// owner belong to every outbox of the primary hub.
+	Owner string
+	// HubName is the name of the additional hub that the statuses are sent to, which is the hub label of the outbox
+	// depth metric. It's empty for the primary hub.
+	HubName string
+
+	lock    sync.Mutex
+	entries map[string]outboxEntry
+	// foreign is the raw entries of the other owners by their ConfigMap key.
+	foreign   map[string]string
+	configMap *corev1.ConfigMap
+}
+
+// load reads the entries from the ConfigMap if they haven't been read yet. The lock must be held.
+func (o *HubStatusOutbox) load(ctx context.Context) error {
+	if o.entries != nil {
+		return nil
+	}
+
+	entries := map[string]outboxEntry{}
+	foreign := map[string]string{}
+
+	if o.Namespace != "" {
+		configMap := &corev1.ConfigMap{}
+
+		err := o.Reader.Get(ctx, types.NamespacedName{Namespace: o.Namespace, Name: OutboxConfigMapName}, configMap)
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("failed to read the %s ConfigMap: %w", OutboxConfigMapName, err)
+		}
+
+		if err == nil {
+			o.configMap = configMap
+		}
+
+		for key, rawEntry := range configMap.Data {
+			entry := outboxEntry{}
+
+			if err := json.Unmarshal([]byte(rawEntry), &entry); err != nil {
+				ctrl.LoggerFrom(ctx).Error(err, "Dropping an invalid entry in the hub status outbox", "key", key)
+
+				continue
+			}
+
+			if entry.Owner != o.Owner && (entry.Owner != "" || o.HubName != "") {
+				foreign[key] = rawEntry
+
+				continue
+			}
+
+			if entry.Owner != "" {
+				key = strings.TrimPrefix(key, entry.Owner+"_")
+			}
+
+			entries[key] = entry
+		}
+	}
+
+	o.entries = entries
+	o.foreign = foreign
+	outboxDepthGauge.WithLabelValues(o.HubName).Set(float64(len(o.entries)))
+
+	return nil
+}
+
+// persist writes the entries to the ConfigMap. The lock must be held.
+func (o *HubStatusOutbox) persist(ctx context.Context) error {
+	outboxDepthGauge.WithLabelValues(o.HubName).Set(float64(len(o.entries)))
+
+	if o.Namespace == "" {
+		return nil
+	}
+
+	data := make(map[string]string, len(o.foreign)+len(o.entries))
+	maps.Copy(data, o.foreign)
+
+	for policyName, entry := range o.entries {
+		rawEntry, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		data[outboxKey(entry.Owner, policyName)] = string(rawEntry)
+	}
+
+	if o.configMap == nil {
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: OutboxConfigMapName, Namespace: o.Namespace},
+			Data:       data,
+		}
+
+		if err := o.Client.Create(ctx, configMap); err != nil {
+			// Read the ConfigMap again on the next write in case another outbox created it
+			o.configMap = nil
+			o.entries = nil
+
+			return fmt.Errorf("failed to create the %s ConfigMap: %w", OutboxConfigMapName, err)
+		}
+
+		o.configMap = configMap
+
+		return nil
+	}
+
+	configMap := o.configMap.DeepCopy()
+	configMap.Data = data
+
+	if err := o.Client.Update(ctx, configMap); err != nil {
+		// Read the ConfigMap again on the next write in case it was changed or deleted
+		o.configMap = nil
+		o.entries = nil
+
+		return fmt.Errorf("failed to update the %s ConfigMap: %w", OutboxConfigMapName, err)
+	}
+
+	o.configMap = configMap
+
+	return nil
+}
+
+// outboxKey returns the ConfigMap key of a policy's entry. The owner is added to the key so that the outboxes of
+// different hubs don't overwrite each other's entries for policies with the same name. Neither a policy nor an owner
+// name can have an underscore, so the key is unambiguous.
+func outboxKey(owner string, policyName string) string {
+	if owner == "" {
+		return policyName
+	}
+
+	return owner + "_" + policyName
+}
+
+// enqueue adds the policy to the outbox. If the policy is already queued, it keeps its place in the queue. When another
+// outbox sharing the ConfigMap wrote it first, the ConfigMap is read again and the write is retried once.
+func (o *HubStatusOutbox) enqueue(ctx context.Context, namespace string, policyName string) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	for retried := false; ; retried = true {
+		if err := o.load(ctx); err != nil {
+			return err
+		}
+
+		if _, ok := o.entries[policyName]; ok {
+			return nil
+		}
+
+		o.entries[policyName] = outboxEntry{Namespace: namespace, Queued: metav1.NowMicro(), Owner: o.Owner}
+
+		err := o.persist(ctx)
+		if err == nil {
+			return nil
+		}
+
+		if o.entries != nil {
+			delete(o.entries, policyName)
+		}
+
+		if retried || !(k8serrors.IsAlreadyExists(err) || k8serrors.IsConflict(err)) {
+			return err
+		}
+	}
+}
+
+// remove removes the policy from the outbox if it's queued. It's safe to call on a nil *HubStatusOutbox.
+func (o *HubStatusOutbox) remove(ctx context.Context, policyName string) error {
+	if o == nil {
+		return nil
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if err := o.load(ctx); err != nil {
+		return err
+	}
+
+	if _, ok := o.entries[policyName]; !ok {
+		return nil
+	}
+
+	delete(o.entries, policyName)
+
+	return o.persist(ctx)
+}
+
+// pending returns the names of the queued policies in the order they were first queued and a copy of the entries.
+func (o *HubStatusOutbox) pending(ctx context.Context) ([]string, map[string]outboxEntry, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if err := o.load(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	names := make([]string, 0, len(o.entries))
+	for policyName := range o.entries {
+		names = append(names, policyName)
+	}
+
+	slices.SortFunc(names, func(a, b string) int {
+		if cmp := o.entries[a].Queued.Time.Compare(o.entries[b].Queued.Time); cmp != 0 {
+			return cmp
+		}
+
+		return strings.Compare(a, b)
+	})
+
+	return names, maps.Clone(o.entries), nil
+}
+
+// startOutbox flushes the outbox right away, which sends the status of the policies that were queued before a
+// restart, and then periodically until the context is canceled.
+func (r *PolicyReconciler) startOutbox(ctx context.Context) error {
+	interval := r.Outbox.FlushInterval
+	if interval == 0 {
+		interval = defaultOutboxFlushInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.flushOutbox(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// flushOutbox sends the status of each queued policy to the hub in order. It stops at the first policy that can't be
+// sent because the hub is unreachable so that the order is kept.
+func (r *PolicyReconciler) flushOutbox(ctx context.Context) {
+	log := ctrl.LoggerFrom(ctx).WithName("hub-status-outbox")
+
+	names, entries, err := r.Outbox.pending(ctx)
+	if err != nil {
+		log.Error(err, "Failed to read the hub status outbox")
+
+		return
+	}
+
+	for _, policyName := range names {
+		policyLog := log.WithValues("policy", policyName)
+
+		err := r.sendHubStatus(ctx, entries[policyName].Namespace, policyName)
+		if err != nil {
+			if hubUnreachable(err) {
+				r.reportHubConnectivity(ctx, false)
+				policyLog.V(1).Info("The hub is still unreachable, will retry flushing the hub status outbox")
+
+				return
+			}
+
+			policyLog.Error(err, "Failed to send the policy status to the hub, will retry")
+
+			continue
+		}
+
+		if err := r.Outbox.remove(ctx, policyName); err != nil {
+			policyLog.Error(err, "Failed to remove the policy from the hub status outbox")
+		}
+
+		policyLog.Info("Sent the queued policy status to the hub")
+	}
+}
+
+// sendHubStatus sends the latest status of the policy from the managed cluster to the hub. A policy that no longer
+// exists on either cluster doesn't need to be sent, so no error is returned.
+func (r *PolicyReconciler) sendHubStatus(ctx context.Context, namespace string, policyName string) error {
+	instance := &policiesv1.Policy{}
+
+	err := r.ManagedClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: policyName}, instance)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	hubInstance := &policiesv1.Policy{}
+
+	err = r.HubClient.Get(ctx, types.NamespacedName{Namespace: r.ClusterNamespaceOnHub, Name: policyName}, hubInstance)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	return r.updateHubStatus(ctx, instance, hubInstance)
+}
+
+// hubUnreachable returns whether the error is from the hub API server being unreachable or unavailable, rather than
+// from the request itself.
+func hubUnreachable(err error) bool {
+	var netErr net.Error
+
+	return errors.As(err, &netErr) ||
+		utilnet.IsConnectionRefused(err) ||
+		utilnet.IsConnectionReset(err) ||
+		utilnet.IsProbableEOF(err) ||
+		k8serrors.IsServiceUnavailable(err) ||
+		k8serrors.IsServerTimeout(err) ||
+		k8serrors.IsTimeout(err) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,70 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package statussync
+
+import (
+	"maps"
+	"slices"
+	"time"
+
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+
+	"open-cluster-management.io/governance-policy-framework-addon/api/v1alpha1"
+	"open-cluster-management.io/governance-policy-framework-addon/controllers/utils"
+)
+
+// overrideDetails reports the PolicyOverride of the policy in its template details, which are sent to the hub, so that
+// the hub can see the local deviation. Every template detail is annotated with the override, and the templates of the
+// hub policy that the override disabled get a detail with the disabled annotation, which keeps their last reported
+// compliance but is ignored when aggregating the compliance of the policy.
+func overrideDetails(
+	details []*policiesv1.DetailsPerTemplate,
+	existingDetails []*policiesv1.DetailsPerTemplate,
+	hubInstance *policiesv1.Policy,
+	override *v1alpha1.PolicyOverride,
+) []*policiesv1.DetailsPerTemplate {
+	annotations := map[string]string{utils.PolicyOverrideAnnotation: override.Name}
+
+	if override.Spec.ExpiresAt != nil {
+		annotations[utils.PolicyOverrideExpiresAnnotation] = override.Spec.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+
+	for _, policyT := range hubInstance.Spec.PolicyTemplates {
+		tName := utils.PolicyTemplateName(policyT)
+		if tName == "" || !slices.Contains(override.Spec.DisabledTemplates, tName) {
+			continue
+		}
+
+		disabled := &policiesv1.DetailsPerTemplate{History: []policiesv1.ComplianceHistory{}}
+
+		for _, dpt := range existingDetails {
+			if dpt != nil && dpt.TemplateMeta.Name == tName {
+				copied := *dpt
+				copied.History = slices.Clone(dpt.History)
+				disabled = &copied
+
+				break
+			}
+		}
+
+		disabled.TemplateMeta.Name = tName
+		disabled.TemplateMeta.Annotations = map[string]string{utils.PolicyOverrideDisabledAnnotation: "true"}
+
+		details = append(details, disabled)
+	}
+
+	for _, dpt := range details {
+		if dpt.TemplateMeta.Annotations == nil {
+			dpt.TemplateMeta.Annotations = map[string]string{}
+		}
+
+		maps.Copy(dpt.TemplateMeta.Annotations, annotations)
+	}
+
+	return details
+}
+
+// overrideDisabled returns whether the template detail is for a template that a PolicyOverride disabled.
+func overrideDisabled(dpt *policiesv1.DetailsPerTemplate) bool {
+	return dpt.TemplateMeta.Annotations[utils.PolicyOverrideDisabledAnnotation] == "true"
+}
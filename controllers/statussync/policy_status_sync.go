@@ -12,10 +12,12 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	depclient "github.com/stolostron/kubernetes-dependency-watches/client"
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
@@ -31,9 +33,12 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
+	"open-cluster-management.io/governance-policy-framework-addon/api/v1alpha1"
 	"open-cluster-management.io/governance-policy-framework-addon/controllers/uninstall"
 	"open-cluster-management.io/governance-policy-framework-addon/controllers/utils"
 )
@@ -44,26 +49,62 @@ const (
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *PolicyReconciler) SetupWithManager(mgr ctrl.Manager, additionalSources ...source.Source) error {
-	builder := ctrl.NewControllerManagedBy(mgr).
-		For(&policiesv1.Policy{}).
+	controllerName := utils.HubScopedName(ControllerName, r.HubName)
+
+	// The managed cluster cache has the replicated policies from every hub, so only handle those from this hub
+	inClusterNamespace := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return r.ClusterNamespace == "" || obj.GetNamespace() == r.ClusterNamespace
+	})
+
+	ctrlBuilder := ctrl.NewControllerManagedBy(mgr).
+		For(&policiesv1.Policy{}, builder.WithPredicates(inClusterNamespace, r.Selector.Predicate())).
 		Watches(
 			&corev1.Event{},
 			handler.EnqueueRequestsFromMapFunc(eventMapper),
-			builder.WithPredicates(eventPredicateFuncs),
+			builder.WithPredicates(inClusterNamespace, eventPredicateFuncs),
 		).
 		WithOptions(controller.Options{MaxConcurrentReconciles: r.ConcurrentReconciles}).
-		Named(ControllerName).
+		Named(controllerName).
 		WithLogConstructor(func(req *reconcile.Request) logr.Logger {
-			return utils.LogConstructor(ControllerName, "Policy", req)
+			return utils.LogConstructor(controllerName, "Policy", req)
 		})
 
+	// A PolicyOverride has the same name and namespace as its policy, so a change to it is handled like a change to the
+	// policy, which triggers the spec-sync when the replicated policy no longer matches
+	if r.PolicyOverrides {
+		ctrlBuilder = ctrlBuilder.Watches(
+			&v1alpha1.PolicyOverride{}, &handler.EnqueueRequestForObject{}, builder.WithPredicates(inClusterNamespace),
+		)
+	}
+
 	for _, addlSource := range additionalSources {
 		if addlSource != nil {
-			builder = builder.WatchesRawSource(addlSource)
+			ctrlBuilder = ctrlBuilder.WatchesRawSource(addlSource)
 		}
 	}
 
-	return builder.Complete(r)
+	if r.HubStatusBatchWindow > 0 {
+		if err := mgr.Add(manager.RunnableFunc(r.startHubStatusBatcher)); err != nil {
+			return err
+		}
+	}
+
+	if r.Archive != nil {
+		if err := mgr.Add(manager.RunnableFunc(r.Archive.Start)); err != nil {
+			return err
+		}
+	}
+
+	if r.Outbox != nil {
+		// This only runs on the leader since the outbox is only written by reconciles
+		if err := mgr.Add(manager.RunnableFunc(r.startOutbox)); err != nil {
+			return err
+		}
+	}
+
+	return ctrlBuilder.Complete(utils.TraceReconciler(
+		controllerName, r.ManagedClient, func() client.Object { return &policiesv1.Policy{} }, r,
+	))
 }
 
 // blank assignment to verify that ReconcilePolicy implements reconcile.Reconciler
@@ -80,14 +121,54 @@ type PolicyReconciler struct {
 	DynamicWatcher        depclient.DynamicWatcher
 	Scheme                *runtime.Scheme
 	ClusterNamespaceOnHub string
-	ConcurrentReconciles  int
-	SpecSyncRequests      chan<- event.GenericEvent
-	OnMulticlusterhub     bool
+	// ClusterNamespace is the namespace on the managed cluster of the policies replicated from this reconciler's hub.
+	// Policies in every namespace in the cache are handled when it's empty.
+	ClusterNamespace     string
+	ConcurrentReconciles int
+	// HubName is the name of the additional hub that the status is sent to, which is added to the controller name and
+	// the metrics. It's empty for the primary hub.
+	HubName           string
+	SpecSyncRequests  chan<- event.GenericEvent
+	OnMulticlusterhub bool
+	// Outbox queues the policy statuses that couldn't be sent to the hub because it was unreachable. The status is only
+	// retried with the requeue backoff when this is nil.
+	Outbox *HubStatusOutbox
+	// HubStatusBatchWindow is how long policy statuses are batched for before they're sent to the hub. Within a
+	// window, each policy is only sent once with its latest status, and as a JSON patch of what changed rather than a
+	// full update. Statuses are sent right away when this is 0.
+	HubStatusBatchWindow time.Duration
+	// HubStatusRateLimiter limits the rate of policy status writes to the hub, separately from the client's rate
+	// limit. The rate isn't limited when this is nil.
+	HubStatusRateLimiter *rate.Limiter
+	// Archive writes every compliance event to a durable sink for an audit trail beyond the compliance history. Events
+	// are not archived when this is nil.
+	Archive *ComplianceArchive
+	// ComplianceHistory configures the compliance history of each template, which can be overridden per policy with
+	// annotations. DefaultComplianceHistoryOptions is used when the length is 0.
+	ComplianceHistory ComplianceHistoryOptions
+	// Selector selects the policies that this deployment syncs. The status of the other policies is left to the
+	// deployments that select them. Every policy is synced when it's nil.
+	Selector *utils.PolicySelector
+	// PolicyOverrides enables the PolicyOverride resources on the managed cluster. A replicated policy matches the hub
+	// when it matches the hub policy with its override applied, and the override is reported in the status details.
+	PolicyOverrides bool
+	// MaintenanceWindows knows which replicated policies the spec-sync deferred changes to from the deferred ConfigMap,
+	// which is reported in the status details. Nothing is deferred when it's nil.
+	MaintenanceWindows *utils.MaintenanceWindows
+	// HubConnectivity tracks the requests to the hub, which the policy_status_sync_hub_connected gauge is set from so
+	// that it agrees with the hub-connectivity readiness check. When it's nil, the gauge is whether the last status
+	// update reached the hub.
+	HubConnectivity *utils.HubConnectivity
+
+	batchLock sync.Mutex
+	// batch maps the name of each policy queued to be sent to the hub to its namespace.
+	batch map[string]string
 }
 
 //+kubebuilder:rbac:groups=policy.open-cluster-management.io,resources=policies,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=policy.open-cluster-management.io,resources=policies/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=policy.open-cluster-management.io,resources=policies/finalizers,verbs=update
+//+kubebuilder:rbac:groups=policy.open-cluster-management.io,resources=policyoverrides,verbs=get;list;watch
 //+kubebuilder:rbac:groups=core;events.k8s.io,resources=events,verbs=get;list;watch;create;update;patch;delete
 // This is required for the status lease for the addon framework
 //+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list
@@ -125,7 +206,18 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 		}
 	}()
 
-	instance, hubInstance, err := r.getInstances(ctx, request)
+	var override *v1alpha1.PolicyOverride
+
+	if r.PolicyOverrides && !r.OnMulticlusterhub {
+		override, err = utils.GetPolicyOverride(ctx, r.ManagedClient, request.Namespace, request.Name)
+		if err != nil {
+			reqLogger.Error(err, "Failed to get the policy override, will requeue the request")
+
+			return reconcile.Result{}, err
+		}
+	}
+
+	instance, hubInstance, err := r.getInstances(ctx, request, override)
 	if err != nil || instance == nil || (!r.OnMulticlusterhub && hubInstance == nil) {
 		return reconcile.Result{}, err
 	}
@@ -139,6 +231,15 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 		return reconcile.Result{}, err
 	}
 
+	if override != nil {
+		instance.Status.Details = overrideDetails(instance.Status.Details, oldStatus.Details, hubInstance, override)
+	}
+
+	if since, deferred := r.MaintenanceWindows.Deferred(request.Namespace, request.Name); deferred {
+		_, until := r.MaintenanceWindows.Frozen(time.Now())
+		deferredDetails(instance.Status.Details, since, until)
+	}
+
 	err = r.updateStatuses(ctx, instance, hubInstance, oldStatus)
 	if err != nil {
 		return reconcile.Result{}, err
@@ -146,14 +247,16 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 
 	reqLogger.V(1).Info("Reconciling complete")
 
-	return reconcile.Result{}, nil
+	// Reconcile again when the override expires so that it's no longer reported
+	return reconcile.Result{RequeueAfter: utils.PolicyOverrideRequeue(override)}, nil
 }
 
 // getInstances retrieves both the managed cluster and hub cluster instances of
 // a Policy. It handles Policy deletion, missing Policies, and Policy mismatches
-// by triggering spec synchronization when inconsistencies are detected.
+// by triggering spec synchronization when inconsistencies are detected. The
+// managed policy is expected to match the hub policy with the override applied.
 func (r *PolicyReconciler) getInstances(
-	ctx context.Context, request reconcile.Request,
+	ctx context.Context, request reconcile.Request, override *v1alpha1.PolicyOverride,
 ) (managedInstance, hubInstance *policiesv1.Policy, err error) {
 	reqLogger := ctrl.LoggerFrom(ctx).WithValues("HubNamespace", r.ClusterNamespaceOnHub)
 	managedInstance = &policiesv1.Policy{}
@@ -161,6 +264,8 @@ func (r *PolicyReconciler) getInstances(
 	err = r.ManagedClient.Get(ctx, request.NamespacedName, managedInstance)
 	if err != nil {
 		if k8serrors.IsNotFound(err) {
+			deleteComplianceMetrics(request.Namespace, request.Name)
+
 			if r.OnMulticlusterhub {
 				return nil, nil, nil
 			}
@@ -184,6 +289,18 @@ func (r *PolicyReconciler) getInstances(
 				return nil, nil, err
 			}
 
+			if !r.Selector.Matches(hubInstance) {
+				reqLogger.V(1).Info("Policy is not selected by this deployment, skipping it")
+
+				return nil, nil, nil
+			}
+
+			if _, deferred := r.MaintenanceWindows.Deferred(request.Namespace, request.Name); deferred {
+				reqLogger.V(1).Info("Policy is missing on the managed cluster because its creation was deferred")
+
+				return nil, nil, nil
+			}
+
 			if r.SpecSyncRequests != nil {
 				reqLogger.Info("Policy is missing on the managed cluster. Triggering the spec-sync to recreate it.")
 
@@ -198,6 +315,13 @@ func (r *PolicyReconciler) getInstances(
 		return nil, nil, err
 	}
 
+	// Another deployment syncs this policy, so a mismatch with the hub must not trigger the spec-sync
+	if !r.Selector.Matches(managedInstance) {
+		reqLogger.V(1).Info("Policy is not selected by this deployment, skipping it")
+
+		return nil, nil, nil
+	}
+
 	if r.OnMulticlusterhub {
 		return managedInstance, nil, nil
 	}
@@ -224,7 +348,14 @@ func (r *PolicyReconciler) getInstances(
 		return nil, nil, err
 	}
 
-	if !utils.EquivalentReplicatedPolicies(managedInstance, hubInstance) {
+	if !utils.EquivalentReplicatedPolicies(managedInstance, utils.ApplyPolicyOverride(hubInstance, override)) {
+		// The spec-sync deferred the changes from the hub, so the status is still sent with the deferral reported
+		if _, deferred := r.MaintenanceWindows.Deferred(request.Namespace, request.Name); deferred {
+			reqLogger.V(1).Info("Policy mismatch with the hub is deferred by a maintenance window")
+
+			return managedInstance, hubInstance, nil
+		}
+
 		if r.SpecSyncRequests != nil {
 			reqLogger.Info("Found a mismatch with the hub and managed policies. Triggering the spec-sync to handle it.")
 
@@ -240,19 +371,35 @@ func (r *PolicyReconciler) getInstances(
 // getEventsInCluster retrieves and filters compliance events for a policy from
 // the managed cluster, organizing them by template name. If an event name has
 // the conventional hexadecimal timestamp suffix, that will be used for a
-// higher-precision timestamp in the returned history.
+// higher-precision timestamp in the returned history. The compliance details
+// from the annotations of the events that have them are also returned, by
+// event name.
 func (r *PolicyReconciler) getEventsInCluster(
 	ctx context.Context, instance *policiesv1.Policy,
-) (map[string][]policiesv1.ComplianceHistory, error) {
+) (map[string][]policiesv1.ComplianceHistory, map[string]utils.ComplianceDetails, error) {
 	eventList := &corev1.EventList{}
 
 	err := r.ManagedClient.List(ctx, eventList, client.InNamespace(instance.GetNamespace()))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// filter events to current policy instance and build map
 	eventForPolicyMap := make(map[string][]policiesv1.ComplianceHistory)
+	eventDetails := map[string]utils.ComplianceDetails{}
+	// events already in the status were linked to the trace of an earlier reconcile
+	existingEvents := map[string]bool{}
+
+	for _, dpt := range instance.Status.Details {
+		if dpt == nil {
+			continue
+		}
+
+		for _, history := range dpt.History {
+			existingEvents[history.EventName] = true
+		}
+	}
+
 	rgx := regexp.MustCompile(`(?i)^policy:\s*(?:([a-z0-9.-]+)\s*\/)?(.+)`)
 
 	for _, event := range eventList.Items {
@@ -271,10 +418,18 @@ func (r *PolicyReconciler) getEventsInCluster(
 			}
 
 			eventForPolicyMap[templateName] = append(eventForPolicyMap[templateName], histEvent)
+
+			if details, ok := utils.ComplianceDetailsFromAnnotations(event.GetAnnotations()); ok {
+				eventDetails[event.GetName()] = details
+			}
+
+			if !existingEvents[event.GetName()] {
+				utils.LinkTraceContext(ctx, event.GetAnnotations())
+			}
 		}
 	}
 
-	return eventForPolicyMap, nil
+	return eventForPolicyMap, eventDetails, nil
 }
 
 // getEventsInTemplate retrieves compliance history events from a template's
@@ -352,14 +507,14 @@ func templateOwnedByPolicy(obj *unstructured.Unstructured, policyName string) bo
 
 // getDetails collects and processes compliance events for each policy template,
 // building a history of compliance states and deduplicating similar events.
-// It limits history to 10 events per template, sorts by timestamp (most recent
+// It limits the history length per template, sorts by timestamp (most recent
 // first), and returns detailed status information for status synchronization.
 func (r *PolicyReconciler) getDetails(
 	ctx context.Context, instance *policiesv1.Policy,
 ) (allDetails []*policiesv1.DetailsPerTemplate, err error) {
 	reqLogger := ctrl.LoggerFrom(ctx).WithValues("HubNamespace", r.ClusterNamespaceOnHub)
 
-	eventForPolicyMap, err := r.getEventsInCluster(ctx, instance)
+	eventForPolicyMap, eventDetails, err := r.getEventsInCluster(ctx, instance)
 	if err != nil {
 		reqLogger.Error(err, "Error listing events, will requeue the request")
 
@@ -367,6 +522,7 @@ func (r *PolicyReconciler) getDetails(
 	}
 
 	policyObjID := policyID(instance.Name, instance.Namespace)
+	historyOpts := r.historyOptions(instance, reqLogger)
 
 	for i, policyT := range instance.Spec.PolicyTemplates {
 		var tName string
@@ -415,8 +571,19 @@ func (r *PolicyReconciler) getDetails(
 			}
 		}
 
+		if r.Archive != nil {
+			r.Archive.add(r.archiveEntries(instance, tName, eventForPolicyMap[tName], eventDetails)...)
+		}
+
 		detailLogger := reqLogger.WithValues("TemplateName", tName, "TemplateIdx", i)
-		templateDetails := mergeDetails(eventForPolicyMap[tName], existingDPTs, tName, detailLogger)
+		templateDetails := mergeDetails(eventForPolicyMap[tName], existingDPTs, tName, historyOpts, detailLogger)
+
+		// Prefer the compliance from the annotations of the latest event over the compliance parsed from its message
+		if len(templateDetails.History) > 0 {
+			if details, ok := eventDetails[templateDetails.History[0].EventName]; ok {
+				templateDetails.ComplianceState = details.Compliance
+			}
+		}
 
 		allDetails = append(allDetails, templateDetails)
 
@@ -427,13 +594,14 @@ func (r *PolicyReconciler) getDetails(
 }
 
 // mergeDetails combines new compliance events with existing template status
-// details, deduplicating events, sorting by timestamp, limiting history to 10
-// events, and determining the compliance state from the most recent event. It
+// details, deduplicating events, sorting by timestamp, limiting the history
+// length, and determining the compliance state from the most recent event. It
 // preserves existing status details when available.
 func mergeDetails(
 	events []policiesv1.ComplianceHistory,
 	existingDPTs []*policiesv1.DetailsPerTemplate,
 	tName string,
+	opts ComplianceHistoryOptions,
 	detailLogger logr.Logger,
 ) (details *policiesv1.DetailsPerTemplate) {
 	details = &policiesv1.DetailsPerTemplate{
@@ -454,14 +622,22 @@ func mergeDetails(
 		}
 	}
 
+	inHistory := make(map[string]bool, len(details.History))
+
 	// Add old events if they were not found in cluster events or the template status
 	for _, oldEvent := range details.History {
+		inHistory[oldEvent.EventName] = true
 		found := false
 
-		for _, foundEvent := range events {
+		for i, foundEvent := range events {
 			if foundEvent.EventName == oldEvent.EventName {
 				found = true
 
+				// Keep the repeat count of a collapsed entry
+				if msg, _ := splitRepeats(oldEvent.Message); opts.CollapseRepeats && msg == foundEvent.Message {
+					events[i].Message = oldEvent.Message
+				}
+
 				break
 			}
 		}
@@ -484,28 +660,63 @@ func mergeDetails(
 		return -1 * a.LastTimestamp.Compare(b.LastTimestamp.Time)
 	})
 
+	if opts.CollapseRepeats {
+		// The events older than the newest history entry that aren't in the history were already collapsed into an
+		// entry, or dropped, so they must not be counted again.
+		newestIdx := slices.IndexFunc(events, func(event policiesv1.ComplianceHistory) bool {
+			return inHistory[event.EventName]
+		})
+
+		if newestIdx != -1 {
+			newest := events[newestIdx].LastTimestamp
+
+			events = slices.DeleteFunc(events, func(event policiesv1.ComplianceHistory) bool {
+				return !inHistory[event.EventName] && !event.LastTimestamp.After(newest.Time)
+			})
+		}
+	}
+
 	dedupedHistory := []policiesv1.ComplianceHistory{}
 
+	// The repeat count is only part of the message when repeats are collapsed
+	baseMessage := func(message string) (string, int) {
+		if !opts.CollapseRepeats {
+			return message, 1
+		}
+
+		return splitRepeats(message)
+	}
+
 	for i, event := range events {
-		// The most recent event is always saved.
-		if i == 0 {
-			dedupedHistory = append(dedupedHistory, event)
+		msg, count := baseMessage(event.Message)
 
-			continue
-		}
+		if i > 0 {
+			prevMsg, _ := baseMessage(events[i-1].Message)
 
-		// limit total length to 10
-		if len(dedupedHistory) == 10 {
-			break
+			// Events with the same message and very close timestamps should not be saved.
+			tooSimilar := timestampsWithin(event.LastTimestamp, events[i-1].LastTimestamp, opts.DedupeWindow) &&
+				msg == prevMsg
+
+			if tooSimilar {
+				continue
+			}
 		}
 
-		// Events with the same message and very close timestamps should not be saved.
-		tooSimilar := timestampsWithin(event.LastTimestamp, events[i-1].LastTimestamp, 5*time.Microsecond) &&
-			event.Message == events[i-1].Message
+		if opts.CollapseRepeats && len(dedupedHistory) > 0 {
+			latest := &dedupedHistory[len(dedupedHistory)-1]
+
+			if latestMsg, latestCount := baseMessage(latest.Message); latestMsg == msg {
+				latest.Message = withRepeats(msg, latestCount+count)
 
-		if !tooSimilar {
-			dedupedHistory = append(dedupedHistory, event)
+				continue
+			}
 		}
+
+		if len(dedupedHistory) == opts.Length {
+			break
+		}
+
+		dedupedHistory = append(dedupedHistory, event)
 	}
 
 	details.History = dedupedHistory
@@ -541,38 +752,21 @@ func (r *PolicyReconciler) updateStatuses(
 ) (err error) {
 	reqLogger := ctrl.LoggerFrom(ctx).WithValues("HubNamespace", r.ClusterNamespaceOnHub)
 
-	// one violation found in status of one template, set overall compliancy to NonCompliant
-	isCompliant := true
-
-Loop:
-	for _, dpt := range instance.Status.Details {
-		switch dpt.ComplianceState {
-		case policiesv1.NonCompliant:
-			instance.Status.ComplianceState = policiesv1.NonCompliant
-			isCompliant = false
-
-			break Loop
-		case policiesv1.Pending:
-			instance.Status.ComplianceState = policiesv1.Pending
-			isCompliant = false
-		case policiesv1.Compliant: // Continue if the status is compliant, no need to update the compliance state
-			continue Loop
-		case "":
-			isCompliant = false
-		}
+	// The compliance is only kept as is when some templates don't have a compliance state yet
+	aggregation := aggregateCompliance(instance, reqLogger)
+	if aggregation.compliance != "" {
+		instance.Status.ComplianceState = aggregation.compliance
 	}
 
-	// set to compliant only when all templates are compliant
-	if isCompliant {
-		instance.Status.ComplianceState = policiesv1.Compliant
-	}
+	// Set the metrics before updating the hub so that they're accurate even when the hub is unreachable
+	setComplianceMetrics(instance)
 
 	// Update status on managed cluster if needed.
 	match := equality.Semantic.DeepEqual(instance.Status.Details, oldStatus.Details) &&
 		instance.Status.ComplianceState == oldStatus.ComplianceState
 
 	if !match {
-		reqLogger.Info("status mismatch on managed, update it")
+		reqLogger.Info("status mismatch on managed, update it", "complianceReason", aggregation.reason)
 
 		err = r.ManagedClient.Status().Update(ctx, instance)
 		if err != nil {
@@ -582,44 +776,117 @@ Loop:
 		}
 
 		r.ManagedRecorder.Eventf(instance, nil, corev1.EventTypeNormal, "PolicyStatusSync", "PolicyStatusSync",
-			fmt.Sprintf("Policy %s status was updated in cluster namespace %s", instance.GetName(),
-				instance.GetNamespace()))
+			fmt.Sprintf("Policy %s status was updated to %s in cluster namespace %s (%s)",
+				instance.GetName(), instance.Status.ComplianceState, instance.GetNamespace(), aggregation.reason))
 	} else {
 		reqLogger.V(1).Info("status match on managed, nothing to update")
 	}
 
-	if !r.OnMulticlusterhub {
-		// Re-fetch the hub template in case it changed
-		nn := types.NamespacedName{Namespace: r.ClusterNamespaceOnHub, Name: instance.Name}
-		updatedHubInstance := &policiesv1.Policy{}
+	if r.OnMulticlusterhub {
+		return nil
+	}
 
-		err = r.HubClient.Get(ctx, nn, updatedHubInstance)
-		if err != nil {
-			reqLogger.Error(err, "Failed to refresh the cached policy. Will use existing policy.")
-		} else {
-			hubInstance = updatedHubInstance
+	if r.HubStatusBatchWindow > 0 {
+		r.queueHubStatus(instance.Namespace, instance.Name)
+
+		return nil
+	}
+
+	err = r.updateHubStatus(ctx, instance, hubInstance)
+	if err != nil {
+		if r.Outbox == nil || !hubUnreachable(err) {
+			return err
 		}
 
-		if !equality.Semantic.DeepEqual(hubInstance.Status, instance.Status) {
-			reqLogger.Info("status not in sync, update the hub")
+		// Rather than relying on the requeue backoff, which can grow long enough to leave the hub with a stale
+		// status well after it's reachable again, queue the policy to be sent as soon as the hub is reachable.
+		if queueErr := r.Outbox.enqueue(ctx, instance.Namespace, instance.Name); queueErr != nil {
+			reqLogger.Error(queueErr, "Failed to queue the policy status for the hub")
+
+			return err
+		}
 
-			hubInstance.Status = instance.Status
+		reqLogger.Info("The hub is unreachable, queued the policy status to be sent when it's reachable")
 
-			err = r.HubClient.Status().Update(ctx, hubInstance)
-			if err != nil {
-				reqLogger.Error(err, "Failed to update policy status on hub")
+		return nil
+	}
 
-				return err
-			}
+	// The hub now has the latest status, so a queued update is no longer needed
+	if err := r.Outbox.remove(ctx, instance.Name); err != nil {
+		reqLogger.Error(err, "Failed to remove the policy from the hub status outbox")
+	}
 
-			r.HubRecorder.Eventf(hubInstance, nil, corev1.EventTypeNormal, "PolicyStatusSync", "PolicyStatusSync",
-				fmt.Sprintf("Policy %s status was updated to %s in cluster namespace %s", hubInstance.GetName(),
-					hubInstance.Status.ComplianceState, hubInstance.GetNamespace()))
-		} else {
-			reqLogger.V(1).Info("status match on hub, nothing to update")
+	return nil
+}
+
+// updateHubStatus updates the status of the policy on the hub to match the status on the managed cluster if they
+// differ. The hub connectivity metric is set based on the result.
+func (r *PolicyReconciler) updateHubStatus(ctx context.Context, instance, hubInstance *policiesv1.Policy) error {
+	reqLogger := ctrl.LoggerFrom(ctx).WithValues("HubNamespace", r.ClusterNamespaceOnHub)
+
+	// Re-fetch the hub template in case it changed
+	nn := types.NamespacedName{Namespace: r.ClusterNamespaceOnHub, Name: instance.Name}
+	updatedHubInstance := &policiesv1.Policy{}
+
+	err := r.HubClient.Get(ctx, nn, updatedHubInstance)
+	if err != nil {
+		reqLogger.Error(err, "Failed to refresh the cached policy. Will use existing policy.")
+	} else {
+		hubInstance = updatedHubInstance
+	}
+
+	if equality.Semantic.DeepEqual(hubInstance.Status, instance.Status) {
+		reqLogger.V(1).Info("status match on hub, nothing to update")
+
+		return nil
+	}
+
+	reqLogger.Info("status not in sync, update the hub")
+
+	oldHubStatus := hubInstance.Status
+	hubInstance.Status = instance.Status
+
+	if r.HubStatusRateLimiter != nil {
+		if err := r.HubStatusRateLimiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	if r.HubStatusBatchWindow > 0 {
+		var patch []byte
+
+		patch, err = hubStatusPatch(hubInstance.ResourceVersion, oldHubStatus, instance.Status)
+		if err != nil {
+			return err
+		}
+
+		err = r.HubClient.Status().Patch(ctx, hubInstance, client.RawPatch(types.JSONPatchType, patch))
+	} else {
+		err = r.HubClient.Status().Update(ctx, hubInstance)
+	}
+
+	if err != nil {
+		reqLogger.Error(err, "Failed to update policy status on hub")
+
+		if hubUnreachable(err) {
+			r.reportHubConnectivity(ctx, false)
 		}
+
+		return err
 	}
 
+	r.reportHubConnectivity(ctx, true)
+	observeStatusSyncLag(
+		utils.HubScopedName(ControllerName, r.HubName), instance.Namespace, instance.Name, oldHubStatus, instance.Status,
+	)
+
+	// An invalid aggregation annotation was already logged when the compliance was aggregated
+	reason := aggregateCompliance(instance, logr.Discard()).reason
+
+	r.HubRecorder.Eventf(hubInstance, nil, corev1.EventTypeNormal, "PolicyStatusSync", "PolicyStatusSync",
+		fmt.Sprintf("Policy %s status was updated to %s in cluster namespace %s (%s)", hubInstance.GetName(),
+			hubInstance.Status.ComplianceState, hubInstance.GetNamespace(), reason))
+
 	return nil
 }
 
@@ -647,20 +914,10 @@ func parseTimestampFromEventName(eventName string) (metav1.Time, error) {
 	return metav1.Unix(0, nanos), nil
 }
 
+// parseComplianceFromMessage returns the compliance state from the start of a compliance event message. This is the
+// fallback for history entries whose event has no compliance annotation or no longer exists.
 func parseComplianceFromMessage(message string) policiesv1.ComplianceState {
-	cleanMsg := strings.ToLower(
-		strings.TrimSpace(
-			strings.TrimPrefix(message, "(combined from similar events):"),
-		),
-	)
-
-	if strings.HasPrefix(cleanMsg, "compliant") {
-		return policiesv1.Compliant
-	} else if strings.HasPrefix(cleanMsg, "pending") {
-		return policiesv1.Pending
-	}
-
-	return policiesv1.NonCompliant
+	return utils.ComplianceDetailsFromMessage(message).Compliance
 }
 
 type templateHistoryEvent struct {
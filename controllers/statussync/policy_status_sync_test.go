@@ -2,14 +2,37 @@
 package statussync
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"syscall"
 	"testing"
 	"time"
 
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
+	"open-cluster-management.io/governance-policy-framework-addon/api/v1alpha1"
 	"open-cluster-management.io/governance-policy-framework-addon/controllers/utils"
 )
 
@@ -200,3 +223,1137 @@ func TestGetEventsInTemplate(t *testing.T) {
 		})
 	}
 }
+
+func TestSetComplianceMetrics(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Truncate(time.Second)
+
+	policy := &policiesv1.Policy{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-metrics.policy", Namespace: "managed"},
+		Status: policiesv1.PolicyStatus{
+			ComplianceState: policiesv1.NonCompliant,
+			Details: []*policiesv1.DetailsPerTemplate{
+				{
+					TemplateMeta:    metav1.ObjectMeta{Name: "config"},
+					ComplianceState: policiesv1.NonCompliant,
+					History: []policiesv1.ComplianceHistory{
+						{LastTimestamp: metav1.NewTime(now), Message: "NonCompliant; violation - missing"},
+						{LastTimestamp: metav1.NewTime(now.Add(-time.Hour)), Message: "NonCompliant; violation - bad"},
+						{LastTimestamp: metav1.NewTime(now.Add(-2 * time.Hour)), Message: "Compliant; notification"},
+					},
+				},
+			},
+		},
+	}
+
+	// The same policy from another hub is in the namespace of that hub
+	otherHubPolicy := policy.DeepCopy()
+	otherHubPolicy.Namespace = "managed-2"
+	otherHubPolicy.Status.ComplianceState = policiesv1.Compliant
+	otherHubPolicy.Status.Details[0].ComplianceState = policiesv1.Compliant
+
+	setComplianceMetrics(policy)
+	setComplianceMetrics(otherHubPolicy)
+
+	gaugeValue := func(gauge *prometheus.GaugeVec, labels ...string) float64 {
+		metric := &dto.Metric{}
+
+		if err := gauge.WithLabelValues(labels...).Write(metric); err != nil {
+			t.Fatalf("Failed to read the metric: %v", err)
+		}
+
+		return metric.GetGauge().GetValue()
+	}
+
+	if gaugeValue(policyComplianceGauge, policy.Name, policy.Namespace, "NonCompliant") != 1 ||
+		gaugeValue(policyComplianceGauge, policy.Name, policy.Namespace, "Compliant") != 0 {
+		t.Fatal("Expected the policy to only be NonCompliant")
+	}
+
+	if gaugeValue(templateComplianceGauge, policy.Name, policy.Namespace, "config", "NonCompliant") != 1 {
+		t.Fatal("Expected the template to be NonCompliant")
+	}
+
+	if gaugeValue(templateHistoryLengthGauge, policy.Name, policy.Namespace, "config") != 3 {
+		t.Fatal("Expected the template history length to be 3")
+	}
+
+	expectedChange := float64(now.Add(-time.Hour).Unix())
+
+	actual := gaugeValue(templateComplianceChangeGauge, policy.Name, policy.Namespace, "config")
+	if actual != expectedChange {
+		t.Fatalf("Expected the last change timestamp to be %v, got %v", expectedChange, actual)
+	}
+
+	if gaugeValue(policyComplianceGauge, policy.Name, otherHubPolicy.Namespace, "Compliant") != 1 ||
+		gaugeValue(templateComplianceGauge, policy.Name, otherHubPolicy.Namespace, "config", "Compliant") != 1 {
+		t.Fatal("Expected the policy from the other hub to be Compliant")
+	}
+
+	deleteComplianceMetrics(policy.Namespace, policy.Name)
+
+	labels := prometheus.Labels{"policy": policy.Name, "namespace": policy.Namespace}
+	if deleted := templateComplianceGauge.DeletePartialMatch(labels); deleted != 0 {
+		t.Fatalf("Expected the template metrics to already be deleted, but %d were found", deleted)
+	}
+
+	otherHubLabels := prometheus.Labels{"policy": policy.Name, "namespace": otherHubPolicy.Namespace}
+	if deleted := templateComplianceGauge.DeletePartialMatch(otherHubLabels); deleted != 3 {
+		t.Fatalf("Expected the template metrics of the policy from the other hub to be kept, but %d were found", deleted)
+	}
+}
+
+func TestObserveStatusSyncLag(t *testing.T) {
+	t.Parallel()
+
+	sent := time.Now().Add(-time.Minute)
+	policyName := "test-lag.policy"
+
+	oldStatus := policiesv1.PolicyStatus{
+		Details: []*policiesv1.DetailsPerTemplate{
+			{History: []policiesv1.ComplianceHistory{{EventName: "test-lag.policy.1", Message: "Compliant; old"}}},
+		},
+	}
+	newStatus := policiesv1.PolicyStatus{
+		Details: []*policiesv1.DetailsPerTemplate{
+			{
+				History: []policiesv1.ComplianceHistory{
+					{
+						EventName: fmt.Sprintf("test-lag.policy.%x", sent.UnixNano()),
+						Message:   "NonCompliant; new",
+					},
+					{EventName: "test-lag.policy.1", Message: "Compliant; old"},
+				},
+			},
+		},
+	}
+
+	observeStatusSyncLag(ControllerName, "managed", policyName, oldStatus, newStatus)
+
+	metric := &dto.Metric{}
+
+	observer := statusSyncLagHistogram.WithLabelValues(ControllerName, policyName, "managed")
+
+	if err := observer.(prometheus.Histogram).Write(metric); err != nil {
+		t.Fatalf("Failed to read the metric: %v", err)
+	}
+
+	if count := metric.GetHistogram().GetSampleCount(); count != 1 {
+		t.Fatalf("Expected only the new event to be observed, got %d samples", count)
+	}
+
+	if sum := metric.GetHistogram().GetSampleSum(); sum < 60 || sum > 120 {
+		t.Fatalf("Expected a lag of about a minute, got %v seconds", sum)
+	}
+}
+
+func TestHubStatusOutbox(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	managedClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	outbox := &HubStatusOutbox{Client: managedClient, Reader: managedClient, Namespace: "addon"}
+
+	for _, policyName := range []string{"policy-b", "policy-a", "policy-b"} {
+		if err := outbox.enqueue(ctx, "cluster", policyName); err != nil {
+			t.Fatalf("Failed to queue %s: %v", policyName, err)
+		}
+	}
+
+	configMap := &corev1.ConfigMap{}
+
+	err := managedClient.Get(ctx, types.NamespacedName{Namespace: "addon", Name: OutboxConfigMapName}, configMap)
+	if err != nil {
+		t.Fatalf("Expected the outbox to be persisted: %v", err)
+	}
+
+	if len(configMap.Data) != 2 {
+		t.Fatalf("Expected the queued updates to be coalesced per policy, got %v", configMap.Data)
+	}
+
+	// A new outbox, such as after a restart, reads the queue from the ConfigMap
+	restarted := &HubStatusOutbox{Client: managedClient, Reader: managedClient, Namespace: "addon"}
+
+	names, entries, err := restarted.pending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(names, []string{"policy-b", "policy-a"}) {
+		t.Fatalf("Expected the policies in the order they were first queued, got %v", names)
+	}
+
+	if entries["policy-a"].Namespace != "cluster" {
+		t.Fatalf("Expected the policy namespace to be persisted, got %v", entries["policy-a"])
+	}
+
+	if err := restarted.remove(ctx, "policy-b"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = managedClient.Get(ctx, types.NamespacedName{Namespace: "addon", Name: OutboxConfigMapName}, configMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := configMap.Data["policy-a"]; !ok || len(configMap.Data) != 1 {
+		t.Fatalf("Expected only policy-a to be queued, got %v", configMap.Data)
+	}
+
+	// Removing from a nil outbox, when the outbox is disabled, does nothing
+	var disabled *HubStatusOutbox
+
+	if err := disabled.remove(ctx, "policy-a"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHubStatusOutboxOwners(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	managedClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: OutboxConfigMapName, Namespace: "addon"},
+		// An entry from before the outbox had owners
+		Data: map[string]string{"policy-c": `{"namespace":"cluster","queued":"2024-01-01T00:00:00.000000Z"}`},
+	}).Build()
+	shard0 := &HubStatusOutbox{Client: managedClient, Reader: managedClient, Namespace: "addon", Owner: "shard-0"}
+	shard1 := &HubStatusOutbox{Client: managedClient, Reader: managedClient, Namespace: "addon", Owner: "shard-1"}
+	teamHub := &HubStatusOutbox{
+		Client: managedClient, Reader: managedClient, Namespace: "addon", Owner: "team", HubName: "team",
+	}
+
+	for _, queue := range []struct {
+		outbox     *HubStatusOutbox
+		policyName string
+	}{
+		{shard0, "policy-a"},
+		{shard1, "policy-b"},
+		{teamHub, "policy-a"},
+	} {
+		// Each outbox reads the ConfigMap again since the others changed it
+		queue.outbox.entries = nil
+
+		if err := queue.outbox.enqueue(ctx, "cluster", queue.policyName); err != nil {
+			t.Fatalf("Failed to queue %s for %s: %v", queue.policyName, queue.outbox.Owner, err)
+		}
+	}
+
+	for _, test := range []struct {
+		outbox   *HubStatusOutbox
+		expected []string
+	}{
+		{shard0, []string{"policy-c", "policy-a"}},
+		{shard1, []string{"policy-c", "policy-b"}},
+		{teamHub, []string{"policy-a"}},
+	} {
+		test.outbox.entries = nil
+
+		names, _, err := test.outbox.pending(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Equal(names, test.expected) {
+			t.Fatalf("Expected %s to have %v queued, got %v", test.outbox.Owner, test.expected, names)
+		}
+	}
+
+	if err := teamHub.remove(ctx, "policy-a"); err != nil {
+		t.Fatal(err)
+	}
+
+	configMap := &corev1.ConfigMap{}
+
+	err := managedClient.Get(ctx, types.NamespacedName{Namespace: "addon", Name: OutboxConfigMapName}, configMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedKeys := []string{"policy-c", "shard-0_policy-a", "shard-1_policy-b"}
+
+	if keys := slices.Sorted(maps.Keys(configMap.Data)); !slices.Equal(keys, expectedKeys) {
+		t.Fatalf("Expected the entries of the other owners to be kept, got %v", keys)
+	}
+}
+
+func TestHubStatusOutboxConcurrentCreate(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	managedClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	shard0 := &HubStatusOutbox{Client: managedClient, Reader: managedClient, Namespace: "addon", Owner: "shard-0"}
+	shard1 := &HubStatusOutbox{Client: managedClient, Reader: managedClient, Namespace: "addon", Owner: "shard-1"}
+
+	// Both outboxes find that there is no ConfigMap before either one creates it
+	for _, outbox := range []*HubStatusOutbox{shard0, shard1} {
+		outbox.lock.Lock()
+		err := outbox.load(ctx)
+		outbox.lock.Unlock()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := shard0.enqueue(ctx, "cluster", "policy-a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The ConfigMap already exists, so the second outbox reads it again rather than failing on every write
+	if err := shard1.enqueue(ctx, "cluster", "policy-b"); err != nil {
+		t.Fatalf("Expected the outbox to write to the ConfigMap created by the other outbox: %v", err)
+	}
+
+	if err := shard1.enqueue(ctx, "cluster", "policy-c"); err != nil {
+		t.Fatal(err)
+	}
+
+	configMap := &corev1.ConfigMap{}
+
+	err := managedClient.Get(ctx, types.NamespacedName{Namespace: "addon", Name: OutboxConfigMapName}, configMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedKeys := []string{"shard-0_policy-a", "shard-1_policy-b", "shard-1_policy-c"}
+
+	if keys := slices.Sorted(maps.Keys(configMap.Data)); !slices.Equal(keys, expectedKeys) {
+		t.Fatalf("Expected the entries of both outboxes, got %v", keys)
+	}
+}
+
+func TestHubUnreachable(t *testing.T) {
+	t.Parallel()
+
+	gr := schema.GroupResource{Group: policiesv1.GroupVersion.Group, Resource: "policies"}
+
+	tests := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"connection refused": {
+			err: fmt.Errorf("failed to update: %w", &net.OpError{
+				Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED),
+			}),
+			expected: true,
+		},
+		"service unavailable": {err: k8serrors.NewServiceUnavailable("the server is down"), expected: true},
+		"server timeout":      {err: k8serrors.NewServerTimeout(gr, "update", 1), expected: true},
+		"deadline exceeded":   {err: context.DeadlineExceeded, expected: true},
+		"conflict":            {err: k8serrors.NewConflict(gr, "policy", errors.New("changed")), expected: false},
+		"not found":           {err: k8serrors.NewNotFound(gr, "policy"), expected: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := hubUnreachable(test.err); actual != test.expected {
+				t.Fatalf("Expected %v but got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestHubStatusPatch(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Truncate(time.Second)
+
+	history := func(messages ...string) []policiesv1.ComplianceHistory {
+		entries := make([]policiesv1.ComplianceHistory, 0, len(messages))
+
+		for _, msg := range messages {
+			entries = append(entries, policiesv1.ComplianceHistory{
+				LastTimestamp: metav1.NewTime(now),
+				Message:       msg,
+				EventName:     "policy." + msg,
+			})
+		}
+
+		return entries
+	}
+
+	details := func(
+		name string, compliance policiesv1.ComplianceState, messages ...string,
+	) *policiesv1.DetailsPerTemplate {
+		return &policiesv1.DetailsPerTemplate{
+			TemplateMeta:    metav1.ObjectMeta{Name: name},
+			ComplianceState: compliance,
+			History:         history(messages...),
+		}
+	}
+
+	tests := map[string]struct {
+		oldStatus   policiesv1.PolicyStatus
+		newStatus   policiesv1.PolicyStatus
+		expectedOps int
+	}{
+		"no status on the hub": {
+			newStatus: policiesv1.PolicyStatus{
+				ComplianceState: policiesv1.Compliant,
+				Details:         []*policiesv1.DetailsPerTemplate{details("a", policiesv1.Compliant, "c1")},
+			},
+			expectedOps: 2,
+		},
+		"new entries with the oldest dropped": {
+			oldStatus: policiesv1.PolicyStatus{
+				ComplianceState: policiesv1.Compliant,
+				Details: []*policiesv1.DetailsPerTemplate{
+					details("a", policiesv1.Compliant, "c3", "c2", "c1"),
+					details("b", policiesv1.Compliant, "c1"),
+				},
+			},
+			newStatus: policiesv1.PolicyStatus{
+				ComplianceState: policiesv1.NonCompliant,
+				Details: []*policiesv1.DetailsPerTemplate{
+					details("a", policiesv1.NonCompliant, "n5", "n4", "c3"),
+					details("b", policiesv1.Compliant, "c1"),
+				},
+			},
+			// The resource version test, the policy compliance, the template test and compliance, two removes, and two
+			// adds
+			expectedOps: 8,
+		},
+		"history without common entries": {
+			oldStatus: policiesv1.PolicyStatus{
+				ComplianceState: policiesv1.Compliant,
+				Details:         []*policiesv1.DetailsPerTemplate{details("a", policiesv1.Compliant, "c2", "c1")},
+			},
+			newStatus: policiesv1.PolicyStatus{
+				ComplianceState: policiesv1.Compliant,
+				Details:         []*policiesv1.DetailsPerTemplate{details("a", policiesv1.Compliant, "c4", "c3")},
+			},
+			// The template test and the whole history
+			expectedOps: 3,
+		},
+		"templates changed": {
+			oldStatus: policiesv1.PolicyStatus{
+				ComplianceState: policiesv1.Compliant,
+				Details:         []*policiesv1.DetailsPerTemplate{details("a", policiesv1.Compliant, "c1")},
+			},
+			newStatus: policiesv1.PolicyStatus{
+				ComplianceState: policiesv1.Pending,
+				Details: []*policiesv1.DetailsPerTemplate{
+					details("b", policiesv1.Pending, "p1"), details("a", policiesv1.Compliant, "c1"),
+				},
+			},
+			expectedOps: 3,
+		},
+		"compliance removed": {
+			oldStatus: policiesv1.PolicyStatus{
+				ComplianceState: policiesv1.Compliant,
+				Details:         []*policiesv1.DetailsPerTemplate{details("a", policiesv1.Compliant, "c1")},
+			},
+			newStatus: policiesv1.PolicyStatus{
+				Details: []*policiesv1.DetailsPerTemplate{details("a", "", "c1")},
+			},
+			expectedOps: 4,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			patch, err := hubStatusPatch("5", test.oldStatus, test.newStatus)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ops := []jsonPatchOp{}
+			if err := json.Unmarshal(patch, &ops); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(ops) != test.expectedOps {
+				t.Fatalf("Expected %d operations but got %d: %s", test.expectedOps, len(ops), patch)
+			}
+
+			objectMeta := metav1.ObjectMeta{ResourceVersion: "5"}
+
+			oldPolicy, err := json.Marshal(&policiesv1.Policy{ObjectMeta: objectMeta, Status: test.oldStatus})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decodedPatch, err := jsonpatch.DecodePatch(patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			patched, err := decodedPatch.Apply(oldPolicy)
+			if err != nil {
+				t.Fatalf("Failed to apply the patch %s: %v", patch, err)
+			}
+
+			expected, err := json.Marshal(&policiesv1.Policy{ObjectMeta: objectMeta, Status: test.newStatus})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !jsonpatch.Equal(patched, expected) {
+				t.Fatalf("Expected the patched policy to be %s but got %s", expected, patched)
+			}
+		})
+	}
+}
+
+func TestHubStatusPatchStaleBase(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Truncate(time.Second)
+
+	status := func(messages ...string) policiesv1.PolicyStatus {
+		history := make([]policiesv1.ComplianceHistory, 0, len(messages))
+
+		for _, msg := range messages {
+			history = append(history, policiesv1.ComplianceHistory{
+				LastTimestamp: metav1.NewTime(now), Message: msg, EventName: "policy." + msg,
+			})
+		}
+
+		return policiesv1.PolicyStatus{
+			ComplianceState: policiesv1.NonCompliant,
+			Details: []*policiesv1.DetailsPerTemplate{
+				{TemplateMeta: metav1.ObjectMeta{Name: "a"}, ComplianceState: policiesv1.NonCompliant, History: history},
+			},
+		}
+	}
+
+	// apply applies the patch to the hub policy like the API server, which sets a new resource version
+	apply := func(hubPolicy *policiesv1.Policy, patch []byte, resourceVersion string) (*policiesv1.Policy, error) {
+		rawPolicy, err := json.Marshal(hubPolicy)
+		if err != nil {
+			return nil, err
+		}
+
+		decodedPatch, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, err
+		}
+
+		rawPatched, err := decodedPatch.Apply(rawPolicy)
+		if err != nil {
+			return nil, err
+		}
+
+		patched := &policiesv1.Policy{}
+		if err := json.Unmarshal(rawPatched, patched); err != nil {
+			return nil, err
+		}
+
+		patched.ResourceVersion = resourceVersion
+
+		return patched, nil
+	}
+
+	hubPolicy := &policiesv1.Policy{ObjectMeta: metav1.ObjectMeta{ResourceVersion: "1"}, Status: status("n1")}
+	// The cache doesn't have the hub policy from the first batch when the second batch is sent
+	stalePolicy := hubPolicy.DeepCopy()
+
+	firstPatch, err := hubStatusPatch(hubPolicy.ResourceVersion, hubPolicy.Status, status("n2", "n1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hubPolicy, err = apply(hubPolicy, firstPatch, "2")
+	if err != nil {
+		t.Fatalf("Failed to apply the first batch: %v", err)
+	}
+
+	secondPatch, err := hubStatusPatch(stalePolicy.ResourceVersion, stalePolicy.Status, status("n3", "n2", "n1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the resource version test, n2 would be added again
+	if _, err := apply(hubPolicy, secondPatch, "3"); err == nil {
+		t.Fatal("Expected the second batch computed against the stale hub policy to fail")
+	}
+
+	// The retry once the cache has the first batch succeeds
+	secondPatch, err = hubStatusPatch(hubPolicy.ResourceVersion, hubPolicy.Status, status("n3", "n2", "n1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hubPolicy, err = apply(hubPolicy, secondPatch, "3")
+	if err != nil {
+		t.Fatalf("Failed to apply the retried second batch: %v", err)
+	}
+
+	if !equality.Semantic.DeepEqual(hubPolicy.Status, status("n3", "n2", "n1")) {
+		t.Fatalf("Unexpected history on the hub: %+v", hubPolicy.Status.Details[0].History)
+	}
+}
+
+func TestMergeDetailsHistoryOptions(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// event returns a compliance event with the timestamp in its name, offset from the start
+	event := func(offset time.Duration, msg string) policiesv1.ComplianceHistory {
+		ts := start.Add(offset)
+
+		return policiesv1.ComplianceHistory{
+			LastTimestamp: metav1.NewTime(ts),
+			Message:       msg,
+			EventName:     fmt.Sprintf("policy.%x", ts.UnixNano()),
+		}
+	}
+
+	messages := func(history []policiesv1.ComplianceHistory) []string {
+		msgs := make([]string, 0, len(history))
+
+		for _, entry := range history {
+			msgs = append(msgs, entry.Message)
+		}
+
+		return msgs
+	}
+
+	events := []policiesv1.ComplianceHistory{
+		event(0, "Compliant; a"),
+		event(time.Second, "NonCompliant; b"),
+		event(time.Second+time.Millisecond, "NonCompliant; b"),
+		event(2*time.Second, "NonCompliant; b"),
+		event(3*time.Second, "Compliant; a"),
+	}
+
+	tests := map[string]struct {
+		opts     ComplianceHistoryOptions
+		expected []string
+	}{
+		"default options": {
+			opts:     DefaultComplianceHistoryOptions,
+			expected: []string{"Compliant; a", "NonCompliant; b", "NonCompliant; b", "NonCompliant; b", "Compliant; a"},
+		},
+		"limited length": {
+			opts:     ComplianceHistoryOptions{Length: 2},
+			expected: []string{"Compliant; a", "NonCompliant; b"},
+		},
+		"wider dedupe window": {
+			opts:     ComplianceHistoryOptions{Length: 10, DedupeWindow: 10 * time.Millisecond},
+			expected: []string{"Compliant; a", "NonCompliant; b", "NonCompliant; b", "Compliant; a"},
+		},
+		"collapsed repeats": {
+			opts:     ComplianceHistoryOptions{Length: 10, CollapseRepeats: true},
+			expected: []string{"Compliant; a", "NonCompliant; b (repeated 3 times)", "Compliant; a"},
+		},
+		"collapsed repeats with the length limit": {
+			opts:     ComplianceHistoryOptions{Length: 2, CollapseRepeats: true},
+			expected: []string{"Compliant; a", "NonCompliant; b (repeated 3 times)"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			details := mergeDetails(slices.Clone(events), nil, "template", test.opts, logr.Discard())
+
+			if got := messages(details.History); !slices.Equal(got, test.expected) {
+				t.Fatalf("Expected the history %v, got %v", test.expected, got)
+			}
+
+			if details.ComplianceState != policiesv1.Compliant {
+				t.Fatalf("Expected the template to be Compliant, got %s", details.ComplianceState)
+			}
+		})
+	}
+}
+
+func TestMergeDetailsCollapsedRepeatsAreStable(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	opts := ComplianceHistoryOptions{Length: 10, CollapseRepeats: true}
+
+	event := func(offset time.Duration, msg string) policiesv1.ComplianceHistory {
+		ts := start.Add(offset)
+
+		return policiesv1.ComplianceHistory{
+			LastTimestamp: metav1.NewTime(ts),
+			Message:       msg,
+			EventName:     fmt.Sprintf("policy.%x", ts.UnixNano()),
+		}
+	}
+
+	events := []policiesv1.ComplianceHistory{
+		event(0, "Compliant; a"),
+		event(time.Second, "NonCompliant; b"),
+		event(2*time.Second, "NonCompliant; b"),
+	}
+
+	details := mergeDetails(slices.Clone(events), nil, "template", opts, logr.Discard())
+
+	// Reconciling again with the same events in the cluster must not count them again
+	details = mergeDetails(slices.Clone(events), []*policiesv1.DetailsPerTemplate{details}, "template", opts,
+		logr.Discard())
+
+	if len(details.History) != 2 || details.History[0].Message != "NonCompliant; b (repeated 2 times)" {
+		t.Fatalf("Expected the repeat count to stay at 2, got %v", details.History)
+	}
+
+	// A new repeat is added to the count, and the older events are not counted again
+	events = append(events, event(3*time.Second, "NonCompliant; b"))
+
+	details = mergeDetails(slices.Clone(events), []*policiesv1.DetailsPerTemplate{details}, "template", opts,
+		logr.Discard())
+
+	if len(details.History) != 2 || details.History[0].Message != "NonCompliant; b (repeated 3 times)" ||
+		details.History[0].EventName != events[3].EventName {
+		t.Fatalf("Expected the newest event with a repeat count of 3, got %v", details.History)
+	}
+
+	// The count is kept after the collapsed events expire from the cluster
+	details = mergeDetails(nil, []*policiesv1.DetailsPerTemplate{details}, "template", opts, logr.Discard())
+
+	if len(details.History) != 2 || details.History[0].Message != "NonCompliant; b (repeated 3 times)" {
+		t.Fatalf("Expected the repeat count to stay at 3, got %v", details.History)
+	}
+
+	if details.ComplianceState != policiesv1.NonCompliant {
+		t.Fatalf("Expected the template to be NonCompliant, got %s", details.ComplianceState)
+	}
+}
+
+func TestHistoryOptions(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		configured  ComplianceHistoryOptions
+		annotations map[string]string
+		expected    ComplianceHistoryOptions
+	}{
+		"defaults": {
+			expected: DefaultComplianceHistoryOptions,
+		},
+		"configured": {
+			configured: ComplianceHistoryOptions{Length: 20, DedupeWindow: time.Second, CollapseRepeats: true},
+			expected:   ComplianceHistoryOptions{Length: 20, DedupeWindow: time.Second, CollapseRepeats: true},
+		},
+		"overridden by annotations": {
+			configured: ComplianceHistoryOptions{Length: 20, DedupeWindow: time.Second},
+			annotations: map[string]string{
+				historyLengthAnnotation:          "50",
+				historyDedupeWindowAnnotation:    "0s",
+				historyCollapseRepeatsAnnotation: "true",
+			},
+			expected: ComplianceHistoryOptions{Length: 50, CollapseRepeats: true},
+		},
+		"invalid annotations": {
+			configured: ComplianceHistoryOptions{Length: 20, DedupeWindow: time.Second},
+			annotations: map[string]string{
+				historyLengthAnnotation:          "101",
+				historyDedupeWindowAnnotation:    "-1s",
+				historyCollapseRepeatsAnnotation: "sometimes",
+			},
+			expected: ComplianceHistoryOptions{Length: 20, DedupeWindow: time.Second},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := &PolicyReconciler{ComplianceHistory: test.configured}
+			pol := &policiesv1.Policy{ObjectMeta: metav1.ObjectMeta{Annotations: test.annotations}}
+
+			if got := r.historyOptions(pol, logr.Discard()); got != test.expected {
+				t.Fatalf("Expected %+v, got %+v", test.expected, got)
+			}
+
+			if err := test.expected.Validate(); err != nil {
+				t.Fatalf("Expected valid options, got %v", err)
+			}
+		})
+	}
+
+	if err := (ComplianceHistoryOptions{Length: 0}).Validate(); err == nil {
+		t.Fatal("Expected an error for a length of 0")
+	}
+}
+
+func TestAggregateCompliance(t *testing.T) {
+	t.Parallel()
+
+	// template returns a policy template and its status with the compliance state
+	template := func(
+		name string, state policiesv1.ComplianceState, tmplAnnotations map[string]string,
+	) (*policiesv1.PolicyTemplate, *policiesv1.DetailsPerTemplate) {
+		raw, err := json.Marshal(map[string]any{
+			"apiVersion": "policy.open-cluster-management.io/v1",
+			"kind":       "ConfigurationPolicy",
+			"metadata":   map[string]any{"name": name, "annotations": tmplAnnotations},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return &policiesv1.PolicyTemplate{ObjectDefinition: runtime.RawExtension{Raw: raw}},
+			&policiesv1.DetailsPerTemplate{TemplateMeta: metav1.ObjectMeta{Name: name}, ComplianceState: state}
+	}
+
+	// policy returns a policy with a template for each compliance state
+	policy := func(annotations map[string]string, states ...policiesv1.ComplianceState) *policiesv1.Policy {
+		pol := &policiesv1.Policy{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}
+
+		for i, state := range states {
+			tmpl, details := template(fmt.Sprintf("template-%d", i), state, nil)
+
+			pol.Spec.PolicyTemplates = append(pol.Spec.PolicyTemplates, tmpl)
+			pol.Status.Details = append(pol.Status.Details, details)
+		}
+
+		return pol
+	}
+
+	// withInformational adds a noncompliant informational template to the policy
+	withInformational := func(pol *policiesv1.Policy) *policiesv1.Policy {
+		tmpl, details := template("informational", policiesv1.NonCompliant, map[string]string{
+			informationalAnnotation: "true",
+		})
+
+		pol.Spec.PolicyTemplates = append(pol.Spec.PolicyTemplates, tmpl)
+		pol.Status.Details = append(pol.Status.Details, details)
+
+		return pol
+	}
+
+	// withOverrideDisabled marks the last template of the policy as disabled by a PolicyOverride
+	withOverrideDisabled := func(pol *policiesv1.Policy) *policiesv1.Policy {
+		pol.Status.Details[len(pol.Status.Details)-1].TemplateMeta.Annotations = map[string]string{
+			utils.PolicyOverrideDisabledAnnotation: "true",
+		}
+
+		return pol
+	}
+
+	const (
+		compliant    = policiesv1.Compliant
+		nonCompliant = policiesv1.NonCompliant
+		pending      = policiesv1.Pending
+	)
+
+	anyPass := map[string]string{aggregationAnnotation: "AnyPass"}
+	threshold := func(value string) map[string]string {
+		return map[string]string{aggregationAnnotation: "Threshold", thresholdAnnotation: value}
+	}
+
+	tests := map[string]struct {
+		policy   *policiesv1.Policy
+		expected policiesv1.ComplianceState
+	}{
+		"all must pass by default":           {policy(nil, compliant, nonCompliant, pending), nonCompliant},
+		"all must pass with a pending":       {policy(nil, compliant, pending, ""), pending},
+		"all must pass with no compliance":   {policy(nil, compliant, ""), ""},
+		"all must pass with all compliant":   {policy(nil, compliant, compliant), compliant},
+		"no templates":                       {policy(nil), compliant},
+		"any pass":                           {policy(anyPass, nonCompliant, compliant), compliant},
+		"any pass with none compliant":       {policy(anyPass, nonCompliant, nonCompliant), nonCompliant},
+		"any pass waiting on a pending":      {policy(anyPass, nonCompliant, pending), pending},
+		"threshold met":                      {policy(threshold("2"), compliant, nonCompliant, compliant), compliant},
+		"threshold not met":                  {policy(threshold("2"), compliant, nonCompliant, nonCompliant), nonCompliant},
+		"threshold percentage met":           {policy(threshold("50%"), compliant, nonCompliant), compliant},
+		"threshold percentage rounded up":    {policy(threshold("50%"), compliant, nonCompliant, nonCompliant), nonCompliant},
+		"threshold above the template count": {policy(threshold("5"), compliant, compliant), compliant},
+		"invalid threshold": {
+			policy(threshold("half"), compliant, nonCompliant), nonCompliant,
+		},
+		"invalid strategy": {
+			policy(map[string]string{aggregationAnnotation: "MostPass"}, compliant, nonCompliant), nonCompliant,
+		},
+		"informational template ignored": {withInformational(policy(nil, compliant)), compliant},
+		"template disabled by an override ignored": {
+			withOverrideDisabled(policy(nil, compliant, nonCompliant)), compliant,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			aggregation := aggregateCompliance(test.policy, logr.Discard())
+			if aggregation.compliance != test.expected {
+				t.Fatalf("Expected %q, got %q: %s", test.expected, aggregation.compliance, aggregation.reason)
+			}
+
+			if aggregation.reason == "" {
+				t.Fatal("Expected a reason for the compliance")
+			}
+		})
+	}
+}
+
+// memoryArchiveSink is an ArchiveSink that keeps the entries in memory and fails while err is set.
+type memoryArchiveSink struct {
+	entries []ArchiveEntry
+	err     error
+}
+
+func (s *memoryArchiveSink) Write(_ context.Context, entries []ArchiveEntry) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	s.entries = append(s.entries, entries...)
+
+	return nil
+}
+
+func TestComplianceArchive(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	sink := &memoryArchiveSink{err: errors.New("sink unavailable")}
+	archive := &ComplianceArchive{Sink: sink, MaxQueue: 3}
+
+	entry := func(name string, timestamp time.Time) ArchiveEntry {
+		return ArchiveEntry{EventName: name, Timestamp: timestamp}
+	}
+
+	archive.add(entry("a", now), entry("b", now), entry("a", now), entry("expired", now.Add(-25*time.Hour)))
+
+	if err := archive.flush(context.Background()); err == nil {
+		t.Fatal("Expected the flush to fail while the sink is unavailable")
+	}
+
+	// The queue is full after d, so the oldest entry is dropped
+	archive.add(entry("b", now), entry("c", now), entry("d", now))
+
+	sink.err = nil
+
+	if err := archive.flush(context.Background()); err != nil {
+		t.Fatalf("Expected the flush to succeed, got %v", err)
+	}
+
+	names := []string{}
+	for _, written := range sink.entries {
+		names = append(names, written.EventName)
+	}
+
+	if !slices.Equal(names, []string{"b", "c", "d"}) {
+		t.Fatalf("Expected the entries b, c, and d to be written, got %v", names)
+	}
+
+	// Written events are remembered so that they aren't archived again
+	archive.add(entry("c", now))
+
+	if len(archive.queue) != 0 {
+		t.Fatalf("Expected an archived event to not be queued again, got %v", archive.queue)
+	}
+}
+
+func TestFileArchiveSink(t *testing.T) {
+	t.Parallel()
+
+	path := t.TempDir() + "/archive.jsonl"
+	sink := &FileArchiveSink{Path: path, MaxSize: 1, MaxBackups: 1}
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := sink.Write(context.Background(), []ArchiveEntry{{EventName: name}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each write rotates the previous file since it's over the max size, and only one backup is kept
+	for file, expected := range map[string]string{path: "c", path + ".1": "b"} {
+		entries, err := (&FileArchiveSink{Path: file}).Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != 1 || entries[0].EventName != expected {
+			t.Fatalf("Expected %s to have the entry %s, got %v", file, expected, entries)
+		}
+	}
+
+	if _, err := os.Stat(path + ".2"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected only one backup to be kept, got %v", err)
+	}
+
+	entries, err := (&FileArchiveSink{Path: path + ".missing"}).Load()
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Expected no entries for a missing file, got %v, %v", entries, err)
+	}
+}
+
+func TestHTTPArchiveSink(t *testing.T) {
+	t.Parallel()
+
+	received := []string{}
+	fail := true
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		scanner := bufio.NewScanner(req.Body)
+		for scanner.Scan() {
+			entry := ArchiveEntry{}
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				t.Error(err)
+			}
+
+			received = append(received, entry.EventName)
+		}
+	}))
+	defer server.Close()
+
+	sink := &HTTPArchiveSink{URL: server.URL}
+	entries := []ArchiveEntry{{EventName: "a"}, {EventName: "b"}}
+
+	if err := sink.Write(context.Background(), entries); err == nil {
+		t.Fatal("Expected an error when the endpoint responds with a 503")
+	}
+
+	fail = false
+
+	if err := sink.Write(context.Background(), entries); err != nil {
+		t.Fatalf("Expected the entries to be sent, got %v", err)
+	}
+
+	if !slices.Equal(received, []string{"a", "b"}) {
+		t.Fatalf("Expected the entries a and b, got %v", received)
+	}
+}
+
+func TestOverrideDetails(t *testing.T) {
+	t.Parallel()
+
+	hubInstance := &policiesv1.Policy{}
+
+	for _, name := range []string{"case1-a", "case1-b", "case1-c"} {
+		raw, err := json.Marshal(map[string]any{
+			"apiVersion": "policy.open-cluster-management.io/v1",
+			"kind":       "ConfigurationPolicy",
+			"metadata":   map[string]any{"name": name},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hubInstance.Spec.PolicyTemplates = append(
+			hubInstance.Spec.PolicyTemplates,
+			&policiesv1.PolicyTemplate{ObjectDefinition: runtime.RawExtension{Raw: raw}},
+		)
+	}
+
+	expiresAt := metav1.NewTime(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+	override := &v1alpha1.PolicyOverride{
+		ObjectMeta: metav1.ObjectMeta{Name: "policies.case1"},
+		Spec: v1alpha1.PolicyOverrideSpec{
+			DisabledTemplates: []string{"case1-b", "case1-c"},
+			ExpiresAt:         &expiresAt,
+		},
+	}
+
+	details := []*policiesv1.DetailsPerTemplate{
+		{TemplateMeta: metav1.ObjectMeta{Name: "case1-a"}, ComplianceState: policiesv1.Compliant},
+	}
+	existingHistory := []policiesv1.ComplianceHistory{{EventName: "policies.case1.17b80d88a995e12c"}}
+	existingDetails := []*policiesv1.DetailsPerTemplate{
+		{
+			TemplateMeta:    metav1.ObjectMeta{Name: "case1-b"},
+			ComplianceState: policiesv1.NonCompliant,
+			History:         existingHistory,
+		},
+	}
+
+	details = overrideDetails(details, existingDetails, hubInstance, override)
+
+	if len(details) != 3 {
+		t.Fatalf("Expected a detail for each template of the hub policy, got %d", len(details))
+	}
+
+	for _, dpt := range details {
+		if dpt.TemplateMeta.Annotations[utils.PolicyOverrideAnnotation] != "policies.case1" {
+			t.Fatalf("Expected the %s detail to have the override annotation", dpt.TemplateMeta.Name)
+		}
+
+		if dpt.TemplateMeta.Annotations[utils.PolicyOverrideExpiresAnnotation] != "2026-10-18T12:00:00Z" {
+			t.Fatalf("Expected the %s detail to have the expiry annotation", dpt.TemplateMeta.Name)
+		}
+
+		if overrideDisabled(dpt) != (dpt.TemplateMeta.Name != "case1-a") {
+			t.Fatalf("Expected only the disabled templates to have the disabled annotation: %s", dpt.TemplateMeta.Name)
+		}
+	}
+
+	// The disabled template keeps its last reported compliance without changing the existing details
+	if details[1].ComplianceState != policiesv1.NonCompliant || len(details[1].History) != 1 {
+		t.Fatalf("Expected the case1-b detail to keep its compliance, got %v", details[1])
+	}
+
+	if existingDetails[0].TemplateMeta.Annotations != nil {
+		t.Fatal("Expected the existing details to not be changed")
+	}
+
+	if details[2].ComplianceState != "" || details[2].History == nil {
+		t.Fatalf("Expected the case1-c detail to have no compliance, got %v", details[2])
+	}
+}
+
+func TestDeferredDetails(t *testing.T) {
+	t.Parallel()
+
+	since := time.Date(2026, 10, 16, 18, 5, 0, 0, time.UTC)
+	until := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+
+	details := []*policiesv1.DetailsPerTemplate{
+		{TemplateMeta: metav1.ObjectMeta{Name: "case1-a"}},
+		{
+			TemplateMeta: metav1.ObjectMeta{
+				Name:        "case1-b",
+				Annotations: map[string]string{utils.PolicyOverrideAnnotation: "policies.case1"},
+			},
+		},
+	}
+
+	deferredDetails(details, since, until)
+
+	for _, dpt := range details {
+		if dpt.TemplateMeta.Annotations[utils.SpecSyncDeferredSinceAnnotation] != "2026-10-16T18:05:00Z" {
+			t.Fatalf("Expected the %s detail to have the deferred since annotation", dpt.TemplateMeta.Name)
+		}
+
+		if dpt.TemplateMeta.Annotations[utils.SpecSyncDeferredUntilAnnotation] != "2026-10-19T08:00:00Z" {
+			t.Fatalf("Expected the %s detail to have the deferred until annotation", dpt.TemplateMeta.Name)
+		}
+	}
+
+	if details[1].TemplateMeta.Annotations[utils.PolicyOverrideAnnotation] != "policies.case1" {
+		t.Fatal("Expected the existing annotations to be kept")
+	}
+
+	details = []*policiesv1.DetailsPerTemplate{{TemplateMeta: metav1.ObjectMeta{Name: "case1-a"}}}
+
+	deferredDetails(details, since, time.Time{})
+
+	if _, ok := details[0].TemplateMeta.Annotations[utils.SpecSyncDeferredUntilAnnotation]; ok {
+		t.Fatal("Expected no deferred until annotation when it's not known when changes are allowed again")
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package statussync
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"open-cluster-management.io/governance-policy-framework-addon/controllers/utils"
+)
+
+var (
+	complianceStates = []policiesv1.ComplianceState{
+		policiesv1.Compliant, policiesv1.NonCompliant, policiesv1.Pending,
+	}
+
+	policyComplianceGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "policy_compliance_state",
+			Help: "Whether the policy has the compliance state (1) or not (0). A policy without a compliance " +
+				"state is 0 for every state.",
+		},
+		[]string{
+			"policy",
+			"namespace",
+			"state",
+		},
+	)
+	templateComplianceGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "policy_template_compliance_state",
+			Help: "Whether the policy template has the compliance state (1) or not (0). A template without a " +
+				"compliance state is 0 for every state.",
+		},
+		[]string{
+			"policy",
+			"namespace",
+			"template",
+			"state",
+		},
+	)
+	templateComplianceChangeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "policy_template_compliance_last_change_timestamp_seconds",
+			Help: "The Unix timestamp of when the policy template changed to its current compliance state, " +
+				"based on its compliance history",
+		},
+		[]string{
+			"policy",
+			"namespace",
+			"template",
+		},
+	)
+	statusSyncLagHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "policy_status_sync_lag_seconds",
+			Help: "The time from when a compliance event was sent on the managed cluster to when it was added to " +
+				"the policy status on the hub",
+			Buckets: utils.LagBuckets,
+		},
+		[]string{
+			"controller",
+			"policy",
+			"namespace",
+		},
+	)
+	outboxDepthGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "policy_status_outbox_depth",
+			Help: "The number of policies whose status is queued to be sent to the hub once it's reachable. The hub " +
+				"label is empty for the primary hub.",
+		},
+		[]string{
+			"hub",
+		},
+	)
+	hubConnectivityGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "policy_status_sync_hub_connected",
+			Help: "Whether the last policy status update on the hub succeeded (1) or failed because the hub was " +
+				"unreachable (0). The hub label is empty for the primary hub.",
+		},
+		[]string{
+			"hub",
+		},
+	)
+	archiveQueueGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "policy_compliance_archive_queue_depth",
+			Help: "The number of compliance events queued to be written to the compliance archive",
+		},
+	)
+	archiveDroppedCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "policy_compliance_archive_dropped_total",
+			Help: "The number of compliance events dropped from the compliance archive queue because it was full",
+		},
+	)
+	templateHistoryLengthGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "policy_template_compliance_history_length",
+			Help: "The number of entries in the compliance history of the policy template",
+		},
+		[]string{
+			"policy",
+			"namespace",
+			"template",
+		},
+	)
+)
+
+func init() {
+	// Register custom metrics with the global Prometheus registry
+	alreadyReg := &prometheus.AlreadyRegisteredError{}
+
+	for _, collector := range []prometheus.Collector{
+		policyComplianceGauge,
+		templateComplianceGauge,
+		templateComplianceChangeGauge,
+		templateHistoryLengthGauge,
+		statusSyncLagHistogram,
+		outboxDepthGauge,
+		hubConnectivityGauge,
+		archiveQueueGauge,
+		archiveDroppedCounter,
+	} {
+		regErr := metrics.Registry.Register(collector)
+		if regErr != nil && !errors.As(regErr, alreadyReg) {
+			panic(regErr)
+		}
+	}
+}
+
+// setComplianceMetrics sets the compliance gauges of the policy and its templates from its status. The template series
+// are replaced so that templates removed from the policy are no longer reported.
+func setComplianceMetrics(instance *policiesv1.Policy) {
+	for _, state := range complianceStates {
+		policyComplianceGauge.WithLabelValues(instance.Name, instance.Namespace, string(state)).Set(
+			boolToFloat(instance.Status.ComplianceState == state),
+		)
+	}
+
+	labels := prometheus.Labels{"policy": instance.Name, "namespace": instance.Namespace}
+
+	_ = templateComplianceGauge.DeletePartialMatch(labels)
+	_ = templateComplianceChangeGauge.DeletePartialMatch(labels)
+	_ = templateHistoryLengthGauge.DeletePartialMatch(labels)
+
+	for _, dpt := range instance.Status.Details {
+		if dpt == nil {
+			continue
+		}
+
+		tName := dpt.TemplateMeta.GetName()
+
+		for _, state := range complianceStates {
+			templateComplianceGauge.WithLabelValues(instance.Name, instance.Namespace, tName, string(state)).Set(
+				boolToFloat(dpt.ComplianceState == state),
+			)
+		}
+
+		templateHistoryLengthGauge.WithLabelValues(instance.Name, instance.Namespace, tName).Set(
+			float64(len(dpt.History)),
+		)
+
+		if changed := lastComplianceChange(dpt); !changed.IsZero() {
+			templateComplianceChangeGauge.WithLabelValues(instance.Name, instance.Namespace, tName).Set(
+				float64(changed.Unix()),
+			)
+		}
+	}
+}
+
+// deleteComplianceMetrics removes the compliance gauges of a policy that was deleted. The namespace is included since
+// the policies from each hub are in their own namespace on the managed cluster and can have the same name.
+func deleteComplianceMetrics(namespace string, policyName string) {
+	labels := prometheus.Labels{"policy": policyName, "namespace": namespace}
+
+	_ = policyComplianceGauge.DeletePartialMatch(labels)
+	_ = templateComplianceGauge.DeletePartialMatch(labels)
+	_ = templateComplianceChangeGauge.DeletePartialMatch(labels)
+	_ = templateHistoryLengthGauge.DeletePartialMatch(labels)
+	_ = statusSyncLagHistogram.DeletePartialMatch(labels)
+}
+
+// lastComplianceChange returns the timestamp of the oldest entry in the most recent run of history entries with the
+// template's current compliance state. The history is ordered from newest to oldest.
+func lastComplianceChange(dpt *policiesv1.DetailsPerTemplate) (changed time.Time) {
+	for _, history := range dpt.History {
+		if parseComplianceFromMessage(history.Message) != dpt.ComplianceState {
+			break
+		}
+
+		changed = history.LastTimestamp.Time
+	}
+
+	return changed
+}
+
+// setHubConnectivity sets whether the hub is reachable.
+func setHubConnectivity(hubName string, connected bool) {
+	hubConnectivityGauge.WithLabelValues(hubName).Set(boolToFloat(connected))
+}
+
+// reportHubConnectivity sets the hub connectivity gauge after a policy status update on the hub, which either reached
+// the hub or failed because the hub was unreachable. When the requests to the hub are tracked, the gauge is set from
+// whether the hub is connected, so that it agrees with the hub-connectivity readiness check and the lease annotation.
+func (r *PolicyReconciler) reportHubConnectivity(ctx context.Context, reached bool) {
+	if r.HubConnectivity != nil {
+		reached = r.HubConnectivity.Connected(ctx)
+	}
+
+	setHubConnectivity(r.HubName, reached)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// observeStatusSyncLag records the time since each compliance event in the new status that isn't in the previous hub
+// status was sent. The higher precision timestamp in the event name is used when available.
+func observeStatusSyncLag(
+	controllerName string,
+	namespace string,
+	policyName string,
+	oldHubStatus policiesv1.PolicyStatus,
+	newStatus policiesv1.PolicyStatus,
+) {
+	synced := map[string]bool{}
+
+	for _, dpt := range oldHubStatus.Details {
+		if dpt == nil {
+			continue
+		}
+
+		for _, history := range dpt.History {
+			synced[history.EventName] = true
+		}
+	}
+
+	now := time.Now()
+
+	for _, dpt := range newStatus.Details {
+		if dpt == nil {
+			continue
+		}
+
+		for _, history := range dpt.History {
+			if history.EventName == "" || synced[history.EventName] {
+				continue
+			}
+
+			sentAt := history.LastTimestamp.Time
+
+			if eventTime, err := parseTimestampFromEventName(history.EventName); err == nil {
+				sentAt = eventTime.Time
+			}
+
+			if sentAt.IsZero() {
+				continue
+			}
+
+			statusSyncLagHistogram.WithLabelValues(controllerName, policyName, namespace).Observe(now.Sub(sentAt).Seconds())
+		}
+	}
+}
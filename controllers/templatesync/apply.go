@@ -0,0 +1,130 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templatesync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/csaupgrade"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// FieldManager is the field manager used when policy templates are written with server-side apply. It's also used for
+// the finalizer on the policy so that adding it isn't counted as a change to the policy spec.
+const FieldManager = ControllerName
+
+// legacyFieldManagers are the field managers that own fields on policy templates written before server-side apply
+// was enabled. Without an explicit field manager, the API server uses the command name from the client-go user agent.
+var legacyFieldManagers = sets.New(filepath.Base(os.Args[0]), "governance-policy-framework-addon")
+
+// applyTemplate writes the policy template with server-side apply, forcing ownership of the fields in the template so
+// that fields set by other controllers are left alone. The existing object may be nil if it doesn't exist yet. If the
+// existing object was previously written with a client-side update, its managed fields are first migrated so that
+// fields removed from the template are also removed from the object.
+func applyTemplate(
+	ctx context.Context,
+	res dynamic.ResourceInterface,
+	existing *unstructured.Unstructured,
+	desired *unstructured.Unstructured,
+	dryRun []string,
+) (*unstructured.Unstructured, error) {
+	if existing != nil && len(dryRun) == 0 {
+		patch, err := csaupgrade.UpgradeManagedFieldsPatch(existing, legacyFieldManagers, FieldManager)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute the managed fields migration: %w", err)
+		}
+
+		if patch != nil {
+			ctrl.LoggerFrom(ctx).V(1).Info("Migrating the managed fields of the policy template to server-side apply")
+
+			_, err = res.Patch(ctx, existing.GetName(), types.JSONPatchType, patch, metav1.PatchOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("failed to migrate the managed fields to server-side apply: %w", err)
+			}
+		}
+	}
+
+	applyObj := desired.DeepCopy()
+	// These must not be set on an apply configuration.
+	applyObj.SetResourceVersion("")
+	applyObj.SetManagedFields(nil)
+	applyObj.SetUID("")
+	applyObj.SetCreationTimestamp(metav1.Time{})
+	unstructured.RemoveNestedField(applyObj.Object, "status")
+
+	data, err := applyObj.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the policy template: %w", err)
+	}
+
+	// This is a patch rather than an apply since the apply options don't have field validation, which must be strict to
+	// report typos in the template as a template error, the same as a create or update
+	return res.Patch(ctx, applyObj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+		FieldManager:    FieldManager,
+		Force:           ptr.To(true),
+		DryRun:          dryRun,
+		FieldValidation: metav1.FieldValidationStrict,
+	})
+}
+
+// templateNeedsApply returns whether a policy template that is equivalent to the existing object must still be applied.
+// This is the case when the managed fields of the existing object need to be migrated from client-side updates, or when
+// an annotation or label that was previously applied was removed from the template, since the apply removes it.
+func templateNeedsApply(existing *unstructured.Unstructured, desired *unstructured.Unstructured) bool {
+	patch, err := csaupgrade.UpgradeManagedFieldsPatch(existing, legacyFieldManagers, FieldManager)
+	if err != nil || patch != nil {
+		return true
+	}
+
+	for _, entry := range existing.GetManagedFields() {
+		if entry.Manager != FieldManager || entry.Operation != metav1.ManagedFieldsOperationApply ||
+			entry.Subresource != "" || entry.FieldsV1 == nil {
+			continue
+		}
+
+		owned := struct {
+			Metadata struct {
+				Annotations map[string]any `json:"f:annotations"`
+				Labels      map[string]any `json:"f:labels"`
+			} `json:"f:metadata"`
+		}{}
+
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &owned); err != nil {
+			return true
+		}
+
+		if removedKey(owned.Metadata.Annotations, desired.GetAnnotations()) ||
+			removedKey(owned.Metadata.Labels, desired.GetLabels()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removedKey returns whether one of the owned annotation or label fields, such as `f:team`, isn't in the desired map.
+func removedKey(owned map[string]any, desired map[string]string) bool {
+	for field := range owned {
+		key, ok := strings.CutPrefix(field, "f:")
+		if !ok {
+			continue
+		}
+
+		if _, ok := desired[key]; !ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,236 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templatesync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	extensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"open-cluster-management.io/governance-policy-framework-addon/controllers/utils"
+)
+
+// TemplateDefaulter sets default values on, or otherwise normalizes, a policy template so that it can be compared with
+// the object on the cluster, which has had its defaults set by the API server.
+type TemplateDefaulter func(tObject *unstructured.Unstructured) error
+
+var (
+	templateDefaulters     = map[schema.GroupKind][]TemplateDefaulter{}
+	templateDefaultersLock sync.RWMutex
+)
+
+func init() {
+	RegisterTemplateDefaulter(
+		schema.GroupKind{Group: policiesv1.GroupVersion.Group, Kind: "ConfigurationPolicy"},
+		defaultConfigurationPolicy,
+	)
+	RegisterTemplateDefaulter(
+		schema.GroupKind{Group: policiesv1.GroupVersion.Group, Kind: "OperatorPolicy"},
+		defaultOperatorPolicy,
+	)
+}
+
+// RegisterTemplateDefaulter adds a defaulter for policy templates of the input GroupKind. Defaulters are run in the
+// order they are registered. This is meant to be called from an init function.
+func RegisterTemplateDefaulter(gk schema.GroupKind, defaulter TemplateDefaulter) {
+	templateDefaultersLock.Lock()
+	defer templateDefaultersLock.Unlock()
+
+	templateDefaulters[gk] = append(templateDefaulters[gk], defaulter)
+}
+
+// applyTemplateDefaults runs the registered defaulters for the template's GroupKind. Errors are logged but do not stop
+// the remaining defaulters from running, since a missing default only results in an unnecessary update.
+func applyTemplateDefaults(ctx context.Context, tObject *unstructured.Unstructured) {
+	templateDefaultersLock.RLock()
+	defaulters := templateDefaulters[tObject.GroupVersionKind().GroupKind()]
+	templateDefaultersLock.RUnlock()
+
+	for _, defaulter := range defaulters {
+		if err := defaulter(tObject); err != nil {
+			ctrl.LoggerFrom(ctx).Error(err, "Failed to set the default values on the policy template")
+		}
+	}
+}
+
+// setNestedStringDefault sets the string value at the input path if it's not already set.
+func setNestedStringDefault(obj map[string]any, value string, fields ...string) error {
+	existing, _, _ := unstructured.NestedString(obj, fields...)
+	if existing != "" {
+		return nil
+	}
+
+	err := unstructured.SetNestedField(obj, value, fields...)
+	if err != nil {
+		return fmt.Errorf("failed to set the default value of %v: %w", fields[len(fields)-1], err)
+	}
+
+	return nil
+}
+
+func defaultConfigurationPolicy(tObject *unstructured.Unstructured) error {
+	err := setNestedStringDefault(tObject.Object, "None", "spec", "pruneObjectBehavior")
+	if err != nil {
+		return err
+	}
+
+	var updatedObjectTemplates bool
+
+	objectTemplates, _, _ := unstructured.NestedSlice(tObject.Object, "spec", "object-templates")
+
+	for i := range objectTemplates {
+		objectTemplate, ok := objectTemplates[i].(map[string]any)
+		if !ok {
+			continue
+		}
+
+		if _, ok := objectTemplate["recreateOption"]; !ok {
+			objectTemplate["recreateOption"] = "None"
+			objectTemplates[i] = objectTemplate
+			updatedObjectTemplates = true
+		}
+	}
+
+	if updatedObjectTemplates {
+		err := unstructured.SetNestedField(tObject.Object, objectTemplates, "spec", "object-templates")
+		if err != nil {
+			return fmt.Errorf("failed to set the default value of recreateOption: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func defaultOperatorPolicy(tObject *unstructured.Unstructured) error {
+	defaults := []struct {
+		field string
+		value string
+	}{
+		{"catalogSourceUnhealthy", "Compliant"},
+		{"deploymentsUnavailable", "NonCompliant"},
+		{"upgradesAvailable", "Compliant"},
+	}
+
+	for _, d := range defaults {
+		err := setNestedStringDefault(tObject.Object, d.value, "spec", "complianceConfig", d.field)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyCRDDefaults sets the `default` values from the OpenAPI schema of the template's CRD on the template, so that
+// policy types without a registered defaulter are still compared correctly. Only CRDs with the policy-type=template
+// label are available in the cache, so other kinds are skipped.
+func (r *PolicyReconciler) applyCRDDefaults(
+	ctx context.Context, rsrc schema.GroupVersionResource, tObject *unstructured.Unstructured,
+) error {
+	crd := extensionsv1.CustomResourceDefinition{}
+
+	err := r.Get(ctx, types.NamespacedName{Name: rsrc.GroupResource().String()}, &crd)
+	if err != nil {
+		if k8serrors.IsNotFound(err) || apimeta.IsNoMatchError(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if crd.GetLabels()[utils.PolicyTypeLabel] != "template" {
+		return nil
+	}
+
+	for _, version := range crd.Spec.Versions {
+		if version.Name != rsrc.Version {
+			continue
+		}
+
+		if version.Schema == nil || version.Schema.OpenAPIV3Schema == nil {
+			return nil
+		}
+
+		spec, ok := tObject.Object["spec"]
+		if !ok {
+			return nil
+		}
+
+		specSchema, ok := version.Schema.OpenAPIV3Schema.Properties["spec"]
+		if !ok {
+			return nil
+		}
+
+		tObject.Object["spec"] = applySchemaDefaults(spec, &specSchema)
+
+		return nil
+	}
+
+	return nil
+}
+
+// applySchemaDefaults recursively sets the `default` values in the OpenAPI schema on the input value for any missing
+// object properties, following the same rules as the API server: defaults are applied to the properties of objects,
+// to the items of arrays, and to the properties of defaulted values, but not to values that are explicitly set.
+func applySchemaDefaults(value any, s *extensionsv1.JSONSchemaProps) any {
+	if s == nil {
+		return value
+	}
+
+	switch typed := value.(type) {
+	case map[string]any:
+		for propName, propSchema := range s.Properties {
+			propValue, found := typed[propName]
+			if !found && propSchema.Default != nil {
+				var defaultValue any
+
+				if err := json.Unmarshal(propSchema.Default.Raw, &defaultValue); err != nil {
+					continue
+				}
+
+				// The API server also fills in the defaults of the properties in a defaulted value
+				typed[propName] = applySchemaDefaults(defaultValue, &propSchema)
+
+				continue
+			}
+
+			if found {
+				typed[propName] = applySchemaDefaults(propValue, &propSchema)
+			}
+		}
+
+		if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+			for propName, propValue := range typed {
+				if _, known := s.Properties[propName]; known {
+					continue
+				}
+
+				typed[propName] = applySchemaDefaults(propValue, s.AdditionalProperties.Schema)
+			}
+		}
+
+		return typed
+	case []any:
+		if s.Items == nil || s.Items.Schema == nil {
+			return typed
+		}
+
+		for i := range typed {
+			typed[i] = applySchemaDefaults(typed[i], s.Items.Schema)
+		}
+
+		return typed
+	default:
+		return value
+	}
+}
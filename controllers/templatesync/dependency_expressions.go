@@ -0,0 +1,382 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templatesync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+	depclient "github.com/stolostron/kubernetes-dependency-watches/client"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+	"sigs.k8s.io/yaml"
+
+	"open-cluster-management.io/governance-policy-framework-addon/controllers/utils"
+)
+
+// dependencyExpressionsAnnotation is the annotation on a policy template that contains a list of DependencyExpressions
+// in JSON or YAML. All of the expressions must be satisfied, in addition to the dependencies in the policy, before the
+// template is created.
+const dependencyExpressionsAnnotation = "policy.open-cluster-management.io/dependency-expressions"
+
+// DependencyExpression is either a group of expressions, set with AllOf or AnyOf, or a requirement on the objects
+// identified by the apiVersion, kind, namespace, and either the name or the selector. When a selector is used, every
+// matching object must satisfy the requirement and at least one must match unless Exists is false.
+type DependencyExpression struct {
+	metav1.TypeMeta `json:",inline"`
+	Name            string                `json:"name,omitempty"`
+	Namespace       string                `json:"namespace,omitempty"`
+	Selector        *metav1.LabelSelector `json:"selector,omitempty"`
+	// Exists defaults to true. When false, the object must not exist and no other requirement can be set.
+	Exists *bool `json:"exists,omitempty"`
+	// Compliance is the compliance state the object must have.
+	Compliance policiesv1.ComplianceState `json:"compliance,omitempty"`
+	// NotCompliance is a compliance state the object must not have. An object that doesn't report a compliance
+	// state satisfies it.
+	NotCompliance policiesv1.ComplianceState `json:"notCompliance,omitempty"`
+	// Conditions are the status conditions the object must have.
+	Conditions []DependencyCondition `json:"conditions,omitempty"`
+	// AllOf is satisfied when all of the expressions are satisfied.
+	AllOf []DependencyExpression `json:"allOf,omitempty"`
+	// AnyOf is satisfied when at least one of the expressions is satisfied.
+	AnyOf []DependencyExpression `json:"anyOf,omitempty"`
+}
+
+// DependencyCondition is a status condition that an object must have, such as Available=True on a Deployment.
+type DependencyCondition struct {
+	Type   string                 `json:"type"`
+	Status metav1.ConditionStatus `json:"status"`
+}
+
+// parseDependencyExpressions parses and validates the dependency expressions annotation value.
+func parseDependencyExpressions(data string) ([]DependencyExpression, error) {
+	exprs := []DependencyExpression{}
+
+	if err := yaml.UnmarshalStrict([]byte(data), &exprs); err != nil {
+		return nil, fmt.Errorf("the %s annotation is invalid: %w", dependencyExpressionsAnnotation, err)
+	}
+
+	for i := range exprs {
+		if err := exprs[i].validate(); err != nil {
+			return nil, fmt.Errorf("the %s annotation is invalid: %w", dependencyExpressionsAnnotation, err)
+		}
+	}
+
+	return exprs, nil
+}
+
+func (e *DependencyExpression) isGroup() bool {
+	return len(e.AllOf) > 0 || len(e.AnyOf) > 0
+}
+
+func (e *DependencyExpression) validate() error {
+	if e.isGroup() {
+		if len(e.AllOf) > 0 && len(e.AnyOf) > 0 {
+			return errors.New("only one of allOf or anyOf can be set in an expression")
+		}
+
+		if e.Kind != "" || e.Name != "" || e.Selector != nil {
+			return errors.New("an expression with allOf or anyOf can't also identify an object")
+		}
+
+		for i := range e.AllOf {
+			if err := e.AllOf[i].validate(); err != nil {
+				return err
+			}
+		}
+
+		for i := range e.AnyOf {
+			if err := e.AnyOf[i].validate(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	gvk := e.GroupVersionKind()
+
+	if gvk.Version == "" || gvk.Kind == "" {
+		return errors.New("an expression must set apiVersion and kind, or allOf or anyOf")
+	}
+
+	if (e.Name == "") == (e.Selector == nil) {
+		return fmt.Errorf("the %s expression must set exactly one of name or selector", gvk.Kind)
+	}
+
+	if e.Selector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(e.Selector); err != nil {
+			return fmt.Errorf("the %s expression has an invalid selector: %w", gvk.Kind, err)
+		}
+	}
+
+	validCompliance := []policiesv1.ComplianceState{"", policiesv1.Compliant, policiesv1.NonCompliant, policiesv1.Pending}
+
+	if !slices.Contains(validCompliance, e.Compliance) || !slices.Contains(validCompliance, e.NotCompliance) {
+		return fmt.Errorf("the %s expression has an invalid compliance state", gvk.Kind)
+	}
+
+	if !e.mustExist() && (e.Compliance != "" || e.NotCompliance != "" || len(e.Conditions) > 0) {
+		return fmt.Errorf("the %s expression can't set other requirements when exists is false", gvk.Kind)
+	}
+
+	for _, condition := range e.Conditions {
+		if condition.Type == "" || condition.Status == "" {
+			return fmt.Errorf("the %s expression has a condition without a type or status", gvk.Kind)
+		}
+	}
+
+	return nil
+}
+
+func (e *DependencyExpression) mustExist() bool {
+	return e.Exists == nil || *e.Exists
+}
+
+// objectIdentifier returns the identifier of the objects the expression applies to. The namespace of known policy
+// kinds is always the cluster namespace, the same as the policy dependencies.
+func (e *DependencyExpression) objectIdentifier(clusterNamespace string) depclient.ObjectIdentifier {
+	gvk := e.GroupVersionKind()
+
+	id := depclient.ObjectIdentifier{
+		Group:     gvk.Group,
+		Version:   gvk.Version,
+		Kind:      gvk.Kind,
+		Namespace: e.Namespace,
+		Name:      e.Name,
+	}
+
+	if gvk.Group == policiesv1.GroupVersion.Group && strings.HasSuffix(gvk.Kind, "Policy") {
+		id.Namespace = clusterNamespace
+	}
+
+	if e.Selector != nil {
+		// The selector was validated when the expression was parsed
+		selector, _ := metav1.LabelSelectorAsSelector(e.Selector)
+		id.Selector = selector.String()
+	}
+
+	return id
+}
+
+// describeDependency returns a readable description of the objects the expression applies to for pending messages.
+func describeDependency(id depclient.ObjectIdentifier) string {
+	name := id.Name
+	if id.Namespace != "" {
+		name = id.Namespace + "/" + name
+	}
+
+	if id.Selector != "" {
+		if id.Namespace != "" {
+			return fmt.Sprintf("%s in %s with the selector %s", id.Kind, id.Namespace, id.Selector)
+		}
+
+		return fmt.Sprintf("%s with the selector %s", id.Kind, id.Selector)
+	}
+
+	return id.Kind + " " + name
+}
+
+// watchIdentifiers returns the identifiers of all the objects in the expressions so that they can be watched.
+func watchIdentifiers(exprs []DependencyExpression, clusterNamespace string) []depclient.ObjectIdentifier {
+	ids := []depclient.ObjectIdentifier{}
+
+	for i := range exprs {
+		if exprs[i].isGroup() {
+			ids = append(ids, watchIdentifiers(exprs[i].AllOf, clusterNamespace)...)
+			ids = append(ids, watchIdentifiers(exprs[i].AnyOf, clusterNamespace)...)
+
+			continue
+		}
+
+		ids = append(ids, exprs[i].objectIdentifier(clusterNamespace))
+	}
+
+	return ids
+}
+
+// processDependencyExpressions evaluates the dependency expressions of a template and returns a message for each
+// requirement that is not satisfied. The policy namespace is used for policy dependencies.
+func (r *PolicyReconciler) processDependencyExpressions(
+	ctx context.Context,
+	dClient dynamic.Interface,
+	discoveryClient discovery.DiscoveryInterface,
+	policyNamespace string,
+	exprs []DependencyExpression,
+	kindFilter *templateKindFilter,
+	tLogger logr.Logger,
+) []string {
+	failures := []string{}
+
+	for i := range exprs {
+		failures = append(failures, r.evaluateDependencyExpression(
+			ctx, dClient, discoveryClient, policyNamespace, &exprs[i], kindFilter, tLogger,
+		)...)
+	}
+
+	return failures
+}
+
+func (r *PolicyReconciler) evaluateDependencyExpression(
+	ctx context.Context,
+	dClient dynamic.Interface,
+	discoveryClient discovery.DiscoveryInterface,
+	policyNamespace string,
+	expr *DependencyExpression,
+	kindFilter *templateKindFilter,
+	tLogger logr.Logger,
+) []string {
+	if len(expr.AllOf) > 0 {
+		return r.processDependencyExpressions(
+			ctx, dClient, discoveryClient, policyNamespace, expr.AllOf, kindFilter, tLogger,
+		)
+	}
+
+	if len(expr.AnyOf) > 0 {
+		anyFailures := make([]string, 0, len(expr.AnyOf))
+
+		for i := range expr.AnyOf {
+			failures := r.evaluateDependencyExpression(
+				ctx, dClient, discoveryClient, policyNamespace, &expr.AnyOf[i], kindFilter, tLogger,
+			)
+			if len(failures) == 0 {
+				return nil
+			}
+
+			anyFailures = append(anyFailures, strings.Join(failures, " and "))
+		}
+
+		return []string{fmt.Sprintf("none of the anyOf requirements were met (%s)", strings.Join(anyFailures, " or "))}
+	}
+
+	depID := expr.objectIdentifier(policyNamespace)
+	desc := describeDependency(depID)
+
+	rsrc, namespaced, err := utils.GVRFromGVK(discoveryClient, depID.GroupVersionKind())
+	if err != nil {
+		tLogger.Error(err, DepFailNoAPIMapping, "object", depID)
+
+		return []string{fmt.Sprintf("%s has no API mapping", desc)}
+	}
+
+	var res dynamic.ResourceInterface = dClient.Resource(rsrc)
+
+	if namespaced {
+		res = dClient.Resource(rsrc).Namespace(depID.Namespace)
+	}
+
+	var objects []unstructured.Unstructured
+
+	if depID.Selector != "" {
+		objList, err := res.List(ctx, metav1.ListOptions{LabelSelector: depID.Selector})
+		if err != nil {
+			tLogger.Error(err, DepFailGet, "object", depID)
+
+			return []string{fmt.Sprintf("%s could not be listed", desc)}
+		}
+
+		objects = objList.Items
+	} else {
+		obj, err := res.Get(ctx, depID.Name, metav1.GetOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			tLogger.Error(err, DepFailGet, "object", depID)
+
+			return []string{fmt.Sprintf("%s could not be retrieved", desc)}
+		}
+
+		if err == nil {
+			objects = append(objects, *obj)
+		}
+	}
+
+	if !expr.mustExist() {
+		if len(objects) > 0 {
+			return []string{desc + " must not exist"}
+		}
+
+		return nil
+	}
+
+	if len(objects) == 0 {
+		return []string{desc + " was not found"}
+	}
+
+	failures := []string{}
+
+	for i := range objects {
+		objDesc := describeDependency(depclient.ObjectIdentifier{
+			Kind: depID.Kind, Namespace: objects[i].GetNamespace(), Name: objects[i].GetName(),
+		})
+
+		failures = append(failures, r.checkDependencyObject(ctx, expr, rsrc, &objects[i], objDesc, kindFilter)...)
+	}
+
+	return failures
+}
+
+// checkDependencyObject returns a message for each requirement in the expression that the object doesn't meet.
+func (r *PolicyReconciler) checkDependencyObject(
+	ctx context.Context,
+	expr *DependencyExpression,
+	rsrc schema.GroupVersionResource,
+	obj *unstructured.Unstructured,
+	desc string,
+	kindFilter *templateKindFilter,
+) []string {
+	failures := []string{}
+
+	if expr.Compliance != "" || expr.NotCompliance != "" {
+		compliance := r.dependencyCompliance(ctx, rsrc, obj, kindFilter)
+
+		switch {
+		case expr.Compliance != "" && compliance == "":
+			failures = append(failures, fmt.Sprintf("%s must be %s but has no compliance state", desc, expr.Compliance))
+		case expr.Compliance != "" && compliance != string(expr.Compliance):
+			failures = append(failures, fmt.Sprintf("%s must be %s but is %s", desc, expr.Compliance, compliance))
+		}
+
+		if expr.NotCompliance != "" && compliance == string(expr.NotCompliance) {
+			failures = append(failures, fmt.Sprintf("%s must not be %s", desc, expr.NotCompliance))
+		}
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+
+	for _, wanted := range expr.Conditions {
+		actual := ""
+
+		for _, condition := range conditions {
+			condMap, ok := condition.(map[string]any)
+			if !ok || condMap["type"] != wanted.Type {
+				continue
+			}
+
+			actual, _ = condMap["status"].(string)
+
+			break
+		}
+
+		if actual == string(wanted.Status) {
+			continue
+		}
+
+		if actual == "" {
+			actual = "not set"
+		}
+
+		failures = append(failures, fmt.Sprintf(
+			"%s must have the condition %s=%s but it is %s", desc, wanted.Type, wanted.Status, actual,
+		))
+	}
+
+	return failures
+}
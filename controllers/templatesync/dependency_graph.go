@@ -0,0 +1,286 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templatesync
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+
+	"open-cluster-management.io/governance-policy-framework-addon/controllers/utils"
+)
+
+// DependencyGraphPath is the path on the metrics server where the policy dependency graphs are served as JSON.
+const DependencyGraphPath = "/debug/policy-dependencies"
+
+// dependencyGraph is the graph of the dependencies between the replicated policies and their templates in the cluster
+// namespace. A policy depends on each of its templates, and a template depends on the policy dependencies, its extra
+// dependencies, and the templates in its previous wave.
+type dependencyGraph struct {
+	// Edges maps each node to the sorted nodes it depends on.
+	Edges map[string][]string `json:"edges"`
+	// Cycles contains the sorted nodes of each dependency cycle.
+	Cycles [][]string `json:"cycles"`
+	// cycleByNode maps each node in a cycle to the index of its cycle in Cycles.
+	cycleByNode map[string]int
+}
+
+// dependencyNode returns the name of the node in the dependency graph for an object, such as
+// `ConfigurationPolicy.policy.open-cluster-management.io/cluster1/example`. The namespace is left out for
+// cluster-scoped objects.
+func dependencyNode(group string, kind string, namespace string, name string) string {
+	node := kind
+	if group != "" {
+		node += "." + group
+	}
+
+	if namespace != "" {
+		node += "/" + namespace
+	}
+
+	return node + "/" + name
+}
+
+// templateNamespace returns the namespace of a policy template in the dependency graph. The Gatekeeper objects are
+// cluster-scoped and the other policy templates are in the policy's namespace.
+func templateNamespace(policyNamespace string, group string) string {
+	if group == utils.GConstraint || group == utils.GvkConstraintTemplate.Group {
+		return ""
+	}
+
+	return policyNamespace
+}
+
+// buildDependencyGraph builds the dependency graph of the policies and finds its cycles.
+func buildDependencyGraph(policies []policiesv1.Policy) *dependencyGraph {
+	graph := &dependencyGraph{
+		Edges:       map[string][]string{},
+		Cycles:      [][]string{},
+		cycleByNode: map[string]int{},
+	}
+
+	addEdge := func(from string, to string) {
+		if !slices.Contains(graph.Edges[from], to) {
+			graph.Edges[from] = append(graph.Edges[from], to)
+		}
+	}
+
+	for i := range policies {
+		pol := &policies[i]
+		polNode := dependencyNode(policiesv1.GroupVersion.Group, "Policy", pol.Namespace, pol.Name)
+		graph.Edges[polNode] = []string{}
+
+		depNode := func(dep policiesv1.PolicyDependency) string {
+			gvk := dep.GroupVersionKind()
+
+			return dependencyNode(gvk.Group, gvk.Kind, getDepNamespace(pol.Namespace, dep), dep.Name)
+		}
+
+		waves, _ := getTemplateWaves(pol)
+
+		for tIndex, policyT := range pol.Spec.PolicyTemplates {
+			if policyT == nil {
+				continue
+			}
+
+			tObject := &unstructured.Unstructured{}
+
+			if err := tObject.UnmarshalJSON(policyT.ObjectDefinition.Raw); err != nil || tObject.GetName() == "" {
+				continue
+			}
+
+			gvk := tObject.GroupVersionKind()
+			tNode := dependencyNode(gvk.Group, gvk.Kind, templateNamespace(pol.Namespace, gvk.Group), tObject.GetName())
+
+			addEdge(polNode, tNode)
+
+			if _, ok := graph.Edges[tNode]; !ok {
+				graph.Edges[tNode] = []string{}
+			}
+
+			for _, dep := range pol.Spec.Dependencies {
+				addEdge(tNode, depNode(dep))
+			}
+
+			for _, dep := range policyT.ExtraDependencies {
+				addEdge(tNode, depNode(dep))
+			}
+
+			for _, dep := range waves.previousWave(tIndex) {
+				addEdge(tNode, dependencyNode(dep.Group, dep.Kind, templateNamespace(pol.Namespace, dep.Group), dep.Name))
+			}
+		}
+	}
+
+	for node := range graph.Edges {
+		slices.Sort(graph.Edges[node])
+	}
+
+	graph.findCycles()
+
+	return graph
+}
+
+// policyGeneration identifies a version of a policy's spec, which is what the dependency graph is built from.
+type policyGeneration struct {
+	UID        types.UID
+	Generation int64
+}
+
+// cachedDependencyGraph is the dependency graph of the policies in a namespace and the policy generations it was built
+// from.
+type cachedDependencyGraph struct {
+	graph       *dependencyGraph
+	generations map[string]policyGeneration
+}
+
+// getDependencyGraph returns the dependency graph of the policies in a namespace. The graph is only built again when a
+// policy in the namespace was added, removed, or had its spec changed since the graph was last built, so that it's not
+// rebuilt on every reconcile.
+func (r *PolicyReconciler) getDependencyGraph(namespace string, policies []policiesv1.Policy) *dependencyGraph {
+	generations := make(map[string]policyGeneration, len(policies))
+
+	for i := range policies {
+		generations[policies[i].Name] = policyGeneration{UID: policies[i].UID, Generation: policies[i].Generation}
+	}
+
+	r.dependencyGraphsLock.Lock()
+	defer r.dependencyGraphsLock.Unlock()
+
+	if cached, ok := r.dependencyGraphs[namespace]; ok && maps.Equal(cached.generations, generations) {
+		return cached.graph
+	}
+
+	if r.dependencyGraphs == nil {
+		r.dependencyGraphs = map[string]*cachedDependencyGraph{}
+	}
+
+	graph := buildDependencyGraph(policies)
+	r.dependencyGraphs[namespace] = &cachedDependencyGraph{graph: graph, generations: generations}
+
+	return graph
+}
+
+// findCycles sets the cycles in the graph using Tarjan's algorithm for strongly connected components. A component is
+// a cycle if it has more than one node or if its node depends on itself.
+func (g *dependencyGraph) findCycles() {
+	index := 0
+	indexes := map[string]int{}
+	lowLinks := map[string]int{}
+	onStack := map[string]bool{}
+	stack := []string{}
+
+	var connect func(node string)
+
+	connect = func(node string) {
+		indexes[node] = index
+		lowLinks[node] = index
+		index++
+
+		stack = append(stack, node)
+		onStack[node] = true
+
+		for _, dep := range g.Edges[node] {
+			if _, visited := indexes[dep]; !visited {
+				connect(dep)
+				lowLinks[node] = min(lowLinks[node], lowLinks[dep])
+			} else if onStack[dep] {
+				lowLinks[node] = min(lowLinks[node], indexes[dep])
+			}
+		}
+
+		if lowLinks[node] != indexes[node] {
+			return
+		}
+
+		component := []string{}
+
+		for {
+			member := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[member] = false
+
+			component = append(component, member)
+
+			if member == node {
+				break
+			}
+		}
+
+		if len(component) == 1 && !slices.Contains(g.Edges[node], node) {
+			return
+		}
+
+		slices.Sort(component)
+
+		g.Cycles = append(g.Cycles, component)
+	}
+
+	// Visit the nodes in a consistent order so that the cycles are reported in a consistent order
+	nodes := make([]string, 0, len(g.Edges))
+	for node := range g.Edges {
+		nodes = append(nodes, node)
+	}
+
+	slices.Sort(nodes)
+
+	for _, node := range nodes {
+		if _, visited := indexes[node]; !visited {
+			connect(node)
+		}
+	}
+
+	slices.SortFunc(g.Cycles, func(a, b []string) int { return strings.Compare(a[0], b[0]) })
+
+	for i, cycle := range g.Cycles {
+		for _, member := range cycle {
+			g.cycleByNode[member] = i
+		}
+	}
+}
+
+// cycle returns the members of the dependency cycle that the node is in, or nil if it's not in one. A nil
+// *dependencyGraph has no cycles.
+func (g *dependencyGraph) cycle(node string) []string {
+	if g == nil {
+		return nil
+	}
+
+	i, ok := g.cycleByNode[node]
+	if !ok {
+		return nil
+	}
+
+	return g.Cycles[i]
+}
+
+// DependencyGraphHandler serves the policy dependency graph of each namespace as JSON for debugging, keyed by the
+// namespace. The namespace query parameter limits the response to the graph of that namespace.
+func (r *PolicyReconciler) DependencyGraphHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		namespace := req.URL.Query().Get("namespace")
+		graphs := map[string]*dependencyGraph{}
+
+		r.dependencyGraphsLock.Lock()
+
+		for graphNamespace, cached := range r.dependencyGraphs {
+			if namespace == "" || graphNamespace == namespace {
+				graphs[graphNamespace] = cached.graph
+			}
+		}
+
+		r.dependencyGraphsLock.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(graphs); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
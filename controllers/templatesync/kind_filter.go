@@ -0,0 +1,251 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templatesync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// TemplateKindsConfigMapName is the name of the optional ConfigMap in the addon's namespace that lists additional
+// policy template kinds to allow or deny. The `allow` and `deny` keys each contain a list of `Kind.group` entries
+// separated by newlines or commas, where `*.group` matches all kinds in the group. The `status-mappings` key contains
+// a map of `Kind.group` to a StatusMapping in YAML.
+const TemplateKindsConfigMapName = "governance-policy-template-kinds"
+
+//+kubebuilder:rbac:groups=core,resources=configmaps,resourceNames=governance-policy-template-kinds,verbs=get;list;watch
+
+// templateKindFilter is the parsed content of the template kinds ConfigMap. A nil *templateKindFilter allows and
+// denies nothing, so all of its methods are safe to call on nil.
+type templateKindFilter struct {
+	allow          []schema.GroupKind
+	deny           []schema.GroupKind
+	statusMappings map[schema.GroupKind]*StatusMapping
+	source         string
+}
+
+// parseTemplateKindFilter parses the allow and deny lists and the status mappings in the ConfigMap. Invalid entries
+// are returned as an error but the valid entries are still used.
+func parseTemplateKindFilter(configMap *corev1.ConfigMap) (*templateKindFilter, error) {
+	filter := &templateKindFilter{
+		source: fmt.Sprintf("the %s/%s ConfigMap", configMap.Namespace, configMap.Name),
+	}
+
+	var invalid []string
+
+	parse := func(key string) []schema.GroupKind {
+		gks := []schema.GroupKind{}
+
+		entries := strings.FieldsFunc(configMap.Data[key], func(r rune) bool {
+			return r == '\n' || r == ','
+		})
+
+		for _, entry := range entries {
+			entry = strings.TrimSpace(entry)
+			if entry == "" || strings.HasPrefix(entry, "#") {
+				continue
+			}
+
+			kind, group, found := strings.Cut(entry, ".")
+			if !found || kind == "" || group == "" {
+				invalid = append(invalid, entry)
+
+				continue
+			}
+
+			// An empty kind matches all kinds in the group, the same as the compiled allow list
+			if kind == "*" {
+				kind = ""
+			}
+
+			gks = append(gks, schema.GroupKind{Group: group, Kind: kind})
+		}
+
+		return gks
+	}
+
+	filter.allow = parse("allow")
+	filter.deny = parse("deny")
+
+	var errs []error
+
+	if len(invalid) > 0 {
+		errs = append(errs, fmt.Errorf(
+			"ignoring the invalid entries in %s, which must be in the format Kind.group or *.group: %s",
+			filter.source, strings.Join(invalid, ", "),
+		))
+	}
+
+	var err error
+
+	filter.statusMappings, err = parseStatusMappings(configMap.Data["status-mappings"])
+	if err != nil {
+		errs = append(errs, fmt.Errorf("ignoring the invalid status mappings in %s: %w", filter.source, err))
+	}
+
+	return filter, errors.Join(errs...)
+}
+
+func matchesGroupKind(gks []schema.GroupKind, target schema.GroupKind) bool {
+	return slices.ContainsFunc(gks, func(gk schema.GroupKind) bool {
+		return target.Group == gk.Group && (gk.Kind == "" || target.Kind == gk.Kind)
+	})
+}
+
+// allowed returns whether the GroupKind is on the allow list and not on the deny list.
+func (f *templateKindFilter) allowed(gk schema.GroupKind) bool {
+	if f == nil {
+		return false
+	}
+
+	return matchesGroupKind(f.allow, gk) && !f.denied(gk)
+}
+
+// denied returns whether the GroupKind is on the deny list. The deny list takes precedence over the allow list, the
+// compiled allow list, and the policy-type=template CRD label.
+func (f *templateKindFilter) denied(gk schema.GroupKind) bool {
+	if f == nil {
+		return false
+	}
+
+	return matchesGroupKind(f.deny, gk)
+}
+
+// statusMapping returns the status mapping for the GroupKind, or nil if there isn't one.
+func (f *templateKindFilter) statusMapping(gk schema.GroupKind) *StatusMapping {
+	if f == nil {
+		return nil
+	}
+
+	return f.statusMappings[gk]
+}
+
+// getTemplateKindFilter returns the parsed template kinds ConfigMap, or nil if it's not configured or doesn't exist.
+// An error is only returned if the ConfigMap couldn't be retrieved.
+func (r *PolicyReconciler) getTemplateKindFilter(ctx context.Context) (*templateKindFilter, error) {
+	if r.TemplateKindsNamespace == "" {
+		return nil, nil
+	}
+
+	configMap := &corev1.ConfigMap{}
+
+	err := r.Get(
+		ctx, types.NamespacedName{Namespace: r.TemplateKindsNamespace, Name: TemplateKindsConfigMapName}, configMap,
+	)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	filter, err := parseTemplateKindFilter(configMap)
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "The template kinds ConfigMap has invalid entries")
+	}
+
+	return filter, nil
+}
+
+// allowedKindGVRs resolves the GroupKinds on the allow list to the preferred version of their resources so that
+// excess templates of those kinds can be cleaned up. The kinds that are also denied are included so that their
+// existing templates are deleted. Groups that aren't installed are skipped.
+func allowedKindGVRs(
+	discoveryClient discovery.DiscoveryInterface, filter *templateKindFilter,
+) (map[schema.GroupVersionResource]scopedKind, error) {
+	gvrs := map[schema.GroupVersionResource]scopedKind{}
+
+	if filter == nil || len(filter.allow) == 0 {
+		return gvrs, nil
+	}
+
+	groups, err := discoveryClient.ServerGroups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the API groups: %w", err)
+	}
+
+	for _, apiGroup := range groups.Groups {
+		if !slices.ContainsFunc(filter.allow, func(gk schema.GroupKind) bool { return gk.Group == apiGroup.Name }) {
+			continue
+		}
+
+		groupVersion := apiGroup.PreferredVersion.GroupVersion
+
+		rsrcList, err := discoveryClient.ServerResourcesForGroupVersion(groupVersion)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the resources in %s: %w", groupVersion, err)
+		}
+
+		gv, err := schema.ParseGroupVersion(groupVersion)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rsrc := range rsrcList.APIResources {
+			// Skip subresources
+			if strings.Contains(rsrc.Name, "/") {
+				continue
+			}
+
+			gk := schema.GroupKind{Group: apiGroup.Name, Kind: rsrc.Kind}
+			if !matchesGroupKind(filter.allow, gk) {
+				continue
+			}
+
+			gvrs[gv.WithResource(rsrc.Name)] = scopedKind{gk: gk, namespaced: rsrc.Namespaced}
+		}
+	}
+
+	return gvrs, nil
+}
+
+// scopedKind is the GroupKind and scope of a resource.
+type scopedKind struct {
+	gk         schema.GroupKind
+	namespaced bool
+}
+
+// templateKindsMapper reconciles all the replicated policies when the template kinds ConfigMap changes so that newly
+// allowed or denied kinds take effect.
+func (r *PolicyReconciler) templateKindsMapper(ctx context.Context, obj client.Object) []reconcile.Request {
+	if obj.GetNamespace() != r.TemplateKindsNamespace || obj.GetName() != TemplateKindsConfigMapName {
+		return nil
+	}
+
+	log := ctrl.LoggerFrom(ctx)
+
+	policies := policiesv1.PolicyList{}
+
+	err := r.List(ctx, &policies)
+	if err != nil {
+		log.Error(err, "Failed to list the policies after the template kinds ConfigMap changed")
+
+		return nil
+	}
+
+	log.Info("The template kinds ConfigMap changed, reconciling all policies", "policies", len(policies.Items))
+
+	requests := make([]reconcile.Request, 0, len(policies.Items))
+
+	for _, policy := range policies.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: policy.Namespace, Name: policy.Name},
+		})
+	}
+
+	return requests
+}
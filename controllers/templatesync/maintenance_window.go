@@ -0,0 +1,54 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templatesync
+
+import (
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+
+	"open-cluster-management.io/governance-policy-framework-addon/controllers/utils"
+)
+
+// frozenTemplate returns whether the policy template must not be created or updated because it enforces and changes
+// are frozen by the maintenance windows, and how long until the policy should be reconciled again to apply it. The
+// duration is 0 when it's not known when changes are allowed again.
+func (r *PolicyReconciler) frozenTemplate(tObjectUnstructured *unstructured.Unstructured) (bool, time.Duration) {
+	if !enforcingTemplate(tObjectUnstructured) {
+		return false, 0
+	}
+
+	frozen, until := r.MaintenanceWindows.Frozen(time.Now())
+	if !frozen {
+		return false, 0
+	}
+
+	if until.IsZero() {
+		return true, 0
+	}
+
+	return true, max(time.Until(until), time.Second)
+}
+
+// enforcingTemplate returns whether the policy template makes changes to the cluster, which is a remediation action of
+// enforce, or a Gatekeeper constraint that denies requests. ConstraintTemplates don't enforce anything on their own.
+func enforcingTemplate(tObjectUnstructured *unstructured.Unstructured) bool {
+	group := tObjectUnstructured.GroupVersionKind().Group
+
+	if group == utils.GConstraint {
+		action, _, _ := unstructured.NestedString(tObjectUnstructured.Object, "spec", "enforcementAction")
+
+		// Gatekeeper denies requests when the enforcement action isn't set
+		return action == "" || strings.EqualFold(action, "deny")
+	}
+
+	if group == utils.GvkConstraintTemplate.Group {
+		return false
+	}
+
+	action, _, _ := unstructured.NestedString(tObjectUnstructured.Object, "spec", "remediationAction")
+
+	return strings.EqualFold(action, string(policiesv1.Enforce))
+}
@@ -0,0 +1,182 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templatesync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	depclient "github.com/stolostron/kubernetes-dependency-watches/client"
+	corev1 "k8s.io/api/core/v1"
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// pendingTimeoutAnnotation is the annotation on a policy or a policy template that sets how long, as a duration
+	// such as `30m`, a template can be pending before it's reported as noncompliant. The annotation on a template takes
+	// precedence over the annotation on the policy.
+	pendingTimeoutAnnotation = "policy.open-cluster-management.io/pending-timeout"
+	// pendingTimeoutActionAnnotation is the annotation on a policy or a policy template that determines what happens
+	// to an existing template object once the pending timeout elapses. See the pendingTimeoutAction constants.
+	pendingTimeoutActionAnnotation = "policy.open-cluster-management.io/pending-timeout-action"
+
+	pendingMsgPrefix = "Dependencies were not satisfied"
+	timeoutMsgPrefix = "Dependencies were not satisfied within the pending timeout"
+)
+
+type pendingTimeoutAction string
+
+const (
+	// pendingTimeoutDelete deletes an existing template object, the same as before the timeout. This is the default.
+	pendingTimeoutDelete pendingTimeoutAction = "Delete"
+	// pendingTimeoutSkip leaves an existing template object as is rather than deleting it.
+	pendingTimeoutSkip pendingTimeoutAction = "Skip"
+)
+
+// pendingTimeout is the parsed pending timeout of a policy template. A nil *pendingTimeout means the template can be
+// pending indefinitely.
+type pendingTimeout struct {
+	timeout time.Duration
+	action  pendingTimeoutAction
+}
+
+// getPendingTimeout returns the pending timeout of the policy template from its annotations or the policy's
+// annotations, or nil if neither sets one.
+func getPendingTimeout(pol *policiesv1.Policy, tAnnotations map[string]string) (*pendingTimeout, error) {
+	lookup := func(key string) string {
+		if val, ok := tAnnotations[key]; ok {
+			return val
+		}
+
+		return pol.GetAnnotations()[key]
+	}
+
+	rawTimeout := lookup(pendingTimeoutAnnotation)
+	if rawTimeout == "" {
+		return nil, nil
+	}
+
+	timeout, err := time.ParseDuration(rawTimeout)
+	if err != nil || timeout <= 0 {
+		return nil, fmt.Errorf("the %s annotation must be a positive duration: %s", pendingTimeoutAnnotation, rawTimeout)
+	}
+
+	action := pendingTimeoutAction(lookup(pendingTimeoutActionAnnotation))
+
+	switch action {
+	case "":
+		action = pendingTimeoutDelete
+	case pendingTimeoutDelete, pendingTimeoutSkip:
+	default:
+		return nil, fmt.Errorf(
+			"the %s annotation must be %s or %s: %s",
+			pendingTimeoutActionAnnotation, pendingTimeoutDelete, pendingTimeoutSkip, action,
+		)
+	}
+
+	return &pendingTimeout{timeout: timeout, action: action}, nil
+}
+
+// pendingSince returns when the policy template started pending based on its compliance history, which is ordered
+// from newest to oldest. The timeout events are included since they replace the pending events. If the template isn't
+// pending yet in the history, the zero time is returned.
+func pendingSince(pol *policiesv1.Policy, tIndex int) time.Time {
+	if tIndex >= len(pol.Status.Details) || pol.Status.Details[tIndex] == nil {
+		return time.Time{}
+	}
+
+	var since time.Time
+
+	for _, history := range pol.Status.Details[tIndex].History {
+		if !strings.HasPrefix(history.Message, string(policiesv1.Pending)+"; "+pendingMsgPrefix) &&
+			!strings.HasPrefix(history.Message, string(policiesv1.NonCompliant)+"; "+timeoutMsgPrefix) {
+			break
+		}
+
+		since = history.LastTimestamp.Time
+	}
+
+	return since
+}
+
+// generateTimeoutMsg formats the reason each dependency was not satisfied into the message sent once the pending
+// timeout elapses.
+// Example: `Dependencies were not satisfied within the pending timeout of 1h0m0s: FooPolicy foo: Compliance mismatch
+// on the dependency object`
+func generateTimeoutMsg(
+	timeout time.Duration, dependencyFailures map[depclient.ObjectIdentifier]string, expressionFailures ...string,
+) string {
+	reasons := make([]string, 0, len(dependencyFailures)+len(expressionFailures))
+
+	for dep, reason := range dependencyFailures {
+		reasons = append(reasons, fmt.Sprintf("%s %s: %s", dep.Kind, dep.Name, reason))
+	}
+
+	sort.Strings(reasons)
+
+	reasons = append(reasons, expressionFailures...)
+
+	return fmt.Sprintf("%s of %s: %s", timeoutMsgPrefix, timeout, strings.Join(reasons, "; "))
+}
+
+// emitTemplatePendingOrTimeout sends a pending event for the policy template, or a noncompliant event once the
+// template has been pending longer than its pending timeout. It returns whether the timeout elapsed and, if it hasn't,
+// how long until it does so that the policy can be requeued. The pending duration gauge is also updated.
+func (r *PolicyReconciler) emitTemplatePendingOrTimeout(
+	ctx context.Context,
+	pol *policiesv1.Policy,
+	tIndex int,
+	tName string,
+	clusterScoped bool,
+	timeout *pendingTimeout,
+	dependencyFailures map[depclient.ObjectIdentifier]string,
+	expressionFailures []string,
+) (bool, time.Duration, error) {
+	now := time.Now()
+
+	since := pendingSince(pol, tIndex)
+	if since.IsZero() {
+		since = now
+	}
+
+	pendingDuration := now.Sub(since)
+
+	templatePendingGauge.WithLabelValues(pol.Name, pol.Namespace, tName).Set(pendingDuration.Seconds())
+
+	if timeout == nil || pol.Spec.PolicyTemplates[tIndex].IgnorePending {
+		return false, 0, r.emitTemplatePending(
+			ctx, pol, tIndex, tName, clusterScoped, generatePendingMsg(dependencyFailures, expressionFailures...),
+		)
+	}
+
+	if pendingDuration < timeout.timeout {
+		return false, timeout.timeout - pendingDuration, r.emitTemplatePending(
+			ctx, pol, tIndex, tName, clusterScoped, generatePendingMsg(dependencyFailures, expressionFailures...),
+		)
+	}
+
+	ctrl.LoggerFrom(ctx).Info(
+		"The policy template exceeded its pending timeout", "template", tName, "timeout", timeout.timeout.String(),
+	)
+
+	msg := generateTimeoutMsg(timeout.timeout, dependencyFailures, expressionFailures...)
+
+	err := r.emitTemplateEvent(
+		ctx, pol, tIndex, tName, clusterScoped, corev1.EventTypeWarning, policiesv1.NonCompliant, msg,
+	)
+
+	return true, 0, err
+}
+
+// minRequeueAfter returns the shortest of the non-zero durations, or zero if both are zero.
+func minRequeueAfter(current time.Duration, next time.Duration) time.Duration {
+	if current == 0 || (next != 0 && next < current) {
+		return next
+	}
+
+	return current
+}
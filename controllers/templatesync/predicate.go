@@ -4,16 +4,27 @@
 package templatesync
 
 import (
-	"strings"
+	"context"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"open-cluster-management.io/governance-policy-framework-addon/controllers/utils"
 )
 
+// historyEventsTimeout bounds how long the predicate waits on the reader for the compliance events in a policy's
+// history, since it's on the watch's hot path. The details of the remaining entries are parsed from their messages.
+const historyEventsTimeout = 2 * time.Second
+
 // templatePredicates filters out changes to policies that don't need to be
-// considered by the template-sync controller.
-func templatePredicates() predicate.Funcs {
+// considered by the template-sync controller. The reader is used to get the
+// compliance events in the policy's history from the cache.
+func templatePredicates(reader client.Reader) predicate.Funcs {
 	return predicate.Funcs{
 		UpdateFunc: func(e event.UpdateEvent) bool {
 			oldPolicy := e.ObjectOld.(*policiesv1.Policy)
@@ -36,13 +47,18 @@ func templatePredicates() predicate.Funcs {
 			// found and the "current" (0th) event is not a `template-error`, then
 			// reconcile to determine if the template-error event needs to be
 			// re-sent.
+			ctx, cancel := context.WithTimeout(context.Background(), historyEventsTimeout)
+			defer cancel()
+
 			for _, dpt := range updatedPolicy.Status.Details {
 				if dpt == nil {
 					continue
 				}
 
 				for i, historyEvent := range dpt.History {
-					if strings.Contains(historyEvent.Message, "template-error") {
+					details := historyComplianceDetails(ctx, reader, updatedPolicy.Namespace, historyEvent)
+
+					if details.Category == utils.CategoryTemplateError {
 						if i == 0 {
 							break
 						}
@@ -57,6 +73,26 @@ func templatePredicates() predicate.Funcs {
 	}
 }
 
+// historyComplianceDetails returns the compliance details from the annotations of the compliance event of the history
+// entry. When the event no longer exists, doesn't have the annotations, or the context is done, the details are parsed
+// from the message.
+func historyComplianceDetails(
+	ctx context.Context, reader client.Reader, namespace string, history policiesv1.ComplianceHistory,
+) utils.ComplianceDetails {
+	if reader != nil && history.EventName != "" && ctx.Err() == nil {
+		complianceEvent := &corev1.Event{}
+
+		err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: history.EventName}, complianceEvent)
+		if err == nil {
+			if details, ok := utils.ComplianceDetailsFromAnnotations(complianceEvent.GetAnnotations()); ok {
+				return details
+			}
+		}
+	}
+
+	return utils.ComplianceDetailsFromMessage(history.Message)
+}
+
 // hasAnyDependencies returns true if the policy has any Dependencies or if
 // any of its templates have any ExtraDependencies.
 func hasAnyDependencies(pol *policiesv1.Policy) bool {
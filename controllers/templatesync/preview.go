@@ -0,0 +1,301 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templatesync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// PreviewEventReason is the reason of the event that records the changes template-sync would have made to a
+	// policy's templates while in preview mode.
+	PreviewEventReason = "PolicyTemplateSyncPreview"
+
+	previewCreate = "create"
+	previewUpdate = "update"
+	previewDelete = "delete"
+	previewSkip   = "skip"
+
+	// maxPreviewPatchBytes is the size above which a template change's patch is left out of the preview event and
+	// summarized by the fields it changes instead.
+	maxPreviewPatchBytes = 4 * 1024
+	// maxPreviewEventBytes is the total size of the patches above which all of them are summarized in the preview
+	// event, so that a policy with many templates doesn't produce an event too large to store.
+	maxPreviewEventBytes = 32 * 1024
+)
+
+// templateChange is a single create, update, or delete decision made by template-sync that was not applied to the
+// managed cluster due to preview mode.
+type templateChange struct {
+	Action     string          `json:"action"`
+	APIVersion string          `json:"apiVersion"`
+	Kind       string          `json:"kind"`
+	Namespace  string          `json:"namespace,omitempty"`
+	Name       string          `json:"name"`
+	Reason     string          `json:"reason,omitempty"`
+	Patch      json.RawMessage `json:"patch,omitempty"`
+	// PatchSummary replaces the patch in the preview event when the patch is too large.
+	PatchSummary string `json:"patchSummary,omitempty"`
+}
+
+// templateSyncPreview collects the template changes computed during a single reconcile of a policy in preview mode.
+// A nil *templateSyncPreview means preview mode is disabled, so all of its methods are safe to call on nil.
+type templateSyncPreview struct {
+	Changes []templateChange `json:"changes"`
+}
+
+// enabled returns whether template changes should be recorded rather than applied.
+func (p *templateSyncPreview) enabled() bool {
+	return p != nil
+}
+
+// dryRun returns the dry-run option to pass on API writes so that the API server still validates them in preview
+// mode.
+func (p *templateSyncPreview) dryRun() []string {
+	if p == nil {
+		return nil
+	}
+
+	return []string{metav1.DryRunAll}
+}
+
+// record adds a change for the input object. When both the existing and desired objects are provided, the JSON merge
+// patch between them is stored. When only the desired object is provided, the whole desired object is stored.
+func (p *templateSyncPreview) record(
+	ctx context.Context, action string, existing, desired *unstructured.Unstructured, reason string,
+) {
+	if p == nil {
+		return
+	}
+
+	obj := desired
+	if obj == nil {
+		obj = existing
+	}
+
+	change := templateChange{
+		Action:     action,
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+		Reason:     reason,
+	}
+
+	if desired != nil {
+		patch, err := previewPatch(existing, desired)
+		if err != nil {
+			ctrl.LoggerFrom(ctx).Error(err, "Failed to compute the preview patch. Continuing without it.",
+				"kind", change.Kind, "name", change.Name)
+		} else if action == previewUpdate && string(patch) == "{}" {
+			// Nothing would change
+			return
+		} else {
+			change.Patch = patch
+		}
+	}
+
+	p.Changes = append(p.Changes, change)
+}
+
+// previewPatch returns the JSON merge patch from existing to desired, or the full desired object if existing is nil.
+// Managed fields are ignored since they always differ after a server-side apply dry run.
+func previewPatch(existing, desired *unstructured.Unstructured) (json.RawMessage, error) {
+	desired = desired.DeepCopy()
+	unstructured.RemoveNestedField(desired.Object, "metadata", "managedFields")
+
+	desiredJSON, err := json.Marshal(desired.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing == nil {
+		return desiredJSON, nil
+	}
+
+	existing = existing.DeepCopy()
+	unstructured.RemoveNestedField(existing.Object, "metadata", "managedFields")
+
+	existingJSON, err := json.Marshal(existing.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	return jsonpatch.CreateMergePatch(existingJSON, desiredJSON)
+}
+
+// capped returns a copy of the preview for the event message where each patch larger than maxPreviewPatchBytes is
+// replaced by a summary. When the remaining patches are still larger than maxPreviewEventBytes, all of them are.
+func (p *templateSyncPreview) capped() *templateSyncPreview {
+	capped := &templateSyncPreview{Changes: slices.Clone(p.Changes)}
+	total := 0
+
+	for i := range capped.Changes {
+		if len(capped.Changes[i].Patch) > maxPreviewPatchBytes {
+			capped.Changes[i].summarizePatch()
+		}
+
+		total += len(capped.Changes[i].Patch)
+	}
+
+	if total > maxPreviewEventBytes {
+		for i := range capped.Changes {
+			capped.Changes[i].summarizePatch()
+		}
+	}
+
+	return capped
+}
+
+// summarizePatch replaces the patch with a summary of its size and the fields it changes, such as
+// `spec.remediationAction`. Only the first two levels of fields are listed.
+func (c *templateChange) summarizePatch() {
+	if c.Patch == nil {
+		return
+	}
+
+	patch := map[string]any{}
+	fields := []string{}
+
+	if err := json.Unmarshal(c.Patch, &patch); err == nil {
+		for key, value := range patch {
+			nested, ok := value.(map[string]any)
+			if !ok || len(nested) == 0 {
+				fields = append(fields, key)
+
+				continue
+			}
+
+			for nestedKey := range nested {
+				fields = append(fields, key+"."+nestedKey)
+			}
+		}
+	}
+
+	slices.Sort(fields)
+
+	c.PatchSummary = fmt.Sprintf("The patch of %d bytes is too large to include", len(c.Patch))
+
+	if len(fields) > 0 {
+		c.PatchSummary += ". It changes " + strings.Join(fields, ", ")
+	}
+
+	c.Patch = nil
+}
+
+// summary returns a short human readable summary of the recorded changes, such as `1 create, 2 update`.
+func (p *templateSyncPreview) summary() string {
+	counts := map[string]int{}
+
+	for _, change := range p.Changes {
+		counts[change.Action]++
+	}
+
+	parts := []string{}
+
+	for _, action := range []string{previewCreate, previewUpdate, previewDelete, previewSkip} {
+		if counts[action] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[action], action))
+		}
+	}
+
+	if len(parts) == 0 {
+		return "no changes"
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// previewEnabled returns whether the policy is in preview mode. The policy annotation takes precedence over the
+// global setting so that a single policy can opt in or out.
+func (r *PolicyReconciler) previewEnabled(pol *policiesv1.Policy) bool {
+	if val, ok := pol.GetAnnotations()[previewAnnotation]; ok {
+		return strings.EqualFold(val, "true")
+	}
+
+	return r.PreviewMode
+}
+
+// emitPreview sends an event on the policy with the changes that template-sync would have made. The event is only
+// sent when the preview differs from the last one sent for the policy, to avoid an event on every reconcile.
+func (r *PolicyReconciler) emitPreview(
+	ctx context.Context, pol *policiesv1.Policy, preview *templateSyncPreview,
+) error {
+	if preview == nil {
+		return nil
+	}
+
+	previewJSON, err := json.Marshal(preview)
+	if err != nil {
+		return err
+	}
+
+	key := types.NamespacedName{Namespace: pol.Namespace, Name: pol.Name}
+	digest := sha256.Sum256(previewJSON)
+
+	if lastDigest, ok := r.lastPreviews.Load(key); ok && lastDigest.([32]byte) == digest {
+		return nil
+	}
+
+	log := ctrl.LoggerFrom(ctx)
+	log.Info("Template sync preview", "summary", preview.summary(), "changes", string(previewJSON))
+
+	// The digest is of the full preview so that a change within a summarized patch still sends a new event
+	eventJSON, err := json.Marshal(preview.capped())
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	// The events.k8s.io API limits the note to 1kB, so the core API is used to allow for larger diffs.
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%v.%x", pol.Name, now.UnixNano()),
+			Namespace: pol.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:       pol.Kind,
+			Namespace:  pol.Namespace,
+			Name:       pol.Name,
+			UID:        pol.UID,
+			APIVersion: pol.APIVersion,
+		},
+		Reason:  PreviewEventReason,
+		Message: fmt.Sprintf("Preview (%s): %s", preview.summary(), eventJSON),
+		Source: corev1.EventSource{
+			Component: ControllerName,
+			Host:      r.InstanceName,
+		},
+		FirstTimestamp:      metav1.NewTime(now),
+		LastTimestamp:       metav1.NewTime(now),
+		Count:               1,
+		Type:                corev1.EventTypeNormal,
+		Action:              "TemplateSyncPreview",
+		ReportingController: ControllerName,
+		ReportingInstance:   r.InstanceName,
+	}
+
+	_, err = r.Clientset.CoreV1().Events(pol.Namespace).Create(ctx, event, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+
+	r.lastPreviews.Store(key, digest)
+
+	return nil
+}
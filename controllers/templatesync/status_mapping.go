@@ -0,0 +1,251 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templatesync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/jsonpath"
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// StatusMappingAnnotation is the annotation on a policy template CRD that contains the StatusMapping for the kind in
+// JSON or YAML. A mapping in the template kinds ConfigMap takes precedence.
+const StatusMappingAnnotation = "policy.open-cluster-management.io/status-mapping"
+
+var errStatusNotReported = errors.New("the status value was not found")
+
+// StatusMapping declares how to determine the compliance of an object of a policy engine that doesn't report its own
+// compliance, so that its policy templates get compliance events and can be used as dependencies.
+type StatusMapping struct {
+	// CompliancePath is a JSONPath expression, such as `{.status.phase}`, whose value determines the compliance.
+	CompliancePath string `json:"compliancePath"`
+	// Compliant is the list of values of CompliancePath that mean the object is compliant.
+	Compliant []string `json:"compliant,omitempty"`
+	// NonCompliant is the list of values of CompliancePath that mean the object is noncompliant. If it's empty, any
+	// value not in Compliant or Pending is noncompliant.
+	NonCompliant []string `json:"nonCompliant,omitempty"`
+	// Pending is the list of values of CompliancePath that mean the object is still being evaluated.
+	Pending []string `json:"pending,omitempty"`
+	// MessagePath is an optional JSONPath expression whose value is used as the compliance message.
+	MessagePath string `json:"messagePath,omitempty"`
+}
+
+// parseStatusMapping parses and validates a StatusMapping in JSON or YAML.
+func parseStatusMapping(data []byte) (*StatusMapping, error) {
+	mapping := &StatusMapping{}
+
+	err := yaml.UnmarshalStrict(data, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	return mapping, mapping.validate()
+}
+
+func (m *StatusMapping) validate() error {
+	if m.CompliancePath == "" {
+		return errors.New("compliancePath must be set")
+	}
+
+	for _, path := range []string{m.CompliancePath, m.MessagePath} {
+		if path == "" {
+			continue
+		}
+
+		if err := jsonpath.New("").Parse(path); err != nil {
+			return fmt.Errorf("invalid JSONPath %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// evaluate returns the compliance and message of the object based on the mapping. If the compliance value isn't set
+// on the object or doesn't match any of the values in the mapping, errStatusNotReported is returned.
+func (m *StatusMapping) evaluate(obj *unstructured.Unstructured) (policiesv1.ComplianceState, string, error) {
+	value, err := jsonPathValue(m.CompliancePath, obj)
+	if err != nil {
+		return "", "", err
+	}
+
+	if value == "" {
+		return "", "", errStatusNotReported
+	}
+
+	var compliance policiesv1.ComplianceState
+
+	switch {
+	case slices.Contains(m.Compliant, value):
+		compliance = policiesv1.Compliant
+	case slices.Contains(m.Pending, value):
+		compliance = policiesv1.Pending
+	case len(m.NonCompliant) == 0 || slices.Contains(m.NonCompliant, value):
+		compliance = policiesv1.NonCompliant
+	default:
+		return "", "", fmt.Errorf("%w: %s is not a mapped value", errStatusNotReported, value)
+	}
+
+	msg := fmt.Sprintf("%s %s has the status %s", obj.GetKind(), obj.GetName(), value)
+
+	if m.MessagePath != "" {
+		customMsg, err := jsonPathValue(m.MessagePath, obj)
+		if err != nil {
+			return "", "", err
+		}
+
+		if customMsg != "" {
+			msg = customMsg
+		}
+	}
+
+	return compliance, msg, nil
+}
+
+// jsonPathValue returns the values at the JSONPath in the object joined by commas, or an empty string if there are
+// none.
+func jsonPathValue(path string, obj *unstructured.Unstructured) (string, error) {
+	jp := jsonpath.New("").AllowMissingKeys(true)
+
+	if err := jp.Parse(path); err != nil {
+		return "", err
+	}
+
+	results, err := jp.FindResults(obj.Object)
+	if err != nil {
+		return "", err
+	}
+
+	values := []string{}
+
+	for _, result := range results {
+		for _, value := range result {
+			if value.CanInterface() {
+				values = append(values, fmt.Sprint(value.Interface()))
+			}
+		}
+	}
+
+	return strings.Join(values, ", "), nil
+}
+
+// parseStatusMappings parses the `status-mappings` key of the template kinds ConfigMap, which is a map of
+// `Kind.group` to a StatusMapping in YAML. Invalid entries are returned as an error but the valid entries are still
+// used.
+func parseStatusMappings(data string) (map[schema.GroupKind]*StatusMapping, error) {
+	mappings := map[schema.GroupKind]*StatusMapping{}
+
+	if data == "" {
+		return mappings, nil
+	}
+
+	rawMappings := map[string]json.RawMessage{}
+
+	if err := yaml.Unmarshal([]byte(data), &rawMappings); err != nil {
+		return mappings, fmt.Errorf("invalid status-mappings: %w", err)
+	}
+
+	var errs []error
+
+	for key, rawMapping := range rawMappings {
+		gk := schema.ParseGroupKind(key)
+		if gk.Kind == "" || gk.Group == "" {
+			errs = append(errs, fmt.Errorf("invalid status-mappings key %s, which must be in the format Kind.group", key))
+
+			continue
+		}
+
+		mapping, err := parseStatusMapping(rawMapping)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid status-mappings entry %s: %w", key, err))
+
+			continue
+		}
+
+		mappings[gk] = mapping
+	}
+
+	return mappings, errors.Join(errs...)
+}
+
+// getStatusMapping returns the StatusMapping for the kind from the template kinds ConfigMap or from the annotation on
+// its CRD, or nil if there isn't one. Only CRDs with the policy-type=template label are in the cache, so other kinds
+// must be mapped in the ConfigMap.
+func (r *PolicyReconciler) getStatusMapping(
+	ctx context.Context, kindFilter *templateKindFilter, gk schema.GroupKind, gr schema.GroupResource,
+) *StatusMapping {
+	if mapping := kindFilter.statusMapping(gk); mapping != nil {
+		return mapping
+	}
+
+	crd := extensionsv1.CustomResourceDefinition{}
+
+	err := r.Get(ctx, types.NamespacedName{Name: gr.String()}, &crd)
+	if err != nil {
+		if !k8serrors.IsNotFound(err) && !apimeta.IsNoMatchError(err) {
+			ctrl.LoggerFrom(ctx).Error(err, "Failed to get the CRD to check for a status mapping", "crd", gr.String())
+		}
+
+		return nil
+	}
+
+	rawMapping, ok := crd.GetAnnotations()[StatusMappingAnnotation]
+	if !ok {
+		return nil
+	}
+
+	mapping, err := parseStatusMapping([]byte(rawMapping))
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "The status mapping annotation on the CRD is invalid", "crd", gr.String())
+
+		return nil
+	}
+
+	return mapping
+}
+
+// emitMappedCompliance sends a compliance event for the policy template based on the status mapping of its kind. If
+// the object hasn't reported a mapped status yet, no event is sent.
+func (r *PolicyReconciler) emitMappedCompliance(
+	ctx context.Context,
+	pol *policiesv1.Policy,
+	tIndex int,
+	tName string,
+	clusterScoped bool,
+	mapping *StatusMapping,
+	obj *unstructured.Unstructured,
+) error {
+	compliance, msg, err := mapping.evaluate(obj)
+	if err != nil {
+		if errors.Is(err, errStatusNotReported) {
+			ctrl.LoggerFrom(ctx).V(1).Info("The policy template has not reported a mapped status yet", "reason", err)
+
+			return nil
+		}
+
+		return r.emitTemplateError(
+			ctx, pol, tIndex, tName, clusterScoped, fmt.Sprintf("Failed to evaluate the status mapping: %s", err),
+		)
+	}
+
+	eventType := corev1.EventTypeWarning
+	if compliance == policiesv1.Compliant {
+		eventType = corev1.EventTypeNormal
+	}
+
+	return r.emitTemplateEvent(ctx, pol, tIndex, tName, clusterScoped, eventType, compliance, msg)
+}
@@ -5,6 +5,8 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"open-cluster-management.io/governance-policy-framework-addon/controllers/utils"
 )
 
 var (
@@ -15,6 +17,7 @@ var (
 		},
 		[]string{
 			"policy",
+			"namespace",
 			"template",
 			"type",
 		},
@@ -26,10 +29,35 @@ var (
 		},
 		[]string{
 			"policy",
+			"namespace",
 			"template",
 			"type",
 		},
 	)
+	templateSyncLatencyHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "policy_template_sync_latency_seconds",
+			Help: "The time from when a policy changed on the managed cluster to when its policy templates were " +
+				"created or updated",
+			Buckets: utils.LagBuckets,
+		},
+		[]string{
+			"controller",
+			"policy",
+			"namespace",
+		},
+	)
+	templatePendingGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "policy_template_pending_seconds",
+			Help: "The number of seconds a policy template has been pending on its dependencies",
+		},
+		[]string{
+			"policy",
+			"namespace",
+			"template",
+		},
+	)
 )
 
 func init() {
@@ -46,4 +74,25 @@ func init() {
 	if regErr != nil && !errors.As(regErr, alreadyReg) {
 		panic(regErr)
 	}
+
+	regErr = metrics.Registry.Register(templateSyncLatencyHistogram)
+	if regErr != nil && !errors.As(regErr, alreadyReg) {
+		panic(regErr)
+	}
+
+	regErr = metrics.Registry.Register(templatePendingGauge)
+	if regErr != nil && !errors.As(regErr, alreadyReg) {
+		panic(regErr)
+	}
+}
+
+// deletePolicyMetrics removes the metrics of a policy that was deleted. The namespace is included since the policies
+// from each hub are in their own namespace on the managed cluster and can have the same name.
+func deletePolicyMetrics(namespace string, policyName string) {
+	labels := prometheus.Labels{"policy": policyName, "namespace": namespace}
+
+	_ = policyUserErrorsCounter.DeletePartialMatch(labels)
+	_ = policySystemErrorsCounter.DeletePartialMatch(labels)
+	_ = templatePendingGauge.DeletePartialMatch(labels)
+	_ = templateSyncLatencyHistogram.DeletePartialMatch(labels)
 }
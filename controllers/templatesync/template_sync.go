@@ -14,12 +14,12 @@ import (
 	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	gktemplatesv1 "github.com/open-policy-agent/frameworks/constraint/pkg/apis/templates/v1"
 	gktemplatesv1beta1 "github.com/open-policy-agent/frameworks/constraint/pkg/apis/templates/v1beta1"
-	"github.com/prometheus/client_golang/prometheus"
 	depclient "github.com/stolostron/kubernetes-dependency-watches/client"
 	corev1 "k8s.io/api/core/v1"
 	extensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
@@ -41,8 +41,10 @@ import (
 	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
 	"open-cluster-management.io/governance-policy-propagator/controllers/common"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
@@ -54,6 +56,8 @@ const (
 	ControllerName string = "policy-template-sync"
 
 	hubTmplErrorKey = "policy.open-cluster-management.io/hub-templates-error"
+	// previewAnnotation overrides the global preview mode for a single policy when set to "true" or "false".
+	previewAnnotation = "policy.open-cluster-management.io/template-sync-preview"
 )
 
 //+kubebuilder:rbac:groups=policy.open-cluster-management.io,resources=*,verbs=get;list;watch;create;update;patch;delete
@@ -64,16 +68,22 @@ const (
 
 // Setup sets up the controller
 func (r *PolicyReconciler) Setup(mgr ctrl.Manager, depEvents source.Source) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	bldr := ctrl.NewControllerManagedBy(mgr).
 		Named(ControllerName).
-		For(&policiesv1.Policy{}).
-		WithEventFilter(templatePredicates()).
+		For(&policiesv1.Policy{}, builder.WithPredicates(r.Selector.Predicate(), templatePredicates(mgr.GetCache()))).
 		WithOptions(controller.Options{MaxConcurrentReconciles: r.ConcurrentReconciles}).
 		WatchesRawSource(depEvents).
 		WithLogConstructor(func(req *reconcile.Request) logr.Logger {
 			return utils.LogConstructor(ControllerName, "Policy", req)
-		}).
-		Complete(r)
+		})
+
+	if r.TemplateKindsNamespace != "" {
+		bldr = bldr.Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.templateKindsMapper))
+	}
+
+	return bldr.Complete(utils.TraceReconciler(
+		ControllerName, r.Client, func() client.Object { return &policiesv1.Policy{} }, r,
+	))
 }
 
 // blank assignment to verify that ReconcilePolicy implements reconcile.Reconciler
@@ -84,16 +94,37 @@ type PolicyReconciler struct {
 	// This client, initialized using mgr.Client() above, is a split client
 	// that reads objects from the cache and writes to the apiserver
 	client.Client
-	DynamicWatcher       depclient.DynamicWatcher
-	Scheme               *runtime.Scheme
-	Config               *rest.Config
-	Recorder             events.EventRecorder
-	ClusterNamespace     string
-	Clientset            *kubernetes.Clientset
-	InstanceName         string
-	DisableGkSync        bool
+	DynamicWatcher depclient.DynamicWatcher
+	Scheme         *runtime.Scheme
+	Config         *rest.Config
+	Recorder       events.EventRecorder
+	Clientset      *kubernetes.Clientset
+	InstanceName   string
+	DisableGkSync  bool
+	// ServerSideApply writes policy templates that changed with server-side apply using a dedicated field manager
+	// rather than a full update.
+	ServerSideApply      bool
 	createdGkConstraint  *bool
 	ConcurrentReconciles int
+	// PreviewMode reports the template changes as an event instead of applying them, unless overridden by the
+	// policy's template-sync-preview annotation.
+	PreviewMode bool
+	// A cache of the last preview sent per policy to avoid repeating preview events. Each value is a SHA256 digest.
+	lastPreviews sync.Map
+	// TemplateKindsNamespace is the namespace of the optional template kinds ConfigMap. When empty, only the compiled
+	// allow list and the policy-type=template CRD label determine which policy template kinds are synced.
+	TemplateKindsNamespace string
+	// The policy generation for which the sync latency was last observed per policy template, so that template
+	// changes unrelated to a policy change aren't observed. The key is the policy namespace, name, and template name.
+	latencyObserved sync.Map
+	// Selector selects the policies that this deployment syncs the templates of. Every policy is synced when it's nil.
+	Selector *utils.PolicySelector
+	// MaintenanceWindows pauses the creation and update of the policy templates that enforce while changes are frozen.
+	// Nothing is paused when it's nil.
+	MaintenanceWindows *utils.MaintenanceWindows
+	// The dependency graph of the policies in each namespace, which is only rebuilt when the policies change.
+	dependencyGraphs     map[string]*cachedDependencyGraph
+	dependencyGraphsLock sync.Mutex
 }
 
 // Reconcile reads that state of the cluster for a Policy object and makes changes based on the state read
@@ -123,8 +154,16 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 			// finalizers.
 			reqLogger.Info("Policy not found, may have been deleted, reconciliation completed")
 
-			_ = policyUserErrorsCounter.DeletePartialMatch(prometheus.Labels{"policy": request.Name})
-			_ = policySystemErrorsCounter.DeletePartialMatch(prometheus.Labels{"policy": request.Name})
+			deletePolicyMetrics(request.Namespace, request.Name)
+			r.lastPreviews.Delete(request.NamespacedName)
+
+			r.latencyObserved.Range(func(key, _ any) bool {
+				if strings.HasPrefix(key.(string), request.Namespace+"/"+request.Name+"/") {
+					r.latencyObserved.Delete(key)
+				}
+
+				return true
+			})
 
 			err := r.DynamicWatcher.RemoveWatcher(policyObjectID)
 			if err != nil {
@@ -138,11 +177,23 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 		// Error reading the object - requeue the request.
 		reqLogger.Error(err, "Failed to get the policy, will requeue the request")
 
-		policySystemErrorsCounter.WithLabelValues(request.Name, "", "get-error").Inc()
+		policySystemErrorsCounter.WithLabelValues(request.Name, request.Namespace, "", "get-error").Inc()
 
 		return reconcile.Result{}, err
 	}
 
+	// The policy can stop being selected after its watches were added, such as when its labels change
+	if !r.Selector.Matches(instance) {
+		reqLogger.V(1).Info("Policy is not selected by this deployment, skipping it")
+
+		err := r.DynamicWatcher.RemoveWatcher(policyObjectID)
+		if err != nil {
+			reqLogger.Error(err, "Error updating dependency watcher. Ignoring the failure.")
+		}
+
+		return reconcile.Result{}, nil
+	}
+
 	var discoveryClient discovery.DiscoveryInterface
 	var dClient dynamic.Interface
 
@@ -154,7 +205,7 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 		if err != nil {
 			reqLogger.Error(err, "Failed to create dynamic client")
 
-			policySystemErrorsCounter.WithLabelValues(instance.Name, "", "client-error").Inc()
+			policySystemErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, "", "client-error").Inc()
 
 			return reconcile.Result{}, err
 		}
@@ -165,7 +216,7 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 		if hasClusterwideFinalizer(instance) {
 			removeFinalizer(instance, utils.ClusterwideFinalizer)
 
-			err = r.Update(ctx, instance)
+			err = r.Update(ctx, instance, client.FieldOwner(FieldManager))
 			if err != nil {
 				reqLogger.Error(err, "Failed to update policy when removing finalizers")
 
@@ -212,11 +263,11 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 		reqLogger.Info("Cleanup complete--removing clusterwide cleanup finalizer")
 		removeFinalizer(instance, utils.ClusterwideFinalizer)
 
-		err = r.Update(ctx, instance)
+		err = r.Update(ctx, instance, client.FieldOwner(FieldManager))
 		if err != nil {
 			reqLogger.Error(err, "Failed to update policy when removing finalizers")
 
-			policySystemErrorsCounter.WithLabelValues(instance.Name, "", "patch-error").Inc()
+			policySystemErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, "", "patch-error").Inc()
 
 			return reconcile.Result{}, err
 		}
@@ -232,6 +283,41 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 		return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
 	}
 
+	// In preview mode, changes to the templates are recorded and sent as an event rather than applied. A nil preview
+	// means preview mode is disabled.
+	var preview *templateSyncPreview
+
+	if r.previewEnabled(instance) {
+		reqLogger.V(1).Info("The policy is in preview mode, template changes will not be applied")
+
+		preview = &templateSyncPreview{Changes: []templateChange{}}
+	}
+
+	kindFilter, err := r.getTemplateKindFilter(ctx)
+	if err != nil {
+		reqLogger.Error(err, "Failed to get the template kinds ConfigMap, will requeue the request")
+
+		policySystemErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, "", "get-error").Inc()
+
+		return reconcile.Result{}, err
+	}
+
+	// Get the dependency graph across all the policies in the policy's namespace to detect dependency cycles, which
+	// would otherwise leave the templates in the cycle pending indefinitely. The policies are only read to determine if
+	// the graph must be rebuilt, so they aren't copied from the cache.
+	clusterPolicies := policiesv1.PolicyList{}
+
+	err = r.List(ctx, &clusterPolicies, client.InNamespace(instance.Namespace), client.UnsafeDisableDeepCopy)
+	if err != nil {
+		reqLogger.Error(err, "Failed to list the policies to build the dependency graph, will requeue the request")
+
+		policySystemErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, "", "get-error").Inc()
+
+		return reconcile.Result{}, err
+	}
+
+	depGraph := r.getDependencyGraph(instance.Namespace, clusterPolicies.Items)
+
 	// Handle dependencies that apply to the parent policy
 	allDeps := make(map[depclient.ObjectIdentifier]string)
 	topLevelDeps := make(map[depclient.ObjectIdentifier]string)
@@ -241,7 +327,7 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 			Group:     dep.GroupVersionKind().Group,
 			Version:   dep.GroupVersionKind().Version,
 			Kind:      dep.GroupVersionKind().Kind,
-			Namespace: getDepNamespace(r.ClusterNamespace, dep),
+			Namespace: getDepNamespace(instance.Namespace, dep),
 			Name:      dep.Name,
 		}
 
@@ -251,7 +337,7 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 
 			reqLogger.Error(err, "Failed to decode the policy dependencies", "policy", instance.GetName())
 
-			policyUserErrorsCounter.WithLabelValues(instance.Name, "", "dependency-error").Inc()
+			policyUserErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, "", "dependency-error").Inc()
 
 			continue
 		}
@@ -260,6 +346,9 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 		topLevelDeps[depID] = string(dep.Compliance)
 	}
 
+	// Templates in a later wave are only created after the templates in the previous wave are compliant or ready
+	waves, waveErrs := getTemplateWaves(instance)
+
 	// Do not exit early from the loop - store an error to return later and `continue`. Be careful
 	// not to overwrite the error in a way that it becomes nil, which would prevent a requeue.
 	// As a quirk of the error handling, only the last occurring error is "returned" by Reconcile.
@@ -267,6 +356,9 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 
 	var templateNames []string
 
+	// The time until the next pending timeout elapses, if any template has one
+	var requeueAfter time.Duration
+
 	// Array of templates managed by this policy to watch
 	var childTemplates []depclient.ObjectIdentifier
 
@@ -287,7 +379,7 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 
 			reqLogger.Error(resultError, "Failed to decode the policy template", "templateIndex", tIndex)
 
-			policyUserErrorsCounter.WithLabelValues(instance.Name, "", "format-error").Inc()
+			policyUserErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, "", "format-error").Inc()
 
 			continue
 		}
@@ -313,7 +405,7 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 
 			reqLogger.Error(resultError, "Failed to process the policy template", "templateIndex", tIndex)
 
-			policyUserErrorsCounter.WithLabelValues(instance.Name, "", "format-error").Inc()
+			policyUserErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, "", "format-error").Inc()
 
 			continue
 		}
@@ -340,7 +432,7 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 				Group:     dep.GroupVersionKind().Group,
 				Version:   dep.GroupVersionKind().Version,
 				Kind:      dep.GroupVersionKind().Kind,
-				Namespace: getDepNamespace(r.ClusterNamespace, dep),
+				Namespace: getDepNamespace(instance.Namespace, dep),
 				Name:      dep.Name,
 			}
 
@@ -357,7 +449,7 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 
 				depConflictErr = true
 
-				policyUserErrorsCounter.WithLabelValues(instance.Name, "", "dependency-error").Inc()
+				policyUserErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, "", "dependency-error").Inc()
 
 				break
 			}
@@ -371,8 +463,64 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 			continue
 		}
 
+		// The template is still part of the policy when its annotations are invalid, so it must not be cleaned up
 		templateNames = append(templateNames, tName)
 
+		if waveErr := waveErrs[tIndex]; waveErr != nil {
+			_ = r.emitTemplateError(ctx, instance, tIndex, tName, isClusterScoped, waveErr.Error())
+
+			reqLogger.Error(waveErr, "Failed to parse the policy template wave", "templateIndex", tIndex)
+
+			policyUserErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "format-error").Inc()
+
+			continue
+		}
+
+		var depExpressions []DependencyExpression
+
+		if rawExpressions, ok := metaObj.GetAnnotations()[dependencyExpressionsAnnotation]; ok {
+			depExpressions, err = parseDependencyExpressions(rawExpressions)
+			if err != nil {
+				_ = r.emitTemplateError(ctx, instance, tIndex, tName, isClusterScoped, err.Error())
+
+				reqLogger.Error(err, "Failed to parse the policy template dependency expressions", "templateIndex", tIndex)
+
+				policyUserErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "dependency-error").Inc()
+
+				continue
+			}
+
+			// The objects in the expressions are watched the same as the policy dependencies
+			for _, depID := range watchIdentifiers(depExpressions, instance.Namespace) {
+				allDeps[depID] = ""
+			}
+		}
+
+		timeout, err := getPendingTimeout(instance, metaObj.GetAnnotations())
+		if err != nil {
+			_ = r.emitTemplateError(ctx, instance, tIndex, tName, isClusterScoped, err.Error())
+
+			reqLogger.Error(err, "Failed to parse the policy template pending timeout", "templateIndex", tIndex)
+
+			policyUserErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "format-error").Inc()
+
+			continue
+		}
+
+		tNode := dependencyNode(gvk.Group, gvk.Kind, templateNamespace(instance.Namespace, gvk.Group), tName)
+
+		if cycle := depGraph.cycle(tNode); cycle != nil {
+			errMsg := "Dependency cycle detected between " + strings.Join(cycle, ", ")
+
+			_ = r.emitTemplateError(ctx, instance, tIndex, tName, isClusterScoped, errMsg)
+
+			reqLogger.Info("The policy template is in a dependency cycle", "templateIndex", tIndex, "cycle", cycle)
+
+			policyUserErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "dependency-cycle").Inc()
+
+			continue
+		}
+
 		tLogger := reqLogger.WithValues("template", tName)
 
 		rsrc, namespaced, err := utils.GVRFromGVK(discoveryClient, *gvk)
@@ -401,13 +549,13 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 				"kind", gvk.Kind,
 			)
 
-			policyUserErrorsCounter.WithLabelValues(instance.Name, tName, "crd-error").Inc()
+			policyUserErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "crd-error").Inc()
 
 			continue
 		} else if err != nil {
 			reqLogger.Error(err, "Failed to get the resource version metadata")
 
-			policySystemErrorsCounter.WithLabelValues(instance.Name, "", "get-error").Inc()
+			policySystemErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, "", "get-error").Inc()
 
 			return reconcile.Result{}, err
 		}
@@ -422,20 +570,28 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 		if err != nil {
 			reqLogger.Error(err, "Failed to retrieve CRD "+rsrc.GroupResource().String())
 
-			policySystemErrorsCounter.WithLabelValues(request.Name, tName, "get-error").Inc()
+			policySystemErrorsCounter.WithLabelValues(request.Name, request.Namespace, tName, "get-error").Inc()
 
 			// The CRD should exist since it was found in the mapping previously; Requeue this template
 			return reconcile.Result{}, err
 		}
 
 		// If no policy-type=template label AND the GroupKind is not on the explicit allow list, don't
-		// sync this template
-		if !hasTemplateLabel && !utils.IsAllowedPolicy(gvk.GroupKind()) || (isGkObj && r.DisableGkSync) {
+		// sync this template. The deny list in the template kinds ConfigMap overrides both.
+		allowedKind := hasTemplateLabel || utils.IsAllowedPolicy(gvk.GroupKind()) || kindFilter.allowed(gvk.GroupKind())
+
+		if !allowedKind || kindFilter.denied(gvk.GroupKind()) || (isGkObj && r.DisableGkSync) {
 			errMsg := "policy-template kind is not supported: " + gvk.String()
 
-			if r.DisableGkSync && isGkObj {
+			switch {
+			case r.DisableGkSync && isGkObj:
 				errMsg = fmt.Sprintf(
 					"not syncing kind %s because the Gatekeeper integration is disabled", gvk.String())
+			case kindFilter.denied(gvk.GroupKind()):
+				errMsg = fmt.Sprintf("policy-template kind %s is denied by %s", gvk.String(), kindFilter.source)
+			case kindFilter != nil:
+				errMsg += fmt.Sprintf(". Label its CRD with %s=template or add %s.%s to the allow list in %s",
+					utils.PolicyTypeLabel, gvk.Kind, gvk.Group, kindFilter.source)
 			}
 
 			err := errors.New(errMsg)
@@ -450,12 +606,19 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 				"kind", gvk.Kind,
 			)
 
-			policyUserErrorsCounter.WithLabelValues(instance.Name, tName, "crd-error").Inc()
+			policyUserErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "crd-error").Inc()
 
 			continue
 		}
 
-		dependencyFailures := r.processDependencies(ctx, dClient, discoveryClient, templateDeps, tLogger)
+		dependencyFailures := r.processDependencies(ctx, dClient, discoveryClient, templateDeps, kindFilter, tLogger)
+		waveFailures := r.processWaveDependencies(
+			ctx, dClient, discoveryClient, waves.previousWave(tIndex), kindFilter, tLogger,
+		)
+		expressionFailures := r.processDependencyExpressions(
+			ctx, dClient, discoveryClient, instance.Namespace, depExpressions, kindFilter, tLogger,
+		)
+		dependenciesPending := len(dependencyFailures) > 0 || len(expressionFailures) > 0
 
 		// Instantiate a dynamic client -- if it's a clusterwide resource, then leave off the namespace
 		var res dynamic.ResourceInterface
@@ -478,7 +641,7 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 
 			tLogger.Error(resultError, "Failed to unmarshal the policy template")
 
-			policySystemErrorsCounter.WithLabelValues(instance.Name, tName, "unmarshal-error").Inc()
+			policySystemErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "unmarshal-error").Inc()
 
 			continue
 		}
@@ -497,16 +660,33 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 		if err != nil {
 			// not found should consider creating it
 			if k8serrors.IsNotFound(err) {
-				if len(dependencyFailures) > 0 {
+				// Waves only gate the creation of a template, so an existing template isn't deleted if the
+				// previous wave stops being compliant
+				creationFailures := maps.Clone(dependencyFailures)
+				maps.Copy(creationFailures, waveFailures)
+
+				creationPending := dependenciesPending || len(waveFailures) > 0
+
+				if creationPending && preview.enabled() {
+					tObjectUnstructured.SetNamespace(resourceNs)
+					preview.record(ctx, previewSkip, nil, tObjectUnstructured,
+						generatePendingMsg(creationFailures, expressionFailures...))
+
+					continue
+				}
+
+				if creationPending {
 					// template must be pending, do not create it
-					emitErr := r.emitTemplatePending(ctx, instance, tIndex, tName, isClusterScoped,
-						generatePendingMsg(dependencyFailures))
+					_, timeoutAfter, emitErr := r.emitTemplatePendingOrTimeout(ctx, instance, tIndex, tName,
+						isClusterScoped, timeout, creationFailures, expressionFailures)
 					if emitErr != nil {
 						resultError = emitErr
 
 						continue
 					}
 
+					requeueAfter = minRequeueAfter(requeueAfter, timeoutAfter)
+
 					tLogger.Info("Dependencies were not satisfied for the policy template",
 						"namespace", instance.GetNamespace(),
 						"kind", gvk.Kind,
@@ -515,13 +695,15 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 					continue
 				}
 
+				templatePendingGauge.DeleteLabelValues(instance.Name, instance.Namespace, tName)
+
 				// check for hub template error before creating
 				if errAnno := metaObj.GetAnnotations()[hubTmplErrorKey]; errAnno != "" {
 					_ = r.emitTemplateError(ctx, instance, tIndex, tName, isClusterScoped, errAnno)
 
 					tLogger.Error(k8serrors.NewBadRequest(errAnno), "Failed to process the policy template")
 
-					policyUserErrorsCounter.WithLabelValues(instance.Name, tName, "format-error").Inc()
+					policyUserErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "format-error").Inc()
 
 					continue
 				}
@@ -543,11 +725,25 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 
 				overrideRemediationAction(instance, tObjectUnstructured)
 
+				if frozen, frozenFor := r.frozenTemplate(tObjectUnstructured); frozen && !preview.enabled() {
+					tLogger.Info("Changes are frozen by a maintenance window, deferring the policy template creation")
+
+					requeueAfter = minRequeueAfter(requeueAfter, frozenFor)
+
+					continue
+				}
+
 				tObjectUnstructured.SetNamespace(resourceNs)
 
-				eObject, err = res.Create(ctx, tObjectUnstructured, metav1.CreateOptions{
-					FieldValidation: metav1.FieldValidationStrict,
-				})
+				if r.ServerSideApply {
+					eObject, err = applyTemplate(ctx, res, nil, tObjectUnstructured, preview.dryRun())
+				} else {
+					eObject, err = res.Create(ctx, tObjectUnstructured, metav1.CreateOptions{
+						FieldValidation: metav1.FieldValidationStrict,
+						DryRun:          preview.dryRun(),
+					})
+				}
+
 				if err != nil {
 					multiTemplateRegExp := regexp.MustCompile(
 						`spec" must validate one and only one schema \(oneOf\)\. Found 2 valid alternatives$`,
@@ -568,9 +764,9 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 
 					// check for syntax error in policy
 					if k8serrors.IsInvalid(err) {
-						policyUserErrorsCounter.WithLabelValues(instance.Name, tName, "format-error").Inc()
+						policyUserErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "format-error").Inc()
 					} else {
-						policySystemErrorsCounter.WithLabelValues(instance.Name, tName, "create-error").Inc()
+						policySystemErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "create-error").Inc()
 
 						// Only requeue if the policy template is valid
 						resultError = err
@@ -579,6 +775,12 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 					continue
 				}
 
+				if preview.enabled() {
+					preview.record(ctx, previewCreate, nil, tObjectUnstructured, "")
+
+					continue
+				}
+
 				// Applicable for Gatekeeper versions v3.17 and later.
 				if isGkConstraintTemplate {
 					sentMsg, err := r.emitGKConstraintTemplateErrMsg(ctx, tObjectUnstructured,
@@ -624,7 +826,7 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 
 					tLogger.Error(resultError, "Error after creating template (will requeue)")
 
-					policySystemErrorsCounter.WithLabelValues(instance.Name, tName, "patch-error").Inc()
+					policySystemErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "patch-error").Inc()
 				}
 
 				continue
@@ -646,7 +848,7 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 				"kind", gvk.Kind,
 			)
 
-			policySystemErrorsCounter.WithLabelValues(instance.Name, tName, "get-error").Inc()
+			policySystemErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "get-error").Inc()
 
 			continue
 		}
@@ -670,17 +872,32 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 			}
 		}
 
-		if len(dependencyFailures) > 0 {
+		if dependenciesPending && preview.enabled() {
+			preview.record(ctx, previewDelete, eObject, nil, generatePendingMsg(dependencyFailures, expressionFailures...))
+
+			continue
+		}
+
+		if dependenciesPending {
 			// template must be pending, need to delete it and error
 			tLogger.Info("Dependencies were not satisfied for the policy template",
 				"namespace", instance.GetNamespace(),
 				"kind", gvk.Kind,
 			)
 
-			emitErr := r.emitTemplatePending(ctx, instance, tIndex, tName,
-				isClusterScoped, generatePendingMsg(dependencyFailures))
+			timedOut, timeoutAfter, emitErr := r.emitTemplatePendingOrTimeout(ctx, instance, tIndex, tName,
+				isClusterScoped, timeout, dependencyFailures, expressionFailures)
 			if emitErr != nil {
-				resultError = err
+				resultError = emitErr
+			}
+
+			requeueAfter = minRequeueAfter(requeueAfter, timeoutAfter)
+
+			if timedOut && timeout.action == pendingTimeoutSkip {
+				tLogger.Info("Leaving the template as is since its pending timeout action is " +
+					string(pendingTimeoutSkip))
+
+				continue
 			}
 
 			err = res.Delete(ctx, tName, metav1.DeleteOptions{})
@@ -689,7 +906,7 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 					"namespace", instance.GetNamespace(),
 					"name", tName,
 				)
-				policySystemErrorsCounter.WithLabelValues(instance.Name, tName, "delete-error").Inc()
+				policySystemErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "delete-error").Inc()
 
 				resultError = err
 			}
@@ -697,13 +914,21 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 			continue
 		}
 
+		templatePendingGauge.DeleteLabelValues(instance.Name, instance.Namespace, tName)
+
 		// check for hub template error
 		if errAnno := metaObj.GetAnnotations()[hubTmplErrorKey]; errAnno != "" {
 			_ = r.emitTemplateError(ctx, instance, tIndex, tName, isClusterScoped, errAnno)
 
 			tLogger.Error(k8serrors.NewBadRequest(errAnno), "Failed to process the policy template")
 
-			policyUserErrorsCounter.WithLabelValues(instance.Name, tName, "format-error").Inc()
+			policyUserErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "format-error").Inc()
+
+			if preview.enabled() {
+				preview.record(ctx, previewDelete, eObject, nil, errAnno)
+
+				continue
+			}
 
 			if rsrc.Resource == "configurationpolicies" {
 				// Patch it so that it doesn't clean up resources in the case of a formatting error
@@ -728,7 +953,7 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 					"namespace", instance.GetNamespace(),
 					"name", tName,
 				)
-				policySystemErrorsCounter.WithLabelValues(instance.Name, tName, "delete-error").Inc()
+				policySystemErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "delete-error").Inc()
 
 				resultError = err
 			}
@@ -797,17 +1022,34 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 
 			tLogger.Error(resultError, "Failed to create the policy template")
 
-			policyUserErrorsCounter.WithLabelValues(instance.Name, tName, "format-error").Inc()
+			policyUserErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "format-error").Inc()
 
 			continue
 		}
 
+		// Kinds with a status mapping don't send their own compliance events, so send them based on the mapping
+		mapping := r.getStatusMapping(ctx, kindFilter, gvk.GroupKind(), rsrc.GroupResource())
+		if mapping != nil && !preview.enabled() {
+			err := r.emitMappedCompliance(ctx, instance, tIndex, tName, isClusterScoped, mapping, eObject)
+			if err != nil {
+				resultError = err
+
+				tLogger.Error(err, "Failed to send the compliance event based on the status mapping")
+			}
+		}
+
 		// Fill in defaults set by the ConstraintTemplate CRD to ensure the spec comparison below is correct.
 		if isGkConstraintTemplate {
 			err := utils.ApplyObjectDefaults(*r.Scheme, tObjectUnstructured)
 			if err != nil {
 				reqLogger.Error(err, "Failed to apply defaults to the ConstraintTemplate for comparison. Continuing.")
 			}
+		} else if !r.ServerSideApply {
+			// Fill in defaults set by the policy template's CRD schema for the same reason.
+			err := r.applyCRDDefaults(ctx, rsrc, tObjectUnstructured)
+			if err != nil {
+				tLogger.Error(err, "Failed to apply the CRD defaults to the policy template for comparison. Continuing.")
+			}
 		}
 		// set default labels for template processing on the template object
 		tObjectUnstructured.SetLabels(r.setDefaultTemplateLabels(instance, tObjectUnstructured.GetLabels()))
@@ -817,21 +1059,66 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 		// got object, need to compare both spec and annotation and update
 		eObjectUnstructured := eObject.UnstructuredContent()
 
-		if !equivalentTemplates(ctx, eObject, tObjectUnstructured) {
-			// doesn't match
-			tLogger.Info("Existing object and template didn't match, will update")
+		// With server-side apply, the CRD defaults are only filled in on a copy for the comparison so that the apply
+		// doesn't take ownership of the defaulted fields. The template is still applied when it's equivalent but the
+		// apply would change the managed fields or remove metadata that was removed from the template.
+		comparedObject := tObjectUnstructured
+
+		if r.ServerSideApply && !isGkConstraintTemplate {
+			comparedObject = tObjectUnstructured.DeepCopy()
+
+			err := r.applyCRDDefaults(ctx, rsrc, comparedObject)
+			if err != nil {
+				tLogger.Error(err, "Failed to apply the CRD defaults to the policy template for comparison. Continuing.")
+			}
+		}
+
+		needsUpdate := !equivalentTemplates(ctx, eObject, comparedObject)
+		if !needsUpdate && r.ServerSideApply {
+			needsUpdate = templateNeedsApply(eObject, tObjectUnstructured)
+		}
+
+		if needsUpdate {
+			if frozen, frozenFor := r.frozenTemplate(tObjectUnstructured); frozen && !preview.enabled() {
+				tLogger.Info("Changes are frozen by a maintenance window, deferring the policy template update")
+
+				requeueAfter = minRequeueAfter(requeueAfter, frozenFor)
+
+				// The existing clusterwide object still needs the finalizer to be cleaned up
+				if isClusterScoped {
+					addFinalizer = true
+				}
 
-			eObjectUnstructured["spec"] = tObjectUnstructured.Object["spec"]
+				continue
+			}
 
-			eObject.SetAnnotations(tObjectUnstructured.GetAnnotations())
-			eObject.SetLabels(tObjectUnstructured.GetLabels())
-			eObject.SetOwnerReferences(tObjectUnstructured.GetOwnerReferences())
+			var existingObject *unstructured.Unstructured
+			if preview.enabled() {
+				existingObject = eObject.DeepCopy()
+			}
 
 			previousRV := eObject.GetResourceVersion()
 
-			updatedObj, err := res.Update(ctx, eObject, metav1.UpdateOptions{
-				FieldValidation: metav1.FieldValidationStrict,
-			})
+			var updatedObj *unstructured.Unstructured
+
+			if r.ServerSideApply {
+				updatedObj, err = applyTemplate(ctx, res, eObject, tObjectUnstructured, preview.dryRun())
+			} else {
+				// doesn't match
+				tLogger.Info("Existing object and template didn't match, will update")
+
+				eObjectUnstructured["spec"] = tObjectUnstructured.Object["spec"]
+
+				eObject.SetAnnotations(tObjectUnstructured.GetAnnotations())
+				eObject.SetLabels(tObjectUnstructured.GetLabels())
+				eObject.SetOwnerReferences(tObjectUnstructured.GetOwnerReferences())
+
+				updatedObj, err = res.Update(ctx, eObject, metav1.UpdateOptions{
+					FieldValidation: metav1.FieldValidationStrict,
+					DryRun:          preview.dryRun(),
+				})
+			}
+
 			if err != nil {
 				// If the policy template retrieved from the cache has since changed, there will be a conflict error
 				// and the reconcile should be retried since this is recoverable.
@@ -847,9 +1134,9 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 
 				// check for syntax error in policy
 				if k8serrors.IsInvalid(err) {
-					policyUserErrorsCounter.WithLabelValues(instance.Name, tName, "format-error").Inc()
+					policyUserErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "format-error").Inc()
 				} else {
-					policySystemErrorsCounter.WithLabelValues(instance.Name, tName, "patch-error").Inc()
+					policySystemErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "patch-error").Inc()
 
 					// Only requeue if the policy template is valid
 					resultError = err
@@ -858,6 +1145,14 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 				continue
 			}
 
+			if preview.enabled() {
+				// A dry run doesn't change the resource version, so compare the dry run result instead. Updates
+				// without any differences are not recorded.
+				preview.record(ctx, previewUpdate, existingObject, updatedObj, "")
+
+				continue
+			}
+
 			if updatedObj.GetResourceVersion() != previousRV {
 				successMsg := fmt.Sprintf("Policy template %s was updated successfully", tName)
 
@@ -887,18 +1182,28 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 					resultError = err
 					tLogger.Error(resultError, "Error after updating template (will requeue)")
 
-					policySystemErrorsCounter.WithLabelValues(instance.Name, tName, "patch-error").Inc()
+					policySystemErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "patch-error").Inc()
 				}
 
 				tLogger.Info("Existing object has been updated")
+			} else {
+				err = r.handleSyncSuccess(ctx, instance, tIndex, tName, "", res, gvk.GroupVersion(), updatedObj)
+				if err != nil {
+					resultError = err
+					tLogger.Error(resultError, "Error after confirming template matches (will requeue)")
+
+					policySystemErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "patch-error").Inc()
+				}
+
+				tLogger.V(1).Info("Existing object matches the policy template")
 			}
-		} else {
+		} else if !preview.enabled() {
 			err = r.handleSyncSuccess(ctx, instance, tIndex, tName, "", res, gvk.GroupVersion(), eObject)
 			if err != nil {
 				resultError = err
 				tLogger.Error(resultError, "Error after confirming template matches (will requeue)")
 
-				policySystemErrorsCounter.WithLabelValues(instance.Name, tName, "patch-error").Inc()
+				policySystemErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, tName, "patch-error").Inc()
 			}
 
 			tLogger.V(1).Info("Existing object matches the policy template")
@@ -941,19 +1246,32 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 
 		if k8serrors.IsNotFound(err) {
 			reqLogger.Error(resultError, "Error updating dependency watcher, likely due to a missing CRD.")
-			policyUserErrorsCounter.WithLabelValues(instance.Name, "", "crd-error").Inc()
+			policyUserErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, "", "crd-error").Inc()
 		} else {
 			reqLogger.Error(resultError, "Error updating dependency watcher")
-			policySystemErrorsCounter.WithLabelValues(instance.Name, "", "client-error").Inc()
+			policySystemErrorsCounter.WithLabelValues(instance.Name, instance.Namespace, "", "client-error").Inc()
 		}
 	}
 
-	err = r.cleanUpExcessTemplates(ctx, dClient, *instance, templateNames)
+	err = r.cleanUpExcessTemplates(ctx, dClient, discoveryClient, *instance, templateNames, kindFilter, preview)
 	if err != nil {
 		resultError = err
 		reqLogger.Error(resultError, "Error cleaning up templates")
 	}
 
+	if preview.enabled() {
+		err = r.emitPreview(ctx, instance, preview)
+		if err != nil {
+			resultError = err
+			reqLogger.Error(resultError, "Failed to send the template sync preview event")
+		}
+
+		// Finalizers are only needed for objects that were created, which doesn't happen in preview mode.
+		reqLogger.V(2).Info("Completed the reconciliation in preview mode")
+
+		return reconcile.Result{}, resultError
+	}
+
 	// Namespaced objects can't own clusterwide objects, so we'll add a finalizer to the policy if
 	// objects were created so that we can handle cleanup before deleting the policy
 	if !hasClusterwideFinalizer(instance) {
@@ -962,7 +1280,7 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 
 			instance.Finalizers = append(instance.Finalizers, utils.ClusterwideFinalizer)
 
-			err = r.Update(ctx, instance)
+			err = r.Update(ctx, instance, client.FieldOwner(FieldManager))
 			if err != nil {
 				resultError = err
 				reqLogger.Error(err, "Failed to update policy when adding finalizers")
@@ -972,7 +1290,7 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 		reqLogger.Info("Cleanup not required--removing clusterwide cleanup finalizer")
 		removeFinalizer(instance, utils.ClusterwideFinalizer)
 
-		err = r.Update(ctx, instance)
+		err = r.Update(ctx, instance, client.FieldOwner(FieldManager))
 		if err != nil {
 			resultError = err
 			reqLogger.Error(err, "Failed to update policy when removing finalizers")
@@ -981,87 +1299,15 @@ func (r *PolicyReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 
 	reqLogger.V(2).Info("Completed the reconciliation")
 
-	return reconcile.Result{}, resultError
+	return reconcile.Result{RequeueAfter: requeueAfter}, resultError
 }
 
 // equivalentTemplates determines whether the template existing on the cluster and the policy template are the same.
-// Any missing defaults this function is aware of will be set on tObject.
+// Any missing defaults from the defaulters registered for the template's kind will be set on tObject.
 func equivalentTemplates(
 	ctx context.Context, eObject *unstructured.Unstructured, tObject *unstructured.Unstructured,
 ) bool {
-	log := ctrl.LoggerFrom(ctx)
-
-	if tObject.GetKind() == "ConfigurationPolicy" {
-		pruneObjectBehavior, _, _ := unstructured.NestedString(tObject.Object, "spec", "pruneObjectBehavior")
-		if pruneObjectBehavior == "" {
-			err := unstructured.SetNestedField(tObject.Object, "None", "spec", "pruneObjectBehavior")
-			if err != nil {
-				log.Error(err, "Failed to set the default value of pruneObjectBehavior")
-			}
-		}
-
-		var updatedObjectTemplates bool
-
-		objectTemplates, _, _ := unstructured.NestedSlice(tObject.Object, "spec", "object-templates")
-
-		for i := range objectTemplates {
-			objectTemplate, ok := objectTemplates[i].(map[string]any)
-			if !ok {
-				continue
-			}
-
-			if _, ok := objectTemplate["recreateOption"]; !ok {
-				objectTemplate["recreateOption"] = "None"
-				objectTemplates[i] = objectTemplate
-				updatedObjectTemplates = true
-			}
-		}
-
-		if updatedObjectTemplates {
-			err := unstructured.SetNestedField(tObject.Object, objectTemplates, "spec", "object-templates")
-			if err != nil {
-				log.Error(err, "Failed to set the default value of recreateOption")
-			}
-		}
-	}
-
-	if tObject.GetKind() == "OperatorPolicy" {
-		// catalogSourceUnhealthy
-		catalogSourceUnhealthy, _, _ := unstructured.NestedString(tObject.Object, "spec",
-			"complianceConfig", "catalogSourceUnhealthy")
-
-		if catalogSourceUnhealthy == "" {
-			err := unstructured.SetNestedField(tObject.Object, "Compliant", "spec",
-				"complianceConfig", "catalogSourceUnhealthy")
-			if err != nil {
-				log.Error(err, "Failed to set the default value of catalogSourceUnhealthy")
-			}
-		}
-
-		// deploymentsUnavailable
-		deploymentsUnavailable, _, _ := unstructured.NestedString(tObject.Object, "spec",
-			"complianceConfig", "deploymentsUnavailable")
-
-		if deploymentsUnavailable == "" {
-			err := unstructured.SetNestedField(tObject.Object, "NonCompliant", "spec",
-				"complianceConfig", "deploymentsUnavailable")
-			if err != nil {
-				log.Error(err, "Failed to set the default value of deploymentsUnavailable")
-			}
-		}
-
-		// upgradesAvailable
-		upgradesAvailable, _, _ := unstructured.NestedString(tObject.Object, "spec",
-			"complianceConfig", "upgradesAvailable")
-
-		if upgradesAvailable == "" {
-			err := unstructured.SetNestedField(tObject.Object, "Compliant", "spec",
-				"complianceConfig", "upgradesAvailable")
-			if err != nil {
-				log.Error(err, "Failed to set the default value of upgradesAvailable")
-			}
-		}
-	}
+	applyTemplateDefaults(ctx, tObject)
 
 	eJSON, e1 := json.Marshal(eObject.UnstructuredContent()["spec"])
 	tJSON, e2 := json.Marshal(tObject.Object["spec"])
@@ -1103,8 +1349,8 @@ func (r *PolicyReconciler) setDefaultTemplateLabels(instance *policiesv1.Policy,
 		utils.ParentPolicyLabel:      instance.GetName(),
 		"cluster-name":               instance.GetLabels()[common.ClusterNameLabel],
 		common.ClusterNameLabel:      instance.GetLabels()[common.ClusterNameLabel],
-		"cluster-namespace":          r.ClusterNamespace,
-		common.ClusterNamespaceLabel: r.ClusterNamespace,
+		"cluster-namespace":          instance.GetNamespace(),
+		common.ClusterNamespaceLabel: instance.GetNamespace(),
 	}
 
 	maps.Copy(labels, desiredLabels)
@@ -1113,12 +1359,16 @@ func (r *PolicyReconciler) setDefaultTemplateLabels(instance *policiesv1.Policy,
 }
 
 // cleanUpExcessTemplates compares existing policy templates on the cluster to those contained in the policy,
-// and deletes those that have been renamed or removed from the parent policy
+// and deletes those that have been renamed or removed from the parent policy. In preview mode, the deletions are
+// recorded instead.
 func (r *PolicyReconciler) cleanUpExcessTemplates(
 	ctx context.Context,
 	dClient dynamic.Interface,
+	discoveryClient discovery.DiscoveryInterface,
 	instance policiesv1.Policy,
 	templateNames []string,
+	kindFilter *templateKindFilter,
+	preview *templateSyncPreview,
 ) error {
 	var errorList utils.ErrList
 
@@ -1127,6 +1377,7 @@ func (r *PolicyReconciler) cleanUpExcessTemplates(
 	// GVR with scope specified
 	type gvrScoped struct {
 		gvr        schema.GroupVersionResource
+		gk         schema.GroupKind
 		namespaced bool
 	}
 
@@ -1149,6 +1400,7 @@ func (r *PolicyReconciler) cleanUpExcessTemplates(
 						Resource: "constrainttemplates",
 						Version:  "v1",
 					},
+					gk:         utils.GvkConstraintTemplate,
 					namespaced: false,
 				})
 			} else {
@@ -1169,6 +1421,7 @@ func (r *PolicyReconciler) cleanUpExcessTemplates(
 						Resource: strings.ToLower(gkCT.Spec.CRD.Spec.Names.Kind),
 						Version:  "v1beta1",
 					},
+					gk:         schema.GroupKind{Group: utils.GConstraint, Kind: gkCT.Spec.CRD.Spec.Names.Kind},
 					namespaced: false,
 				})
 			}
@@ -1188,6 +1441,7 @@ func (r *PolicyReconciler) cleanUpExcessTemplates(
 							Resource: "constrainttemplates",
 							Version:  "v1beta1",
 						},
+						gk:         utils.GvkConstraintTemplate,
 						namespaced: false,
 					})
 				} else {
@@ -1202,6 +1456,7 @@ func (r *PolicyReconciler) cleanUpExcessTemplates(
 							Resource: strings.ToLower(gkCT.Spec.CRD.Spec.Names.Kind),
 							Version:  "v1beta1",
 						},
+						gk:         schema.GroupKind{Group: utils.GConstraint, Kind: gkCT.Spec.CRD.Spec.Names.Kind},
 						namespaced: false,
 					})
 				}
@@ -1240,6 +1495,7 @@ func (r *PolicyReconciler) cleanUpExcessTemplates(
 						Resource: crd.Spec.Names.Plural,
 						Version:  crd.Spec.Versions[0].Name,
 					},
+					gk:         schema.GroupKind{Group: crd.Spec.Group, Kind: crd.Spec.Names.Kind},
 					namespaced: crd.Spec.Scope == extensionsv1.NamespaceScoped,
 				})
 			}
@@ -1260,6 +1516,7 @@ func (r *PolicyReconciler) cleanUpExcessTemplates(
 						Resource: crd.Spec.Names.Plural,
 						Version:  crd.Spec.Versions[0].Name,
 					},
+					gk:         schema.GroupKind{Group: crd.Spec.Group, Kind: crd.Spec.Names.Kind},
 					namespaced: crd.Spec.Scope == extensionsv1beta1.NamespaceScoped,
 				})
 			}
@@ -1268,11 +1525,27 @@ func (r *PolicyReconciler) cleanUpExcessTemplates(
 		return fmt.Errorf("error listing v1 CRDs with query %+v: %w", crdQuery, err)
 	}
 
+	// Include the kinds on the template kinds ConfigMap allow list that aren't already covered
+	allowedGVRs, err := allowedKindGVRs(discoveryClient, kindFilter)
+	if err != nil {
+		errorList = append(errorList, err)
+	}
+
+	for gvr, kind := range allowedGVRs {
+		if !slices.ContainsFunc(tmplGVRs, func(existing gvrScoped) bool { return existing.gk == kind.gk }) {
+			tmplGVRs = append(tmplGVRs, gvrScoped{gvr: gvr, gk: kind.gk, namespaced: kind.namespaced})
+		}
+	}
+
 	for _, gvrScoped := range tmplGVRs {
+		// Templates of a denied kind are deleted even if they're still in the policy, so that the objects created
+		// before the kind was denied don't keep enforcing
+		denied := kindFilter.denied(gvrScoped.gk)
+
 		// Instantiate a dynamic client for the GVR
 		resourceNs := ""
 		if gvrScoped.namespaced {
-			resourceNs = r.ClusterNamespace
+			resourceNs = instance.GetNamespace()
 		}
 
 		resClient := dClient.Resource(gvrScoped.gvr).Namespace(resourceNs)
@@ -1290,13 +1563,32 @@ func (r *PolicyReconciler) cleanUpExcessTemplates(
 		}
 
 		for _, tmpl := range children.Items {
-			// delete all templates with policy label that aren't still in the policy
-			if !slices.Contains(templateNames, tmpl.GetName()) {
-				err := resClient.Delete(ctx, tmpl.GetName(), metav1.DeleteOptions{})
-				if err != nil {
-					errorList = append(errorList,
-						fmt.Errorf("error deleting %s object %s: %w", gvrScoped.gvr.String(), tmpl.GetName(), err))
+			// delete all templates with policy label that aren't still in the policy or are of a denied kind
+			reason := "The template is no longer in the policy"
+
+			if slices.Contains(templateNames, tmpl.GetName()) {
+				if !denied {
+					continue
 				}
+
+				reason = fmt.Sprintf("The template kind %s is denied by %s", gvrScoped.gk.String(), kindFilter.source)
+			}
+
+			if preview.enabled() {
+				preview.record(ctx, previewDelete, &tmpl, nil, reason)
+
+				continue
+			}
+
+			if denied {
+				reqLogger.Info("Deleting the policy template since its kind is denied",
+					"kind", gvrScoped.gk.String(), "name", tmpl.GetName())
+			}
+
+			err := resClient.Delete(ctx, tmpl.GetName(), metav1.DeleteOptions{})
+			if err != nil {
+				errorList = append(errorList,
+					fmt.Errorf("error deleting %s object %s: %w", gvrScoped.gvr.String(), tmpl.GetName(), err))
 			}
 		}
 	}
@@ -1331,6 +1623,7 @@ func (r *PolicyReconciler) processDependencies(
 	dClient dynamic.Interface,
 	discoveryClient discovery.DiscoveryInterface,
 	templateDeps map[depclient.ObjectIdentifier]string,
+	kindFilter *templateKindFilter,
 	tLogger logr.Logger,
 ) map[depclient.ObjectIdentifier]string {
 	dependencyFailures := make(map[depclient.ObjectIdentifier]string)
@@ -1379,17 +1672,10 @@ func (r *PolicyReconciler) processDependencies(
 				// The ConstraintTemplate was found, but the policy wants it to not be found
 				dependencyFailures[dep] = DepFailWrongCompliance
 			}
-		case utils.GConstraint:
-			violations, found, err := unstructured.NestedInt64(depObj.Object, "status", "totalViolations")
-			if err != nil || !found {
-				// Note that not finding the field is *not* considered "Compliant"
-				dependencyFailures[dep] = DepFailCompNotFound
-			} else if (violations == 0) != (templateDeps[dep] == "Compliant") {
-				dependencyFailures[dep] = DepFailWrongCompliance
-			}
 		default:
-			depCompliance, found, err := unstructured.NestedString(depObj.Object, "status", "compliant")
-			if err != nil || !found {
+			depCompliance := r.dependencyCompliance(ctx, rsrc, depObj, kindFilter)
+			if depCompliance == "" {
+				// Note that not finding the compliance is *not* considered "Compliant"
 				dependencyFailures[dep] = DepFailCompNotFound
 			} else if depCompliance != templateDeps[dep] {
 				dependencyFailures[dep] = DepFailWrongCompliance
@@ -1406,24 +1692,76 @@ func (r *PolicyReconciler) processDependencies(
 	return dependencyFailures
 }
 
-// generatePendingMsg formats the list of failed dependencies into a readable error.
-// Example: `Dependencies were not satisfied: 1 is still pending (FooPolicy foo)`
-func generatePendingMsg(dependencyFailures map[depclient.ObjectIdentifier]string) string {
-	names := make([]string, 0, len(dependencyFailures))
-	for dep := range dependencyFailures {
-		names = append(names, fmt.Sprintf("%s %s", dep.Kind, dep.Name))
+// dependencyCompliance returns the compliance state of a dependency object, or an empty string if it doesn't report
+// one. A Gatekeeper constraint is compliant when it has no violations, and kinds with a status mapping use it.
+func (r *PolicyReconciler) dependencyCompliance(
+	ctx context.Context,
+	rsrc schema.GroupVersionResource,
+	depObj *unstructured.Unstructured,
+	kindFilter *templateKindFilter,
+) string {
+	depGK := depObj.GroupVersionKind().GroupKind()
+
+	switch {
+	case depGK == utils.GvkConstraintTemplate:
+		// A ConstraintTemplate doesn't report a compliance, so it's compliant if it exists
+		return string(policiesv1.Compliant)
+	case depGK.Group == utils.GConstraint:
+		violations, found, err := unstructured.NestedInt64(depObj.Object, "status", "totalViolations")
+		if err != nil || !found {
+			return ""
+		}
+
+		if violations == 0 {
+			return string(policiesv1.Compliant)
+		}
+
+		return string(policiesv1.NonCompliant)
+	}
+
+	if mapping := r.getStatusMapping(ctx, kindFilter, depGK, rsrc.GroupResource()); mapping != nil {
+		depCompliance, _, err := mapping.evaluate(depObj)
+		if err != nil {
+			return ""
+		}
+
+		return string(depCompliance)
 	}
 
-	sort.Strings(names)
+	depCompliance, _, _ := unstructured.NestedString(depObj.Object, "status", "compliant")
+
+	return depCompliance
+}
+
+// generatePendingMsg formats the list of failed dependencies and dependency expression requirements into a readable
+// error.
+// Example: `Dependencies were not satisfied: 1 is still pending (FooPolicy foo)`
+func generatePendingMsg(
+	dependencyFailures map[depclient.ObjectIdentifier]string, expressionFailures ...string,
+) string {
+	reasons := make([]string, 0, len(expressionFailures)+1)
+
+	if len(dependencyFailures) > 0 {
+		names := make([]string, 0, len(dependencyFailures))
+		for dep := range dependencyFailures {
+			names = append(names, fmt.Sprintf("%s %s", dep.Kind, dep.Name))
+		}
+
+		sort.Strings(names)
+
+		nameStr := strings.Join(names, ", ")
 
-	nameStr := strings.Join(names, ", ")
+		fmtStr := "%d are still pending (%s)"
+		if len(dependencyFailures) == 1 {
+			fmtStr = "%d is still pending (%s)"
+		}
 
-	fmtStr := "Dependencies were not satisfied: %d are still pending (%s)"
-	if len(dependencyFailures) == 1 {
-		fmtStr = "Dependencies were not satisfied: %d is still pending (%s)"
+		reasons = append(reasons, fmt.Sprintf(fmtStr, len(dependencyFailures), nameStr))
 	}
 
-	return fmt.Sprintf(fmtStr, len(dependencyFailures), nameStr)
+	reasons = append(reasons, expressionFailures...)
+
+	return "Dependencies were not satisfied: " + strings.Join(reasons, "; ")
 }
 
 func overrideRemediationAction(instance *policiesv1.Policy, tObjectUnstructured *unstructured.Unstructured) {
@@ -1503,8 +1841,8 @@ func (r *PolicyReconciler) emitTemplateError(
 ) error {
 	log := ctrl.LoggerFrom(ctx)
 
-	err := r.emitTemplateEvent(ctx, pol, tIndex, tName, clusterScoped,
-		"Warning", policiesv1.NonCompliant, "template-error; "+errMsg)
+	err := r.emitCategorizedTemplateEvent(ctx, pol, tIndex, tName, clusterScoped,
+		"Warning", policiesv1.NonCompliant, utils.CategoryTemplateError, "template-error; "+errMsg)
 	if err != nil {
 		tlog := log.WithValues("Policy.Namespace", pol.Namespace, "Policy.Name", pol.Name, "template", tName)
 		tlog.Error(err, "Failed to emit template error event")
@@ -1544,6 +1882,17 @@ func (r *PolicyReconciler) emitTemplatePending(
 func (r *PolicyReconciler) emitTemplateEvent(
 	ctx context.Context, pol *policiesv1.Policy, tIndex int, tName string, clusterScoped bool,
 	eventType string, compliance policiesv1.ComplianceState, msg string,
+) error {
+	return r.emitCategorizedTemplateEvent(
+		ctx, pol, tIndex, tName, clusterScoped, eventType, compliance, utils.DefaultComplianceCategory(compliance), msg,
+	)
+}
+
+// emitCategorizedTemplateEvent is the same as emitTemplateEvent, but with the category of the compliance event set
+// explicitly, such as for template errors.
+func (r *PolicyReconciler) emitCategorizedTemplateEvent(
+	ctx context.Context, pol *policiesv1.Policy, tIndex int, tName string, clusterScoped bool,
+	eventType string, compliance policiesv1.ComplianceState, category utils.ComplianceCategory, msg string,
 ) error {
 	// refresh the policy to get the latest status, this helps prevent duplicates
 	refreshed := &policiesv1.Policy{}
@@ -1592,7 +1941,25 @@ func (r *PolicyReconciler) emitTemplateEvent(
 		instance = instanceUnstructured
 	}
 
-	return sender.SendEvent(ctx, instance, ownerref, policyComplianceReason, msg, compliance)
+	return sender.SendCategorizedEvent(ctx, instance, ownerref, policyComplianceReason, msg, compliance, category)
+}
+
+// observeSyncLatency records the time since the policy was last changed when one of its templates is created or
+// updated. It's only recorded once per policy generation for each template.
+func (r *PolicyReconciler) observeSyncLatency(pol *policiesv1.Policy, tName string) {
+	key := pol.Namespace + "/" + pol.Name + "/" + tName
+
+	if prevGeneration, loaded := r.latencyObserved.Swap(key, pol.Generation); loaded && prevGeneration == pol.Generation {
+		return
+	}
+
+	lastChange := utils.LastSpecChange(pol)
+	if lastChange.IsZero() {
+		return
+	}
+
+	templateSyncLatencyHistogram.WithLabelValues(ControllerName, pol.Name, pol.Namespace).
+		Observe(time.Since(lastChange).Seconds())
 }
 
 // handleSyncSuccess performs common actions that should be run whenever a template is in sync,
@@ -1612,6 +1979,8 @@ func (r *PolicyReconciler) handleSyncSuccess(
 ) error {
 	if msg != "" {
 		r.Recorder.Eventf(pol, nil, corev1.EventTypeNormal, "PolicyTemplateSync", "PolicyTemplateSync", msg)
+
+		r.observeSyncLatency(pol, tName)
 	}
 
 	if gv.Group != policiesv1.GroupVersion.Group {
@@ -1731,7 +2100,7 @@ func finalizerCleanup(
 				errorList = append(errorList, fmt.Errorf("failed to decode policy template with error: %w", err))
 			}
 
-			policyUserErrorsCounter.WithLabelValues(pol.Name, "", "format-error").Inc()
+			policyUserErrorsCounter.WithLabelValues(pol.Name, pol.Namespace, "", "format-error").Inc()
 
 			continue
 		}
@@ -1750,7 +2119,7 @@ func finalizerCleanup(
 		if errors.Is(err, utils.ErrNoVersionedResource) {
 			continue
 		} else if err != nil {
-			policySystemErrorsCounter.WithLabelValues(pol.Name, tName, "get-error").Inc()
+			policySystemErrorsCounter.WithLabelValues(pol.Name, pol.Namespace, tName, "get-error").Inc()
 
 			errorList = append(errorList, err)
 
@@ -1762,7 +2131,7 @@ func finalizerCleanup(
 			// Delete object, ignoring not found errors
 			err := dClient.Resource(rsrc).Delete(ctx, tName, metav1.DeleteOptions{})
 			if err != nil && !k8serrors.IsNotFound(err) {
-				policySystemErrorsCounter.WithLabelValues(pol.Name, tName, "delete-error").Inc()
+				policySystemErrorsCounter.WithLabelValues(pol.Name, pol.Namespace, tName, "delete-error").Inc()
 
 				errorList = append(errorList, fmt.Errorf("failed to delete "+gvk.Kind+" with error: %w", err))
 			}
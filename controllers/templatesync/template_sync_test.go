@@ -3,17 +3,44 @@
 package templatesync
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	gktemplatesv1 "github.com/open-policy-agent/frameworks/constraint/pkg/apis/templates/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	depclient "github.com/stolostron/kubernetes-dependency-watches/client"
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/managedfields"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/events"
 	configpoliciesv1 "open-cluster-management.io/config-policy-controller/api/v1"
 	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"open-cluster-management.io/governance-policy-framework-addon/controllers/utils"
 )
 
 func TestHandleSyncSuccessNoDoubleRemoveStatus(t *testing.T) {
@@ -376,6 +403,96 @@ func TestEquivalentTemplatesExtraMetadata(t *testing.T) {
 	}
 }
 
+func TestApplySchemaDefaults(t *testing.T) {
+	t.Parallel()
+
+	specSchema := extensionsv1.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]extensionsv1.JSONSchemaProps{
+			"severity": {Type: "string", Default: &extensionsv1.JSON{Raw: []byte(`"low"`)}},
+			"pruning": {
+				Type:    "object",
+				Default: &extensionsv1.JSON{Raw: []byte(`{}`)},
+				Properties: map[string]extensionsv1.JSONSchemaProps{
+					"behavior": {Type: "string", Default: &extensionsv1.JSON{Raw: []byte(`"None"`)}},
+				},
+			},
+			"rules": {
+				Type: "array",
+				Items: &extensionsv1.JSONSchemaPropsOrArray{
+					Schema: &extensionsv1.JSONSchemaProps{
+						Type: "object",
+						Properties: map[string]extensionsv1.JSONSchemaProps{
+							"name":    {Type: "string"},
+							"enabled": {Type: "boolean", Default: &extensionsv1.JSON{Raw: []byte(`true`)}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	spec := map[string]any{
+		"rules": []any{
+			map[string]any{"name": "first"},
+			map[string]any{"name": "second", "enabled": false},
+		},
+	}
+
+	defaulted, ok := applySchemaDefaults(spec, &specSchema).(map[string]any)
+	if !ok {
+		t.Fatal("Expected the defaulted spec to be an object")
+	}
+
+	if defaulted["severity"] != "low" {
+		t.Fatalf("Expected the severity to default to low, got %v", defaulted["severity"])
+	}
+
+	// The defaults of the properties in a defaulted object are also filled in, the same as the API server
+	pruning, _ := defaulted["pruning"].(map[string]any)
+	if pruning["behavior"] != "None" {
+		t.Fatalf("Expected the defaulted pruning to have its behavior default to None, got %v", defaulted["pruning"])
+	}
+
+	rules, _ := defaulted["rules"].([]any)
+
+	if rules[0].(map[string]any)["enabled"] != true {
+		t.Fatal("Expected the first rule to default to enabled")
+	}
+
+	if rules[1].(map[string]any)["enabled"] != false {
+		t.Fatal("Expected the explicitly set value on the second rule to be kept")
+	}
+}
+
+func TestRegisterTemplateDefaulter(t *testing.T) {
+	t.Parallel()
+
+	gk := schema.GroupKind{Group: "example.com", Kind: "ExamplePolicy"}
+
+	RegisterTemplateDefaulter(gk, func(tObject *unstructured.Unstructured) error {
+		return setNestedStringDefault(tObject.Object, "inform", "spec", "remediationAction")
+	})
+
+	existing := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "example.com/v1",
+		"kind":       "ExamplePolicy",
+		"metadata":   map[string]any{"name": "example"},
+		"spec":       map[string]any{"remediationAction": "inform"},
+	}}
+
+	template := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "example.com/v1",
+		"kind":       "ExamplePolicy",
+		"metadata":   map[string]any{"name": "example"},
+		"spec":       map[string]any{},
+	}}
+
+	if !equivalentTemplates(t.Context(), existing, template) {
+		t.Fatal("Expected the templates to be equivalent after the registered defaulter ran")
+	}
+}
+
 func TestGetDepNamespace(t *testing.T) {
 	t.Parallel()
 
@@ -442,3 +559,1511 @@ func TestGetDepNamespace(t *testing.T) {
 		})
 	}
 }
+
+func TestTemplateSyncPreview(t *testing.T) {
+	t.Parallel()
+
+	var disabled *templateSyncPreview
+
+	if disabled.enabled() || disabled.dryRun() != nil {
+		t.Fatal("Expected a nil preview to be disabled")
+	}
+
+	// Recording on a disabled preview must be a no-op
+	disabled.record(t.Context(), previewCreate, nil, &unstructured.Unstructured{}, "")
+
+	existing := &unstructured.Unstructured{
+		Object: map[string]any{
+			"apiVersion": "policy.open-cluster-management.io/v1",
+			"kind":       "ConfigurationPolicy",
+			"metadata": map[string]any{
+				"name":      "my-policy",
+				"namespace": "local-cluster",
+			},
+			"spec": map[string]any{
+				"remediationAction": "inform",
+				"severity":          "low",
+			},
+		},
+	}
+
+	desired := existing.DeepCopy()
+	desired.Object["spec"].(map[string]any)["remediationAction"] = "enforce"
+
+	preview := &templateSyncPreview{Changes: []templateChange{}}
+
+	if !preview.enabled() || len(preview.dryRun()) != 1 {
+		t.Fatal("Expected the preview to be enabled with a dry run")
+	}
+
+	preview.record(t.Context(), previewUpdate, existing, desired, "")
+	preview.record(t.Context(), previewDelete, existing, nil, "The template is no longer in the policy")
+
+	if len(preview.Changes) != 2 {
+		t.Fatalf("Expected 2 changes but got %d", len(preview.Changes))
+	}
+
+	if string(preview.Changes[0].Patch) != `{"spec":{"remediationAction":"enforce"}}` {
+		t.Fatalf("Unexpected update patch: %s", preview.Changes[0].Patch)
+	}
+
+	if preview.Changes[1].Patch != nil || preview.Changes[1].Name != "my-policy" {
+		t.Fatalf("Unexpected delete change: %+v", preview.Changes[1])
+	}
+
+	if preview.summary() != "1 update, 1 delete" {
+		t.Fatalf("Unexpected summary: %s", preview.summary())
+	}
+}
+
+func TestTemplateSyncPreviewCapped(t *testing.T) {
+	t.Parallel()
+
+	largePatch := json.RawMessage(fmt.Sprintf(
+		`{"metadata":{"labels":{"team":"a"}},"spec":{"object-templates":[{"data":%q}],"severity":"high"}}`,
+		strings.Repeat("x", maxPreviewPatchBytes),
+	))
+	smallPatch := json.RawMessage(`{"spec":{"remediationAction":"enforce"}}`)
+
+	preview := &templateSyncPreview{Changes: []templateChange{
+		{Action: previewUpdate, Name: "large", Patch: largePatch},
+		{Action: previewUpdate, Name: "small", Patch: smallPatch},
+		{Action: previewDelete, Name: "deleted"},
+	}}
+
+	capped := preview.capped()
+
+	expectedSummary := fmt.Sprintf(
+		"The patch of %d bytes is too large to include. It changes metadata.labels, spec.object-templates, "+
+			"spec.severity",
+		len(largePatch),
+	)
+
+	if capped.Changes[0].Patch != nil || capped.Changes[0].PatchSummary != expectedSummary {
+		t.Fatalf("Expected the large patch to be summarized, got %+v", capped.Changes[0])
+	}
+
+	if string(capped.Changes[1].Patch) != string(smallPatch) || capped.Changes[1].PatchSummary != "" {
+		t.Fatalf("Expected the small patch to be kept, got %+v", capped.Changes[1])
+	}
+
+	if capped.Changes[2].Patch != nil || capped.Changes[2].PatchSummary != "" {
+		t.Fatalf("Expected the change without a patch to be unchanged, got %+v", capped.Changes[2])
+	}
+
+	if string(preview.Changes[0].Patch) != string(largePatch) {
+		t.Fatal("Expected the original preview to keep the full patch")
+	}
+
+	// Many patches under the per patch limit are all summarized when they're too large together
+	many := &templateSyncPreview{}
+	mediumPatch := json.RawMessage(fmt.Sprintf(`{"spec":{"data":%q}}`, strings.Repeat("x", maxPreviewPatchBytes/2)))
+
+	for i := range maxPreviewEventBytes / len(mediumPatch) * 2 {
+		many.Changes = append(many.Changes, templateChange{
+			Action: previewUpdate, Name: fmt.Sprintf("template-%d", i), Patch: mediumPatch,
+		})
+	}
+
+	for _, change := range many.capped().Changes {
+		if change.Patch != nil || !strings.HasSuffix(change.PatchSummary, "It changes spec.data") {
+			t.Fatalf("Expected every patch to be summarized, got %+v", change)
+		}
+	}
+}
+
+// removeWatcherRecorder records the objects whose watches were removed.
+type removeWatcherRecorder struct {
+	depclient.DynamicWatcher
+	removed []depclient.ObjectIdentifier
+}
+
+func (w *removeWatcherRecorder) RemoveWatcher(watcher depclient.ObjectIdentifier) error {
+	w.removed = append(w.removed, watcher)
+
+	return nil
+}
+
+func TestReconcileDeletedPolicyCleanup(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	if err := policiesv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to set up the scheme: %s", err)
+	}
+
+	watcher := &removeWatcherRecorder{}
+	r := &PolicyReconciler{
+		Client:         crfake.NewClientBuilder().WithScheme(scheme).Build(),
+		DynamicWatcher: watcher,
+	}
+
+	deleted := types.NamespacedName{Namespace: "managed", Name: "deleted"}
+	otherHub := types.NamespacedName{Namespace: "team-policies", Name: "deleted"}
+
+	r.lastPreviews.Store(deleted, [32]byte{1})
+	r.lastPreviews.Store(otherHub, [32]byte{2})
+	r.latencyObserved.Store("managed/deleted/config", int64(1))
+
+	_, err := r.Reconcile(t.Context(), reconcile.Request{NamespacedName: deleted})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A policy recreated with the same name must get its first preview event
+	if _, ok := r.lastPreviews.Load(deleted); ok {
+		t.Fatal("Expected the last preview of the deleted policy to be removed")
+	}
+
+	if _, ok := r.lastPreviews.Load(otherHub); !ok {
+		t.Fatal("Expected the last preview of the policy from the other hub to be kept")
+	}
+
+	if _, ok := r.latencyObserved.Load("managed/deleted/config"); ok {
+		t.Fatal("Expected the observed sync latency of the deleted policy to be removed")
+	}
+
+	if len(watcher.removed) != 1 || watcher.removed[0].Name != "deleted" {
+		t.Fatalf("Expected the watcher of the deleted policy to be removed, got %v", watcher.removed)
+	}
+}
+
+func TestPreviewEnabled(t *testing.T) {
+	t.Parallel()
+
+	policy := &policiesv1.Policy{}
+	reconciler := &PolicyReconciler{PreviewMode: true}
+
+	if !reconciler.previewEnabled(policy) {
+		t.Fatal("Expected the global preview mode to apply")
+	}
+
+	policy.SetAnnotations(map[string]string{previewAnnotation: "false"})
+
+	if reconciler.previewEnabled(policy) {
+		t.Fatal("Expected the annotation to disable preview mode")
+	}
+
+	reconciler.PreviewMode = false
+	policy.SetAnnotations(map[string]string{previewAnnotation: "true"})
+
+	if !reconciler.previewEnabled(policy) {
+		t.Fatal("Expected the annotation to enable preview mode")
+	}
+}
+
+func TestParseTemplateKindFilter(t *testing.T) {
+	t.Parallel()
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: TemplateKindsConfigMapName, Namespace: "open-cluster-management-agent-addon"},
+		Data: map[string]string{
+			"allow": "ClusterPolicy.kyverno.io\nPolicy.kyverno.io, *.example.com\n# a comment\nnot-a-group-kind",
+			"deny":  "Dangerous.example.com",
+		},
+	}
+
+	filter, err := parseTemplateKindFilter(configMap)
+	if err == nil {
+		t.Fatal("Expected an error for the invalid entry")
+	}
+
+	tests := map[string]struct {
+		gk      schema.GroupKind
+		allowed bool
+		denied  bool
+	}{
+		"allowed kind":          {schema.GroupKind{Group: "kyverno.io", Kind: "ClusterPolicy"}, true, false},
+		"kind not on the list":  {schema.GroupKind{Group: "kyverno.io", Kind: "CleanupPolicy"}, false, false},
+		"allowed group":         {schema.GroupKind{Group: "example.com", Kind: "Anything"}, true, false},
+		"denied in the group":   {schema.GroupKind{Group: "example.com", Kind: "Dangerous"}, false, true},
+		"unrelated group":       {schema.GroupKind{Group: "apps", Kind: "Deployment"}, false, false},
+		"compiled allow list":   {utils.GvkConstraintTemplate, false, false},
+		"invalid entry ignored": {schema.GroupKind{Group: "", Kind: "not-a-group-kind"}, false, false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if filter.allowed(test.gk) != test.allowed {
+				t.Fatalf("Expected allowed to be %v for %s", test.allowed, test.gk)
+			}
+
+			if filter.denied(test.gk) != test.denied {
+				t.Fatalf("Expected denied to be %v for %s", test.denied, test.gk)
+			}
+		})
+	}
+
+	var nilFilter *templateKindFilter
+
+	if nilFilter.allowed(utils.GvkConstraintTemplate) || nilFilter.denied(utils.GvkConstraintTemplate) {
+		t.Fatal("Expected a nil filter to neither allow nor deny")
+	}
+}
+
+func TestAllowedKindGVRs(t *testing.T) {
+	t.Parallel()
+
+	discoveryClient := &discoveryfake.FakeDiscovery{Fake: &clienttesting.Fake{
+		Resources: []*metav1.APIResourceList{{
+			GroupVersion: "kyverno.io/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "clusterpolicies", Kind: "ClusterPolicy"},
+				{Name: "policies", Kind: "Policy", Namespaced: true},
+				{Name: "policies/status", Kind: "Policy", Namespaced: true},
+			},
+		}},
+	}}
+
+	// A kind that was allowed and is now denied is included so that its existing templates are deleted
+	filter := &templateKindFilter{
+		allow: []schema.GroupKind{{Group: "kyverno.io", Kind: "ClusterPolicy"}, {Group: "kyverno.io", Kind: "Policy"}},
+		deny:  []schema.GroupKind{{Group: "kyverno.io", Kind: "Policy"}},
+	}
+
+	gvrs, err := allowedKindGVRs(discoveryClient, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[schema.GroupVersionResource]scopedKind{
+		{Group: "kyverno.io", Version: "v1", Resource: "clusterpolicies"}: {
+			gk: schema.GroupKind{Group: "kyverno.io", Kind: "ClusterPolicy"},
+		},
+		{Group: "kyverno.io", Version: "v1", Resource: "policies"}: {
+			gk: schema.GroupKind{Group: "kyverno.io", Kind: "Policy"}, namespaced: true,
+		},
+	}
+
+	if !maps.Equal(gvrs, expected) {
+		t.Fatalf("Expected the resources %v, got %v", expected, gvrs)
+	}
+
+	if gvrs, err := allowedKindGVRs(discoveryClient, nil); err != nil || len(gvrs) != 0 {
+		t.Fatalf("Expected no resources without a filter, got %v (%v)", gvrs, err)
+	}
+}
+
+func TestCleanUpExcessTemplatesDeniedKind(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	if err := extensionsv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to set up the scheme: %s", err)
+	}
+
+	crd := &extensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "configurationpolicies.policy.open-cluster-management.io",
+			Labels: map[string]string{utils.PolicyTypeLabel: "template"},
+		},
+		Spec: extensionsv1.CustomResourceDefinitionSpec{
+			Group:    configpoliciesv1.GroupVersion.Group,
+			Names:    extensionsv1.CustomResourceDefinitionNames{Plural: "configurationpolicies", Kind: "ConfigurationPolicy"},
+			Scope:    extensionsv1.NamespaceScoped,
+			Versions: []extensionsv1.CustomResourceDefinitionVersion{{Name: "v1"}},
+		},
+	}
+
+	createdGkConstraint := false
+	r := &PolicyReconciler{
+		Client:              crfake.NewClientBuilder().WithScheme(scheme).WithObjects(crd).Build(),
+		createdGkConstraint: &createdGkConstraint,
+	}
+
+	policy := policiesv1.Policy{ObjectMeta: metav1.ObjectMeta{Name: "parent", Namespace: "managed"}}
+	filter := &templateKindFilter{
+		deny:   []schema.GroupKind{{Group: configpoliciesv1.GroupVersion.Group, Kind: "ConfigurationPolicy"}},
+		source: "the addon/governance-policy-template-kinds ConfigMap",
+	}
+
+	tests := map[string]struct {
+		filter          *templateKindFilter
+		expectedDeleted bool
+	}{
+		"allowed kind still in the policy": {filter: nil, expectedDeleted: false},
+		"denied kind still in the policy":  {filter: filter, expectedDeleted: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			template := applyTestTemplate(map[string]any{"remediationAction": "enforce"})
+			template.SetLabels(map[string]string{utils.ParentPolicyLabel: policy.Name})
+
+			dClient, res := newApplyTestClient(t, template)
+
+			err := r.cleanUpExcessTemplates(
+				t.Context(), dClient, nil, policy, []string{template.GetName()}, test.filter, nil,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = res.Get(t.Context(), template.GetName(), metav1.GetOptions{})
+			if deleted := k8serrors.IsNotFound(err); deleted != test.expectedDeleted {
+				t.Fatalf("Expected the template to be deleted to be %v, got the error %v", test.expectedDeleted, err)
+			}
+		})
+	}
+}
+
+func TestStatusMappingEvaluate(t *testing.T) {
+	t.Parallel()
+
+	mappings, err := parseStatusMappings(`
+ScanPolicy.example.com:
+  compliancePath: '{.status.result}'
+  compliant: [pass]
+  nonCompliant: [fail]
+  pending: [scanning]
+  messagePath: '{.status.summary}'
+Invalid.example.com:
+  compliant: [pass]
+`)
+	if err == nil {
+		t.Fatal("Expected an error for the mapping without a compliancePath")
+	}
+
+	mapping := mappings[schema.GroupKind{Group: "example.com", Kind: "ScanPolicy"}]
+	if mapping == nil {
+		t.Fatal("Expected the valid mapping to be parsed")
+	}
+
+	if _, ok := mappings[schema.GroupKind{Group: "example.com", Kind: "Invalid"}]; ok {
+		t.Fatal("Expected the invalid mapping to be skipped")
+	}
+
+	tests := map[string]struct {
+		status     map[string]any
+		compliance policiesv1.ComplianceState
+		msg        string
+		notFound   bool
+	}{
+		"compliant": {
+			status:     map[string]any{"result": "pass", "summary": "All checks passed"},
+			compliance: policiesv1.Compliant,
+			msg:        "All checks passed",
+		},
+		"noncompliant without a message": {
+			status:     map[string]any{"result": "fail"},
+			compliance: policiesv1.NonCompliant,
+			msg:        "ScanPolicy example has the status fail",
+		},
+		"pending": {
+			status:     map[string]any{"result": "scanning"},
+			compliance: policiesv1.Pending,
+			msg:        "ScanPolicy example has the status scanning",
+		},
+		"unmapped value": {
+			status:   map[string]any{"result": "unknown"},
+			notFound: true,
+		},
+		"no status": {
+			notFound: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			obj := &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "example.com/v1",
+				"kind":       "ScanPolicy",
+				"metadata":   map[string]any{"name": "example"},
+			}}
+
+			if test.status != nil {
+				obj.Object["status"] = test.status
+			}
+
+			compliance, msg, err := mapping.evaluate(obj)
+			if test.notFound {
+				if !errors.Is(err, errStatusNotReported) {
+					t.Fatalf("Expected errStatusNotReported, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if compliance != test.compliance || msg != test.msg {
+				t.Fatalf("Expected %s with %q, got %s with %q", test.compliance, test.msg, compliance, msg)
+			}
+		})
+	}
+}
+
+func TestGetTemplateWaves(t *testing.T) {
+	t.Parallel()
+
+	template := func(name string, wave string) *policiesv1.PolicyTemplate {
+		annotations := ""
+		if wave != "" {
+			annotations = fmt.Sprintf(`,"annotations":{"%s":"%s"}`, templateWaveAnnotation, wave)
+		}
+
+		return &policiesv1.PolicyTemplate{
+			ObjectDefinition: runtime.RawExtension{Raw: []byte(fmt.Sprintf(
+				`{"apiVersion":"policy.open-cluster-management.io/v1beta1","kind":"OperatorPolicy",`+
+					`"metadata":{"name":"%s"%s}}`, name, annotations,
+			))},
+		}
+	}
+
+	policy := &policiesv1.Policy{
+		ObjectMeta: metav1.ObjectMeta{Name: "policy", Namespace: "managed"},
+		Spec: policiesv1.PolicySpec{
+			PolicyTemplates: []*policiesv1.PolicyTemplate{
+				template("operator", ""),
+				template("instance", "5"),
+				template("config-a", "10"),
+				template("config-b", "10"),
+				template("invalid", "later"),
+			},
+		},
+	}
+
+	waves, waveErrs := getTemplateWaves(policy)
+	if waves == nil {
+		t.Fatal("Expected waves to be returned")
+	}
+
+	if len(waveErrs) != 1 || waveErrs[4] == nil {
+		t.Fatalf("Expected an error only for the invalid wave, got %v", waveErrs)
+	}
+
+	names := func(ids []depclient.ObjectIdentifier) []string {
+		result := []string{}
+		for _, id := range ids {
+			result = append(result, id.Name)
+		}
+
+		return result
+	}
+
+	expected := map[int][]string{
+		0: {},
+		1: {"operator"},
+		2: {"instance"},
+		3: {"instance"},
+		4: {},
+	}
+
+	for tIndex, expectedNames := range expected {
+		if actual := names(waves.previousWave(tIndex)); !slices.Equal(actual, expectedNames) {
+			t.Fatalf("Expected the previous wave of template %d to be %v, got %v", tIndex, expectedNames, actual)
+		}
+	}
+
+	// The template with an invalid wave isn't synced, so no wave waits on it
+	for wave, members := range waves.members {
+		if slices.Contains(names(members), "invalid") {
+			t.Fatalf("Expected the template with an invalid wave to not be in a wave, found it in wave %d", wave)
+		}
+	}
+
+	policy.Spec.PolicyTemplates = []*policiesv1.PolicyTemplate{template("operator", ""), template("instance", "")}
+
+	waves, _ = getTemplateWaves(policy)
+	if waves != nil {
+		t.Fatal("Expected no waves when no template sets a wave")
+	}
+
+	if waves.previousWave(1) != nil {
+		t.Fatal("Expected a nil templateWaves to have no previous wave")
+	}
+}
+
+func TestHasReadyCondition(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		conditions []any
+		expected   bool
+	}{
+		"ready":         {[]any{map[string]any{"type": "Ready", "status": "True"}}, true},
+		"not ready":     {[]any{map[string]any{"type": "Ready", "status": "False"}}, false},
+		"other type":    {[]any{map[string]any{"type": "Available", "status": "True"}}, false},
+		"no conditions": {nil, false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			obj := &unstructured.Unstructured{Object: map[string]any{}}
+			if test.conditions != nil {
+				obj.Object["status"] = map[string]any{"conditions": test.conditions}
+			}
+
+			if actual := hasReadyCondition(obj); actual != test.expected {
+				t.Fatalf("Expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseDependencyExpressions(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		input  string
+		errMsg string
+	}{
+		"valid": {
+			input: `
+- anyOf:
+  - apiVersion: apps/v1
+    kind: Deployment
+    name: operator
+    namespace: operators
+    conditions:
+    - type: Available
+      status: "True"
+  - apiVersion: policy.open-cluster-management.io/v1
+    kind: ConfigurationPolicy
+    selector:
+      matchLabels:
+        app: operator
+    notCompliance: NonCompliant
+- apiVersion: v1
+  kind: Namespace
+  name: legacy
+  exists: false
+`,
+		},
+		"allOf and anyOf": {
+			input: `[{"allOf": [{"apiVersion": "v1", "kind": "Namespace", "name": "a"}],` +
+				`"anyOf": [{"apiVersion": "v1", "kind": "Namespace", "name": "b"}]}]`,
+			errMsg: "only one of allOf or anyOf",
+		},
+		"name and selector": {
+			input:  `[{"apiVersion": "v1", "kind": "Namespace", "name": "a", "selector": {}}]`,
+			errMsg: "exactly one of name or selector",
+		},
+		"no kind": {
+			input:  `[{"name": "a"}]`,
+			errMsg: "must set apiVersion and kind",
+		},
+		"invalid compliance": {
+			input:  `[{"apiVersion": "v1", "kind": "Namespace", "name": "a", "compliance": "Ready"}]`,
+			errMsg: "invalid compliance state",
+		},
+		"not exists with requirements": {
+			input:  `[{"apiVersion": "v1", "kind": "Namespace", "name": "a", "exists": false, "compliance": "Compliant"}]`,
+			errMsg: "can't set other requirements",
+		},
+		"unknown field": {
+			input:  `[{"apiVersion": "v1", "kind": "Namespace", "name": "a", "state": "Compliant"}]`,
+			errMsg: "unknown field",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			exprs, err := parseDependencyExpressions(test.input)
+			if test.errMsg == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				if len(exprs) != 2 || len(exprs[0].AnyOf) != 2 || exprs[1].mustExist() {
+					t.Fatalf("Unexpected expressions: %+v", exprs)
+				}
+
+				ids := watchIdentifiers(exprs, "managed")
+				if len(ids) != 3 || ids[1].Namespace != "managed" || ids[1].Selector != "app=operator" {
+					t.Fatalf("Unexpected watch identifiers: %+v", ids)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.errMsg) {
+				t.Fatalf("Expected an error containing %q, got %v", test.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestCheckDependencyObject(t *testing.T) {
+	t.Parallel()
+
+	r := &PolicyReconciler{}
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "constraints.gatekeeper.sh/v1beta1",
+		"kind":       "K8sRequiredLabels",
+		"metadata":   map[string]any{"name": "labels"},
+		"status": map[string]any{
+			"totalViolations": int64(2),
+			"conditions": []any{
+				map[string]any{"type": "Available", "status": "True"},
+			},
+		},
+	}}
+	rsrc := schema.GroupVersionResource{
+		Group: "constraints.gatekeeper.sh", Version: "v1beta1", Resource: "k8srequiredlabels",
+	}
+
+	failures := r.checkDependencyObject(context.TODO(), &DependencyExpression{
+		Compliance: policiesv1.Compliant,
+		Conditions: []DependencyCondition{
+			{Type: "Available", Status: metav1.ConditionTrue},
+			{Type: "Ready", Status: metav1.ConditionTrue},
+		},
+	}, rsrc, obj, "K8sRequiredLabels labels", nil)
+
+	expected := []string{
+		"K8sRequiredLabels labels must be Compliant but is NonCompliant",
+		"K8sRequiredLabels labels must have the condition Ready=True but it is not set",
+	}
+
+	if !slices.Equal(failures, expected) {
+		t.Fatalf("Expected %v, got %v", expected, failures)
+	}
+
+	failures = r.checkDependencyObject(context.TODO(), &DependencyExpression{
+		NotCompliance: policiesv1.Compliant,
+	}, rsrc, obj, "K8sRequiredLabels labels", nil)
+
+	if len(failures) != 0 {
+		t.Fatalf("Expected no failures, got %v", failures)
+	}
+}
+
+func TestGeneratePendingMsg(t *testing.T) {
+	t.Parallel()
+
+	deps := map[depclient.ObjectIdentifier]string{
+		{Kind: "ConfigurationPolicy", Name: "b"}: DepFailWrongCompliance,
+		{Kind: "ConfigurationPolicy", Name: "a"}: DepFailObjNotFound,
+	}
+
+	msg := generatePendingMsg(deps)
+	if msg != "Dependencies were not satisfied: 2 are still pending (ConfigurationPolicy a, ConfigurationPolicy b)" {
+		t.Fatalf("Unexpected message: %s", msg)
+	}
+
+	msg = generatePendingMsg(nil, "Deployment ns/op must have the condition Available=True but it is False")
+	if msg != "Dependencies were not satisfied: Deployment ns/op must have the condition Available=True but it is False" {
+		t.Fatalf("Unexpected message: %s", msg)
+	}
+}
+
+func TestGetPendingTimeout(t *testing.T) {
+	t.Parallel()
+
+	policy := &policiesv1.Policy{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				pendingTimeoutAnnotation:       "1h",
+				pendingTimeoutActionAnnotation: "Skip",
+			},
+		},
+	}
+
+	timeout, err := getPendingTimeout(policy, nil)
+	if err != nil || timeout == nil || timeout.timeout != time.Hour || timeout.action != pendingTimeoutSkip {
+		t.Fatalf("Expected the policy timeout of 1h with Skip, got %+v and %v", timeout, err)
+	}
+
+	timeout, err = getPendingTimeout(policy, map[string]string{
+		pendingTimeoutAnnotation: "10m", pendingTimeoutActionAnnotation: "Delete",
+	})
+	if err != nil || timeout.timeout != 10*time.Minute || timeout.action != pendingTimeoutDelete {
+		t.Fatalf("Expected the template timeout of 10m with Delete, got %+v and %v", timeout, err)
+	}
+
+	_, err = getPendingTimeout(policy, map[string]string{pendingTimeoutAnnotation: "soon"})
+	if err == nil {
+		t.Fatal("Expected an error for an invalid duration")
+	}
+
+	_, err = getPendingTimeout(policy, map[string]string{pendingTimeoutActionAnnotation: "Ignore"})
+	if err == nil {
+		t.Fatal("Expected an error for an invalid action")
+	}
+
+	timeout, err = getPendingTimeout(&policiesv1.Policy{}, nil)
+	if err != nil || timeout != nil {
+		t.Fatalf("Expected no timeout, got %+v and %v", timeout, err)
+	}
+}
+
+func TestPendingSince(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+
+	policy := &policiesv1.Policy{
+		Status: policiesv1.PolicyStatus{
+			Details: []*policiesv1.DetailsPerTemplate{
+				{
+					History: []policiesv1.ComplianceHistory{
+						{
+							LastTimestamp: metav1.NewTime(start.Add(time.Hour)),
+							Message:       "NonCompliant; " + timeoutMsgPrefix + " of 1h0m0s: Policy a: " + DepFailObjNotFound,
+						},
+						{
+							LastTimestamp: metav1.NewTime(start),
+							Message:       "Pending; Dependencies were not satisfied: 1 is still pending (Policy a)",
+						},
+						{
+							LastTimestamp: metav1.NewTime(start.Add(-time.Hour)),
+							Message:       "Compliant; notification - example created",
+						},
+					},
+				},
+				{
+					History: []policiesv1.ComplianceHistory{
+						{LastTimestamp: metav1.NewTime(start), Message: "Compliant; notification - example created"},
+					},
+				},
+			},
+		},
+	}
+
+	if since := pendingSince(policy, 0); !since.Equal(start) {
+		t.Fatalf("Expected the template to be pending since %s, got %s", start, since)
+	}
+
+	if since := pendingSince(policy, 1); !since.IsZero() {
+		t.Fatalf("Expected the template to not be pending, got %s", since)
+	}
+
+	if since := pendingSince(policy, 2); !since.IsZero() {
+		t.Fatalf("Expected a template without a status to not be pending, got %s", since)
+	}
+}
+
+func TestGenerateTimeoutMsg(t *testing.T) {
+	t.Parallel()
+
+	msg := generateTimeoutMsg(time.Hour, map[depclient.ObjectIdentifier]string{
+		{Kind: "ConfigurationPolicy", Name: "b"}: DepFailWrongCompliance,
+		{Kind: "ConfigurationPolicy", Name: "a"}: DepFailObjNotFound,
+	}, "Deployment ns/op was not found")
+
+	expected := timeoutMsgPrefix + " of 1h0m0s: ConfigurationPolicy a: " + DepFailObjNotFound +
+		"; ConfigurationPolicy b: " + DepFailWrongCompliance + "; Deployment ns/op was not found"
+
+	if msg != expected {
+		t.Fatalf("Expected %q, got %q", expected, msg)
+	}
+
+	if minRequeueAfter(0, time.Minute) != time.Minute || minRequeueAfter(time.Hour, time.Minute) != time.Minute ||
+		minRequeueAfter(time.Minute, 0) != time.Minute {
+		t.Fatal("Expected the shortest non-zero requeue duration")
+	}
+}
+
+func TestBuildDependencyGraph(t *testing.T) {
+	t.Parallel()
+
+	configPolicy := func(name string, deps ...policiesv1.PolicyDependency) *policiesv1.PolicyTemplate {
+		return &policiesv1.PolicyTemplate{
+			ObjectDefinition: runtime.RawExtension{Raw: []byte(fmt.Sprintf(
+				`{"apiVersion":"policy.open-cluster-management.io/v1","kind":"ConfigurationPolicy",`+
+					`"metadata":{"name":"%s"}}`, name,
+			))},
+			ExtraDependencies: deps,
+		}
+	}
+
+	policyDep := func(name string) policiesv1.PolicyDependency {
+		return policiesv1.PolicyDependency{
+			TypeMeta: metav1.TypeMeta{APIVersion: "policy.open-cluster-management.io/v1", Kind: "Policy"},
+			Name:     name,
+		}
+	}
+
+	policies := []policiesv1.Policy{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "managed"},
+			Spec: policiesv1.PolicySpec{
+				Dependencies:    []policiesv1.PolicyDependency{policyDep("b")},
+				PolicyTemplates: []*policiesv1.PolicyTemplate{configPolicy("a-config")},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "managed"},
+			Spec: policiesv1.PolicySpec{
+				PolicyTemplates: []*policiesv1.PolicyTemplate{configPolicy("b-config", policyDep("a"))},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "managed"},
+			Spec: policiesv1.PolicySpec{
+				PolicyTemplates: []*policiesv1.PolicyTemplate{configPolicy("c-config", policyDep("a"))},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "d", Namespace: "managed"},
+			Spec: policiesv1.PolicySpec{
+				PolicyTemplates: []*policiesv1.PolicyTemplate{configPolicy("d-config", policyDep("d"))},
+			},
+		},
+	}
+
+	// Policies with the same names from another hub don't form a cycle with these policies
+	policies = append(policies,
+		policiesv1.Policy{
+			ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "managed-2"},
+			Spec: policiesv1.PolicySpec{
+				PolicyTemplates: []*policiesv1.PolicyTemplate{configPolicy("c-config")},
+			},
+		},
+		policiesv1.Policy{
+			ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "managed-2"},
+			Spec: policiesv1.PolicySpec{
+				Dependencies:    []policiesv1.PolicyDependency{policyDep("c")},
+				PolicyTemplates: []*policiesv1.PolicyTemplate{configPolicy("a-config")},
+			},
+		},
+	)
+
+	graph := buildDependencyGraph(policies)
+
+	expected := [][]string{
+		{
+			"ConfigurationPolicy.policy.open-cluster-management.io/managed/a-config",
+			"ConfigurationPolicy.policy.open-cluster-management.io/managed/b-config",
+			"Policy.policy.open-cluster-management.io/managed/a",
+			"Policy.policy.open-cluster-management.io/managed/b",
+		},
+		{
+			"ConfigurationPolicy.policy.open-cluster-management.io/managed/d-config",
+			"Policy.policy.open-cluster-management.io/managed/d",
+		},
+	}
+
+	if !equality.Semantic.DeepEqual(graph.Cycles, expected) {
+		t.Fatalf("Expected the cycles %v, got %v", expected, graph.Cycles)
+	}
+
+	if cycle := graph.cycle("ConfigurationPolicy.policy.open-cluster-management.io/managed/c-config"); cycle != nil {
+		t.Fatalf("Expected the template that depends on a cycle to not be in it, got %v", cycle)
+	}
+
+	if cycle := graph.cycle("Policy.policy.open-cluster-management.io/managed-2/c"); cycle != nil {
+		t.Fatalf("Expected the policy from the other hub to not be in a cycle, got %v", cycle)
+	}
+
+	if cycle := graph.cycle("Policy.policy.open-cluster-management.io/managed/b"); !slices.Equal(cycle, expected[0]) {
+		t.Fatalf("Expected the policy to be in the first cycle, got %v", cycle)
+	}
+
+	var nilGraph *dependencyGraph
+	if nilGraph.cycle("Policy.policy.open-cluster-management.io/managed/a") != nil {
+		t.Fatal("Expected a nil graph to have no cycles")
+	}
+}
+
+func TestDependencyNode(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		group    string
+		kind     string
+		expected string
+	}{
+		"namespaced template": {
+			"policy.open-cluster-management.io", "ConfigurationPolicy",
+			"ConfigurationPolicy.policy.open-cluster-management.io/managed/example",
+		},
+		"Gatekeeper constraint": {
+			utils.GConstraint, "K8sRequiredLabels", "K8sRequiredLabels.constraints.gatekeeper.sh/example",
+		},
+		"Gatekeeper constraint template": {
+			utils.GvkConstraintTemplate.Group, "ConstraintTemplate", "ConstraintTemplate.templates.gatekeeper.sh/example",
+		},
+		"core group": {"", "ConfigMap", "ConfigMap/managed/example"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			namespace := templateNamespace("managed", test.group)
+
+			if actual := dependencyNode(test.group, test.kind, namespace, "example"); actual != test.expected {
+				t.Fatalf("Expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestGetDependencyGraph(t *testing.T) {
+	t.Parallel()
+
+	policies := []policiesv1.Policy{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "managed", UID: "a-uid", Generation: 1}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "managed", UID: "b-uid", Generation: 1}},
+	}
+
+	r := &PolicyReconciler{}
+
+	graph := r.getDependencyGraph("managed", policies)
+
+	// A status update doesn't change the generation, so the graph isn't rebuilt
+	policies[0].ResourceVersion = "2"
+
+	if r.getDependencyGraph("managed", policies) != graph {
+		t.Fatal("Expected the graph to not be rebuilt when the policies didn't change")
+	}
+
+	if r.getDependencyGraph("managed-2", policies) == graph {
+		t.Fatal("Expected a separate graph for each namespace")
+	}
+
+	policies[1].Generation = 2
+
+	if r.getDependencyGraph("managed", policies) == graph {
+		t.Fatal("Expected the graph to be rebuilt when a policy spec changed")
+	}
+
+	graph = r.getDependencyGraph("managed", policies)
+
+	if r.getDependencyGraph("managed", policies[:1]) == graph {
+		t.Fatal("Expected the graph to be rebuilt when a policy was removed")
+	}
+}
+
+func TestDependencyGraphHandler(t *testing.T) {
+	t.Parallel()
+
+	r := &PolicyReconciler{}
+
+	for _, namespace := range []string{"cluster1", "team-policies"} {
+		r.getDependencyGraph(namespace, []policiesv1.Policy{
+			{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: namespace, UID: "a-uid", Generation: 1}},
+		})
+	}
+
+	serve := func(target string) map[string]*dependencyGraph {
+		recorder := httptest.NewRecorder()
+		r.DependencyGraphHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+
+		graphs := map[string]*dependencyGraph{}
+
+		if err := json.Unmarshal(recorder.Body.Bytes(), &graphs); err != nil {
+			t.Fatalf("Failed to parse the response %q: %v", recorder.Body.String(), err)
+		}
+
+		return graphs
+	}
+
+	graphs := serve(DependencyGraphPath)
+	if len(graphs) != 2 || graphs["cluster1"] == nil || graphs["team-policies"] == nil {
+		t.Fatalf("Expected the graph of each namespace, got %v", graphs)
+	}
+
+	graphs = serve(DependencyGraphPath + "?namespace=team-policies")
+	if len(graphs) != 1 || graphs["team-policies"] == nil {
+		t.Fatalf("Expected only the graph of the team-policies namespace, got %v", graphs)
+	}
+
+	if _, ok := graphs["team-policies"].Edges["Policy.policy.open-cluster-management.io/team-policies/a"]; !ok {
+		t.Fatalf("Expected the graph to have the policy in the team-policies namespace, got %v", graphs)
+	}
+}
+
+func TestTemplatePredicatesTemplateError(t *testing.T) {
+	t.Parallel()
+
+	// A violation whose message happens to contain "template-error", such as from an object's name
+	violationEvent := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "policy.violation",
+			Namespace: "cluster",
+			Annotations: map[string]string{
+				utils.ComplianceAnnotation:         string(policiesv1.NonCompliant),
+				utils.ComplianceCategoryAnnotation: string(utils.CategoryViolation),
+			},
+		},
+	}
+
+	templateErrorEvent := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "policy.template-error",
+			Namespace: "cluster",
+			Annotations: map[string]string{
+				utils.ComplianceAnnotation:         string(policiesv1.NonCompliant),
+				utils.ComplianceCategoryAnnotation: string(utils.CategoryTemplateError),
+			},
+		},
+	}
+
+	reader := crfake.NewClientBuilder().WithObjects(violationEvent, templateErrorEvent).Build()
+
+	history := func(entries ...policiesv1.ComplianceHistory) *policiesv1.Policy {
+		return &policiesv1.Policy{
+			ObjectMeta: metav1.ObjectMeta{Name: "policy", Namespace: "cluster"},
+			Status: policiesv1.PolicyStatus{
+				Details: []*policiesv1.DetailsPerTemplate{{History: entries}},
+			},
+		}
+	}
+
+	compliant := policiesv1.ComplianceHistory{EventName: "policy.compliant", Message: "Compliant; all good"}
+
+	tests := map[string]struct {
+		policy   *policiesv1.Policy
+		expected bool
+	}{
+		"template error parsed from the message of an expired event": {
+			policy: history(compliant, policiesv1.ComplianceHistory{
+				EventName: "policy.expired", Message: "NonCompliant; template-error; invalid",
+			}),
+			expected: true,
+		},
+		"template error from the event annotations": {
+			policy: history(compliant, policiesv1.ComplianceHistory{
+				EventName: templateErrorEvent.Name, Message: "NonCompliant; invalid",
+			}),
+			expected: true,
+		},
+		"violation from the event annotations": {
+			policy: history(compliant, policiesv1.ComplianceHistory{
+				EventName: violationEvent.Name, Message: "NonCompliant; violation - template-error not found",
+			}),
+		},
+		"latest entry is the template error": {
+			policy: history(policiesv1.ComplianceHistory{
+				EventName: templateErrorEvent.Name, Message: "NonCompliant; invalid",
+			}, compliant),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			updated := templatePredicates(reader).Update(event.UpdateEvent{ObjectOld: test.policy, ObjectNew: test.policy})
+			if updated != test.expected {
+				t.Fatalf("Expected the predicate to return %v, got %v", test.expected, updated)
+			}
+		})
+	}
+}
+
+// deadlineReader records whether each Get had a deadline and then waits for its context to be done, like a read from
+// a cache that hasn't synced.
+type deadlineReader struct {
+	client.Reader
+	gets         int
+	withDeadline int
+}
+
+func (r *deadlineReader) Get(ctx context.Context, _ client.ObjectKey, _ client.Object, _ ...client.GetOption) error {
+	r.gets++
+
+	if _, ok := ctx.Deadline(); !ok {
+		return errors.New("the context has no deadline")
+	}
+
+	r.withDeadline++
+
+	<-ctx.Done()
+
+	return ctx.Err()
+}
+
+func TestTemplatePredicatesBoundedGet(t *testing.T) {
+	t.Parallel()
+
+	reader := &deadlineReader{}
+	policy := &policiesv1.Policy{
+		ObjectMeta: metav1.ObjectMeta{Name: "policy", Namespace: "cluster"},
+		Status: policiesv1.PolicyStatus{
+			Details: []*policiesv1.DetailsPerTemplate{{History: []policiesv1.ComplianceHistory{
+				{EventName: "policy.compliant", Message: "Compliant; all good"},
+				{EventName: "policy.template-error", Message: "NonCompliant; template-error; invalid"},
+			}}},
+		},
+	}
+
+	start := time.Now()
+
+	if !templatePredicates(reader).Update(event.UpdateEvent{ObjectOld: policy, ObjectNew: policy}) {
+		t.Fatal("Expected the template error to be parsed from the message when the event can't be read in time")
+	}
+
+	if elapsed := time.Since(start); elapsed > historyEventsTimeout+time.Second {
+		t.Fatalf("Expected the predicate to stop waiting on the reader after %s, took %s", historyEventsTimeout, elapsed)
+	}
+
+	// Once the deadline is reached, the remaining entries aren't read
+	if reader.gets != 1 || reader.withDeadline != 1 {
+		t.Fatalf("Expected a single Get with a deadline, got %d Gets and %d with a deadline",
+			reader.gets, reader.withDeadline)
+	}
+}
+
+func TestEnforcingTemplate(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		apiVersion string
+		kind       string
+		spec       map[string]any
+		expected   bool
+	}{
+		"enforce": {
+			"policy.open-cluster-management.io/v1", "ConfigurationPolicy", map[string]any{"remediationAction": "Enforce"}, true,
+		},
+		"inform": {
+			"policy.open-cluster-management.io/v1", "ConfigurationPolicy", map[string]any{"remediationAction": "inform"}, false,
+		},
+		"no remediation action": {
+			"policy.open-cluster-management.io/v1", "ConfigurationPolicy", map[string]any{}, false,
+		},
+		"constraint that denies": {
+			"constraints.gatekeeper.sh/v1beta1", "K8sRequiredLabels", map[string]any{"enforcementAction": "deny"}, true,
+		},
+		"constraint with the default enforcement action": {
+			"constraints.gatekeeper.sh/v1beta1", "K8sRequiredLabels", map[string]any{}, true,
+		},
+		"constraint that warns": {
+			"constraints.gatekeeper.sh/v1beta1", "K8sRequiredLabels", map[string]any{"enforcementAction": "warn"}, false,
+		},
+		"constraint template": {
+			"templates.gatekeeper.sh/v1", "ConstraintTemplate", map[string]any{}, false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			obj := &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": test.apiVersion,
+				"kind":       test.kind,
+				"metadata":   map[string]any{"name": "case1"},
+				"spec":       test.spec,
+			}}
+
+			if enforcing := enforcingTemplate(obj); enforcing != test.expected {
+				t.Fatalf("Expected enforcing to be %v, got %v", test.expected, enforcing)
+			}
+		})
+	}
+}
+
+func TestFrozenTemplate(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	// The freeze window opens every minute for an hour, so changes are always frozen
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: utils.MaintenanceWindowsConfigMapName, Namespace: "addon"},
+		Data:       map[string]string{"windows": `[{name: always, schedule: "* * * * *", duration: 1h}]`},
+	}
+
+	windows := &utils.MaintenanceWindows{
+		Reader: crfake.NewClientBuilder().WithScheme(scheme).WithObjects(configMap).Build(), Namespace: "addon",
+	}
+	if err := windows.Load(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	enforce := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "policy.open-cluster-management.io/v1",
+		"kind":       "ConfigurationPolicy",
+		"metadata":   map[string]any{"name": "case1"},
+		"spec":       map[string]any{"remediationAction": "enforce"},
+	}}
+	inform := enforce.DeepCopy()
+	inform.Object["spec"] = map[string]any{"remediationAction": "inform"}
+
+	if frozen, _ := (&PolicyReconciler{}).frozenTemplate(enforce); frozen {
+		t.Fatal("Expected the template to not be frozen without maintenance windows")
+	}
+
+	r := &PolicyReconciler{MaintenanceWindows: windows}
+
+	if frozen, _ := r.frozenTemplate(inform); frozen {
+		t.Fatal("Expected the inform template to not be frozen")
+	}
+
+	frozen, frozenFor := r.frozenTemplate(enforce)
+	if !frozen || frozenFor < 59*time.Minute || frozenFor > time.Hour {
+		t.Fatalf("Expected the enforce template to be frozen for about an hour, got %v for %s", frozen, frozenFor)
+	}
+}
+
+// newApplyTestClient returns a fake dynamic client for ConfigurationPolicies that tracks managed fields like the API
+// server, so that server-side apply and the managed fields migration can be tested.
+func newApplyTestClient(t *testing.T, objects ...runtime.Object) (*fake.FakeDynamicClient, dynamic.ResourceInterface) {
+	t.Helper()
+
+	gvk := configpoliciesv1.GroupVersion.WithKind("ConfigurationPolicy")
+	gvr := configpoliciesv1.GroupVersion.WithResource("configurationpolicies")
+
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(gvk.GroupVersion().WithKind("ConfigurationPolicyList"), &unstructured.UnstructuredList{})
+
+	tracker := clienttesting.NewFieldManagedObjectTracker(
+		scheme, unstructured.UnstructuredJSONScheme, managedfields.NewDeducedTypeConverter(),
+	)
+
+	for _, obj := range objects {
+		if err := tracker.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(
+		scheme, map[schema.GroupVersionResource]string{gvr: "ConfigurationPolicyList"},
+	)
+	client.PrependReactor("*", "*", clienttesting.ObjectReaction(tracker))
+
+	return client, client.Resource(gvr).Namespace("managed")
+}
+
+func applyTestTemplate(spec map[string]any) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": configpoliciesv1.GroupVersion.String(),
+		"kind":       "ConfigurationPolicy",
+		"metadata":   map[string]any{"name": "case1", "namespace": "managed"},
+		"spec":       spec,
+	}}
+}
+
+// patchActions returns the patch types of the patch actions of the client, and the options of the last apply.
+func patchActions(t *testing.T, client *fake.FakeDynamicClient) ([]types.PatchType, metav1.PatchOptions) {
+	t.Helper()
+
+	patchTypes := []types.PatchType{}
+	applyOptions := metav1.PatchOptions{}
+
+	for _, action := range client.Actions() {
+		patchAction, ok := action.(clienttesting.PatchActionImpl)
+		if !ok {
+			continue
+		}
+
+		patchTypes = append(patchTypes, patchAction.GetPatchType())
+
+		if patchAction.GetPatchType() == types.ApplyPatchType {
+			applyOptions = patchAction.PatchOptions
+		}
+	}
+
+	return patchTypes, applyOptions
+}
+
+func TestApplyTemplate(t *testing.T) {
+	t.Parallel()
+
+	client, res := newApplyTestClient(t)
+	desired := applyTestTemplate(map[string]any{"remediationAction": "inform", "severity": "low"})
+
+	created, err := applyTemplate(t.Context(), res, nil, desired, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patchTypes, options := patchActions(t, client)
+	if !slices.Equal(patchTypes, []types.PatchType{types.ApplyPatchType}) {
+		t.Fatalf("Expected only an apply, got %v", patchTypes)
+	}
+
+	if options.FieldManager != FieldManager || options.Force == nil || !*options.Force {
+		t.Fatalf("Expected the apply to force ownership as the %s field manager, got %+v", FieldManager, options)
+	}
+
+	if options.FieldValidation != metav1.FieldValidationStrict {
+		t.Fatalf("Expected strict field validation, got %q", options.FieldValidation)
+	}
+
+	// Applying the same template again doesn't migrate the managed fields or change the object
+	client.ClearActions()
+
+	applied, err := applyTemplate(t.Context(), res, created, desired, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if patchTypes, _ := patchActions(t, client); !slices.Equal(patchTypes, []types.PatchType{types.ApplyPatchType}) {
+		t.Fatalf("Expected only an apply for an equivalent template, got %v", patchTypes)
+	}
+
+	if !equality.Semantic.DeepEqual(applied.Object["spec"], created.Object["spec"]) ||
+		!equality.Semantic.DeepEqual(applied.GetManagedFields(), created.GetManagedFields()) {
+		t.Fatalf("Expected an equivalent template to not change the object, got %v", applied.Object)
+	}
+}
+
+func TestApplyTemplateDryRun(t *testing.T) {
+	t.Parallel()
+
+	// The existing object was written with a client-side update, so a real apply would migrate its managed fields
+	existing := applyTestTemplate(map[string]any{"remediationAction": "inform"})
+	existing.SetManagedFields([]metav1.ManagedFieldsEntry{{
+		Manager:    "governance-policy-framework-addon",
+		Operation:  metav1.ManagedFieldsOperationUpdate,
+		APIVersion: configpoliciesv1.GroupVersion.String(),
+		FieldsType: "FieldsV1",
+		FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:spec":{".":{},"f:remediationAction":{}}}`)},
+	}})
+
+	client, res := newApplyTestClient(t, existing)
+	desired := applyTestTemplate(map[string]any{"remediationAction": "enforce"})
+
+	_, err := applyTemplate(t.Context(), res, existing, desired, []string{metav1.DryRunAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patchTypes, options := patchActions(t, client)
+	if !slices.Equal(patchTypes, []types.PatchType{types.ApplyPatchType}) {
+		t.Fatalf("Expected a dry run to only apply without migrating the managed fields, got %v", patchTypes)
+	}
+
+	dryRun := slices.Equal(options.DryRun, []string{metav1.DryRunAll})
+	if !dryRun || options.FieldValidation != metav1.FieldValidationStrict {
+		t.Fatalf("Expected a strictly validated dry run apply, got %+v", options)
+	}
+}
+
+func TestApplyTemplateManagedFieldsUpgrade(t *testing.T) {
+	t.Parallel()
+
+	// The existing object was written with a client-side update before server-side apply was enabled
+	existing := applyTestTemplate(map[string]any{"remediationAction": "inform", "severity": "low"})
+	existing.SetManagedFields([]metav1.ManagedFieldsEntry{{
+		Manager:    "governance-policy-framework-addon",
+		Operation:  metav1.ManagedFieldsOperationUpdate,
+		APIVersion: configpoliciesv1.GroupVersion.String(),
+		FieldsType: "FieldsV1",
+		FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:spec":{".":{},"f:remediationAction":{},"f:severity":{}}}`)},
+	}})
+
+	client, res := newApplyTestClient(t, existing)
+
+	// The severity was removed from the template, so it must be removed from the object
+	desired := applyTestTemplate(map[string]any{"remediationAction": "enforce"})
+
+	applied, err := applyTemplate(t.Context(), res, existing, desired, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patchTypes, _ := patchActions(t, client)
+	if !slices.Equal(patchTypes, []types.PatchType{types.JSONPatchType, types.ApplyPatchType}) {
+		t.Fatalf("Expected the managed fields to be migrated before the apply, got %v", patchTypes)
+	}
+
+	expectedSpec := map[string]any{"remediationAction": "enforce"}
+	if !equality.Semantic.DeepEqual(applied.Object["spec"], expectedSpec) {
+		t.Fatalf("Expected the spec to be %v, got %v", expectedSpec, applied.Object["spec"])
+	}
+
+	for _, entry := range applied.GetManagedFields() {
+		if entry.Manager != FieldManager || entry.Operation != metav1.ManagedFieldsOperationApply {
+			t.Fatalf("Expected only the %s field manager to own fields with apply, got %+v", FieldManager, entry)
+		}
+	}
+}
+
+func TestTemplateNeedsApply(t *testing.T) {
+	t.Parallel()
+
+	_, res := newApplyTestClient(t)
+	desired := applyTestTemplate(map[string]any{"remediationAction": "inform"})
+	desired.SetLabels(map[string]string{"team": "a"})
+	desired.SetAnnotations(map[string]string{"owner": "b"})
+
+	applied, err := applyTemplate(t.Context(), res, nil, desired, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if templateNeedsApply(applied, desired) {
+		t.Fatal("Expected an applied template with the same metadata to not need to be applied")
+	}
+
+	withoutLabel := desired.DeepCopy()
+	withoutLabel.SetLabels(nil)
+
+	if !templateNeedsApply(applied, withoutLabel) {
+		t.Fatal("Expected a template without a previously applied label to need to be applied")
+	}
+
+	withoutAnnotation := desired.DeepCopy()
+	withoutAnnotation.SetAnnotations(nil)
+
+	if !templateNeedsApply(applied, withoutAnnotation) {
+		t.Fatal("Expected a template without a previously applied annotation to need to be applied")
+	}
+
+	// The existing object was written with a client-side update before server-side apply was enabled
+	legacy := applyTestTemplate(map[string]any{"remediationAction": "inform"})
+	legacy.SetManagedFields([]metav1.ManagedFieldsEntry{{
+		Manager:    "governance-policy-framework-addon",
+		Operation:  metav1.ManagedFieldsOperationUpdate,
+		APIVersion: configpoliciesv1.GroupVersion.String(),
+		FieldsType: "FieldsV1",
+		FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:spec":{".":{},"f:remediationAction":{}}}`)},
+	}})
+
+	if !templateNeedsApply(legacy, legacy) {
+		t.Fatal("Expected a template with managed fields from a client-side update to need to be applied")
+	}
+}
+
+func TestDeletePolicyMetrics(t *testing.T) {
+	t.Parallel()
+
+	// The policies from each hub are in their own namespace and can have the same name
+	policyName := "delete-metrics"
+
+	for _, namespace := range []string{"cluster1", "team-policies"} {
+		policyUserErrorsCounter.WithLabelValues(policyName, namespace, "config", "format-error").Inc()
+		policySystemErrorsCounter.WithLabelValues(policyName, namespace, "config", "get-error").Inc()
+		templatePendingGauge.WithLabelValues(policyName, namespace, "config").Set(30)
+		templateSyncLatencyHistogram.WithLabelValues(ControllerName, policyName, namespace).Observe(1)
+	}
+
+	deletePolicyMetrics("cluster1", policyName)
+
+	labels := prometheus.Labels{"policy": policyName, "namespace": "cluster1"}
+	if deleted := templatePendingGauge.DeletePartialMatch(labels); deleted != 0 {
+		t.Fatalf("Expected the pending metric to already be deleted, but %d were found", deleted)
+	}
+
+	if deleted := templateSyncLatencyHistogram.DeletePartialMatch(labels); deleted != 0 {
+		t.Fatalf("Expected the latency metric to already be deleted, but %d were found", deleted)
+	}
+
+	otherHubLabels := prometheus.Labels{"policy": policyName, "namespace": "team-policies"}
+
+	for name, metric := range map[string]interface {
+		DeletePartialMatch(labels prometheus.Labels) int
+	}{
+		"user errors":   policyUserErrorsCounter,
+		"system errors": policySystemErrorsCounter,
+		"pending":       templatePendingGauge,
+		"latency":       templateSyncLatencyHistogram,
+	} {
+		if deleted := metric.DeletePartialMatch(otherHubLabels); deleted != 1 {
+			t.Fatalf("Expected the %s metric of the policy from the other hub to be kept, but %d were found", name, deleted)
+		}
+	}
+}
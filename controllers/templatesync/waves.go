@@ -0,0 +1,202 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templatesync
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	depclient "github.com/stolostron/kubernetes-dependency-watches/client"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+
+	"open-cluster-management.io/governance-policy-framework-addon/controllers/utils"
+)
+
+// templateWaveAnnotation is the annotation on a policy template that sets its wave. Templates without the annotation
+// are in wave 0. A template is only created after all the templates in the previous wave are compliant or ready.
+const templateWaveAnnotation = "policy.open-cluster-management.io/template-wave"
+
+// templateWaves is the wave of each policy template in a policy and the templates in each wave.
+type templateWaves struct {
+	// waves is the sorted list of waves that contain at least one template
+	waves []int
+	// byIndex is the wave of each template by its index in the policy
+	byIndex map[int]int
+	// members is the identifiers of the templates in each wave
+	members map[int][]depclient.ObjectIdentifier
+}
+
+// getTemplateWaves parses the wave annotation of each policy template. Templates that can't be decoded are skipped
+// since they are reported separately. Invalid annotations are returned by the template index so that an error can be
+// emitted for each, and those templates are left out of the waves since they aren't synced, so the next wave doesn't
+// wait on them. If no template sets a wave, nil is returned.
+func getTemplateWaves(pol *policiesv1.Policy) (*templateWaves, map[int]error) {
+	waves := &templateWaves{
+		byIndex: map[int]int{},
+		members: map[int][]depclient.ObjectIdentifier{},
+	}
+	waveErrs := map[int]error{}
+	hasWaves := false
+
+	for tIndex, policyT := range pol.Spec.PolicyTemplates {
+		if policyT == nil || policyT.ObjectDefinition.Raw == nil {
+			continue
+		}
+
+		tObject := &unstructured.Unstructured{}
+
+		if err := tObject.UnmarshalJSON(policyT.ObjectDefinition.Raw); err != nil || tObject.GetName() == "" {
+			continue
+		}
+
+		wave := 0
+
+		if rawWave, ok := tObject.GetAnnotations()[templateWaveAnnotation]; ok {
+			parsed, err := strconv.Atoi(rawWave)
+			if err != nil {
+				waveErrs[tIndex] = fmt.Errorf("the %s annotation must be an integer: %s", templateWaveAnnotation, rawWave)
+
+				continue
+			}
+
+			wave = parsed
+			hasWaves = true
+		}
+
+		gvk := tObject.GroupVersionKind()
+
+		waves.byIndex[tIndex] = wave
+		waves.members[wave] = append(waves.members[wave], depclient.ObjectIdentifier{
+			Group:     gvk.Group,
+			Version:   gvk.Version,
+			Kind:      gvk.Kind,
+			Namespace: pol.Namespace,
+			Name:      tObject.GetName(),
+		})
+	}
+
+	if !hasWaves {
+		return nil, waveErrs
+	}
+
+	waves.waves = slices.Sorted(maps.Keys(waves.members))
+
+	return waves, waveErrs
+}
+
+// previousWave returns the templates in the wave before the wave of the template at the index, or nil if it's in the
+// first wave. A nil *templateWaves has no waves.
+func (w *templateWaves) previousWave(tIndex int) []depclient.ObjectIdentifier {
+	if w == nil {
+		return nil
+	}
+
+	wave, ok := w.byIndex[tIndex]
+	if !ok {
+		return nil
+	}
+
+	pos := slices.Index(w.waves, wave)
+	if pos <= 0 {
+		return nil
+	}
+
+	return w.members[w.waves[pos-1]]
+}
+
+// processWaveDependencies returns the templates in the previous wave that are not yet compliant or ready, mapped to
+// the reason. A template without a compliance state is considered ready when it has a Ready condition set to True.
+func (r *PolicyReconciler) processWaveDependencies(
+	ctx context.Context,
+	dClient dynamic.Interface,
+	discoveryClient discovery.DiscoveryInterface,
+	previousWave []depclient.ObjectIdentifier,
+	kindFilter *templateKindFilter,
+	tLogger logr.Logger,
+) map[depclient.ObjectIdentifier]string {
+	waveDeps := make(map[depclient.ObjectIdentifier]string, len(previousWave))
+
+	for _, dep := range previousWave {
+		waveDeps[dep] = string(policiesv1.Compliant)
+	}
+
+	waveFailures := r.processDependencies(ctx, dClient, discoveryClient, waveDeps, kindFilter, tLogger)
+
+	for dep, reason := range waveFailures {
+		if reason != DepFailCompNotFound {
+			continue
+		}
+
+		ready, err := templateReady(ctx, dClient, discoveryClient, dep)
+		if err != nil {
+			tLogger.Error(err, "Failed to check if the template in the previous wave is ready", "object", dep)
+
+			continue
+		}
+
+		if ready {
+			tLogger.V(1).Info("Wave dependency satisfied by the Ready condition", "object", dep)
+
+			delete(waveFailures, dep)
+		}
+	}
+
+	return waveFailures
+}
+
+// templateReady returns whether the object has a Ready condition set to True.
+func templateReady(
+	ctx context.Context,
+	dClient dynamic.Interface,
+	discoveryClient discovery.DiscoveryInterface,
+	dep depclient.ObjectIdentifier,
+) (bool, error) {
+	rsrc, namespaced, err := utils.GVRFromGVK(discoveryClient, dep.GroupVersionKind())
+	if err != nil {
+		return false, err
+	}
+
+	var res dynamic.ResourceInterface = dClient.Resource(rsrc)
+
+	if namespaced {
+		res = dClient.Resource(rsrc).Namespace(dep.Namespace)
+	}
+
+	depObj, err := res.Get(ctx, dep.Name, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return hasReadyCondition(depObj), nil
+}
+
+// hasReadyCondition returns whether the object has a status condition of type Ready set to True.
+func hasReadyCondition(obj *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+
+	for _, condition := range conditions {
+		condMap, ok := condition.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		if condMap["type"] == "Ready" && condMap["status"] == string(metav1.ConditionTrue) {
+			return true
+		}
+	}
+
+	return false
+}
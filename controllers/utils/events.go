@@ -4,7 +4,9 @@ package utils
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -14,6 +16,145 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+const (
+	// ComplianceAnnotation is the annotation on compliance events with the compliance state that the event reports,
+	// such as NonCompliant, so that it doesn't need to be parsed from the start of the message.
+	ComplianceAnnotation = "policy.open-cluster-management.io/compliance"
+	// ComplianceCategoryAnnotation is the annotation on compliance events with the ComplianceCategory of the event.
+	// It's not set on events for compliant templates.
+	ComplianceCategoryAnnotation = "policy.open-cluster-management.io/compliance-category"
+	// RelatedObjectsAnnotation is the annotation on compliance events with a JSON list of references to the objects
+	// that the event is about, such as the policy template.
+	RelatedObjectsAnnotation = "policy.open-cluster-management.io/related-objects"
+)
+
+// ComplianceCategory is why a template isn't compliant.
+type ComplianceCategory string
+
+const (
+	// CategoryTemplateError is when the template couldn't be synced to the managed cluster, such as when it's invalid.
+	CategoryTemplateError ComplianceCategory = "template-error"
+	// CategoryPending is when the template is waiting for its dependencies.
+	CategoryPending ComplianceCategory = "pending"
+	// CategoryViolation is when the template was evaluated and found to be noncompliant.
+	CategoryViolation ComplianceCategory = "violation"
+)
+
+// DefaultComplianceCategory returns the category of an event with the compliance state that's not from a template
+// error. Compliant events have no category.
+func DefaultComplianceCategory(compliance policyv1.ComplianceState) ComplianceCategory {
+	switch compliance {
+	case policyv1.NonCompliant:
+		return CategoryViolation
+	case policyv1.Pending:
+		return CategoryPending
+	default:
+		return ""
+	}
+}
+
+// ComplianceDetails is the structured information of a compliance event.
+type ComplianceDetails struct {
+	Compliance     policyv1.ComplianceState
+	Category       ComplianceCategory
+	RelatedObjects []corev1.ObjectReference
+}
+
+// ComplianceDetailsFromAnnotations returns the compliance details from the annotations on a compliance event. False is
+// returned when the event has no compliance annotation, such as an event from an older version or another controller.
+func ComplianceDetailsFromAnnotations(annotations map[string]string) (ComplianceDetails, bool) {
+	compliance := policyv1.ComplianceState(annotations[ComplianceAnnotation])
+
+	switch compliance {
+	case policyv1.Compliant, policyv1.NonCompliant, policyv1.Pending:
+	default:
+		return ComplianceDetails{}, false
+	}
+
+	details := ComplianceDetails{
+		Compliance: compliance,
+		Category:   ComplianceCategory(annotations[ComplianceCategoryAnnotation]),
+	}
+
+	if rawRelated := annotations[RelatedObjectsAnnotation]; rawRelated != "" {
+		// The related objects are informational, so invalid ones are ignored
+		_ = json.Unmarshal([]byte(rawRelated), &details.RelatedObjects)
+	}
+
+	return details, true
+}
+
+// ComplianceDetailsFromMessage returns the compliance details parsed from the message of a compliance event, which
+// starts with the compliance state, such as `NonCompliant; template-error; ...`. This is the fallback for events
+// without the compliance annotations and for compliance history entries whose event no longer exists.
+func ComplianceDetailsFromMessage(message string) ComplianceDetails {
+	cleanMsg := strings.ToLower(
+		strings.TrimSpace(
+			strings.TrimPrefix(message, "(combined from similar events):"),
+		),
+	)
+
+	details := ComplianceDetails{Compliance: policyv1.NonCompliant}
+
+	if strings.HasPrefix(cleanMsg, "compliant") {
+		details.Compliance = policyv1.Compliant
+	} else if strings.HasPrefix(cleanMsg, "pending") {
+		details.Compliance = policyv1.Pending
+	}
+
+	if strings.Contains(cleanMsg, string(CategoryTemplateError)) {
+		details.Category = CategoryTemplateError
+	} else {
+		details.Category = DefaultComplianceCategory(details.Compliance)
+	}
+
+	return details
+}
+
+// CachedEventAnnotations returns the annotations of a compliance event that the controllers use, which are the
+// compliance and trace context annotations, so that the other annotations don't need to be cached.
+func CachedEventAnnotations(annotations map[string]string) map[string]string {
+	var cached map[string]string
+
+	for _, key := range []string{
+		ComplianceAnnotation, ComplianceCategoryAnnotation, RelatedObjectsAnnotation,
+		TraceParentAnnotation, TraceStateAnnotation,
+	} {
+		if value, ok := annotations[key]; ok {
+			if cached == nil {
+				cached = map[string]string{}
+			}
+
+			cached[key] = value
+		}
+	}
+
+	return cached
+}
+
+// TransformCachedEvent is a cache transform for compliance events that only keeps the fields the controllers use. The
+// annotations from CachedEventAnnotations are kept so that the status sync can link to the trace of each event.
+func TransformCachedEvent(obj any) (any, error) {
+	event, ok := obj.(*corev1.Event)
+	if !ok {
+		return obj, nil
+	}
+
+	return &corev1.Event{
+		InvolvedObject: event.InvolvedObject,
+		TypeMeta:       event.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        event.Name,
+			Namespace:   event.Namespace,
+			UID:         event.UID,
+			Annotations: CachedEventAnnotations(event.Annotations),
+		},
+		LastTimestamp: event.LastTimestamp,
+		Message:       event.Message,
+		Reason:        event.Reason,
+	}, nil
+}
+
 // ComplianceEventSender handles sending policy template status events in the correct format.
 type ComplianceEventSender struct {
 	ClusterNamespace string
@@ -31,6 +172,20 @@ func (c *ComplianceEventSender) SendEvent(
 	reason string,
 	msg string,
 	compliance policyv1.ComplianceState,
+) error {
+	return c.SendCategorizedEvent(ctx, instance, owner, reason, msg, compliance, DefaultComplianceCategory(compliance))
+}
+
+// SendCategorizedEvent is the same as SendEvent, but with the category of the event set explicitly, such as for
+// template errors.
+func (c *ComplianceEventSender) SendCategorizedEvent(
+	ctx context.Context,
+	instance client.Object,
+	owner metav1.OwnerReference,
+	reason string,
+	msg string,
+	compliance policyv1.ComplianceState,
+	category ComplianceCategory,
 ) error {
 	msg = string(compliance) + "; " + msg
 
@@ -63,6 +218,13 @@ func (c *ComplianceEventSender) SendEvent(
 		ReportingInstance:   c.InstanceName,
 	}
 
+	// The message still starts with the compliance state for clients that don't read the annotations
+	event.Annotations = map[string]string{ComplianceAnnotation: string(compliance)}
+
+	if category != "" {
+		event.Annotations[ComplianceCategoryAnnotation] = string(category)
+	}
+
 	if instance != nil {
 		gvk := instance.GetObjectKind().GroupVersionKind()
 
@@ -73,8 +235,18 @@ func (c *ComplianceEventSender) SendEvent(
 			UID:        instance.GetUID(),
 			APIVersion: gvk.GroupVersion().String(),
 		}
+
+		related, err := json.Marshal([]corev1.ObjectReference{*event.Related})
+		if err != nil {
+			return err
+		}
+
+		event.Annotations[RelatedObjectsAnnotation] = string(related)
 	}
 
+	// Carry the trace context to the status-sync, which links its span to the trace
+	InjectTraceContext(ctx, event)
+
 	if compliance == policyv1.Compliant {
 		event.Type = corev1.EventTypeNormal
 	} else {
@@ -0,0 +1,100 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+)
+
+func TestComplianceDetailsFromAnnotations(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		annotations map[string]string
+		expected    ComplianceDetails
+		expectedOK  bool
+	}{
+		"template error": {
+			annotations: map[string]string{
+				ComplianceAnnotation:         "NonCompliant",
+				ComplianceCategoryAnnotation: "template-error",
+				RelatedObjectsAnnotation:     `[{"kind":"ConfigurationPolicy","namespace":"cluster","name":"tmpl"}]`,
+			},
+			expected: ComplianceDetails{
+				Compliance: policyv1.NonCompliant,
+				Category:   CategoryTemplateError,
+				RelatedObjects: []corev1.ObjectReference{
+					{Kind: "ConfigurationPolicy", Namespace: "cluster", Name: "tmpl"},
+				},
+			},
+			expectedOK: true,
+		},
+		"compliant with invalid related objects": {
+			annotations: map[string]string{ComplianceAnnotation: "Compliant", RelatedObjectsAnnotation: "{"},
+			expected:    ComplianceDetails{Compliance: policyv1.Compliant},
+			expectedOK:  true,
+		},
+		"no annotations": {},
+		"unknown compliance": {
+			annotations: map[string]string{ComplianceAnnotation: "Unknown"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			details, ok := ComplianceDetailsFromAnnotations(test.annotations)
+			if ok != test.expectedOK || !reflect.DeepEqual(details, test.expected) {
+				t.Fatalf("Expected %+v (%v), got %+v (%v)", test.expected, test.expectedOK, details, ok)
+			}
+		})
+	}
+}
+
+func TestComplianceDetailsFromMessage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		message    string
+		compliance policyv1.ComplianceState
+		category   ComplianceCategory
+	}{
+		{"Compliant; notification - all good", policyv1.Compliant, ""},
+		{"(combined from similar events): Compliant; all good", policyv1.Compliant, ""},
+		{"Pending; Dependencies were not satisfied", policyv1.Pending, CategoryPending},
+		{"NonCompliant; violation - pods not found", policyv1.NonCompliant, CategoryViolation},
+		{"NonCompliant; template-error; Failed to create the template", policyv1.NonCompliant, CategoryTemplateError},
+		{"no compliance prefix", policyv1.NonCompliant, CategoryViolation},
+	}
+
+	for _, test := range tests {
+		expected := ComplianceDetails{Compliance: test.compliance, Category: test.category}
+
+		if details := ComplianceDetailsFromMessage(test.message); !reflect.DeepEqual(details, expected) {
+			t.Fatalf("%s: expected %+v, got %+v", test.message, expected, details)
+		}
+	}
+}
+
+func TestCachedEventAnnotations(t *testing.T) {
+	t.Parallel()
+
+	cached := CachedEventAnnotations(map[string]string{
+		ComplianceAnnotation:  "Compliant",
+		TraceParentAnnotation: "00-abc-def-01",
+		"foo":                 "bar",
+	})
+
+	if len(cached) != 2 || cached[ComplianceAnnotation] != "Compliant" || cached[TraceParentAnnotation] == "" {
+		t.Fatalf("Expected only the compliance and traceparent annotations, got %v", cached)
+	}
+
+	if CachedEventAnnotations(map[string]string{"foo": "bar"}) != nil {
+		t.Fatal("Expected nil when there are no annotations to cache")
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// HubConnectedAnnotation is set on the addon's lease to "true" when the hub was reachable within the hub
+	// connectivity threshold and "false" otherwise. The lease is renewed either way, so that an addon that is running
+	// but cut off from the hub can be told apart from an addon that is down.
+	HubConnectedAnnotation = "policy.open-cluster-management.io/hub-connected"
+	// HubLastContactAnnotation is set on the addon's lease to the time of the last successful request to the hub.
+	HubLastContactAnnotation = "policy.open-cluster-management.io/hub-last-contact"
+
+	hubProbeTimeout = 5 * time.Second
+)
+
+// HubConnectivity tracks when the last successful request to the hub API server was made, such as by the spec-sync
+// and status-sync controllers, to determine whether the hub is reachable.
+type HubConnectivity struct {
+	// threshold is how long without a successful request to the hub before the hub is considered unreachable.
+	threshold time.Duration
+	// probe makes a request to the hub, which is used when there haven't been any requests within the threshold,
+	// such as when there are no policy changes to sync.
+	probe       func(ctx context.Context) error
+	probeLock   sync.Mutex
+	lastContact atomic.Int64
+	// lastProbe is when the last probe finished and lastProbeOK is whether it succeeded. Both are guarded by
+	// probeLock.
+	lastProbe   time.Time
+	lastProbeOK bool
+}
+
+// NewHubConnectivity returns a HubConnectivity that considers the hub unreachable after the threshold elapses without
+// a successful request. The time it's created counts as the last contact, so that the hub isn't considered
+// unreachable before the controllers start.
+func NewHubConnectivity(threshold time.Duration, probe func(ctx context.Context) error) *HubConnectivity {
+	connectivity := &HubConnectivity{threshold: threshold, probe: probe}
+	connectivity.RecordContact()
+
+	return connectivity
+}
+
+// RecordContact records a successful request to the hub.
+func (c *HubConnectivity) RecordContact() {
+	c.lastContact.Store(time.Now().UnixNano())
+}
+
+// LastContact returns the time of the last successful request to the hub.
+func (c *HubConnectivity) LastContact() time.Time {
+	return time.Unix(0, c.lastContact.Load())
+}
+
+// WrapConfig wraps the transport of the hub config so that each response from the hub API server is recorded as a
+// successful request. Responses with server errors, which are typically from a proxy or load balancer in front of an
+// unavailable API server, are not recorded.
+func (c *HubConnectivity) WrapConfig(cfg *rest.Config) {
+	cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := rt.RoundTrip(req)
+			if err == nil && resp.StatusCode < http.StatusInternalServerError {
+				c.RecordContact()
+			}
+
+			return resp, err
+		})
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Connected returns whether there was a successful request to the hub within the threshold. If not, the hub is probed
+// before it's considered unreachable. Concurrent calls don't probe the hub more than once at a time, so a call made
+// while the hub is being probed waits for that probe and returns its result.
+func (c *HubConnectivity) Connected(ctx context.Context) bool {
+	if time.Since(c.LastContact()) <= c.threshold {
+		return true
+	}
+
+	if c.probe == nil {
+		return false
+	}
+
+	waitStart := time.Now()
+
+	c.probeLock.Lock()
+	defer c.probeLock.Unlock()
+
+	// Another call probed the hub while this one waited for it
+	if !c.lastProbe.Before(waitStart) {
+		return c.lastProbeOK
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, hubProbeTimeout)
+	defer cancel()
+
+	err := c.probe(probeCtx)
+
+	c.lastProbe = time.Now()
+	c.lastProbeOK = err == nil
+
+	if err != nil {
+		ctrl.LoggerFrom(ctx).V(2).Info("Failed to probe the hub", "error", err.Error())
+
+		return false
+	}
+
+	c.RecordContact()
+
+	return true
+}
+
+// Check is a healthz.Checker that fails when the hub has been unreachable for longer than the threshold.
+func (c *HubConnectivity) Check(req *http.Request) error {
+	if c.Connected(req.Context()) {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"no successful request to the hub since %s, which is longer than the threshold of %s",
+		c.LastContact().UTC().Format(time.RFC3339), c.threshold,
+	)
+}
+
+// AnnotateLease periodically sets the hub connectivity annotations on the addon's lease until the context is
+// canceled. A lease that doesn't exist yet is skipped until it's created by the lease updater.
+func (c *HubConnectivity) AnnotateLease(
+	ctx context.Context, client kubernetes.Interface, namespace string, name string, period time.Duration,
+) {
+	log := ctrl.LoggerFrom(ctx).WithValues("lease", namespace+"/"+name)
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		patch, err := json.Marshal(map[string]any{
+			"metadata": map[string]any{
+				"annotations": map[string]string{
+					HubConnectedAnnotation:   strconv.FormatBool(c.Connected(ctx)),
+					HubLastContactAnnotation: c.LastContact().UTC().Format(time.RFC3339),
+				},
+			},
+		})
+		if err != nil {
+			log.Error(err, "Failed to generate the lease patch")
+
+			return
+		}
+
+		_, err = client.CoordinationV1().Leases(namespace).Patch(
+			ctx, name, types.MergePatchType, patch, metav1.PatchOptions{},
+		)
+		if err != nil && !k8serrors.IsNotFound(err) {
+			log.Error(err, "Failed to set the hub connectivity annotations on the lease")
+		}
+	}, period)
+}
@@ -0,0 +1,139 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestHubConnectivity(t *testing.T) {
+	t.Parallel()
+
+	probeErr := errors.New("connection refused")
+	probes := 0
+
+	connectivity := NewHubConnectivity(time.Minute, func(context.Context) error {
+		probes++
+
+		return probeErr
+	})
+
+	if !connectivity.Connected(context.Background()) || probes != 0 {
+		t.Fatal("Expected the hub to be connected without a probe right after starting")
+	}
+
+	connectivity.lastContact.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+
+	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+
+	err := connectivity.Check(req)
+	if err == nil || !strings.Contains(err.Error(), "longer than the threshold of 1m0s") || probes != 1 {
+		t.Fatalf("Expected the check to fail after probing the hub, got %v after %d probes", err, probes)
+	}
+
+	probeErr = nil
+
+	if err := connectivity.Check(req); err != nil {
+		t.Fatalf("Expected the check to pass after a successful probe, got %v", err)
+	}
+
+	if time.Since(connectivity.LastContact()) > time.Minute {
+		t.Fatal("Expected the successful probe to be recorded as the last contact")
+	}
+}
+
+func TestHubConnectivityConcurrentProbe(t *testing.T) {
+	t.Parallel()
+
+	probing := make(chan struct{})
+	release := make(chan struct{})
+
+	var probes atomic.Int32
+
+	connectivity := NewHubConnectivity(time.Minute, func(context.Context) error {
+		if probes.Add(1) == 1 {
+			close(probing)
+			<-release
+		}
+
+		return errors.New("connection refused")
+	})
+
+	connectivity.lastContact.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+
+	results := make(chan bool, 2)
+
+	go func() { results <- connectivity.Connected(context.Background()) }()
+
+	<-probing
+
+	// The second call starts while the hub is being probed, so it waits for the probe rather than probing again
+	go func() { results <- connectivity.Connected(context.Background()) }()
+
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	if <-results || <-results {
+		t.Fatal("Expected both calls to report the hub as unreachable")
+	}
+
+	if count := probes.Load(); count != 1 {
+		t.Fatalf("Expected the hub to be probed once, got %d probes", count)
+	}
+}
+
+func TestHubConnectivityWrapConfig(t *testing.T) {
+	t.Parallel()
+
+	status := http.StatusOK
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	connectivity := NewHubConnectivity(time.Minute, nil)
+
+	cfg := &rest.Config{Host: server.URL}
+	connectivity.WrapConfig(cfg)
+
+	httpClient, err := rest.HTTPClientFor(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func() {
+		resp, err := httpClient.Get(server.URL + "/version")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp.Body.Close()
+	}
+
+	old := time.Now().Add(-time.Hour)
+
+	status = http.StatusServiceUnavailable
+	connectivity.lastContact.Store(old.UnixNano())
+	request()
+
+	if !connectivity.LastContact().Equal(old) {
+		t.Fatal("Expected a server error to not be recorded as a successful request")
+	}
+
+	status = http.StatusForbidden
+	request()
+
+	if connectivity.LastContact().Equal(old) {
+		t.Fatal("Expected a response from the API server to be recorded as a successful request")
+	}
+}
@@ -0,0 +1,613 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"open-cluster-management.io/governance-policy-propagator/controllers/common"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// MaintenanceWindowsConfigMapName is the name of the optional ConfigMap in the addon's namespace with the windows
+	// that pause the spec-sync and the enforcement of policy templates. The `windows` key contains a YAML list of
+	// windows, each with a name, a type of Freeze or Maintenance, a cron schedule of when the window starts, a duration,
+	// and an optional time zone.
+	MaintenanceWindowsConfigMapName = "governance-policy-maintenance-windows"
+	// SpecSyncDeferredSinceAnnotation is set on the template details in the policy status to when the spec-sync
+	// started deferring the changes to the policy from the hub, so that the hub can see that they didn't land yet.
+	SpecSyncDeferredSinceAnnotation = common.APIGroup + "/spec-sync-deferred-since"
+	// SpecSyncDeferredUntilAnnotation is set on the template details in the policy status to when the window that
+	// defers the changes to the policy ends, if it's known.
+	SpecSyncDeferredUntilAnnotation = common.APIGroup + "/spec-sync-deferred-until"
+	// SpecSyncDeferredConfigMapName is the name of the ConfigMap in the addon's namespace with the replicated policies
+	// whose changes from the hub were deferred. Each key is the policy's namespace and name separated by an underscore,
+	// and each value is when it was first deferred. It's kept in a ConfigMap so that the deferral and the order to sync
+	// the policies in survive a restart, and so that the status-sync knows about it when it's not the leader in the
+	// same pod as the spec-sync.
+	SpecSyncDeferredConfigMapName = "governance-policy-spec-sync-deferred"
+
+	// maintenanceWindowsRefresh is how often the ConfigMap is read again.
+	maintenanceWindowsRefresh = 30 * time.Second
+)
+
+//+kubebuilder:rbac:groups=core,resources=configmaps,resourceNames=governance-policy-maintenance-windows,verbs=get
+//+kubebuilder:rbac:groups=core,resources=configmaps,resourceNames=governance-policy-spec-sync-deferred,verbs=get;update
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=create,namespace=open-cluster-management-agent-addon
+
+// MaintenanceWindowType is whether changes are frozen during a window or only allowed during it.
+type MaintenanceWindowType string
+
+const (
+	// FreezeWindow freezes changes while it's open. This is the default.
+	FreezeWindow MaintenanceWindowType = "Freeze"
+	// MaintenanceWindow only allows changes while it's open, so when any are configured, changes are frozen outside of
+	// them.
+	MaintenanceWindow MaintenanceWindowType = "Maintenance"
+)
+
+// maintenanceWindowConfig is an entry in the `windows` key of the maintenance windows ConfigMap.
+type maintenanceWindowConfig struct {
+	Name     string                `json:"name"`
+	Type     MaintenanceWindowType `json:"type,omitempty"`
+	Schedule string                `json:"schedule"`
+	Duration string                `json:"duration"`
+	TimeZone string                `json:"timeZone,omitempty"`
+}
+
+// scheduledWindow is a parsed window that starts on each time of the schedule in the location and lasts for the
+// duration.
+type scheduledWindow struct {
+	freeze   bool
+	schedule *CronSchedule
+	duration time.Duration
+	location *time.Location
+}
+
+// activeUntil returns when the window that's open at the time ends, or the zero time when the window isn't open. When
+// the window opens again before it ends, the end of the last time it opened is returned.
+func (w *scheduledWindow) activeUntil(now time.Time) time.Time {
+	start := w.schedule.Next(now.Add(-w.duration).In(w.location))
+	if start.IsZero() || start.After(now) {
+		return time.Time{}
+	}
+
+	for next := w.schedule.Next(start); !next.IsZero() && !next.After(now); next = w.schedule.Next(next) {
+		start = next
+	}
+
+	return start.Add(w.duration)
+}
+
+// parseMaintenanceWindows parses the windows in the ConfigMap. Invalid windows are returned as an error but the valid
+// windows are still used.
+func parseMaintenanceWindows(configMap *corev1.ConfigMap) ([]scheduledWindow, error) {
+	configs := []maintenanceWindowConfig{}
+
+	if err := yaml.UnmarshalStrict([]byte(configMap.Data["windows"]), &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse the windows key: %w", err)
+	}
+
+	windows := make([]scheduledWindow, 0, len(configs))
+
+	var errs []error
+
+	for i, config := range configs {
+		window, err := parseMaintenanceWindow(config)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ignoring the invalid window %q at index %d: %w", config.Name, i, err))
+
+			continue
+		}
+
+		windows = append(windows, window)
+	}
+
+	return windows, errors.Join(errs...)
+}
+
+func parseMaintenanceWindow(config maintenanceWindowConfig) (scheduledWindow, error) {
+	window := scheduledWindow{location: time.UTC}
+
+	switch config.Type {
+	case "", FreezeWindow:
+		window.freeze = true
+	case MaintenanceWindow:
+	default:
+		return window, fmt.Errorf("the type must be %s or %s: %s", FreezeWindow, MaintenanceWindow, config.Type)
+	}
+
+	var err error
+
+	if window.schedule, err = ParseCronSchedule(config.Schedule); err != nil {
+		return window, err
+	}
+
+	window.duration, err = time.ParseDuration(config.Duration)
+	if err != nil || window.duration <= 0 {
+		return window, fmt.Errorf("the duration must be a positive duration such as 2h30m: %s", config.Duration)
+	}
+
+	if config.TimeZone != "" {
+		if window.location, err = time.LoadLocation(config.TimeZone); err != nil {
+			return window, fmt.Errorf("invalid time zone: %w", err)
+		}
+	}
+
+	return window, nil
+}
+
+// MaintenanceWindows pauses the spec-sync and the enforcement of policy templates on a schedule, such as during a
+// change freeze, based on the maintenance windows ConfigMap. It also keeps track of the policies whose changes from the
+// hub were deferred in the deferred ConfigMap, so that it can be reported to the hub. A nil *MaintenanceWindows never
+// freezes changes, so all of its methods are safe to call on nil.
+type MaintenanceWindows struct {
+	// Client writes the deferred ConfigMap.
+	Client client.Client
+	// Reader reads the ConfigMaps. They're read again periodically, so they don't need to be cached.
+	Reader client.Reader
+	// Namespace is the namespace of the ConfigMaps.
+	Namespace string
+
+	lock    sync.RWMutex
+	windows []scheduledWindow
+
+	deferredLock sync.Mutex
+	// deferred maps the replicated policies whose changes from the hub were deferred to when they were first deferred,
+	// as of the last time the deferred ConfigMap was read or written.
+	deferred map[types.NamespacedName]time.Time
+}
+
+// Load reads and parses the ConfigMaps. A missing ConfigMap has no windows or deferred policies. Invalid windows and
+// deferred policies are logged and ignored.
+func (m *MaintenanceWindows) Load(ctx context.Context) error {
+	configMap := &corev1.ConfigMap{}
+
+	err := m.Reader.Get(
+		ctx, types.NamespacedName{Namespace: m.Namespace, Name: MaintenanceWindowsConfigMapName}, configMap,
+	)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get the maintenance windows ConfigMap: %w", err)
+	}
+
+	windows, err := parseMaintenanceWindows(configMap)
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "The maintenance windows ConfigMap has invalid windows")
+	}
+
+	m.lock.Lock()
+	m.windows = windows
+	m.lock.Unlock()
+
+	m.deferredLock.Lock()
+	defer m.deferredLock.Unlock()
+
+	deferredConfigMap, err := m.getDeferredConfigMap(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.deferred = parseDeferred(ctx, deferredConfigMap)
+
+	return nil
+}
+
+// Start reads the ConfigMap again periodically until the context is canceled, and logs when changes are frozen and
+// when they're allowed again.
+func (m *MaintenanceWindows) Start(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx).WithName("maintenance-windows")
+	ticker := time.NewTicker(maintenanceWindowsRefresh)
+
+	defer ticker.Stop()
+
+	wasFrozen := false
+
+	for {
+		if err := m.Load(ctx); err != nil {
+			log.Error(err, "Failed to refresh the maintenance windows, keeping the previous windows")
+		}
+
+		frozen, until := m.Frozen(time.Now())
+		if frozen && !wasFrozen {
+			log.Info("Changes to the policies are frozen", "until", until)
+		} else if !frozen && wasFrozen {
+			log.Info("Changes to the policies are allowed again")
+		}
+
+		wasFrozen = frozen
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection returns false since the windows are used by the controllers of every manager, which might not have
+// the same leader.
+func (m *MaintenanceWindows) NeedLeaderElection() bool {
+	return false
+}
+
+// Frozen returns whether changes are frozen at the time, and until when if it's known. Changes are frozen during a
+// freeze window, and outside of the maintenance windows when there are any.
+func (m *MaintenanceWindows) Frozen(now time.Time) (bool, time.Time) {
+	if m == nil {
+		return false, time.Time{}
+	}
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	frozenUntil := time.Time{}
+	hasMaintenance := false
+	inMaintenance := false
+	nextMaintenance := time.Time{}
+
+	for i := range m.windows {
+		window := &m.windows[i]
+		activeUntil := window.activeUntil(now)
+
+		if window.freeze {
+			if activeUntil.After(frozenUntil) {
+				frozenUntil = activeUntil
+			}
+
+			continue
+		}
+
+		hasMaintenance = true
+
+		if !activeUntil.IsZero() {
+			// A maintenance window is open, so it's only frozen by the freeze windows
+			inMaintenance = true
+		} else if next := window.schedule.Next(now.In(window.location)); !next.IsZero() {
+			if nextMaintenance.IsZero() || next.Before(nextMaintenance) {
+				nextMaintenance = next
+			}
+		}
+	}
+
+	if !frozenUntil.IsZero() {
+		return true, frozenUntil
+	}
+
+	if hasMaintenance && !inMaintenance {
+		return true, nextMaintenance
+	}
+
+	return false, time.Time{}
+}
+
+// getDeferredConfigMap reads the deferred ConfigMap. A missing ConfigMap is returned without a resource version.
+func (m *MaintenanceWindows) getDeferredConfigMap(ctx context.Context) (*corev1.ConfigMap, error) {
+	configMap := &corev1.ConfigMap{}
+
+	err := m.Reader.Get(ctx, types.NamespacedName{Namespace: m.Namespace, Name: SpecSyncDeferredConfigMapName}, configMap)
+	if k8serrors.IsNotFound(err) {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: SpecSyncDeferredConfigMapName, Namespace: m.Namespace},
+		}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the %s ConfigMap: %w", SpecSyncDeferredConfigMapName, err)
+	}
+
+	return configMap, nil
+}
+
+// parseDeferred returns the deferred policies in the deferred ConfigMap. Invalid entries are logged and ignored.
+func parseDeferred(ctx context.Context, configMap *corev1.ConfigMap) map[types.NamespacedName]time.Time {
+	deferred := make(map[types.NamespacedName]time.Time, len(configMap.Data))
+
+	for key, value := range configMap.Data {
+		namespace, name, _ := strings.Cut(key, "_")
+
+		since, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil || namespace == "" || name == "" {
+			ctrl.LoggerFrom(ctx).Info(
+				"Ignoring an invalid entry in the deferred ConfigMap", "name", SpecSyncDeferredConfigMapName, "key", key,
+			)
+
+			continue
+		}
+
+		deferred[types.NamespacedName{Namespace: namespace, Name: name}] = since
+	}
+
+	return deferred
+}
+
+// setDeferred sets or removes the replicated policy in the deferred ConfigMap, which is read again before it's changed
+// so that the entries written by the spec-sync of other hubs are kept. The policy is removed when since is zero. The
+// write is retried once when the ConfigMap was changed since it was read. Must be called with deferredLock held.
+func (m *MaintenanceWindows) setDeferred(ctx context.Context, policy types.NamespacedName, since time.Time) error {
+	key := policy.Namespace + "_" + policy.Name
+
+	for retried := false; ; retried = true {
+		configMap, err := m.getDeferredConfigMap(ctx)
+		if err != nil {
+			return err
+		}
+
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+
+		if since.IsZero() {
+			if _, ok := configMap.Data[key]; !ok {
+				m.deferred = parseDeferred(ctx, configMap)
+
+				return nil
+			}
+
+			delete(configMap.Data, key)
+		} else {
+			configMap.Data[key] = since.UTC().Format(time.RFC3339Nano)
+		}
+
+		if configMap.ResourceVersion == "" {
+			err = m.Client.Create(ctx, configMap)
+		} else {
+			err = m.Client.Update(ctx, configMap)
+		}
+
+		if err == nil {
+			m.deferred = parseDeferred(ctx, configMap)
+
+			return nil
+		}
+
+		if retried || !(k8serrors.IsConflict(err) || k8serrors.IsAlreadyExists(err)) {
+			return fmt.Errorf("failed to write the %s ConfigMap: %w", SpecSyncDeferredConfigMapName, err)
+		}
+	}
+}
+
+// Defer records in the deferred ConfigMap that the changes from the hub to the replicated policy were deferred, and
+// returns when they were first deferred.
+func (m *MaintenanceWindows) Defer(ctx context.Context, namespace, name string) (time.Time, error) {
+	if m == nil {
+		return time.Time{}, nil
+	}
+
+	m.deferredLock.Lock()
+	defer m.deferredLock.Unlock()
+
+	key := types.NamespacedName{Namespace: namespace, Name: name}
+
+	if since, ok := m.deferred[key]; ok {
+		return since, nil
+	}
+
+	since := time.Now()
+
+	return since, m.setDeferred(ctx, key, since)
+}
+
+// Undefer removes the replicated policy from the deferred ConfigMap since it's in sync with the hub, and returns
+// whether its changes were deferred.
+func (m *MaintenanceWindows) Undefer(ctx context.Context, namespace, name string) (bool, error) {
+	if m == nil {
+		return false, nil
+	}
+
+	m.deferredLock.Lock()
+	defer m.deferredLock.Unlock()
+
+	key := types.NamespacedName{Namespace: namespace, Name: name}
+
+	if _, ok := m.deferred[key]; !ok {
+		return false, nil
+	}
+
+	return true, m.setDeferred(ctx, key, time.Time{})
+}
+
+// Deferred returns when the changes from the hub to the replicated policy were first deferred, if they are. It's based
+// on the last time the deferred ConfigMap was read or written, so a deferral by the spec-sync in another pod is seen
+// once the ConfigMaps are read again.
+func (m *MaintenanceWindows) Deferred(namespace, name string) (time.Time, bool) {
+	if m == nil {
+		return time.Time{}, false
+	}
+
+	m.deferredLock.Lock()
+	defer m.deferredLock.Unlock()
+
+	since, ok := m.deferred[types.NamespacedName{Namespace: namespace, Name: name}]
+
+	return since, ok
+}
+
+// DeferredPolicies returns the names of the replicated policies in the namespace whose changes from the hub were
+// deferred, in the order they were deferred.
+func (m *MaintenanceWindows) DeferredPolicies(namespace string) []string {
+	if m == nil {
+		return nil
+	}
+
+	m.deferredLock.Lock()
+	defer m.deferredLock.Unlock()
+
+	names := []string{}
+
+	for policy := range m.deferred {
+		if policy.Namespace == namespace {
+			names = append(names, policy.Name)
+		}
+	}
+
+	slices.SortFunc(names, func(a, b string) int {
+		sinceA := m.deferred[types.NamespacedName{Namespace: namespace, Name: a}]
+		sinceB := m.deferred[types.NamespacedName{Namespace: namespace, Name: b}]
+
+		if c := sinceA.Compare(sinceB); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a, b)
+	})
+
+	return names
+}
+
+// CronSchedule is a standard cron schedule with the minute, hour, day of the month, month, and day of the week fields.
+// Each field is a comma-separated list of `*`, a number, or a range such as `1-5`, optionally with a step such as
+// `*/15`. The day of the week is from 0 to 7, where both 0 and 7 are Sunday. As with cron, when both the day of the
+// month and the day of the week are restricted, a time matches if either matches.
+type CronSchedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	// Whether the day of the month and the day of the week fields start with `*`, in which case they don't restrict
+	// the day.
+	dayOfMonthAny, dayOfWeekAny bool
+}
+
+// cronField is the range of a cron schedule field.
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59}, {"hour", 0, 23}, {"day of the month", 1, 31}, {"month", 1, 12}, {"day of the week", 0, 7},
+}
+
+// ParseCronSchedule parses a cron schedule with five fields, such as `0 18 * * 5` for every Friday at 18:00.
+func ParseCronSchedule(schedule string) (*CronSchedule, error) {
+	fields := strings.Fields(schedule)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("the schedule must have %d fields: %q", len(cronFields), schedule)
+	}
+
+	bits := make([]uint64, len(fields))
+
+	for i, field := range fields {
+		var err error
+
+		if bits[i], err = parseCronField(field, cronFields[i]); err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", schedule, err)
+		}
+	}
+
+	// Both 0 and 7 are Sunday
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &CronSchedule{
+		minute:        bits[0],
+		hour:          bits[1],
+		dayOfMonth:    bits[2],
+		month:         bits[3],
+		dayOfWeek:     bits[4],
+		dayOfMonthAny: strings.HasPrefix(fields[2], "*"),
+		dayOfWeekAny:  strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// parseCronField returns the bits of the values in the range that the field matches.
+func parseCronField(field string, bounds cronField) (uint64, error) {
+	var bits uint64
+
+	for item := range strings.SplitSeq(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+
+		step := 1
+
+		if hasStep {
+			var err error
+
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("the step of the %s field must be a positive number: %s", bounds.name, item)
+			}
+		}
+
+		start, end := bounds.min, bounds.max
+
+		if rangePart != "*" {
+			rawStart, rawEnd, isRange := strings.Cut(rangePart, "-")
+
+			var err error
+
+			if start, err = strconv.Atoi(rawStart); err != nil {
+				return 0, fmt.Errorf("the %s field has an invalid value: %s", bounds.name, item)
+			}
+
+			end = start
+
+			if isRange {
+				if end, err = strconv.Atoi(rawEnd); err != nil {
+					return 0, fmt.Errorf("the %s field has an invalid range: %s", bounds.name, item)
+				}
+			} else if hasStep {
+				// As with cron, a single value with a step is the start of a range to the maximum
+				end = bounds.max
+			}
+		}
+
+		if start < bounds.min || end > bounds.max || start > end {
+			return 0, fmt.Errorf("the %s field must be between %d and %d: %s", bounds.name, bounds.min, bounds.max, item)
+		}
+
+		for value := start; value <= end; value += step {
+			bits |= 1 << value
+		}
+	}
+
+	return bits, nil
+}
+
+// matchesDay returns whether the day matches the day of the month and the day of the week fields.
+func (s *CronSchedule) matchesDay(t time.Time) bool {
+	dayOfMonth := s.dayOfMonth&(1<<t.Day()) != 0
+	dayOfWeek := s.dayOfWeek&(1<<t.Weekday()) != 0
+
+	if s.dayOfMonthAny || s.dayOfWeekAny {
+		return dayOfMonth && dayOfWeek
+	}
+
+	return dayOfMonth || dayOfWeek
+}
+
+// Next returns the first time after t that matches the schedule, in the location of t. The zero time is returned when
+// nothing matches within five years, such as for February 30.
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<t.Month()) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,256 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	t.Parallel()
+
+	// A Wednesday
+	from := time.Date(2026, 10, 14, 10, 30, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		schedule string
+		expected time.Time
+	}{
+		"every minute":             {"* * * * *", time.Date(2026, 10, 14, 10, 31, 0, 0, time.UTC)},
+		"every 15 minutes":         {"*/15 * * * *", time.Date(2026, 10, 14, 10, 45, 0, 0, time.UTC)},
+		"later today":              {"0 18 * * *", time.Date(2026, 10, 14, 18, 0, 0, 0, time.UTC)},
+		"tomorrow":                 {"0 9 * * *", time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)},
+		"friday":                   {"0 18 * * 5", time.Date(2026, 10, 16, 18, 0, 0, 0, time.UTC)},
+		"sunday as 7":              {"0 0 * * 7", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		"weekdays":                 {"0 9 * * 1-5", time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)},
+		"a list of hours":          {"0 6,12 * * *", time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)},
+		"first of the month":       {"0 0 1 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		"next year":                {"0 0 1 1 *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		"day of the month or week": {"0 0 20 * 5", time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)},
+		"february 30":              {"0 0 30 2 *", time.Time{}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			schedule, err := ParseCronSchedule(test.schedule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if next := schedule.Next(from); !next.Equal(test.expected) {
+				t.Fatalf("Expected %s, got %s", test.expected, next)
+			}
+		})
+	}
+}
+
+func TestParseCronScheduleInvalid(t *testing.T) {
+	t.Parallel()
+
+	invalid := []string{
+		"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *",
+	}
+
+	for _, schedule := range invalid {
+		if _, err := ParseCronSchedule(schedule); err == nil {
+			t.Fatalf("Expected the schedule %q to be invalid", schedule)
+		}
+	}
+}
+
+func TestMaintenanceWindowsFrozen(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	// A Wednesday
+	wednesday := time.Date(2026, 10, 14, 10, 30, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		windows        string
+		now            time.Time
+		expectedFrozen bool
+		expectedUntil  time.Time
+	}{
+		"no windows": {
+			now: wednesday,
+		},
+		"in a freeze window": {
+			windows: `[{name: weekend, schedule: "0 18 * * 5", duration: 62h}]`,
+			now:     time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC),
+			// The freeze ends on Monday at 08:00
+			expectedFrozen: true,
+			expectedUntil:  time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC),
+		},
+		"outside of a freeze window": {
+			windows: `[{name: weekend, schedule: "0 18 * * 5", duration: 62h}]`,
+			now:     wednesday,
+		},
+		"in a freeze window with a time zone": {
+			windows: `[{name: night, schedule: "0 22 * * *", duration: 10h, timeZone: America/New_York}]`,
+			now:     time.Date(2026, 10, 14, 3, 0, 0, 0, time.UTC),
+			// 22:00 in New York is 02:00 UTC, so the freeze ends at 12:00 UTC
+			expectedFrozen: true,
+			expectedUntil:  time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC),
+		},
+		"in a maintenance window": {
+			windows: `[{name: mornings, type: Maintenance, schedule: "0 9 * * 1-5", duration: 3h}]`,
+			now:     wednesday,
+		},
+		"outside of a maintenance window": {
+			windows:        `[{name: mornings, type: Maintenance, schedule: "0 9 * * 1-5", duration: 1h}]`,
+			now:            wednesday,
+			expectedFrozen: true,
+			expectedUntil:  time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC),
+		},
+		"a freeze window during a maintenance window": {
+			windows: `[{name: mornings, type: Maintenance, schedule: "0 9 * * 1-5", duration: 3h},
+				{name: incident, schedule: "0 10 14 10 *", duration: 1h}]`,
+			now:            wednesday,
+			expectedFrozen: true,
+			expectedUntil:  time.Date(2026, 10, 14, 11, 0, 0, 0, time.UTC),
+		},
+		"an invalid window is ignored": {
+			windows: `[{name: weekend, schedule: "0 18 * * 5", duration: 62h},
+				{name: invalid, schedule: "0 25 * * *", duration: 1h}]`,
+			now:            time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC),
+			expectedFrozen: true,
+			expectedUntil:  time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			builder := fake.NewClientBuilder().WithScheme(scheme)
+
+			if test.windows != "" {
+				builder = builder.WithObjects(&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: MaintenanceWindowsConfigMapName, Namespace: "addon"},
+					Data:       map[string]string{"windows": test.windows},
+				})
+			}
+
+			windows := &MaintenanceWindows{Reader: builder.Build(), Namespace: "addon"}
+			if err := windows.Load(context.TODO()); err != nil {
+				t.Fatal(err)
+			}
+
+			frozen, until := windows.Frozen(test.now)
+			if frozen != test.expectedFrozen || !until.Equal(test.expectedUntil) {
+				t.Fatalf("Expected frozen to be %v until %s, got %v until %s",
+					test.expectedFrozen, test.expectedUntil, frozen, until)
+			}
+		})
+	}
+}
+
+func TestMaintenanceWindowsDeferred(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	var nilWindows *MaintenanceWindows
+
+	if frozen, _ := nilWindows.Frozen(time.Now()); frozen {
+		t.Fatal("Expected nil maintenance windows to not be frozen")
+	}
+
+	if _, deferred := nilWindows.Deferred("managed", "policies.case1"); deferred {
+		t.Fatal("Expected nil maintenance windows to not defer policies")
+	}
+
+	managedClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	windows := &MaintenanceWindows{Client: managedClient, Reader: managedClient, Namespace: "addon"}
+
+	since, err := windows.Defer(ctx, "managed", "policies.case2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again, err := windows.Defer(ctx, "managed", "policies.case2"); err != nil || !again.Equal(since) {
+		t.Fatal("Expected deferring a policy again to keep when it was first deferred")
+	}
+
+	for _, policy := range []types.NamespacedName{
+		{Namespace: "managed", Name: "policies.case1"},
+		{Namespace: "other", Name: "policies.case1"},
+		{Namespace: "managed", Name: "policies.case3"},
+	} {
+		if _, err := windows.Defer(ctx, policy.Namespace, policy.Name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if deferredSince, deferred := windows.Deferred("managed", "policies.case2"); !deferred || !deferredSince.Equal(since) {
+		t.Fatal("Expected the policy to be deferred")
+	}
+
+	if undeferred, err := windows.Undefer(ctx, "other", "policies.case1"); err != nil || !undeferred {
+		t.Fatal("Expected the policy in the other namespace to be undeferred")
+	}
+
+	if _, deferred := windows.Deferred("other", "policies.case1"); deferred {
+		t.Fatal("Expected the policy in another namespace to not be deferred")
+	}
+
+	// After a restart, or in the pod where the status-sync is the leader, the deferral is read from the ConfigMap
+	restarted := &MaintenanceWindows{Client: managedClient, Reader: managedClient, Namespace: "addon"}
+
+	if err := restarted.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if deferredSince, deferred := restarted.Deferred("managed", "policies.case2"); !deferred ||
+		!deferredSince.Equal(since) {
+		t.Fatalf("Expected the policy to still be deferred since %v, got %v", since, deferredSince)
+	}
+
+	expectedOrder := []string{"policies.case2", "policies.case1", "policies.case3"}
+
+	if order := restarted.DeferredPolicies("managed"); !slices.Equal(order, expectedOrder) {
+		t.Fatalf("Expected the policies in the order they were deferred %v, got %v", expectedOrder, order)
+	}
+
+	if undeferred, err := restarted.Undefer(ctx, "managed", "policies.case1"); err != nil || !undeferred {
+		t.Fatal("Expected the policy to be undeferred")
+	}
+
+	if undeferred, err := restarted.Undefer(ctx, "managed", "policies.case1"); err != nil || undeferred {
+		t.Fatal("Expected the policy to only be undeferred once")
+	}
+
+	configMap := &corev1.ConfigMap{}
+
+	err = managedClient.Get(ctx, types.NamespacedName{Namespace: "addon", Name: SpecSyncDeferredConfigMapName}, configMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedKeys := []string{"managed_policies.case2", "managed_policies.case3"}
+
+	if keys := slices.Sorted(maps.Keys(configMap.Data)); !slices.Equal(keys, expectedKeys) {
+		t.Fatalf("Expected the deferred ConfigMap keys %v, got %v", expectedKeys, keys)
+	}
+}
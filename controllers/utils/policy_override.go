@@ -0,0 +1,106 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+	"open-cluster-management.io/governance-policy-propagator/controllers/common"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"open-cluster-management.io/governance-policy-framework-addon/api/v1alpha1"
+)
+
+const (
+	// PolicyOverrideAnnotation is set on the template details in the policy status to the name of the PolicyOverride
+	// that changes the policy, so that the hub can see the local deviation.
+	PolicyOverrideAnnotation = common.APIGroup + "/policy-override"
+	// PolicyOverrideExpiresAnnotation is set on the template details in the policy status to when the PolicyOverride
+	// expires, if it does.
+	PolicyOverrideExpiresAnnotation = common.APIGroup + "/policy-override-expires-at"
+	// PolicyOverrideDisabledAnnotation is set to `true` on the details of the templates that the PolicyOverride
+	// disabled. Their compliance is ignored.
+	PolicyOverrideDisabledAnnotation = common.APIGroup + "/policy-override-disabled"
+)
+
+// GetPolicyOverride returns the PolicyOverride of the replicated policy, which has the same name and namespace. Nil is
+// returned when there isn't one or when it expired.
+func GetPolicyOverride(
+	ctx context.Context, reader client.Reader, namespace string, name string,
+) (*v1alpha1.PolicyOverride, error) {
+	override := &v1alpha1.PolicyOverride{}
+
+	err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, override)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if override.Expired(time.Now()) {
+		return nil, nil
+	}
+
+	return override, nil
+}
+
+// ApplyPolicyOverride returns a copy of the policy with the changes of the override. The policy is returned as is when
+// the override is nil.
+func ApplyPolicyOverride(policy *policiesv1.Policy, override *v1alpha1.PolicyOverride) *policiesv1.Policy {
+	if override == nil {
+		return policy
+	}
+
+	overridden := policy.DeepCopy()
+
+	if override.Spec.RemediationAction != "" {
+		overridden.Spec.RemediationAction = override.Spec.RemediationAction
+	}
+
+	if len(override.Spec.DisabledTemplates) > 0 {
+		overridden.Spec.PolicyTemplates = slices.DeleteFunc(
+			overridden.Spec.PolicyTemplates, func(policyT *policiesv1.PolicyTemplate) bool {
+				return slices.Contains(override.Spec.DisabledTemplates, PolicyTemplateName(policyT))
+			},
+		)
+	}
+
+	return overridden
+}
+
+// PolicyOverrideRequeue returns how long until the override expires, which is when the policy must be reconciled again
+// to restore it. It's 0 when the override is nil or doesn't expire.
+func PolicyOverrideRequeue(override *v1alpha1.PolicyOverride) time.Duration {
+	if override == nil || override.Spec.ExpiresAt == nil {
+		return 0
+	}
+
+	// The override is only returned by GetPolicyOverride before it expires, so this is positive except for clock skew
+	return max(time.Until(override.Spec.ExpiresAt.Time), time.Second)
+}
+
+// PolicyTemplateName returns the name of the object in the policy template. It's empty when the template is invalid.
+func PolicyTemplateName(policyT *policiesv1.PolicyTemplate) string {
+	if policyT == nil || policyT.ObjectDefinition.Raw == nil {
+		return ""
+	}
+
+	template := struct {
+		Metadata metav1.ObjectMeta `json:"metadata"`
+	}{}
+
+	if err := json.Unmarshal(policyT.ObjectDefinition.Raw, &template); err != nil {
+		return ""
+	}
+
+	return template.Metadata.Name
+}
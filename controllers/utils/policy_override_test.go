@@ -0,0 +1,135 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"open-cluster-management.io/governance-policy-framework-addon/api/v1alpha1"
+)
+
+func overrideTestPolicy(t *testing.T, templateNames ...string) *policiesv1.Policy {
+	t.Helper()
+
+	policy := &policiesv1.Policy{
+		ObjectMeta: metav1.ObjectMeta{Name: "policies.case1", Namespace: "managed"},
+		Spec:       policiesv1.PolicySpec{RemediationAction: policiesv1.Enforce},
+	}
+
+	for _, name := range templateNames {
+		raw, err := json.Marshal(map[string]any{
+			"apiVersion": "policy.open-cluster-management.io/v1",
+			"kind":       "ConfigurationPolicy",
+			"metadata":   map[string]any{"name": name},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		policy.Spec.PolicyTemplates = append(
+			policy.Spec.PolicyTemplates, &policiesv1.PolicyTemplate{ObjectDefinition: runtime.RawExtension{Raw: raw}},
+		)
+	}
+
+	return policy
+}
+
+func TestApplyPolicyOverride(t *testing.T) {
+	t.Parallel()
+
+	policy := overrideTestPolicy(t, "case1-a", "case1-b", "case1-c")
+
+	if ApplyPolicyOverride(policy, nil) != policy {
+		t.Fatal("Expected the policy to be returned as is without an override")
+	}
+
+	overridden := ApplyPolicyOverride(policy, &v1alpha1.PolicyOverride{
+		Spec: v1alpha1.PolicyOverrideSpec{
+			RemediationAction: policiesv1.Inform,
+			DisabledTemplates: []string{"case1-b", "not-a-template"},
+		},
+	})
+
+	if overridden.Spec.RemediationAction != policiesv1.Inform {
+		t.Fatalf("Expected the remediation action to be overridden, got %s", overridden.Spec.RemediationAction)
+	}
+
+	names := []string{}
+
+	for _, policyT := range overridden.Spec.PolicyTemplates {
+		names = append(names, PolicyTemplateName(policyT))
+	}
+
+	if len(names) != 2 || names[0] != "case1-a" || names[1] != "case1-c" {
+		t.Fatalf("Expected the case1-b template to be disabled, got %v", names)
+	}
+
+	// The policy from the hub is not changed
+	if policy.Spec.RemediationAction != policiesv1.Enforce || len(policy.Spec.PolicyTemplates) != 3 {
+		t.Fatal("Expected the original policy to not be changed")
+	}
+}
+
+func TestGetPolicyOverride(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	active := &v1alpha1.PolicyOverride{
+		ObjectMeta: metav1.ObjectMeta{Name: "policies.active", Namespace: "managed"},
+		Spec: v1alpha1.PolicyOverrideSpec{
+			RemediationAction: policiesv1.Inform,
+			ExpiresAt:         &metav1.Time{Time: time.Now().Add(time.Hour)},
+		},
+	}
+	expired := &v1alpha1.PolicyOverride{
+		ObjectMeta: metav1.ObjectMeta{Name: "policies.expired", Namespace: "managed"},
+		Spec: v1alpha1.PolicyOverrideSpec{
+			RemediationAction: policiesv1.Inform,
+			ExpiresAt:         &metav1.Time{Time: time.Now().Add(-time.Minute)},
+		},
+	}
+
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(active, expired).Build()
+
+	tests := map[string]struct {
+		name          string
+		expectActive  bool
+		expectRequeue bool
+	}{
+		"an active override":  {name: "policies.active", expectActive: true, expectRequeue: true},
+		"an expired override": {name: "policies.expired"},
+		"a missing override":  {name: "policies.missing"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			override, err := GetPolicyOverride(context.TODO(), reader, "managed", test.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if (override != nil) != test.expectActive {
+				t.Fatalf("Expected an active override to be %v, got %v", test.expectActive, override)
+			}
+
+			requeue := PolicyOverrideRequeue(override)
+			if (requeue > 0) != test.expectRequeue || requeue > time.Hour {
+				t.Fatalf("Expected a requeue to be %v, got %s", test.expectRequeue, requeue)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// PolicySelector selects the subset of the policies in the cluster namespace that an addon deployment handles, so
+// that a large number of policies can be split across several deployments. A nil *PolicySelector selects every
+// policy.
+type PolicySelector struct {
+	// Labels selects the policies by their labels. This is also used to filter the hub cache.
+	Labels labels.Selector
+	// Annotations selects the policies by their annotations, with the same syntax as a label selector.
+	Annotations labels.Selector
+	// ShardCount is the number of deployments that the policies are split across by a consistent hash of their name.
+	// Policies aren't sharded when this is 0 or 1.
+	ShardCount int
+	// ShardIndex is the shard of this deployment, from 0 to ShardCount-1.
+	ShardIndex int
+}
+
+// NewPolicySelector parses the label and annotation selectors and validates the shard. Nil is returned when every
+// policy is selected.
+func NewPolicySelector(labelSelector, annotationSelector string, shardCount, shardIndex int) (*PolicySelector, error) {
+	if labelSelector == "" && annotationSelector == "" && shardCount <= 1 {
+		return nil, nil
+	}
+
+	selector := &PolicySelector{ShardCount: shardCount, ShardIndex: shardIndex}
+
+	var err error
+
+	if selector.Labels, err = labels.Parse(labelSelector); err != nil {
+		return nil, fmt.Errorf("invalid policy label selector: %w", err)
+	}
+
+	if selector.Annotations, err = labels.Parse(annotationSelector); err != nil {
+		return nil, fmt.Errorf("invalid policy annotation selector: %w", err)
+	}
+
+	if shardCount > 1 && (shardIndex < 0 || shardIndex >= shardCount) {
+		return nil, fmt.Errorf("the shard index must be between 0 and %d: %d", shardCount-1, shardIndex)
+	}
+
+	return selector, nil
+}
+
+// Matches returns whether the policy is handled by this deployment. Since replicated policies keep the labels and
+// annotations of the hub policy, this is the same for the policy on the hub and on the managed cluster.
+func (s *PolicySelector) Matches(obj client.Object) bool {
+	if s == nil {
+		return true
+	}
+
+	if s.Labels != nil && !s.Labels.Matches(labels.Set(obj.GetLabels())) {
+		return false
+	}
+
+	if s.Annotations != nil && !s.Annotations.Matches(labels.Set(obj.GetAnnotations())) {
+		return false
+	}
+
+	return s.ShardCount <= 1 || PolicyShard(obj.GetName(), s.ShardCount) == s.ShardIndex
+}
+
+// Predicate returns a predicate that filters out the policies that aren't selected.
+func (s *PolicySelector) Predicate() predicate.Predicate {
+	return predicate.NewPredicateFuncs(s.Matches)
+}
+
+// PolicyShard returns the shard of the policy name out of the shard count, using a consistent hash of the name so
+// that every deployment agrees on it.
+func PolicyShard(policyName string, shardCount int) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(policyName))
+
+	return int(hash.Sum32() % uint32(shardCount)) //nolint:gosec // the shard count is positive
+}
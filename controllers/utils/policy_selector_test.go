@@ -0,0 +1,115 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"fmt"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+)
+
+func TestNewPolicySelector(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		labels      string
+		annotations string
+		shardCount  int
+		shardIndex  int
+		expectNil   bool
+		expectErr   bool
+	}{
+		"nothing configured":      {expectNil: true},
+		"a single shard":          {shardCount: 1, expectNil: true},
+		"a label selector":        {labels: "team=payments"},
+		"an annotation selector":  {annotations: "tier in (gold,silver)"},
+		"a shard":                 {shardCount: 3, shardIndex: 2},
+		"an invalid selector":     {labels: "team=(", expectErr: true},
+		"a shard index too large": {shardCount: 3, shardIndex: 3, expectErr: true},
+		"a negative shard index":  {shardCount: 3, shardIndex: -1, expectErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			selector, err := NewPolicySelector(test.labels, test.annotations, test.shardCount, test.shardIndex)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("Expected an error to be %v, got %v", test.expectErr, err)
+			}
+
+			if err == nil && (selector == nil) != test.expectNil {
+				t.Fatalf("Expected a nil selector to be %v, got %v", test.expectNil, selector)
+			}
+		})
+	}
+}
+
+func TestPolicySelectorMatches(t *testing.T) {
+	t.Parallel()
+
+	policy := &policiesv1.Policy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "policies.payments",
+			Labels:      map[string]string{"team": "payments"},
+			Annotations: map[string]string{"tier": "gold"},
+		},
+	}
+
+	var all *PolicySelector
+
+	if !all.Matches(policy) {
+		t.Fatal("Expected a nil selector to match every policy")
+	}
+
+	tests := []struct {
+		labels      string
+		annotations string
+		expected    bool
+	}{
+		{labels: "team=payments", expected: true},
+		{labels: "team=storage", expected: false},
+		{annotations: "tier=gold", expected: true},
+		{annotations: "team=payments", expected: false},
+		{labels: "team=payments", annotations: "tier!=gold", expected: false},
+	}
+
+	for _, test := range tests {
+		selector, err := NewPolicySelector(test.labels, test.annotations, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if selector.Matches(policy) != test.expected {
+			t.Fatalf("Expected %q and %q to match to be %v", test.labels, test.annotations, test.expected)
+		}
+	}
+
+	// Each policy is selected by exactly one shard
+	shards := make([]*PolicySelector, 4)
+
+	for i := range shards {
+		var err error
+
+		if shards[i], err = NewPolicySelector("", "", len(shards), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := range 100 {
+		policy := &policiesv1.Policy{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("policies.policy-%d", i)}}
+		matches := 0
+
+		for _, shard := range shards {
+			if shard.Matches(policy) {
+				matches++
+			}
+		}
+
+		if matches != 1 {
+			t.Fatalf("Expected %s to be selected by one shard, got %d", policy.Name, matches)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"sync/atomic"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// TraceParentAnnotation is the annotation on replicated policies and compliance events containing the W3C
+	// traceparent of the span that last wrote them, so that the next controller can continue the trace.
+	TraceParentAnnotation = "policy.open-cluster-management.io/traceparent"
+	// TraceStateAnnotation is the annotation containing the W3C tracestate that accompanies TraceParentAnnotation.
+	TraceStateAnnotation = "policy.open-cluster-management.io/tracestate"
+
+	tracerName = "open-cluster-management.io/governance-policy-framework-addon"
+)
+
+var (
+	// traceAnnotations maps the W3C trace context header names to the annotations they're stored in.
+	traceAnnotations = map[string]string{
+		"traceparent": TraceParentAnnotation,
+		"tracestate":  TraceStateAnnotation,
+	}
+	tracePropagator = propagation.TraceContext{}
+	tracingEnabled  atomic.Bool
+)
+
+// TracingOptions configures the export of traces with OTLP.
+type TracingOptions struct {
+	// Endpoint is the host and port of the OTLP gRPC receiver. Tracing is disabled when it's empty.
+	Endpoint string
+	// Insecure disables TLS when connecting to the endpoint.
+	Insecure bool
+	// SampleRatio is the fraction of traces started by the addon that are sampled. Traces continued from a trace
+	// context annotation follow the sampling decision of the parent.
+	SampleRatio float64
+	// ClusterNamespace is added to the trace resource to identify the managed cluster.
+	ClusterNamespace string
+}
+
+// SetupTracing sets the global tracer provider to export traces to the OTLP endpoint. The returned function flushes
+// and stops the exporter. If no endpoint is set, tracing stays disabled and the returned function does nothing.
+func SetupTracing(ctx context.Context, opts TracingOptions) (func(context.Context) error, error) {
+	if opts.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	if opts.SampleRatio < 0 || opts.SampleRatio > 1 {
+		return nil, fmt.Errorf("the trace sample ratio must be between 0 and 1: %v", opts.SampleRatio)
+	}
+
+	clientOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		clientOpts = append(clientOpts, otlptracegrpc.WithInsecure())
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the OTLP trace exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			semconv.ServiceName("governance-policy-framework-addon"),
+			semconv.K8SNamespaceName(opts.ClusterNamespace),
+		)),
+	)
+
+	otel.SetTracerProvider(provider)
+	tracingEnabled.Store(true)
+
+	return provider.Shutdown, nil
+}
+
+// TraceAPIWrites wraps the transport of the config so that each request that writes to the API server is in a span.
+// Reads and watches are not traced since they're mostly served by the cache. This does nothing when tracing is
+// disabled.
+func TraceAPIWrites(cfg *rest.Config) {
+	if !tracingEnabled.Load() {
+		return
+	}
+
+	cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return otelhttp.NewTransport(
+			rt,
+			otelhttp.WithPropagators(tracePropagator),
+			otelhttp.WithFilter(func(req *http.Request) bool { return req.Method != http.MethodGet }),
+			otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+				return req.Method + " " + req.URL.Path
+			}),
+		)
+	})
+}
+
+// annotationCarrier adapts the trace context annotations to a propagation.TextMapCarrier.
+type annotationCarrier map[string]string
+
+func (c annotationCarrier) Get(key string) string {
+	return c[traceAnnotations[key]]
+}
+
+func (c annotationCarrier) Set(key string, value string) {
+	if annotation, ok := traceAnnotations[key]; ok {
+		c[annotation] = value
+	}
+}
+
+func (c annotationCarrier) Keys() []string {
+	keys := make([]string, 0, len(traceAnnotations))
+
+	for key, annotation := range traceAnnotations {
+		if _, ok := c[annotation]; ok {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// InjectTraceContext sets the trace context annotations on the object to the span in the context, so that the next
+// controller to handle the object continues the trace. Nothing is set if the context has no valid span.
+func InjectTraceContext(ctx context.Context, obj client.Object) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return
+	}
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	tracePropagator.Inject(ctx, annotationCarrier(annotations))
+
+	obj.SetAnnotations(annotations)
+}
+
+// ExtractTraceContext returns a context with the remote span from the trace context annotations as its parent. The
+// context is returned as is when the annotations have no trace context.
+func ExtractTraceContext(ctx context.Context, annotations map[string]string) context.Context {
+	return tracePropagator.Extract(ctx, annotationCarrier(annotations))
+}
+
+// LinkTraceContext links the span in the context to the span from the trace context annotations, which is used when
+// a span is caused by objects from several traces, such as compliance events.
+func LinkTraceContext(ctx context.Context, annotations map[string]string) {
+	linked := trace.SpanContextFromContext(ExtractTraceContext(context.Background(), annotations))
+	if !linked.IsValid() {
+		return
+	}
+
+	trace.SpanFromContext(ctx).AddLink(trace.Link{SpanContext: linked})
+}
+
+// withoutTraceAnnotations returns the annotations without the trace context annotations, which change on every write
+// and so shouldn't be considered when comparing objects.
+func withoutTraceAnnotations(annotations map[string]string) map[string]string {
+	if _, ok := annotations[TraceParentAnnotation]; !ok {
+		if _, ok := annotations[TraceStateAnnotation]; !ok {
+			return annotations
+		}
+	}
+
+	annotations = maps.Clone(annotations)
+
+	delete(annotations, TraceParentAnnotation)
+	delete(annotations, TraceStateAnnotation)
+
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	return annotations
+}
+
+// TraceReconciler wraps a policy reconciler so that each reconcile is in a span. The span continues the trace from
+// the trace context annotations on the policy, which is read with the reader using the request's namespace and name.
+// The reconciler is returned as is when tracing is disabled.
+func TraceReconciler(controllerName string, reader client.Reader, newObj func() client.Object, r reconcile.Reconciler,
+) reconcile.Reconciler {
+	if !tracingEnabled.Load() {
+		return r
+	}
+
+	return &tracedReconciler{
+		controllerName: controllerName,
+		reader:         reader,
+		newObj:         newObj,
+		reconciler:     r,
+		tracer:         otel.Tracer(tracerName),
+	}
+}
+
+type tracedReconciler struct {
+	controllerName string
+	reader         client.Reader
+	newObj         func() client.Object
+	reconciler     reconcile.Reconciler
+	tracer         trace.Tracer
+}
+
+func (t *tracedReconciler) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	obj := t.newObj()
+
+	// A policy that isn't found is still reconciled, but in a new trace
+	if err := t.reader.Get(ctx, request.NamespacedName, obj); err == nil {
+		ctx = ExtractTraceContext(ctx, obj.GetAnnotations())
+	}
+
+	ctx, span := t.tracer.Start(
+		ctx,
+		t.controllerName+" reconcile",
+		trace.WithAttributes(
+			attribute.String("controller", t.controllerName),
+			attribute.String("policy.namespace", request.Namespace),
+			attribute.String("policy.name", request.Name),
+		),
+	)
+	defer span.End()
+
+	result, err := t.reconciler.Reconcile(ctx, request)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return result, err
+}
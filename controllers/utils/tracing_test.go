@@ -0,0 +1,229 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// reconcileFunc adapts a function to a reconcile.Reconciler.
+type reconcileFunc func(context.Context, reconcile.Request) (reconcile.Result, error)
+
+func (f reconcileFunc) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	return f(ctx, request)
+}
+
+func TestTraceContextAnnotations(t *testing.T) {
+	t.Parallel()
+
+	provider := sdktrace.NewTracerProvider()
+
+	policy := &policiesv1.Policy{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"foo": "bar"}}}
+
+	InjectTraceContext(context.Background(), policy)
+
+	if len(policy.Annotations) != 1 {
+		t.Fatalf("Expected no trace context without a span, got %v", policy.Annotations)
+	}
+
+	ctx, span := provider.Tracer("test").Start(context.Background(), "test")
+	defer span.End()
+
+	InjectTraceContext(ctx, policy)
+
+	if policy.Annotations[TraceParentAnnotation] == "" || policy.Annotations["foo"] != "bar" {
+		t.Fatalf("Expected the traceparent annotation to be added, got %v", policy.Annotations)
+	}
+
+	extracted := trace.SpanContextFromContext(ExtractTraceContext(context.Background(), policy.Annotations))
+
+	if !extracted.IsRemote() || extracted.TraceID() != span.SpanContext().TraceID() ||
+		extracted.SpanID() != span.SpanContext().SpanID() {
+		t.Fatalf("Expected the extracted span context to match %v, got %v", span.SpanContext(), extracted)
+	}
+
+	hubPolicy := &policiesv1.Policy{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"foo": "bar"}}}
+
+	if !EquivalentReplicatedPolicies(hubPolicy, policy) {
+		t.Fatal("Expected the trace context annotations to be ignored when comparing policies")
+	}
+}
+
+func TestTracedReconciler(t *testing.T) {
+	t.Parallel()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	// The span that wrote the policy, such as the spec-sync's span
+	parentCtx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	parent.End()
+
+	policy := &policiesv1.Policy{ObjectMeta: metav1.ObjectMeta{Name: "policy", Namespace: "cluster"}}
+	InjectTraceContext(parentCtx, policy)
+
+	scheme := runtime.NewScheme()
+	if err := policiesv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	reconcileErr := errors.New("reconcile failed")
+
+	traced := &tracedReconciler{
+		controllerName: "test-controller",
+		reader:         fake.NewClientBuilder().WithScheme(scheme).WithObjects(policy).Build(),
+		newObj:         func() client.Object { return &policiesv1.Policy{} },
+		reconciler: reconcileFunc(func(ctx context.Context, _ reconcile.Request) (reconcile.Result, error) {
+			if !trace.SpanContextFromContext(ctx).IsValid() {
+				t.Error("Expected the reconcile context to have a span")
+			}
+
+			return reconcile.Result{}, reconcileErr
+		}),
+		tracer: provider.Tracer("test"),
+	}
+
+	tests := map[string]struct {
+		name          string
+		expectedTrace trace.TraceID
+	}{
+		"policy with a trace context": {name: "policy", expectedTrace: parent.SpanContext().TraceID()},
+		"policy not found":            {name: "missing"},
+	}
+
+	for name, test := range tests {
+		_, err := traced.Reconcile(context.Background(), reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: "cluster", Name: test.name},
+		})
+		if !errors.Is(err, reconcileErr) {
+			t.Fatalf("%s: expected the reconcile error to be returned, got %v", name, err)
+		}
+
+		spans := recorder.Ended()
+		span := spans[len(spans)-1]
+
+		if span.Name() != "test-controller reconcile" {
+			t.Fatalf("%s: unexpected span name %s", name, span.Name())
+		}
+
+		if span.Status().Code != codes.Error {
+			t.Fatalf("%s: expected the span to have an error status, got %v", name, span.Status())
+		}
+
+		if test.expectedTrace.IsValid() {
+			if span.Parent().SpanID() != parent.SpanContext().SpanID() ||
+				span.SpanContext().TraceID() != test.expectedTrace {
+				t.Fatalf("%s: expected the span to continue the trace of the policy", name)
+			}
+		} else if span.Parent().IsValid() {
+			t.Fatalf("%s: expected a new trace, got the parent %v", name, span.Parent())
+		}
+	}
+}
+
+func TestLinkTraceContext(t *testing.T) {
+	t.Parallel()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := provider.Tracer("test")
+
+	eventCtx, eventSpan := tracer.Start(context.Background(), "event")
+	eventSpan.End()
+
+	event := &corev1.Event{}
+	InjectTraceContext(eventCtx, event)
+
+	ctx, span := tracer.Start(context.Background(), "status-sync")
+
+	LinkTraceContext(ctx, event.Annotations)
+	LinkTraceContext(ctx, map[string]string{})
+
+	span.End()
+
+	links := recorder.Ended()[1].Links()
+
+	if len(links) != 1 || links[0].SpanContext.SpanID() != eventSpan.SpanContext().SpanID() {
+		t.Fatalf("Expected a single link to the event span, got %v", links)
+	}
+}
+
+func TestLinkTraceContextCachedEvent(t *testing.T) {
+	t.Parallel()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := provider.Tracer("test")
+
+	eventCtx, eventSpan := tracer.Start(context.Background(), "event")
+	eventSpan.End()
+
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "policy.17b0db2427432200",
+			Namespace:   "managed",
+			Annotations: map[string]string{ComplianceAnnotation: "Compliant", "foo": "bar"},
+		},
+		Message: "Compliant; notification - no violations",
+	}
+	InjectTraceContext(eventCtx, event)
+
+	// The status sync reads the events from the cache, so link to the trace from the transformed event
+	transformed, err := TransformCachedEvent(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cachedEvent := transformed.(*corev1.Event)
+
+	if _, ok := cachedEvent.Annotations["foo"]; ok {
+		t.Fatalf("Expected the other annotations to not be cached, got %v", cachedEvent.Annotations)
+	}
+
+	ctx, span := tracer.Start(context.Background(), "status-sync")
+
+	LinkTraceContext(ctx, cachedEvent.Annotations)
+
+	span.End()
+
+	links := recorder.Ended()[1].Links()
+
+	if len(links) != 1 || links[0].SpanContext.SpanID() != eventSpan.SpanContext().SpanID() {
+		t.Fatalf("Expected a single link to the event span from the cached event, got %v", links)
+	}
+}
+
+func TestWithoutTraceAnnotations(t *testing.T) {
+	t.Parallel()
+
+	annotations := map[string]string{TraceParentAnnotation: "00-abc-def-01", "foo": "bar"}
+
+	stripped := withoutTraceAnnotations(annotations)
+
+	if len(stripped) != 1 || stripped["foo"] != "bar" {
+		t.Fatalf("Expected only the foo annotation, got %v", stripped)
+	}
+
+	if annotations[TraceParentAnnotation] == "" {
+		t.Fatal("Expected the original annotations to not be modified")
+	}
+
+	if withoutTraceAnnotations(map[string]string{TraceStateAnnotation: "foo=bar"}) != nil {
+		t.Fatal("Expected nil when only trace context annotations are set")
+	}
+}
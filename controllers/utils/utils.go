@@ -4,10 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/apimachinery/pkg/api/equality"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -31,6 +34,9 @@ var (
 		{Group: GConstraint},
 	}
 	ErrNoVersionedResource = errors.New("the resource version was not found")
+	// LagBuckets are the histogram buckets for the sync lag and latency metrics, from 100 milliseconds to about 14
+	// minutes.
+	LagBuckets = prometheus.ExponentialBuckets(0.1, 2, 14)
 )
 
 const (
@@ -46,8 +52,10 @@ const (
 // labels is skipped here in part because in hosted mode the cluster-namespace label likely will not
 // match.)
 func EquivalentReplicatedPolicies(plc1 *policiesv1.Policy, plc2 *policiesv1.Policy) bool {
-	// Compare annotations
-	if !equality.Semantic.DeepEqual(plc1.GetAnnotations(), plc2.GetAnnotations()) {
+	// Compare annotations, except for the trace context which is set by the spec-sync on each write
+	if !equality.Semantic.DeepEqual(
+		withoutTraceAnnotations(plc1.GetAnnotations()), withoutTraceAnnotations(plc2.GetAnnotations()),
+	) {
 		return false
 	}
 
@@ -159,6 +167,16 @@ func GVRFromGVK(
 	)
 }
 
+// HubScopedName returns the name, such as of a controller, with the hub name appended for an additional hub so that
+// each hub has its own controllers, leader election, and metrics. The hub name is empty for the primary hub.
+func HubScopedName(name string, hubName string) string {
+	if hubName == "" {
+		return name
+	}
+
+	return name + "-" + hubName
+}
+
 func LogConstructor(controllerName string, kind string, req *reconcile.Request) logr.Logger {
 	log := ctrl.Log.WithName(controllerName)
 
@@ -168,3 +186,44 @@ func LogConstructor(controllerName string, kind string, req *reconcile.Request)
 
 	return log
 }
+
+// LastSpecChange returns when the spec of the object was last changed, based on the timestamps of the entries in its
+// managed fields that own a spec field. Writes that don't change the spec, such as adding a finalizer with a different
+// field manager, are not counted. A zero time is returned when the spec hasn't changed since the object was created,
+// based on its generation, or when no entry has a timestamp, so that the age of the object isn't reported as a lag.
+func LastSpecChange(obj metav1.Object) time.Time {
+	var lastChange time.Time
+
+	if obj.GetGeneration() <= 1 {
+		return lastChange
+	}
+
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Subresource != "" || entry.Time == nil || !ownsSpec(entry.FieldsV1) {
+			continue
+		}
+
+		if entry.Time.After(lastChange) {
+			lastChange = entry.Time.Time
+		}
+	}
+
+	return lastChange
+}
+
+// ownsSpec returns whether the managed fields contain a field in the spec.
+func ownsSpec(fields *metav1.FieldsV1) bool {
+	if fields == nil {
+		return false
+	}
+
+	owned := map[string]json.RawMessage{}
+
+	if err := json.Unmarshal(fields.Raw, &owned); err != nil {
+		return false
+	}
+
+	_, ok := owned["f:spec"]
+
+	return ok
+}
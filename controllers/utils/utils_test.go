@@ -0,0 +1,81 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package utils
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLastSpecChange(t *testing.T) {
+	t.Parallel()
+
+	created := time.Now().Add(-time.Hour).Truncate(time.Second)
+	updated := created.Add(30 * time.Minute)
+	finalizerAdded := created.Add(40 * time.Minute)
+	statusUpdated := created.Add(45 * time.Minute)
+
+	specFields := &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{}},"f:spec":{"f:disabled":{}}}`)}
+	finalizerFields := &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:finalizers":{}}}`)}
+
+	obj := &metav1.ObjectMeta{
+		CreationTimestamp: metav1.NewTime(created),
+		Generation:        1,
+		ManagedFields: []metav1.ManagedFieldsEntry{
+			{Manager: "creator", Operation: metav1.ManagedFieldsOperationUpdate, Time: ptrTime(created), FieldsV1: specFields},
+		},
+	}
+
+	if lastChange := LastSpecChange(obj); !lastChange.IsZero() {
+		t.Fatalf("Expected no spec change when the object was only created, got %s", lastChange)
+	}
+
+	obj.Generation = 2
+	obj.ManagedFields = []metav1.ManagedFieldsEntry{
+		{Manager: "creator", Operation: metav1.ManagedFieldsOperationUpdate, Time: ptrTime(created), FieldsV1: specFields},
+		{Manager: "updater", Operation: metav1.ManagedFieldsOperationApply, Time: ptrTime(updated), FieldsV1: specFields},
+		{
+			Manager:   "finalizer",
+			Operation: metav1.ManagedFieldsOperationUpdate,
+			Time:      ptrTime(finalizerAdded),
+			FieldsV1:  finalizerFields,
+		},
+		{
+			Manager:     "status-updater",
+			Operation:   metav1.ManagedFieldsOperationUpdate,
+			Time:        ptrTime(statusUpdated),
+			FieldsV1:    &metav1.FieldsV1{Raw: []byte(`{"f:status":{}}`)},
+			Subresource: "status",
+		},
+	}
+
+	if lastChange := LastSpecChange(obj); !lastChange.Equal(updated) {
+		t.Fatalf("Expected the latest spec update %s, got %s", updated, lastChange)
+	}
+
+	obj.ManagedFields = obj.ManagedFields[2:]
+
+	if lastChange := LastSpecChange(obj); !lastChange.IsZero() {
+		t.Fatalf("Expected no spec change without a spec field manager, got %s", lastChange)
+	}
+}
+
+func TestHubScopedName(t *testing.T) {
+	t.Parallel()
+
+	if name := HubScopedName("policy-spec-sync", ""); name != "policy-spec-sync" {
+		t.Fatalf("Expected the name to be unchanged for the primary hub, got %s", name)
+	}
+
+	if name := HubScopedName("policy-spec-sync", "team"); name != "policy-spec-sync-team" {
+		t.Fatalf("Expected the hub name to be appended for an additional hub, got %s", name)
+	}
+}
+
+func ptrTime(t time.Time) *metav1.Time {
+	mt := metav1.NewTime(t)
+
+	return &mt
+}
@@ -24,7 +24,9 @@ import (
 	"github.com/stolostron/go-log-utils/zaputil"
 	depclient "github.com/stolostron/kubernetes-dependency-watches/client"
 	"golang.org/x/mod/semver"
+	"golang.org/x/time/rate"
 	admissionregistration "k8s.io/api/admissionregistration/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
 	v1 "k8s.io/api/core/v1"
 	extensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -46,6 +48,7 @@ import (
 	"k8s.io/klog/v2"
 	"open-cluster-management.io/addon-framework/pkg/lease"
 	addonutils "open-cluster-management.io/addon-framework/pkg/utils"
+	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
 	sdktls "open-cluster-management.io/sdk-go/pkg/tls"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
@@ -58,8 +61,11 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	"open-cluster-management.io/governance-policy-framework-addon/controllers/gatekeepersync"
+	"open-cluster-management.io/governance-policy-framework-addon/controllers/kyvernosync"
+	"open-cluster-management.io/governance-policy-framework-addon/controllers/policyprotection"
 	"open-cluster-management.io/governance-policy-framework-addon/controllers/secretsync"
 	"open-cluster-management.io/governance-policy-framework-addon/controllers/specsync"
 	"open-cluster-management.io/governance-policy-framework-addon/controllers/statussync"
@@ -76,6 +82,8 @@ var (
 	scheme              = k8sruntime.NewScheme()
 	healthAddresses     = map[string]bool{}
 	healthAddressesLock = sync.RWMutex{}
+	// policySelector selects the policies that this deployment syncs. It's nil when every policy is selected.
+	policySelector *utils.PolicySelector
 )
 
 func printVersion() {
@@ -130,6 +138,17 @@ func main() {
 
 	printVersion()
 
+	policySelector, err = utils.NewPolicySelector(
+		tool.Options.PolicyLabelSelector,
+		tool.Options.PolicyAnnotationSelector,
+		int(tool.Options.ShardCount),
+		int(tool.Options.ShardIndex),
+	)
+	if err != nil {
+		log.Error(err, "Invalid policy selector flags")
+		os.Exit(1)
+	}
+
 	hubCfg, err := clientcmd.BuildConfigFromFlags("", tool.Options.HubConfigFilePathName)
 	if err != nil {
 		log.Error(err, "Failed to build hub cluster config")
@@ -159,6 +178,54 @@ func main() {
 
 	mainCtx := ctrl.SetupSignalHandler()
 
+	shutdownTracing, err := utils.SetupTracing(mainCtx, utils.TracingOptions{
+		Endpoint:         tool.Options.TracingEndpoint,
+		Insecure:         tool.Options.TracingInsecure,
+		SampleRatio:      tool.Options.TracingSampleRatio,
+		ClusterNamespace: tool.Options.ClusterNamespace,
+	})
+	if err != nil {
+		log.Error(err, "Failed to set up tracing")
+		os.Exit(1)
+	}
+
+	utils.TraceAPIWrites(hubCfg)
+	utils.TraceAPIWrites(managedCfg)
+
+	primaryHub := &hubTarget{
+		configFile:      tool.Options.HubConfigFilePathName,
+		cfg:             hubCfg,
+		hubNamespace:    tool.Options.ClusterNamespaceOnHub,
+		targetNamespace: tool.Options.ClusterNamespace,
+	}
+
+	if !tool.Options.OnMulticlusterhub {
+		primaryHub.connectivity = newHubConnectivity(hubCfg)
+	}
+
+	hubConnectivity := primaryHub.connectivity
+
+	additionalHubs := make([]*hubTarget, 0, len(tool.Options.AdditionalHubs))
+
+	for _, hubConfig := range tool.Options.AdditionalHubs {
+		additionalHubCfg, err := clientcmd.BuildConfigFromFlags("", hubConfig.Kubeconfig)
+		if err != nil {
+			log.Error(err, "Failed to build the additional hub cluster config", "hub", hubConfig.Name)
+			os.Exit(1)
+		}
+
+		utils.TraceAPIWrites(additionalHubCfg)
+
+		additionalHubs = append(additionalHubs, &hubTarget{
+			name:            hubConfig.Name,
+			configFile:      hubConfig.Kubeconfig,
+			cfg:             additionalHubCfg,
+			hubNamespace:    hubConfig.HubNamespace,
+			targetNamespace: hubConfig.TargetNamespace,
+			connectivity:    newHubConnectivity(additionalHubCfg),
+		})
+	}
+
 	tlsCfg := resolveEffectiveTLSConfig(mainCtx, managedCfg)
 
 	metricsOptions := server.Options{
@@ -228,6 +295,12 @@ func main() {
 			).WithHubLeaseConfig(hubCfg, tool.Options.ClusterNamespaceOnHub)
 
 			go leaseUpdater.Start(ctx)
+
+			if hubConnectivity != nil {
+				go hubConnectivity.AnnotateLease(
+					ctx, generatedClient, operatorNs, "governance-policy-framework", time.Minute,
+				)
+			}
 		}
 	} else {
 		log.Info("Status reporting is not enabled")
@@ -244,9 +317,25 @@ func main() {
 	healthAddresses[mgrHealthAddr] = true
 	mgrCtx, mgrCtxCancel := context.WithCancel(mainCtx)
 
-	mgr := getManager(mgrCtx, mgrOptionsBase, mgrHealthAddr, hubCfg, managedCfg)
+	mgrOptions := mgrOptionsBase
+
+	// The webhook server is only added to the managed cluster manager, which is the only one that serves webhooks
+	if tool.Options.EnableProtectionWebhook {
+		mgrOptions.WebhookServer = webhook.NewServer(webhook.Options{
+			Port:    tool.Options.ProtectionWebhookPort,
+			CertDir: tool.Options.ProtectionWebhookCertDir,
+			TLSOpts: []func(*tls.Config){sdktls.ConfigToFunc(tlsCfg)},
+		})
+	}
 
-	var hubMgr manager.Manager
+	mgr := getManager(mgrCtx, mgrOptions, mgrHealthAddr, hubCfg, managedCfg)
+
+	if hubConnectivity != nil {
+		if err := mgr.AddReadyzCheck("hub-connectivity", hubConnectivity.Check); err != nil {
+			log.Error(err, "unable to set up the hub connectivity ready check")
+			os.Exit(1)
+		}
+	}
 
 	if !tool.Options.OnMulticlusterhub {
 		hubMgrHealthAddr, err := getFreeLocalAddr()
@@ -257,7 +346,20 @@ func main() {
 
 		healthAddresses[hubMgrHealthAddr] = true
 
-		hubMgr = getHubManager(mgrCtx, mgrOptionsBase, hubMgrHealthAddr, hubCfg, managedCfg)
+		primaryHub.mgr = getHubManager(mgrCtx, mgrOptionsBase, hubMgrHealthAddr, primaryHub, managedCfg)
+	}
+
+	// Each additional hub has its own manager so that its health is reported separately
+	for _, hub := range additionalHubs {
+		hubMgrHealthAddr, err := getFreeLocalAddr()
+		if err != nil {
+			log.Error(err, "Failed to get a free port for the health endpoint")
+			os.Exit(1)
+		}
+
+		healthAddresses[hubMgrHealthAddr] = true
+
+		hub.mgr = getHubManager(mgrCtx, mgrOptionsBase, hubMgrHealthAddr, hub, managedCfg)
 	}
 
 	healthAddressesLock.Unlock()
@@ -279,7 +381,7 @@ func main() {
 		if semver.Compare(serverVersion.GitVersion, "v1.16.0") >= 0 {
 			dynamicClient := dynamic.NewForConfigOrDie(managedCfg)
 
-			go manageGatekeeperSyncManager(mgrCtx, &wg, managedCfg, dynamicClient, mgrOptionsBase)
+			go manageDynamicSyncManager(mgrCtx, &wg, managedCfg, dynamicClient, mgrOptionsBase, gatekeeperSyncManager())
 		} else {
 			log.Info("The Gatekeeper integration is disabled due to the Kubernetes version being less than 1.16.0")
 		}
@@ -287,9 +389,22 @@ func main() {
 		log.Info("The Gatekeeper integration is set to disabled")
 	}
 
+	// Add Kyverno controller if enabled
+	if !tool.Options.DisableKyvernoSync {
+		dynamicClient := dynamic.NewForConfigOrDie(managedCfg)
+
+		go manageDynamicSyncManager(mgrCtx, &wg, managedCfg, dynamicClient, mgrOptionsBase, kyvernoSyncManager())
+	} else {
+		log.Info("The Kyverno integration is set to disabled")
+	}
+
 	log.Info("Adding controllers to managers")
 
-	addControllers(mgrCtx, hubCfg, hubMgr, mgr)
+	addControllers(mgrCtx, primaryHub, additionalHubs, mgr)
+
+	if tool.Options.EnableProtectionWebhook {
+		addProtectionWebhook(mgrCtx, mgr, managedCfg)
+	}
 
 	log.Info("Starting the controller managers")
 
@@ -345,7 +460,7 @@ func main() {
 
 	if !tool.Options.OnMulticlusterhub {
 		wg.Go(func() {
-			if err := hubMgr.Start(mgrCtx); err != nil {
+			if err := primaryHub.mgr.Start(mgrCtx); err != nil {
 				log.Error(err, "problem running hub manager")
 
 				// On errors, the parent context (mainCtx) may not have closed, so cancel the child context.
@@ -356,20 +471,81 @@ func main() {
 		})
 	}
 
+	for _, hub := range additionalHubs {
+		wg.Go(func() {
+			if err := hub.mgr.Start(mgrCtx); err != nil {
+				log.Error(err, "problem running the additional hub manager", "hub", hub.name)
+
+				// On errors, the parent context (mainCtx) may not have closed, so cancel the child context.
+				mgrCtxCancel()
+
+				errorExit = true
+			}
+		})
+	}
+
 	wg.Wait()
 
+	// Use a new context since the main context is canceled by now
+	shutdownCtx, shutdownCtxCancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Error(err, "Failed to flush the remaining traces")
+	}
+
+	shutdownCtxCancel()
+
 	if errorExit {
 		os.Exit(1)
 	}
 }
 
 // getManager return a controller Manager object that watches on the managed cluster and has the controllers registered.
+// addProtectionWebhook registers the webhook that rejects local changes to the replicated policies and their generated
+// templates. The addon's own username is looked up so that its changes are always allowed.
+func addProtectionWebhook(ctx context.Context, mgr manager.Manager, managedCfg *rest.Config) {
+	review, err := kubernetes.NewForConfigOrDie(managedCfg).AuthenticationV1().SelfSubjectReviews().Create(
+		ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{},
+	)
+	if err != nil {
+		log.Error(err, "Failed to look up the addon's username for the protection webhook")
+		os.Exit(1)
+	}
+
+	allowedGroups := []string{}
+
+	for _, group := range strings.Split(tool.Options.ProtectionWebhookAllowedGroups, ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			allowedGroups = append(allowedGroups, group)
+		}
+	}
+
+	log.Info(
+		"Serving the protection webhook",
+		"path", policyprotection.WebhookPath,
+		"username", review.Status.UserInfo.Username,
+		"allowedGroups", allowedGroups,
+	)
+
+	mgr.GetWebhookServer().Register(policyprotection.WebhookPath, &webhook.Admission{
+		Handler: &policyprotection.Validator{
+			Username:      review.Status.UserInfo.Username,
+			AllowedGroups: allowedGroups,
+		},
+	})
+
+	if err := mgr.AddReadyzCheck("protection-webhook", mgr.GetWebhookServer().StartedChecker()); err != nil {
+		log.Error(err, "unable to set up the protection webhook ready check")
+		os.Exit(1)
+	}
+}
+
 func getManager(
 	ctx context.Context, options manager.Options, healthAddr string, hubCfg *rest.Config, managedCfg *rest.Config,
 ) manager.Manager {
 	crdLabelSelector := labels.SelectorFromSet(map[string]string{utils.PolicyTypeLabel: "template"})
 
-	options.LeaderElectionID = "governance-policy-framework-addon.open-cluster-management.io"
+	options.LeaderElectionID = "governance-policy-framework-addon.open-cluster-management.io" + leaderElectionSuffix()
 	options.HealthProbeBindAddress = healthAddr
 	options.Client = client.Options{
 		Cache: &client.CacheOptions{
@@ -379,50 +555,53 @@ func getManager(
 			},
 		},
 	}
+	eventsCacheConfig := cache.Config{
+		// Filter out events not related to policy compliance
+		FieldSelector: fields.ParseSelectorOrDie(`involvedObject.kind=Policy,` +
+			`reason!="PolicySpecSync",` +
+			`reason!="PolicyTemplateSync",` +
+			`reason!="PolicyStatusSync",` +
+			`reason!="` + templatesync.PreviewEventReason + `"`,
+		),
+		// Only cache fields that are utilized by the controllers.
+		Transform: utils.TransformCachedEvent,
+	}
+	secretsCacheConfig := cache.Config{
+		FieldSelector: fields.SelectorFromSet(fields.Set{"metadata.name": secretsync.SecretName}),
+	}
+
+	eventsNamespaces := map[string]cache.Config{}
+	secretsNamespaces := map[string]cache.Config{}
+	defaultNamespaces := map[string]cache.Config{}
+
+	// The policies from each hub are replicated to their own namespace
+	for _, namespace := range managedPolicyNamespaces() {
+		eventsNamespaces[namespace] = eventsCacheConfig
+		secretsNamespaces[namespace] = secretsCacheConfig
+		defaultNamespaces[namespace] = cache.Config{}
+	}
+
 	options.Cache = cache.Options{
 		ByObject: map[client.Object]cache.ByObject{
 			&extensionsv1.CustomResourceDefinition{}: {
 				Label: crdLabelSelector,
 			},
-			&v1.Event{}: {
-				Namespaces: map[string]cache.Config{
-					tool.Options.ClusterNamespace: {
-						// Filter out events not related to policy compliance
-						FieldSelector: fields.ParseSelectorOrDie(`involvedObject.kind=Policy,` +
-							`reason!="PolicySpecSync",` +
-							`reason!="PolicyTemplateSync",` +
-							`reason!="PolicyStatusSync"`,
-						),
-						Transform: func(obj any) (any, error) {
-							event := obj.(*v1.Event)
-							// Only cache fields that are utilized by the controllers.
-							return &v1.Event{
-								InvolvedObject: event.InvolvedObject,
-								TypeMeta:       event.TypeMeta,
-								ObjectMeta: metav1.ObjectMeta{
-									Name:      event.Name,
-									Namespace: event.Namespace,
-									UID:       event.UID,
-								},
-								LastTimestamp: event.LastTimestamp,
-								Message:       event.Message,
-								Reason:        event.Reason,
-							}, nil
-						},
-					},
-				},
-			},
-			&v1.Secret{}: {
-				Namespaces: map[string]cache.Config{
-					tool.Options.ClusterNamespace: {
-						FieldSelector: fields.SelectorFromSet(fields.Set{"metadata.name": secretsync.SecretName}),
-					},
+			&v1.Event{}:  {Namespaces: eventsNamespaces},
+			&v1.Secret{}: {Namespaces: secretsNamespaces},
+		},
+		DefaultNamespaces: defaultNamespaces,
+	}
+
+	if templateKindsNs := getAddonNamespace(); templateKindsNs != "" {
+		options.Cache.ByObject[&v1.ConfigMap{}] = cache.ByObject{
+			Namespaces: map[string]cache.Config{
+				templateKindsNs: {
+					FieldSelector: fields.SelectorFromSet(
+						fields.Set{"metadata.name": templatesync.TemplateKindsConfigMapName},
+					),
 				},
 			},
-		},
-		DefaultNamespaces: map[string]cache.Config{
-			tool.Options.ClusterNamespace: {},
-		},
+		}
 	}
 
 	mgr, err := utils.NewManagerWithRetry(ctx, log, managedCfg, options)
@@ -460,11 +639,13 @@ func getManager(
 
 // getHubManager return a controller Manager object that watches on the Hub and has the controllers registered.
 func getHubManager(
-	ctx context.Context, options manager.Options, healthAddr string, hubCfg *rest.Config, managedCfg *rest.Config,
+	ctx context.Context, options manager.Options, healthAddr string, hub *hubTarget, managedCfg *rest.Config,
 ) manager.Manager {
 	// Set the manager options
 	options.HealthProbeBindAddress = healthAddr
-	options.LeaderElectionID = "governance-policy-framework-addon2.open-cluster-management.io"
+	options.LeaderElectionID = utils.HubScopedName(
+		"governance-policy-framework-addon2.open-cluster-management.io"+leaderElectionSuffix(), hub.name,
+	)
 	options.LeaderElectionConfig = managedCfg
 	// Set a field selector so that a watch on secrets will be limited to just the secret with the policy template
 	// encryption key.
@@ -472,36 +653,44 @@ func getHubManager(
 		ByObject: map[client.Object]cache.ByObject{
 			&v1.Secret{}: {
 				Namespaces: map[string]cache.Config{
-					tool.Options.ClusterNamespaceOnHub: {
+					hub.hubNamespace: {
 						FieldSelector: fields.SelectorFromSet(fields.Set{"metadata.name": secretsync.SecretName}),
 					},
 				},
 			},
 		},
 		DefaultNamespaces: map[string]cache.Config{
-			tool.Options.ClusterNamespaceOnHub: {},
+			hub.hubNamespace: {},
 		},
 	}
 
+	// Only cache the selected policies. The annotation selector and the shard can't be used to filter a watch, so
+	// those are filtered by the controllers.
+	if policySelector != nil && !policySelector.Labels.Empty() {
+		options.Cache.ByObject[&policiesv1.Policy{}] = cache.ByObject{Label: policySelector.Labels}
+	}
+
 	// Disable the metrics endpoint for this manager. Note that since they both use the global
 	// metrics registry, metrics for this manager are still exposed by the other manager.
 	options.Metrics.BindAddress = "0"
 
 	// Create a new manager to provide shared dependencies and start components
-	mgr, err := utils.NewManagerWithRetry(ctx, log, hubCfg, options)
+	mgr, err := utils.NewManagerWithRetry(ctx, log, hub.cfg, options)
 	if err != nil {
 		log.Error(err, "Failed to start manager")
 		os.Exit(1)
 	}
 
-	configFiles := []string{tool.Options.HubConfigFilePathName}
+	configFiles := []string{hub.configFile}
 
-	if hubCfg.CertFile != "" {
-		configFiles = append(configFiles, hubCfg.CertFile)
+	if hub.cfg.CertFile != "" {
+		configFiles = append(configFiles, hub.cfg.CertFile)
 	}
 
 	// use config check
-	configChecker, err := addonutils.NewConfigChecker("governance-policy-framework-addon2", configFiles...)
+	configChecker, err := addonutils.NewConfigChecker(
+		utils.HubScopedName("governance-policy-framework-addon2", hub.name), configFiles...,
+	)
 	if err != nil {
 		log.Error(err, "unable to setup a configChecker")
 		os.Exit(1)
@@ -518,6 +707,14 @@ func getHubManager(
 		os.Exit(1)
 	}
 
+	// The connectivity to the primary hub is checked by the managed cluster manager
+	if hub.name != "" && hub.connectivity != nil {
+		if err := mgr.AddReadyzCheck("hub-connectivity", hub.connectivity.Check); err != nil {
+			log.Error(err, "unable to set up the hub connectivity ready check", "hub", hub.name)
+			os.Exit(1)
+		}
+	}
+
 	return mgr
 }
 
@@ -635,27 +832,62 @@ func getFreeLocalAddr() (string, error) {
 	return fmt.Sprintf("127.0.0.1:%d", l.Addr().(*net.TCPAddr).Port), nil
 }
 
-// addControllers sets up all controllers with their respective managers
+// addControllers sets up all controllers with their respective managers. The primary hub's manager is nil when
+// running on the hub.
 func addControllers(
 	ctx context.Context,
-	hubCfg *rest.Config,
-	hubMgr manager.Manager,
+	primaryHub *hubTarget,
+	additionalHubs []*hubTarget,
 	managedMgr manager.Manager,
 ) {
-	// Set up all controllers for manager on managed cluster
-	var hubClient client.Client
-	var specSyncRequests chan event.GenericEvent
-	var specSyncRequestsSource source.Source
-	var statusSyncRequests chan event.GenericEvent
-	var statusSyncRequestsSource source.Source
-
-	if hubMgr == nil {
-		hubCache, err := cache.New(hubCfg,
+	var archive *statussync.ComplianceArchive
+
+	// The archive is shared by the status-sync of every hub
+	if tool.Options.ComplianceArchiveFile != "" {
+		archive = &statussync.ComplianceArchive{
+			Sink: &statussync.FileArchiveSink{
+				Path:       tool.Options.ComplianceArchiveFile,
+				MaxSize:    int64(tool.Options.ComplianceArchiveFileMaxSizeMB) * 1024 * 1024,
+				MaxBackups: tool.Options.ComplianceArchiveFileBackups,
+			},
+		}
+	} else if tool.Options.ComplianceArchiveURL != "" {
+		archive = &statussync.ComplianceArchive{
+			Sink: &statussync.HTTPArchiveSink{
+				URL:    tool.Options.ComplianceArchiveURL,
+				Client: &http.Client{Timeout: 30 * time.Second},
+			},
+		}
+	}
+
+	var windows *utils.MaintenanceWindows
+
+	// The maintenance windows are shared by the controllers of every hub, since the spec-sync defers the changes that
+	// the status-sync reports to the hub
+	if addonNs := getAddonNamespace(); addonNs != "" {
+		windows = &utils.MaintenanceWindows{
+			Client: managedMgr.GetClient(), Reader: managedMgr.GetAPIReader(), Namespace: addonNs,
+		}
+
+		// Load the windows before the controllers start so that no change lands during a freeze
+		if err := windows.Load(ctx); err != nil {
+			log.Error(err, "Failed to load the maintenance windows")
+			os.Exit(1)
+		}
+
+		if err := managedMgr.Add(windows); err != nil {
+			log.Error(err, "Unable to add the maintenance windows to the manager")
+			os.Exit(1)
+		}
+	}
+
+	if primaryHub.mgr == nil {
+		hubCache, err := cache.New(primaryHub.cfg,
 			cache.Options{
 				ByObject: map[client.Object]cache.ByObject{
 					&v1.Secret{}: {
 						Namespaces: map[string]cache.Config{
-							tool.Options.ClusterNamespaceOnHub: {
+							primaryHub.hubNamespace: {
 								FieldSelector: fields.SelectorFromSet(
 									fields.Set{"metadata.name": secretsync.SecretName},
 								),
@@ -664,7 +896,7 @@ func addControllers(
 					},
 				},
 				DefaultNamespaces: map[string]cache.Config{
-					tool.Options.ClusterNamespaceOnHub: {},
+					primaryHub.hubNamespace: {},
 				},
 				Scheme: scheme,
 			},
@@ -682,27 +914,152 @@ func addControllers(
 			}
 		}()
 
-		hubClient, err = client.New(
-			hubCfg, client.Options{Scheme: scheme, Cache: &client.CacheOptions{Reader: hubCache}},
+		hubClient, err := client.New(
+			primaryHub.cfg, client.Options{Scheme: scheme, Cache: &client.CacheOptions{Reader: hubCache}},
 		)
 		if err != nil {
 			log.Error(err, "Failed to generate a client to the hub cluster")
 			os.Exit(1)
 		}
+
+		addStatusSync(ctx, primaryHub, hubClient, managedMgr, archive, windows, nil, nil)
 	} else {
-		bufferSize := 100
+		var kubeClient kubernetes.Interface = kubernetes.NewForConfigOrDie(managedMgr.GetConfig())
+		eventBroadcaster := events.NewBroadcaster(&events.EventSinkImpl{Interface: kubeClient.EventsV1()})
+
+		err := eventBroadcaster.StartRecordingToSinkWithContext(ctx)
+		if err != nil {
+			log.Error(err, "Unable to start event broadcaster to the managed cluster")
+			os.Exit(1)
+		}
+
+		for _, hub := range append([]*hubTarget{primaryHub}, additionalHubs...) {
+			addHubControllers(ctx, hub, managedMgr, eventBroadcaster, archive, windows)
+		}
+	}
+
+	depReconciler, depEvents := depclient.NewControllerRuntimeSource()
+
+	watcher, err := depclient.New(managedMgr.GetConfig(), depReconciler, nil)
+	if err != nil {
+		log.Error(err, "Unable to create dependency watcher")
+		os.Exit(1)
+	}
+
+	instanceName, _ := os.Hostname() // on an error, instanceName will be empty, which is ok
+
+	templateReconciler := &templatesync.PolicyReconciler{
+		Client:                 managedMgr.GetClient(),
+		DynamicWatcher:         watcher,
+		Scheme:                 managedMgr.GetScheme(),
+		Config:                 managedMgr.GetConfig(),
+		Recorder:               managedMgr.GetEventRecorder(templatesync.ControllerName),
+		Clientset:              kubernetes.NewForConfigOrDie(managedMgr.GetConfig()),
+		InstanceName:           instanceName,
+		DisableGkSync:          tool.Options.DisableGkSync,
+		ConcurrentReconciles:   int(tool.Options.EvaluationConcurrency),
+		PreviewMode:            tool.Options.TemplateSyncPreview,
+		ServerSideApply:        tool.Options.TemplateSyncServerSideApply,
+		TemplateKindsNamespace: getAddonNamespace(),
+		Selector:               policySelector,
+		MaintenanceWindows:     windows,
+	}
+
+	go func() {
+		err := watcher.Start(ctx)
+		if err != nil {
+			panic(err)
+		}
+	}()
 
-		specSyncRequests = make(chan event.GenericEvent, bufferSize)
-		specSource := source.Channel(specSyncRequests, &handler.EnqueueRequestForObject{})
-		specSyncRequestsSource = specSource
+	// Wait until the dynamic watcher has started.
+	<-watcher.Started()
 
-		statusSyncRequests = make(chan event.GenericEvent, bufferSize)
-		statusSyncRequestsSource = source.Channel(statusSyncRequests, &handler.EnqueueRequestForObject{})
+	if err := templateReconciler.Setup(managedMgr, depEvents); err != nil {
+		log.Error(err, "Unable to create the controller", "controller", templatesync.ControllerName)
+		os.Exit(1)
+	}
 
-		hubClient = hubMgr.GetClient()
+	err = managedMgr.AddMetricsServerExtraHandler(
+		templatesync.DependencyGraphPath, templateReconciler.DependencyGraphHandler(),
+	)
+	if err != nil {
+		log.Error(err, "Unable to serve the policy dependency graphs")
+		os.Exit(1)
 	}
+}
+
+// addHubControllers sets up the status-sync, spec-sync, and secret-sync controllers for the hub, which replicate the
+// hub's policies to its target namespace and send their status back to it.
+func addHubControllers(
+	ctx context.Context,
+	hub *hubTarget,
+	managedMgr manager.Manager,
+	managedEvents events.EventBroadcaster,
+	archive *statussync.ComplianceArchive,
+	windows *utils.MaintenanceWindows,
+) {
+	bufferSize := 100
 
-	var kubeClientHub kubernetes.Interface = kubernetes.NewForConfigOrDie(hubCfg)
+	specSyncRequests := make(chan event.GenericEvent, bufferSize)
+	specSyncRequestsSource := source.Channel(specSyncRequests, &handler.EnqueueRequestForObject{})
+
+	statusSyncRequests := make(chan event.GenericEvent, bufferSize)
+	statusSyncRequestsSource := source.Channel(statusSyncRequests, &handler.EnqueueRequestForObject{})
+
+	addStatusSync(
+		ctx, hub, hub.mgr.GetClient(), managedMgr, archive, windows, specSyncRequests, statusSyncRequestsSource,
+	)
+
+	specSyncName := utils.HubScopedName(specsync.ControllerName, hub.name)
+
+	if err := (&specsync.PolicyReconciler{
+		HubClient:            hub.mgr.GetClient(),
+		ManagedClient:        managedMgr.GetClient(),
+		ManagedRecorder:      managedEvents.NewRecorder(eventsScheme, specSyncName),
+		Scheme:               hub.mgr.GetScheme(),
+		TargetNamespace:      hub.targetNamespace,
+		ConcurrentReconciles: int(tool.Options.EvaluationConcurrency),
+		StatusSyncRequests:   statusSyncRequests,
+		Selector:             policySelector,
+		HubAPIReader:         hub.mgr.GetAPIReader(),
+		HubName:              hub.name,
+		PolicyOverrides:      tool.Options.EnablePolicyOverrides,
+		MaintenanceWindows:   windows,
+		// The deferred policies are synced from the policy namespace on the hub
+		ClusterNamespaceOnHub: hub.hubNamespace,
+	}).SetupWithManager(hub.mgr, specSyncRequestsSource); err != nil {
+		log.Error(err, "Unable to create the controller", "controller", specSyncName)
+		os.Exit(1)
+	}
+
+	if err := (&secretsync.SecretReconciler{
+		Client:               hub.mgr.GetClient(),
+		ManagedClient:        managedMgr.GetClient(),
+		Scheme:               hub.mgr.GetScheme(),
+		TargetNamespace:      hub.targetNamespace,
+		ConcurrentReconciles: int(tool.Options.EvaluationConcurrency),
+		HubName:              hub.name,
+	}).SetupWithManager(hub.mgr); err != nil {
+		log.Error(err, "Unable to create the controller", "controller",
+			utils.HubScopedName(secretsync.ControllerName, hub.name))
+		os.Exit(1)
+	}
+}
+
+// addStatusSync sets up the status-sync controller that sends the status of the policies in the hub's target
+// namespace to the hub.
+func addStatusSync(
+	ctx context.Context,
+	hub *hubTarget,
+	hubClient client.Client,
+	managedMgr manager.Manager,
+	archive *statussync.ComplianceArchive,
+	windows *utils.MaintenanceWindows,
+	specSyncRequests chan<- event.GenericEvent,
+	statusSyncRequestsSource source.Source,
+) {
+	var kubeClientHub kubernetes.Interface = kubernetes.NewForConfigOrDie(hub.cfg)
 	eventBroadcasterHub := events.NewBroadcaster(&events.EventSinkImpl{Interface: kubeClientHub.EventsV1()})
 
 	err := eventBroadcasterHub.StartRecordingToSinkWithContext(ctx)
@@ -711,7 +1068,8 @@ func addControllers(
 		os.Exit(1)
 	}
 
-	hubRecorder := eventBroadcasterHub.NewRecorder(eventsScheme, statussync.ControllerName)
+	controllerName := utils.HubScopedName(statussync.ControllerName, hub.name)
+	hubRecorder := eventBroadcasterHub.NewRecorder(eventsScheme, controllerName)
 
 	statusDepReconciler, statusDepEvents := depclient.NewControllerRuntimeSource()
 
@@ -725,16 +1083,56 @@ func addControllers(
 	}
 
 	statusReconciler := &statussync.PolicyReconciler{
-		ClusterNamespaceOnHub: tool.Options.ClusterNamespaceOnHub,
+		ClusterNamespaceOnHub: hub.hubNamespace,
+		ClusterNamespace:      hub.targetNamespace,
+		HubName:               hub.name,
 		HubClient:             hubClient,
 		HubRecorder:           hubRecorder,
 		ManagedClient:         managedMgr.GetClient(),
-		ManagedRecorder:       managedMgr.GetEventRecorder(statussync.ControllerName),
+		ManagedRecorder:       managedMgr.GetEventRecorder(controllerName),
 		DynamicWatcher:        statusDepWatcher,
 		Scheme:                managedMgr.GetScheme(),
 		ConcurrentReconciles:  int(tool.Options.EvaluationConcurrency),
 		SpecSyncRequests:      specSyncRequests,
 		OnMulticlusterhub:     tool.Options.OnMulticlusterhub,
+		Selector:              policySelector,
+		PolicyOverrides:       tool.Options.EnablePolicyOverrides,
+		MaintenanceWindows:    windows,
+		HubConnectivity:       hub.connectivity,
+		Archive:               archive,
+		ComplianceHistory: statussync.ComplianceHistoryOptions{
+			Length:          tool.Options.ComplianceHistoryLength,
+			DedupeWindow:    tool.Options.ComplianceHistoryDedupeWindow,
+			CollapseRepeats: tool.Options.ComplianceHistoryCollapseRepeats,
+		},
+	}
+
+	if err := statusReconciler.ComplianceHistory.Validate(); err != nil {
+		log.Error(err, "Invalid compliance history flags")
+		os.Exit(1)
+	}
+
+	// Each hub has its own rate limit
+	if tool.Options.HubStatusQPS > 0 {
+		statusReconciler.HubStatusRateLimiter = rate.NewLimiter(
+			rate.Limit(tool.Options.HubStatusQPS), max(int(tool.Options.HubStatusBurst), 1),
+		)
+	}
+
+	if !tool.Options.OnMulticlusterhub {
+		statusReconciler.HubStatusBatchWindow = tool.Options.HubStatusBatchWindow
+		statusReconciler.Outbox = &statussync.HubStatusOutbox{
+			Client:    managedMgr.GetClient(),
+			Reader:    managedMgr.GetAPIReader(),
+			Namespace: getAddonNamespace(),
+			Owner:     hub.name,
+			HubName:   hub.name,
+		}
+
+		// Deployments that split the policies share the outbox ConfigMap, so each only handles its own entries
+		if policySelector != nil {
+			statusReconciler.Outbox.Owner = utils.HubScopedName(tool.Options.DeploymentName, hub.name)
+		}
 	}
 
 	go func() {
@@ -748,100 +1146,168 @@ func addControllers(
 	<-statusDepWatcher.Started()
 
 	if err := statusReconciler.SetupWithManager(managedMgr, statusSyncRequestsSource, statusDepEvents); err != nil {
-		log.Error(err, "unable to create controller", "controller", "Policy")
+		log.Error(err, "unable to create controller", "controller", controllerName)
 		os.Exit(1)
 	}
+}
 
-	depReconciler, depEvents := depclient.NewControllerRuntimeSource()
-
-	watcher, err := depclient.New(managedMgr.GetConfig(), depReconciler, nil)
-	if err != nil {
-		log.Error(err, "Unable to create dependency watcher")
-		os.Exit(1)
+// leaderElectionSuffix returns the suffix of the leader election IDs, which is the deployment name when only some of
+// the policies are selected, so that each deployment has its own leader.
+func leaderElectionSuffix() string {
+	if policySelector == nil {
+		return ""
 	}
 
-	instanceName, _ := os.Hostname() // on an error, instanceName will be empty, which is ok
+	return "-" + tool.Options.DeploymentName
+}
 
-	templateReconciler := &templatesync.PolicyReconciler{
-		Client:               managedMgr.GetClient(),
-		DynamicWatcher:       watcher,
-		Scheme:               managedMgr.GetScheme(),
-		Config:               managedMgr.GetConfig(),
-		Recorder:             managedMgr.GetEventRecorder(templatesync.ControllerName),
-		ClusterNamespace:     tool.Options.ClusterNamespace,
-		Clientset:            kubernetes.NewForConfigOrDie(managedMgr.GetConfig()),
-		InstanceName:         instanceName,
-		DisableGkSync:        tool.Options.DisableGkSync,
-		ConcurrentReconciles: int(tool.Options.EvaluationConcurrency),
+// hubTarget is a hub that policies are replicated from and that their status is sent back to.
+type hubTarget struct {
+	// name is the name of an additional hub. It's empty for the primary hub from the --hub-cluster-configfile flag.
+	name       string
+	configFile string
+	cfg        *rest.Config
+	// hubNamespace is the namespace of the policies on the hub.
+	hubNamespace string
+	// targetNamespace is the namespace on the managed cluster that the hub's policies are replicated to.
+	targetNamespace string
+	// connectivity tracks the requests to the hub. It's nil when the hub connectivity check is disabled.
+	connectivity *utils.HubConnectivity
+	// mgr is the manager that watches the hub. It's nil when running on the hub.
+	mgr manager.Manager
+}
+
+// newHubConnectivity returns the connectivity tracker of the hub, or nil when the hub connectivity check is disabled.
+// This must be called before any clients are created from the hub config so that all their requests are tracked.
+func newHubConnectivity(hubCfg *rest.Config) *utils.HubConnectivity {
+	if tool.Options.HubConnectivityThreshold <= 0 {
+		return nil
 	}
 
-	go func() {
-		err := watcher.Start(ctx)
-		if err != nil {
-			panic(err)
-		}
-	}()
+	hubDiscoveryClient := discovery.NewDiscoveryClientForConfigOrDie(hubCfg)
 
-	// Wait until the dynamic watcher has started.
-	<-watcher.Started()
+	connectivity := utils.NewHubConnectivity(
+		tool.Options.HubConnectivityThreshold,
+		func(ctx context.Context) error {
+			return hubDiscoveryClient.RESTClient().Get().AbsPath("/version").Do(ctx).Error()
+		},
+	)
 
-	if err := templateReconciler.Setup(managedMgr, depEvents); err != nil {
-		log.Error(err, "Unable to create the controller", "controller", templatesync.ControllerName)
-		os.Exit(1)
-	}
+	connectivity.WrapConfig(hubCfg)
 
-	// When running on the hub, no more controllers are needed.
-	if tool.Options.OnMulticlusterhub {
-		return
+	return connectivity
+}
+
+// managedPolicyNamespaces returns the namespaces on the managed cluster that the policies from the hubs are replicated
+// to.
+func managedPolicyNamespaces() []string {
+	namespaces := []string{tool.Options.ClusterNamespace}
+
+	for _, hub := range tool.Options.AdditionalHubs {
+		namespaces = append(namespaces, hub.TargetNamespace)
 	}
 
-	var kubeClient kubernetes.Interface = kubernetes.NewForConfigOrDie(managedMgr.GetConfig())
-	eventBroadcaster := events.NewBroadcaster(&events.EventSinkImpl{Interface: kubeClient.EventsV1()})
+	return namespaces
+}
 
-	err = eventBroadcaster.StartRecordingToSinkWithContext(ctx)
+// getAddonNamespace returns the addon's namespace, which contains the template kinds, hub status outbox, and
+// maintenance windows ConfigMaps. An empty string is returned when not running in a cluster, which disables the
+// template kinds and maintenance windows ConfigMaps and keeps the hub status outbox in memory.
+func getAddonNamespace() string {
+	operatorNs, err := tool.GetOperatorNamespace()
 	if err != nil {
-		log.Error(err, "Unable to start event broadcaster to the managed cluster")
-		os.Exit(1)
+		if !errors.Is(err, tool.ErrNoNamespace) && !errors.Is(err, tool.ErrRunLocal) {
+			log.Error(err, "Failed to get the operator namespace; skipping the ConfigMaps in the addon namespace")
+		}
+
+		return ""
 	}
 
-	managedRecorder := eventBroadcaster.NewRecorder(eventsScheme, specsync.ControllerName)
+	return operatorNs
+}
 
-	if err = (&specsync.PolicyReconciler{
-		HubClient:            hubClient,
-		ManagedClient:        managedMgr.GetClient(),
-		ManagedRecorder:      managedRecorder,
-		Scheme:               hubMgr.GetScheme(),
-		TargetNamespace:      tool.Options.ClusterNamespace,
-		ConcurrentReconciles: int(tool.Options.EvaluationConcurrency),
-		StatusSyncRequests:   statusSyncRequests,
-	}).SetupWithManager(hubMgr, specSyncRequestsSource); err != nil {
-		log.Error(err, "Unable to create the controller", "controller", specsync.ControllerName)
-		os.Exit(1)
+// dynamicSyncManager describes a controller manager that only runs while a third-party policy engine is installed on
+// the managed cluster, as determined by the presence of one of the engine's CRDs.
+type dynamicSyncManager struct {
+	// engine is the human readable name of the policy engine used in log messages.
+	engine         string
+	controllerName string
+	// crdName is the name of the CRD that indicates the policy engine is installed.
+	crdName          string
+	leaderElectionID string
+	// cacheByObject is added to the manager's cache options in addition to the managed policy namespaces.
+	cacheByObject map[client.Object]cache.ByObject
+	// setup adds the controller to the manager. The dynamic watcher is started before this is called.
+	setup func(mgr manager.Manager, watcher depclient.DynamicWatcher, watcherEvents source.Source) error
+}
+
+// gatekeeperSyncManager returns the dynamicSyncManager for the gatekeeper-constraint-status-sync controller.
+func gatekeeperSyncManager() dynamicSyncManager {
+	return dynamicSyncManager{
+		engine:           "Gatekeeper",
+		controllerName:   gatekeepersync.ControllerName,
+		crdName:          "constrainttemplates." + utils.GvkConstraintTemplate.Group,
+		leaderElectionID: "governance-policy-framework-addon3.open-cluster-management.io",
+		cacheByObject: map[client.Object]cache.ByObject{
+			&admissionregistration.ValidatingWebhookConfiguration{}: {
+				Field: fields.SelectorFromSet(fields.Set{"metadata.name": gatekeepersync.GatekeeperWebhookName}),
+			},
+		},
+		setup: func(mgr manager.Manager, watcher depclient.DynamicWatcher, watcherEvents source.Source) error {
+			instanceName, _ := os.Hostname() // on an error, instanceName will be empty, which is ok
+
+			return (&gatekeepersync.GatekeeperConstraintReconciler{
+				Client: mgr.GetClient(),
+				ComplianceEventSender: utils.ComplianceEventSender{
+					ClientSet:      kubernetes.NewForConfigOrDie(mgr.GetConfig()),
+					ControllerName: gatekeepersync.ControllerName,
+					InstanceName:   instanceName,
+				},
+				ConstraintsWatcher:   watcher,
+				Scheme:               mgr.GetScheme(),
+				ConcurrentReconciles: int(tool.Options.EvaluationConcurrency),
+			}).SetupWithManager(mgr, watcherEvents)
+		},
 	}
+}
 
-	if err = (&secretsync.SecretReconciler{
-		Client:               hubClient,
-		ManagedClient:        managedMgr.GetClient(),
-		Scheme:               hubMgr.GetScheme(),
-		TargetNamespace:      tool.Options.ClusterNamespace,
-		ConcurrentReconciles: int(tool.Options.EvaluationConcurrency),
-	}).SetupWithManager(hubMgr); err != nil {
-		log.Error(err, "Unable to create the controller", "controller", secretsync.ControllerName)
-		os.Exit(1)
+// kyvernoSyncManager returns the dynamicSyncManager for the kyverno-policy-status-sync controller.
+func kyvernoSyncManager() dynamicSyncManager {
+	return dynamicSyncManager{
+		engine:           "Kyverno",
+		controllerName:   kyvernosync.ControllerName,
+		crdName:          kyvernosync.ClusterPolicyCRDName,
+		leaderElectionID: "governance-policy-framework-addon4.open-cluster-management.io",
+		setup: func(mgr manager.Manager, watcher depclient.DynamicWatcher, watcherEvents source.Source) error {
+			instanceName, _ := os.Hostname() // on an error, instanceName will be empty, which is ok
+
+			return (&kyvernosync.KyvernoPolicyReconciler{
+				Client: mgr.GetClient(),
+				ComplianceEventSender: utils.ComplianceEventSender{
+					ClientSet:      kubernetes.NewForConfigOrDie(mgr.GetConfig()),
+					ControllerName: kyvernosync.ControllerName,
+					InstanceName:   instanceName,
+				},
+				ReportsWatcher:       watcher,
+				Scheme:               mgr.GetScheme(),
+				ConcurrentReconciles: int(tool.Options.EvaluationConcurrency),
+			}).SetupWithManager(mgr, watcherEvents)
+		},
 	}
 }
 
-// manageGatekeeperSyncManager ensures the gatekeeper-constraint-status-sync controller is running based on Gatekeeper's
-// installation status. The controller will be off when Gatekeeper is not installed. This is blocking until ctx
-// is closed and continuously retries to start the manager if the manager shuts down unexpectedly.
-func manageGatekeeperSyncManager(
+// manageDynamicSyncManager ensures the controller of the input dynamicSyncManager is running based on the policy
+// engine's installation status. The controller will be off when the policy engine is not installed. This is blocking
+// until ctx is closed and continuously retries to start the manager if the manager shuts down unexpectedly.
+func manageDynamicSyncManager(
 	ctx context.Context,
 	wg *sync.WaitGroup,
 	managedCfg *rest.Config,
 	dynamicClient dynamic.Interface,
 	mgrOptions manager.Options,
+	syncMgr dynamicSyncManager,
 ) {
-	fieldSelector := "metadata.name=constrainttemplates." + utils.GvkConstraintTemplate.Group
+	fieldSelector := "metadata.name=" + syncMgr.crdName
 	timeout := int64(30)
 	crdGVR := schema.GroupVersionResource{
 		Group:    "apiextensions.k8s.io",
@@ -853,7 +1319,7 @@ func manageGatekeeperSyncManager(
 	var mgrCtxCancel context.CancelFunc
 	var watcher *watch.RetryWatcher
 	var mgrRunning bool
-	var gatekeeperInstalled bool
+	var engineInstalled bool
 
 	mgrCtx, mgrCtxCancel = context.WithCancel(ctx)
 
@@ -863,7 +1329,9 @@ func manageGatekeeperSyncManager(
 				ctx, metav1.ListOptions{FieldSelector: fieldSelector, TimeoutSeconds: &timeout},
 			)
 			if err != nil {
-				log.Error(err, "Failed to list the CRDs to check for the Gatekeeper installation. Will retry.")
+				log.Error(
+					err, fmt.Sprintf("Failed to list the CRDs to check for the %s installation. Will retry.", syncMgr.engine),
+				)
 
 				time.Sleep(time.Second)
 
@@ -882,22 +1350,24 @@ func manageGatekeeperSyncManager(
 				ctx, resourceVersion, &apiCache.ListWatch{WatchFunc: watchFunc},
 			)
 			if err != nil {
-				log.Error(err, "Failed to watch the CRDs to check for the Gatekeeper installation. Will retry.")
+				log.Error(
+					err, fmt.Sprintf("Failed to watch the CRDs to check for the %s installation. Will retry.", syncMgr.engine),
+				)
 
 				time.Sleep(time.Second)
 
 				continue
 			}
 
-			gatekeeperInstalled = len(listResult.Items) > 0
+			engineInstalled = len(listResult.Items) > 0
 		}
 
-		if gatekeeperInstalled && !mgrRunning {
+		if engineInstalled && !mgrRunning {
 			mgrRunning = true
 
 			wg.Add(1)
 
-			// Keep retrying to start the Gatekeeper sync manager until mgrCtx closes.
+			// Keep retrying to start the sync manager until mgrCtx closes.
 			go func(ctx context.Context) {
 				for {
 					select {
@@ -906,12 +1376,12 @@ func manageGatekeeperSyncManager(
 
 						return
 					default:
-						log.Info(
-							"Gatekeeper is installed. Starting the gatekeeper-constraint-status-sync controller.",
-						)
+						log.Info(fmt.Sprintf(
+							"%s is installed. Starting the %s controller.", syncMgr.engine, syncMgr.controllerName,
+						))
 
-						err := runGatekeeperSyncManager(ctx, managedCfg, mgrOptions)
-						// The error is logged in runGatekeeperSyncManager since it has more context.
+						err := runDynamicSyncManager(ctx, managedCfg, mgrOptions, syncMgr)
+						// The error is logged in runDynamicSyncManager since it has more context.
 						if err != nil {
 							time.Sleep(time.Second)
 						}
@@ -920,15 +1390,17 @@ func manageGatekeeperSyncManager(
 			}(mgrCtx)
 		}
 
-		if !gatekeeperInstalled && mgrRunning {
-			log.Info("Gatekeeper was uninstalled. Stopping the gatekeeper-constraint-status-sync controller.")
+		if !engineInstalled && mgrRunning {
+			log.Info(fmt.Sprintf(
+				"%s was uninstalled. Stopping the %s controller.", syncMgr.engine, syncMgr.controllerName,
+			))
 
 			mgrRunning = false
 
 			mgrCtxCancel()
 
 			// Reset the context for later, otherwise the context is permanently cancelled,
-			// and the manager won't start if Gatekeeper is reinstalled.
+			// and the manager won't start if the policy engine is reinstalled.
 			//nolint:fatcontext
 			mgrCtx, mgrCtxCancel = context.WithCancel(ctx)
 		}
@@ -951,22 +1423,26 @@ func manageGatekeeperSyncManager(
 			// on purpose.
 			watcher = nil
 		case result := <-watcher.ResultChan():
-			// If the CRD is added, then Gatekeeper is installed.
+			// If the CRD is added, then the policy engine is installed.
 			//nolint:exhaustive
 			switch result.Type {
 			case apiWatch.Added:
-				gatekeeperInstalled = true
+				engineInstalled = true
 			case apiWatch.Deleted:
-				gatekeeperInstalled = false
+				engineInstalled = false
 			}
 		}
 	}
 }
 
-func runGatekeeperSyncManager(ctx context.Context, managedCfg *rest.Config, mgrOptions manager.Options) error {
+func runDynamicSyncManager(
+	ctx context.Context, managedCfg *rest.Config, mgrOptions manager.Options, syncMgr dynamicSyncManager,
+) error {
+	mgrDescription := fmt.Sprintf("the %s sync manager", syncMgr.controllerName)
+
 	healthAddress, err := getFreeLocalAddr()
 	if err != nil {
-		log.Error(err, "Unable to get a health address for the Gatekeeper constraint status sync manager")
+		log.Error(err, "Unable to get a health address for "+mgrDescription)
 
 		return err
 	}
@@ -974,54 +1450,52 @@ func runGatekeeperSyncManager(ctx context.Context, managedCfg *rest.Config, mgrO
 	// Disable the metrics endpoint for this manager. Note that since they both use the global
 	// metrics registry, metrics for this manager are still exposed by the other manager.
 	mgrOptions.Metrics.BindAddress = "0"
-	mgrOptions.LeaderElectionID = "governance-policy-framework-addon3.open-cluster-management.io"
+	mgrOptions.LeaderElectionID = syncMgr.leaderElectionID
+	defaultNamespaces := map[string]cache.Config{}
+
+	// The policies from each hub are replicated to their own namespace
+	for _, namespace := range managedPolicyNamespaces() {
+		defaultNamespaces[namespace] = cache.Config{}
+	}
+
 	mgrOptions.Cache = cache.Options{
-		ByObject: map[client.Object]cache.ByObject{
-			&admissionregistration.ValidatingWebhookConfiguration{}: {
-				Field: fields.SelectorFromSet(fields.Set{"metadata.name": gatekeepersync.GatekeeperWebhookName}),
-			},
-		},
-		DefaultNamespaces: map[string]cache.Config{
-			tool.Options.ClusterNamespace: {},
-		},
+		ByObject:          syncMgr.cacheByObject,
+		DefaultNamespaces: defaultNamespaces,
 	}
 	mgrOptions.HealthProbeBindAddress = healthAddress
 
 	// When ctx is still open, then start the manager.
 	mgr, err := ctrl.NewManager(managedCfg, mgrOptions)
 	if err != nil {
-		log.Error(err, "Unable to start the Gatekeeper constraint status sync manager")
+		log.Error(err, "Unable to start "+mgrDescription)
 
 		return err
 	}
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
-		log.Error(err, "Unable to set up health check on the Gatekeeper constraint status sync manager")
+		log.Error(err, "Unable to set up health check on "+mgrDescription)
 
 		return err
 	}
 
 	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
-		log.Error(err, "Unable to set up ready check on the Gatekeeper constraint status sync manager")
+		log.Error(err, "Unable to set up ready check on "+mgrDescription)
 
 		return err
 	}
 
-	clientset := kubernetes.NewForConfigOrDie(mgr.GetConfig())
-	instanceName, _ := os.Hostname() // on an error, instanceName will be empty, which is ok
-
-	constraintsReconciler, constraintEvents := depclient.NewControllerRuntimeSource()
+	watcherReconciler, watcherEvents := depclient.NewControllerRuntimeSource()
 
-	constraintsWatcher, err := depclient.New(
+	dynamicWatcher, err := depclient.New(
 		managedCfg,
-		constraintsReconciler,
+		watcherReconciler,
 		&depclient.Options{
 			DisableInitialReconcile: true,
 			EnableCache:             true,
 		},
 	)
 	if err != nil {
-		log.Error(err, "Unable to create the constraints watcher")
+		log.Error(err, "Unable to create the dynamic watcher for "+mgrDescription)
 
 		return err
 	}
@@ -1032,28 +1506,17 @@ func runGatekeeperSyncManager(ctx context.Context, managedCfg *rest.Config, mgrO
 	defer dynamicWatchCancel()
 
 	go func() {
-		err := constraintsWatcher.Start(dynamicWatcherCtx)
+		err := dynamicWatcher.Start(dynamicWatcherCtx)
 		if err != nil {
 			panic(err)
 		}
 	}()
 
-	// Wait until the constraints watcher has started.
-	<-constraintsWatcher.Started()
+	// Wait until the dynamic watcher has started.
+	<-dynamicWatcher.Started()
 
-	if err = (&gatekeepersync.GatekeeperConstraintReconciler{
-		Client: mgr.GetClient(),
-		ComplianceEventSender: utils.ComplianceEventSender{
-			ClusterNamespace: tool.Options.ClusterNamespace,
-			ClientSet:        clientset,
-			ControllerName:   gatekeepersync.ControllerName,
-			InstanceName:     instanceName,
-		},
-		ConstraintsWatcher:   constraintsWatcher,
-		Scheme:               mgr.GetScheme(),
-		ConcurrentReconciles: int(tool.Options.EvaluationConcurrency),
-	}).SetupWithManager(mgr, constraintEvents); err != nil {
-		log.Error(err, "Unable to create controller", "controller", gatekeepersync.ControllerName)
+	if err = syncMgr.setup(mgr, dynamicWatcher, watcherEvents); err != nil {
+		log.Error(err, "Unable to create controller", "controller", syncMgr.controllerName)
 
 		// Stop the dynamic watcher since the manager will get recreated.
 		dynamicWatchCancel()
@@ -1077,7 +1540,7 @@ func runGatekeeperSyncManager(ctx context.Context, managedCfg *rest.Config, mgrO
 	healthAddressesLock.Unlock()
 
 	if err != nil {
-		log.Error(err, "Unable to start the Gatekeeper constraint status sync manager")
+		log.Error(err, "Unable to start "+mgrDescription)
 
 		// Stop the dynamic watcher since the manager will get recreated.
 		dynamicWatchCancel()
@@ -9,6 +9,8 @@ import (
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	policiesv1 "open-cluster-management.io/governance-policy-propagator/api/v1"
+
+	policyv1alpha1 "open-cluster-management.io/governance-policy-framework-addon/api/v1alpha1"
 )
 
 func init() {
@@ -16,6 +18,7 @@ func init() {
 	utilruntime.Must(v1.AddToScheme(eventsScheme))
 	//+kubebuilder:scaffold:scheme
 	utilruntime.Must(policiesv1.AddToScheme(scheme))
+	utilruntime.Must(policyv1alpha1.AddToScheme(scheme))
 	utilruntime.Must(policiesv1.AddToScheme(eventsScheme))
 	utilruntime.Must(extensionsv1.AddToScheme(scheme))
 	utilruntime.Must(gktemplatesv1.AddToScheme(scheme))
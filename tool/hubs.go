@@ -0,0 +1,85 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package tool
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// HubConfig is a hub, in addition to the one from the --hub-cluster-configfile flag, that policies are replicated from
+// and that their status is sent back to.
+type HubConfig struct {
+	// Name identifies the hub in the controller names, leader election IDs, and metrics.
+	Name string `json:"name"`
+	// Kubeconfig is the path to the kubeconfig file of the hub.
+	Kubeconfig string `json:"kubeconfig"`
+	// HubNamespace is the namespace of the policies on the hub. This defaults to the target namespace.
+	HubNamespace string `json:"hubNamespace,omitempty"`
+	// TargetNamespace is the namespace on the managed cluster that the hub's policies are replicated to. Each hub needs
+	// its own target namespace so that the status of each policy is only sent to the hub it came from.
+	TargetNamespace string `json:"targetNamespace"`
+}
+
+// LoadHubConfigs reads and validates the YAML or JSON list of additional hubs in the file. The cluster namespace is the
+// target namespace of the hub from the --hub-cluster-configfile flag, which the additional hubs can't use.
+func LoadHubConfigs(path string, clusterNamespace string) ([]HubConfig, error) {
+	rawHubs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the additional hubs config: %w", err)
+	}
+
+	hubs := []HubConfig{}
+
+	if err := yaml.UnmarshalStrict(rawHubs, &hubs); err != nil {
+		return nil, fmt.Errorf("failed to parse the additional hubs config: %w", err)
+	}
+
+	names := map[string]bool{}
+	targetNamespaces := map[string]bool{clusterNamespace: true}
+
+	for i := range hubs {
+		hub := &hubs[i]
+
+		if errs := validation.IsDNS1123Label(hub.Name); len(errs) > 0 {
+			return nil, fmt.Errorf("the additional hub name %q is invalid: %v", hub.Name, errs)
+		}
+
+		if names[hub.Name] {
+			return nil, fmt.Errorf("the additional hub name %s is used more than once", hub.Name)
+		}
+
+		names[hub.Name] = true
+
+		if hub.Kubeconfig == "" {
+			return nil, fmt.Errorf("the additional hub %s must have a kubeconfig", hub.Name)
+		}
+
+		if hub.TargetNamespace == "" {
+			return nil, fmt.Errorf("the additional hub %s must have a target namespace", hub.Name)
+		}
+
+		if targetNamespaces[hub.TargetNamespace] {
+			return nil, fmt.Errorf(
+				"the target namespace %s of the additional hub %s is already used by another hub",
+				hub.TargetNamespace, hub.Name,
+			)
+		}
+
+		targetNamespaces[hub.TargetNamespace] = true
+
+		if hub.HubNamespace == "" {
+			hub.HubNamespace = hub.TargetNamespace
+		}
+	}
+
+	if len(hubs) == 0 {
+		return nil, errors.New("the additional hubs config doesn't have any hubs")
+	}
+
+	return hubs, nil
+}
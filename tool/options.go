@@ -7,6 +7,7 @@ import (
 	"errors"
 	"flag"
 	"os"
+	"time"
 
 	"github.com/spf13/pflag"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -21,6 +22,7 @@ type SyncerOptions struct {
 	ManagedConfigFilePathName string
 	OnMulticlusterhub         bool
 	DisableGkSync             bool
+	DisableKyvernoSync        bool
 	EnableLease               bool
 	EnableLeaderElection      bool
 	ProbeAddr                 string
@@ -35,6 +37,54 @@ type SyncerOptions struct {
 	ClientBurst           uint32
 	TLSMinVersion         string
 	TLSCipherSuites       string
+	// When enabled, the template-sync controller reports the changes it would make to policy templates as events
+	// instead of applying them. This can be overridden per policy with an annotation.
+	TemplateSyncPreview bool
+	// When enabled, the template-sync controller writes policy templates with server-side apply.
+	TemplateSyncServerSideApply bool
+	// The host and port of the OTLP gRPC receiver that traces are exported to. Tracing is disabled when it's empty.
+	TracingEndpoint    string
+	TracingInsecure    bool
+	TracingSampleRatio float64
+	// How long without a successful request to the hub before the addon reports that it's not ready. This is
+	// disabled when it's 0.
+	HubConnectivityThreshold time.Duration
+	// How long the status-sync batches policy statuses for before sending them to the hub as JSON patches. Statuses
+	// are sent right away with full updates when this is 0.
+	HubStatusBatchWindow time.Duration
+	// The max policy status writes per second to the hub, separate from ClientQPS. This is unlimited when 0.
+	HubStatusQPS   float32
+	HubStatusBurst uint32
+	// How the status-sync builds the compliance history of each template. These can be overridden per policy with
+	// annotations.
+	ComplianceHistoryLength          int
+	ComplianceHistoryDedupeWindow    time.Duration
+	ComplianceHistoryCollapseRepeats bool
+	// Where the status-sync archives every compliance event, either a file such as on a persistent volume or an HTTP
+	// endpoint. Events aren't archived when both are empty.
+	ComplianceArchiveFile          string
+	ComplianceArchiveFileMaxSizeMB int
+	ComplianceArchiveFileBackups   int
+	ComplianceArchiveURL           string
+	// Select the subset of the policies that this deployment syncs, so that a large number of policies can be split
+	// across several deployments. All policies are selected by default.
+	PolicyLabelSelector      string
+	PolicyAnnotationSelector string
+	ShardCount               uint
+	ShardIndex               uint
+	// The file with the hubs that policies are replicated from in addition to the one from HubConfigFilePathName.
+	AdditionalHubsConfigFile string
+	// The hubs parsed from AdditionalHubsConfigFile.
+	AdditionalHubs []HubConfig
+	// When enabled, a validating webhook rejects local changes to the replicated policies and their generated
+	// templates. The serving certificate is read from the cert directory and uses the same TLS profile as the metrics.
+	EnableProtectionWebhook        bool
+	ProtectionWebhookPort          int
+	ProtectionWebhookCertDir       string
+	ProtectionWebhookAllowedGroups string
+	// When enabled, the PolicyOverride resources on the managed cluster are applied on top of the replicated policies
+	// and reported in their status. The PolicyOverride CRD must be installed.
+	EnablePolicyOverrides bool
 }
 
 var disableSpecSync bool
@@ -103,6 +153,13 @@ func ProcessFlags() {
 		"If enabled, Gatekeeper object syncing will be entirely disabled.",
 	)
 
+	flag.BoolVar(
+		&Options.DisableKyvernoSync,
+		"disable-kyverno-sync",
+		false,
+		"If enabled, the Kyverno policy report status relay will be entirely disabled.",
+	)
+
 	flag.BoolVar(
 		&Options.EnableLeaderElection,
 		"leader-elect",
@@ -171,6 +228,208 @@ func ProcessFlags() {
 		"A comma-separated list of IANA cipher suite names to use on the metrics server. "+
 			"Overrides the ocm-tls-profile ConfigMap when set.",
 	)
+
+	flag.BoolVar(
+		&Options.TemplateSyncPreview,
+		"template-sync-preview",
+		false,
+		"If enabled, the template-sync controller will not create, update, or delete policy templates and will "+
+			"instead report the changes it would make as events on the policy. The "+
+			"'policy.open-cluster-management.io/template-sync-preview' annotation on a policy overrides this.",
+	)
+
+	flag.BoolVar(
+		&Options.TemplateSyncServerSideApply,
+		"template-sync-server-side-apply",
+		false,
+		"If enabled, the template-sync controller will write policy templates with server-side apply using the "+
+			"'policy-template-sync' field manager, so that fields set by other controllers are not overwritten.",
+	)
+
+	flag.StringVar(
+		&Options.TracingEndpoint,
+		"tracing-endpoint",
+		"",
+		"The host and port of an OTLP gRPC receiver to export traces of the spec-sync, template-sync, and "+
+			"status-sync controllers to. Tracing is disabled when this is not set.",
+	)
+
+	flag.BoolVar(
+		&Options.TracingInsecure,
+		"tracing-insecure",
+		false,
+		"If enabled, TLS is not used when connecting to the tracing endpoint.",
+	)
+
+	flag.Float64Var(
+		&Options.TracingSampleRatio,
+		"tracing-sample-ratio",
+		1,
+		"The fraction of new traces that are sampled, between 0 and 1. Traces continued from the trace context "+
+			"annotations on policies and events follow the sampling decision of the parent.",
+	)
+
+	flag.DurationVar(
+		&Options.HubConnectivityThreshold,
+		"hub-connectivity-threshold",
+		0,
+		"How long without a successful request to the hub before the readiness check fails and the addon's lease "+
+			"is annotated as disconnected from the hub, such as 5m. The check is disabled when this is 0, which is "+
+			"the default.",
+	)
+
+	flag.DurationVar(
+		&Options.HubStatusBatchWindow,
+		"hub-status-batch-window",
+		0,
+		"How long the status-sync controller batches policy status changes for before sending them to the hub. "+
+			"Each policy is sent once per window as a JSON patch of the changed compliance history. "+
+			"When 0, each status change is sent right away with a full update.",
+	)
+
+	flag.Float32Var(
+		&Options.HubStatusQPS,
+		"hub-status-max-qps",
+		0,
+		"The max policy status writes per second to the hub, separate from --client-max-qps. "+
+			"When 0, the status writes are only limited by the hub client.",
+	)
+
+	flag.Uint32Var(
+		&Options.HubStatusBurst,
+		"hub-status-burst",
+		10,
+		"The maximum burst of policy status writes to the hub before they're limited by --hub-status-max-qps.",
+	)
+
+	flag.IntVar(
+		&Options.ComplianceHistoryLength,
+		"compliance-history-length",
+		10,
+		"The number of entries kept in the compliance history of each policy template, up to 100.",
+	)
+
+	flag.DurationVar(
+		&Options.ComplianceHistoryDedupeWindow,
+		"compliance-history-dedupe-window",
+		5*time.Microsecond,
+		"How close in time two compliance events with the same message must be for the older one to be dropped as a "+
+			"duplicate. Set to 0 to not drop any events.",
+	)
+
+	flag.BoolVar(
+		&Options.ComplianceHistoryCollapseRepeats,
+		"compliance-history-collapse-repeats",
+		false,
+		"Collapse consecutive compliance events with the same message into one compliance history entry with a "+
+			"repeat count.",
+	)
+
+	flag.StringVar(
+		&Options.ComplianceArchiveFile,
+		"compliance-archive-file",
+		"",
+		"The path of a file, such as on a persistent volume, to append every compliance event to as JSON lines for an "+
+			"audit trail. This can't be used with --compliance-archive-url.",
+	)
+
+	flag.IntVar(
+		&Options.ComplianceArchiveFileMaxSizeMB,
+		"compliance-archive-file-max-size",
+		100,
+		"The size in megabytes at which the compliance archive file is rotated. Set to 0 to not rotate it.",
+	)
+
+	flag.IntVar(
+		&Options.ComplianceArchiveFileBackups,
+		"compliance-archive-file-max-backups",
+		5,
+		"The number of rotated compliance archive files to keep.",
+	)
+
+	flag.StringVar(
+		&Options.ComplianceArchiveURL,
+		"compliance-archive-url",
+		"",
+		"The URL to POST every compliance event to as JSON lines for an audit trail. The events are sent again until "+
+			"the endpoint responds with a 2xx status, so it should deduplicate them by the eventName field.",
+	)
+
+	flag.StringVar(
+		&Options.PolicyLabelSelector,
+		"policy-label-selector",
+		"",
+		"A label selector, such as 'team=payments', for the policies that this deployment syncs.",
+	)
+
+	flag.StringVar(
+		&Options.PolicyAnnotationSelector,
+		"policy-annotation-selector",
+		"",
+		"A selector with the same syntax as a label selector for the annotations of the policies that this deployment "+
+			"syncs.",
+	)
+
+	flag.UintVar(
+		&Options.ShardCount,
+		"shard-count",
+		0,
+		"The number of deployments that split the policies by a consistent hash of their name. Policies aren't "+
+			"sharded when this is 0 or 1.",
+	)
+
+	flag.UintVar(
+		&Options.ShardIndex,
+		"shard-index",
+		0,
+		"The shard of the policies that this deployment syncs, from 0 to --shard-count minus 1.",
+	)
+
+	flag.StringVar(
+		&Options.AdditionalHubsConfigFile,
+		"additional-hubs-config",
+		"",
+		"A YAML file with a list of additional hubs to replicate policies from, each with a name, a kubeconfig, a "+
+			"hubNamespace, and a targetNamespace on the managed cluster.",
+	)
+
+	flag.BoolVar(
+		&Options.EnableProtectionWebhook,
+		"enable-protection-webhook",
+		false,
+		"Serve a validating webhook that rejects local changes to the replicated policies and their generated "+
+			"templates. A ValidatingWebhookConfiguration must also be created for it.",
+	)
+
+	flag.IntVar(
+		&Options.ProtectionWebhookPort,
+		"protection-webhook-port",
+		9443,
+		"The port that the protection webhook is served on.",
+	)
+
+	flag.StringVar(
+		&Options.ProtectionWebhookCertDir,
+		"protection-webhook-cert-dir",
+		"/var/run/webhook-cert",
+		"The directory with the tls.crt and tls.key files of the protection webhook's serving certificate.",
+	)
+
+	flag.StringVar(
+		&Options.ProtectionWebhookAllowedGroups,
+		"protection-webhook-allowed-groups",
+		"system:serviceaccounts:kube-system",
+		"A comma-separated list of groups whose members can change the replicated policies and their generated "+
+			"templates in addition to the addon. The default allows the garbage collector and namespace controller.",
+	)
+
+	flag.BoolVar(
+		&Options.EnablePolicyOverrides,
+		"enable-policy-overrides",
+		false,
+		"Apply the PolicyOverride resources on the managed cluster, which have the same name and namespace as a "+
+			"replicated policy, on top of the policy from the hub. The PolicyOverride CRD must be installed.",
+	)
 }
 
 func ProcessAndParse(flagset *flag.FlagSet) error {
@@ -220,6 +479,31 @@ func ProcessAndParse(flagset *flag.FlagSet) error {
 		Options.ClusterNamespaceOnHub = Options.ClusterNamespace
 	}
 
+	if Options.AdditionalHubsConfigFile != "" {
+		if Options.OnMulticlusterhub {
+			return errors.New("the --additional-hubs-config flag can't be used on the hub")
+		}
+
+		var err error
+
+		Options.AdditionalHubs, err = LoadHubConfigs(Options.AdditionalHubsConfigFile, Options.ClusterNamespace)
+		if err != nil {
+			return err
+		}
+	}
+
+	if Options.EnableProtectionWebhook && Options.OnMulticlusterhub {
+		return errors.New("the --enable-protection-webhook flag can't be used on the hub")
+	}
+
+	if Options.EnablePolicyOverrides && Options.OnMulticlusterhub {
+		return errors.New("the --enable-policy-overrides flag can't be used on the hub")
+	}
+
+	if Options.ComplianceArchiveFile != "" && Options.ComplianceArchiveURL != "" {
+		return errors.New("only one of the --compliance-archive-file and --compliance-archive-url flags can be provided")
+	}
+
 	var found bool
 
 	// Get hubconfig to talk to hub apiserver